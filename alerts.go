@@ -0,0 +1,82 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+// alert holds one registered attribute alert.
+type alert struct {
+	deviceID string
+	attr     string
+	pred     func(float64) bool
+	fn       func(*Device, float64)
+	// active is true while the attribute is in the alerting state.
+	active bool
+}
+
+// AddAlert registers an alert on an attribute of a device. Each time the
+// device is refreshed, pred is evaluated against the attribute value and fn
+// is called when the attribute enters the alerting state (pred goes from
+// false to true). Fn is not called again until the attribute leaves and
+// re-enters the alerting state. The returned handle removes the alert.
+func (st *SmartThings) AddAlert(deviceID, attr string, pred func(float64) bool, fn func(*Device, float64)) *Handle {
+	if st.smartThings == nil {
+		return newHandle(func() {})
+	}
+	a := &alert{
+		deviceID: deviceID,
+		attr:     attr,
+		pred:     pred,
+		fn:       fn,
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.alerts = append(st.alerts, a)
+	return newHandle(func() { st.removeAlert(a) })
+}
+
+// removeAlert unregisters a.
+func (st *SmartThings) removeAlert(a *alert) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for i, x := range st.alerts {
+		if x == a {
+			st.alerts = append(st.alerts[:i], st.alerts[i+1:]...)
+			return
+		}
+	}
+}
+
+// evalAlerts evaluates all alerts registered for the device, calling the
+// callbacks of those that became active.
+func (st *SmartThings) evalAlerts(d *Device) {
+	type firing struct {
+		fn    func(*Device, float64)
+		value float64
+	}
+	var fire []firing
+
+	st.mu.Lock()
+	for _, a := range st.alerts {
+		if a.deviceID != d.ID {
+			continue
+		}
+		v, ok := d.reading(a.attr)
+		if !ok {
+			continue
+		}
+		on := a.pred(v)
+		if on && !a.active {
+			fire = append(fire, firing{a.fn, v})
+		}
+		a.active = on
+	}
+	st.mu.Unlock()
+
+	// Run callbacks without holding the lock.
+	for _, f := range fire {
+		f.fn(d, f.value)
+	}
+}
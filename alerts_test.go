@@ -0,0 +1,108 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/smoogle/gosmart"
+)
+
+func TestAddAlert(t *testing.T) {
+	s := newServer(t, thermostat("1"), thermostat("2"))
+	st := connect(t, s, gosmart.Config{})
+
+	var fired []float64
+	h := st.AddAlert("1", "temperature", func(v float64) bool { return v > 25 }, func(d *gosmart.Device, v float64) {
+		if d.ID != "1" {
+			t.Errorf("alert fired for device %s", d.ID)
+		}
+		fired = append(fired, v)
+	})
+
+	// Temperatures seen by the successive refreshes of both thermostats.
+	for _, temp := range []float64{20, 26, 27, 24, 30, 30} {
+		for _, id := range []string{"1", "2"} {
+			th := thermostat(id)
+			th.Attributes["temperature"] = temp
+			s.AddDevice(th)
+		}
+		if err := st.Refresh(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []float64{26, 30}; !reflect.DeepEqual(fired, want) {
+		t.Errorf("alert fired with %v, want %v (only when crossing the threshold)", fired, want)
+	}
+
+	// A cancelled alert no longer fires.
+	h.Cancel()
+	for _, temp := range []float64{20, 40} {
+		th := thermostat("1")
+		th.Attributes["temperature"] = temp
+		s.AddDevice(th)
+		if err := st.Refresh(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(fired) != 2 {
+		t.Errorf("cancelled alert fired: %v", fired)
+	}
+}
+
+func TestCancelAlert(t *testing.T) {
+	s := newServer(t, thermostat("1"))
+	st := connect(t, s, gosmart.Config{})
+
+	var hot, cold int
+	h := st.AddAlert("1", "temperature", func(v float64) bool { return v > 25 }, func(*gosmart.Device, float64) { hot++ })
+	st.AddAlert("1", "temperature", func(v float64) bool { return v < 15 }, func(*gosmart.Device, float64) { cold++ })
+
+	set := func(temp float64) {
+		s.SetAttribute("1", "temperature", temp)
+		if err := st.Refresh(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	set(30)
+	set(10)
+	h.Cancel()
+	h.Cancel()
+	set(30)
+	set(10)
+	if hot != 1 || cold != 2 {
+		t.Errorf("alerts fired %d (cancelled) and %d times, want 1 and 2", hot, cold)
+	}
+}
+
+func TestCancelWatcher(t *testing.T) {
+	dev := thermostat("1")
+	dev.Attributes["presence"] = "present"
+	s := newServer(t, dev)
+	st := connect(t, s, gosmart.Config{})
+
+	kept, _ := st.WatchPresence()
+	cancelled, h := st.WatchPresence()
+	h.Cancel()
+	if _, open := <-cancelled; open {
+		t.Error("cancelled watcher channel still open")
+	}
+
+	s.SetAttribute("1", "presence", "not present")
+	if err := st.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case c := <-kept:
+		if c.DeviceID != "1" {
+			t.Errorf("got change for device %s", c.DeviceID)
+		}
+	default:
+		t.Error("remaining watcher got no change")
+	}
+}
@@ -7,100 +7,900 @@
 package gosmart
 
 import (
+	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	"io"
 	"io/ioutil"
-	"log"
+	"math"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 const (
 	tokenFilePrefix = ".smartthings.token"
+
+	// Default number of endpoint discovery retries.
+	discoveryRetries = 3
+
+	// Default maximum number of devices loaded concurrently by Refresh.
+	refreshWorkers = 8
+
+	// Maximum number of pages read from a paginated device list.
+	maxDevicePages = 100
 )
 
 // Global configuration for smart things.
 type Config struct {
 	ClientID, Secret string
+
+	// TokenStore keeps the OAuth token. Refreshed tokens are saved back to
+	// it automatically. If nil, the token is kept in a file under the user's
+	// home directory, named after TokenPrefix and the client ID.
+	TokenStore TokenStore
+
+	// TokenPrefix is the prefix of the token file names used when no
+	// TokenStore is set, so different applications (or environments) using
+	// the same client ID keep separate tokens. Blank means
+	// ".smartthings.token".
+	TokenPrefix string
+
+	// MaxRetries is the number of times a request failing with a network
+	// error or a transient HTTP status (429, 502, 503, 504) is retried.
+	// Zero disables retries. Only commands listed in IdempotentCommands are
+	// retried; other commands are sent once.
+	MaxRetries int
+
+	// RetryBaseDelay is the delay before the first retry, doubled on every
+	// further attempt. Zero means 500ms. A Retry-After header sent by the
+	// server takes precedence.
+	RetryBaseDelay time.Duration
+
+	// RetryMaxDelay caps the delay between retries, including delays asked
+	// for with Retry-After. Zero means no cap.
+	RetryMaxDelay time.Duration
+
+	// RetryBudget caps the total number of retries across a whole high-level
+	// operation (Refresh, RefreshDevice, RefreshChangedSince, ApplyState,
+	// BatchCall and each auto-refresh round), no matter how many devices it
+	// touches. Every operation gets its own budget. Once exhausted, failing
+	// requests are returned immediately. Zero means no cap. Single calls
+	// (e.g. Device.Call) are only limited by MaxRetries.
+	RetryBudget int
+
+	// DiscoveryRetries is the number of times endpoint discovery is retried
+	// by Connect on a network error or a transient HTTP status, with the
+	// backoff set by RetryBaseDelay and RetryMaxDelay. Zero means 3, and a
+	// negative value disables retries. Retries stop when the context passed
+	// to Connect is done.
+	DiscoveryRetries int
+
+	// RequestTimeout limits each individual request (each attempt, when
+	// retried), within the deadline of the caller's context, so a hung
+	// connection fails fast instead of stalling a whole Refresh. Zero means
+	// no per-request limit.
+	RequestTimeout time.Duration
+
+	// MaxResponseBytes is the maximum size of a response body. Larger
+	// responses, or compressed responses decoding to larger ones, fail with
+	// ErrResponseTooLarge. Zero or less means 32MB.
+	MaxResponseBytes int64
+
+	// CacheTTL, if positive, caches the details (attributes included) of
+	// each device read from the API for this long, so refreshes within the
+	// TTL are served from memory. Sending a command to a device discards
+	// its cached details; see also SmartThings.Invalidate. Zero disables the
+	// cache.
+	CacheTTL time.Duration
+
+	// CommandCacheTTL, if positive, keeps the command list of each device
+	// for this long, so Refresh only re-reads it when stale. Attributes are
+	// still read on every refresh. See Device.RefreshCommands. Zero means
+	// command lists are read on every Refresh.
+	CommandCacheTTL time.Duration
+
+	// UnitSystem, if set, is the unit system (UnitsMetric or
+	// UnitsImperial) of the temperatures returned and accepted by the
+	// convenience accessors (Device.Temperature and the Thermostat and
+	// Sensor interfaces), converting from the unit the device reports. When
+	// blank, values are in the native unit of the device.
+	UnitSystem UnitSystem
+
+	// CommandCooldown is the minimum interval between a successful command
+	// and the next one sent to the same device. Commands issued sooner fail
+	// with *ErrThrottled; failed commands can be retried at once. Zero
+	// disables the cooldown.
+	CommandCooldown time.Duration
+
+	// CommandDedupWindow suppresses a command identical (same device,
+	// command and arguments) to the last successful one issued to a device
+	// less than this long ago. The suppressed call returns success without
+	// sending a request. Zero disables deduplication.
+	CommandDedupWindow time.Duration
+
+	// IdempotentCommands lists the commands that are safe to retry on
+	// transient failures (see MaxRetries). Other commands are sent only once,
+	// since a retry could actuate the device twice. Every command carries an
+	// Idempotency-Key header so servers supporting it can discard duplicates.
+	// If nil, DefaultIdempotentCommands is used.
+	IdempotentCommands []string
+
+	// AllowedCommands, if not nil, lists the only commands that may be sent
+	// to devices. Other commands fail with ErrCommandNotAllowed. It can be
+	// changed at runtime with SmartThings.SetAllowedCommands.
+	AllowedCommands []string
+
+	// BeforeCommand, if set, is called right before a command is sent to a
+	// device (after checking the device supports it). A non-nil error aborts
+	// the command and is returned by the call. Arguments that are not
+	// numbers (sent with CallString or CallWithArgs) are passed as NaN, and
+	// named arguments (CallNamed) are not passed.
+	BeforeCommand func(deviceID, cmd string, args []float64) error
+
+	// OnRequest, if set, is called after every request to the SmartThings
+	// API completes, with the request path relative to the endpoint, the
+	// total time taken (every attempt and the delays between retries, up to
+	// the response body being read), the final HTTP status (zero on network
+	// errors) and the network error, if any. It must not block.
+	OnRequest func(path string, duration time.Duration, status int, err error)
+
+	// AttributeIntervals sets how often the auto-refresh loop re-reads each
+	// attribute (by name), reducing load for slowly changing attributes such
+	// as temperature. Attributes not listed are read every auto-refresh
+	// interval, so a device is read as often as its most frequently read
+	// attribute requires. See StartAutoRefresh.
+	AttributeIntervals map[string]time.Duration
+
+	// DevicePriority sets the polling priority of devices in the
+	// auto-refresh loop, keyed by device ID or capability name (e.g.
+	// "Contact Sensor"). Each priority step above zero polls the device
+	// twice as often as the auto-refresh interval, and each step below zero
+	// half as often. A device ID entry takes precedence over capabilities;
+	// among capabilities the highest priority wins. See StartAutoRefresh.
+	DevicePriority map[string]int
+
+	// RateLimitWarning logs a warning (to Logger) whenever the server
+	// reports fewer remaining requests than this in the current rate limit
+	// window. Zero disables the warning. See SmartThings.RateLimitStatus.
+	RateLimitWarning int
+
+	// RefreshWorkers is the maximum number of devices loaded concurrently
+	// by Refresh. Zero or less means 8.
+	RefreshWorkers int
+
+	// ActivityFeedSize is the number of attribute changes kept for
+	// SmartThings.ActivityFeed. Zero or less means 100.
+	ActivityFeedSize int
+
+	// Endpoint, if set, is the base URI of the SmartApp endpoints, skipping
+	// endpoint discovery for ClientID/Secret. Use it to point the library at
+	// a mock server or a staging environment. The installed app and location
+	// IDs are not known in this case.
+	Endpoint string
+
+	// UserAgent is the User-Agent header sent with every request. Blank
+	// means "gosmart/" followed by Version.
+	UserAgent string
+
+	// DisableBulkStatus makes Refresh read the attributes of each device
+	// with its own request. By default, Refresh first tries to read all of
+	// them at once (see GetDevicesWithStatus), and only falls back to
+	// per-device requests if the endpoint does not support it.
+	DisableBulkStatus bool
+
+	// Headers lists extra headers sent with every request (e.g. trace or
+	// correlation IDs). They take precedence over UserAgent.
+	Headers map[string]string
+
+	// TruthyValues maps string attribute values to the numbers returned by
+	// Attribute and Attributes, overriding or extending DefaultTruthyValues
+	// (e.g. {"jammed": 1}). Keys are matched case-insensitively.
+	TruthyValues map[string]float64
+
+	// HTTPClient, if set, is the client used for all requests. The OAuth
+	// transport wraps its Transport, and its Timeout, Jar and CheckRedirect
+	// settings apply to every request. Use it to set proxies, timeouts or
+	// instrumentation.
+	HTTPClient *http.Client
+
+	// Logger, if set, receives the library's diagnostic messages (such as
+	// skipped attributes or low rate limit warnings). A *log.Logger may be
+	// used. If nil, messages are discarded.
+	Logger Logger
+
+	// Scopes lists the OAuth scopes requested for new tokens. If empty,
+	// DefaultScopes is used. Tokens already kept in the TokenStore keep the
+	// scopes they were granted; delete them to request new ones.
+	Scopes []string
+
+	// SkipDeviceErrors makes Refresh load all the devices it can instead of
+	// stopping at the first device failing to load. Devices that fail keep
+	// their previous state (new devices are left out) and Refresh returns a
+	// *RefreshError listing them.
+	SkipDeviceErrors bool
+
+	// APIVersion selects the API used for the device list, the device
+	// status and commands: APILegacy (the default) for the SmartApp
+	// endpoints, or APIV1 for the SmartThings v1 REST API, usually with a
+	// personal access token (AccessToken). In v1 mode the endpoint is not
+	// discovered (Endpoint defaults to https://api.smartthings.com/v1), and
+	// only the main component of each device is used. Other features
+	// (rooms, scenes, modes, events and the like) need the legacy API.
+	APIVersion APIVersion
+
+	// ReadOnly blocks every request changing state: device commands
+	// (Device.Call and the like, Group.Call), scenes, location modes,
+	// preferences and custom data return ErrReadOnly without sending
+	// anything. Reading devices and subscribing to events still work.
+	ReadOnly bool
+
+	// CallbackURL is the URL event notifications are posted to by the
+	// SmartApp (see SubscribeDevice and EventHandler).
+	CallbackURL string
+
+	// CallbackSecret is the secret shared with the SmartApp to sign the
+	// event notifications posted to CallbackURL (see SignatureHeader).
+	// Notifications without a valid signature are rejected, so it must be
+	// set to subscribe to and receive events.
+	CallbackSecret string
+
+	// RedirectURL is the OAuth redirect URI registered for the SmartApp,
+	// where a local HTTP server listens during the interactive
+	// authentication (see NewAuthRedirect). Set it when the default port is
+	// taken. Blank means http://localhost:4567/OAuthCallback.
+	RedirectURL string
+
+	// AccessToken, if set, is a personal access token used instead of the
+	// OAuth flow for the primary credential. ClientID, Secret and
+	// TokenStore are ignored in this case. See ConnectWithToken.
+	AccessToken string
+
+	// Credentials lists additional OAuth credentials (other SmartApps
+	// installed in the same location). When set, requests are spread across
+	// ClientID/Secret and these credentials using weighted round-robin,
+	// multiplying the effective API quota. Each credential keeps its own
+	// token file.
+	Credentials []Credential
 }
 
-// Represents all smart things.
+// Represents all smart things. A SmartThings is a handle to a connection:
+// copies of it (such as the value returned by Connect) share the same
+// configuration, client and devices.
 type SmartThings struct {
-	client *http.Client
-	endpoint string
-	Devices []Device
+	*smartThings
+}
+
+// smartThings holds the state of a connection, shared by all the copies of
+// the SmartThings handle.
+type smartThings struct {
+	cfgMu      sync.RWMutex
+	cfg        Config
+	client     *http.Client
+	endpoint   string
+	appID      string
+	locationID string
+	rotate     *rotateTransport
+	rateLimit  *rateLimitTransport
+	retry      *retryTransport
+	latency    reservoir
+	feed       changeRing
+	cache      infoCache
+	flights    flightGroup
+
+	// devices holds the devices loaded by the last Refresh (see
+	// DeviceList), and scenes the scenes read by Connect or RefreshScenes
+	// (see SceneList). Both are replaced, not modified, under devMu.
+	devices []*Device
+	scenes  []Scene
+	devMu   sync.RWMutex
+
+	// mu protects the fields below.
+	mu        sync.Mutex
+	delta     DeviceDelta
+	unhealthy bool
+	alerts    []*alert
+
+	// refreshedAt is the start time of the last successful refresh.
+	refreshedAt time.Time
+
+	// noBulkStatus is set once the endpoint is known not to support
+	// GetDevicesWithStatus.
+	noBulkStatus bool
+
+	// Connectivity watch state (see connectivity.go).
+	connState    map[string]bool
+	connWatchers []*connWatcher
+
+	// Presence watch state (see presence.go).
+	presenceState    map[string]bool
+	presenceWatchers []*presenceWatcher
+
+	// Pushed event state (see push.go). Push is set once an event handler
+	// was created.
+	pushMu      sync.Mutex
+	push        bool
+	pushWaiters []*pushWaiter
+
+	// Health check state (see health.go).
+	hcMu   sync.Mutex
+	hcStop chan struct{}
+
+	// Capability definitions read in v1 mode, keyed by "id/version" (see
+	// v1.go).
+	v1Mu   sync.Mutex
+	v1Caps map[string][]DeviceCommand
+
+	// Auto-refresh state (see autorefresh.go).
+	arMu     sync.Mutex
+	arStop   chan struct{}
+	arDone   chan struct{}
+	arPaused bool
 }
 
+// Connect authenticates with SmartThings using cfg (with OAuth, or with
+// Config.AccessToken if set), discovers the endpoint
+// URI (unless Config.Endpoint is set) and performs an initial Refresh of all
+// devices and scenes.
 func Connect(ctx context.Context, cfg Config) (SmartThings, error) {
-	st := SmartThings{}
-	tokenFile := fmt.Sprintf("%s_%s.json", tokenFilePrefix, cfg.ClientID)
-	config := NewOAuthConfig(cfg.ClientID, cfg.Secret)
-	token, err := GetToken(tokenFile, config)
-	if err != nil {
-		return st, err
+	st, err := connect(ctx, cfg)
+	return *st, err
+}
+
+// connect implements Connect.
+func connect(ctx context.Context, cfg Config) (*SmartThings, error) {
+	st := &SmartThings{&smartThings{cfg: cfg}}
+	ctx = st.oauthContext(ctx)
+
+	// Authenticate every credential and discover its endpoint.
+	creds := append([]Credential{{ClientID: cfg.ClientID, Secret: cfg.Secret, TokenStore: cfg.TokenStore}}, cfg.Credentials...)
+	st.rotate = &rotateTransport{}
+	var ep EndPoints
+	for i, cred := range creds {
+		var (
+			m   *member
+			err error
+		)
+		if i == 0 && cfg.AccessToken != "" {
+			m = tokenMember(ctx, cfg.AccessToken)
+		} else {
+			m, err = newMember(ctx, cred, cfg)
+		}
+		if err != nil {
+			return st, err
+		}
+		var e EndPoints
+		switch {
+		case (i == 0 || cfg.APIVersion == APIV1) && cfg.Endpoint != "":
+			e = EndPoints{URI: strings.TrimSuffix(cfg.Endpoint, "/")}
+		case cfg.APIVersion == APIV1:
+			e = EndPoints{URI: v1Endpoint}
+		default:
+			if e, err = GetEndPoints(ctx, st.httpClient(&headerTransport{base: discoveryTransport(m.base, cfg), st: st})); err != nil {
+				return st, err
+			}
+		}
+		m.endpoint = e.URI
+		if i == 0 {
+			ep = e
+			st.rotate.primary = e.URI
+		}
+		st.rotate.members = append(st.rotate.members, m)
 	}
-	st.client = config.Client(ctx, token)
-	st.endpoint, err = GetEndPointsURI(st.client)
-	if err != nil {
+	st.rateLimit = &rateLimitTransport{base: st.rotate, warn: cfg.RateLimitWarning, logf: st.logf}
+	st.retry = &retryTransport{
+		base:   st.rateLimit,
+		policy: policyFromConfig(cfg),
+	}
+	st.client = st.httpClient(&hookTransport{base: &headerTransport{base: st.retry, st: st}, st: st})
+	st.endpoint = ep.URI
+	st.appID = ep.InstalledAppID()
+	st.locationID = ep.Location.ID
+	err := st.RefreshContext(ctx)
+	var re *RefreshError
+	if err != nil && !errors.As(err, &re) {
 		return st, err
 	}
-	return st, st.Refresh()
+	// Not all SmartApps expose scenes, so a failure here is not fatal.
+	if !st.v1() {
+		if serr := st.RefreshScenesContext(ctx); serr != nil {
+			st.logf("cannot read scenes: %v", serr)
+		}
+	}
+	return st, err
+}
+
+// ConnectWithToken connects using a personal access token instead of the
+// OAuth flow. If endpoint is blank, it is discovered as in Connect.
+func ConnectWithToken(ctx context.Context, endpoint, token string) (SmartThings, error) {
+	return Connect(ctx, Config{Endpoint: endpoint, AccessToken: token})
+}
+
+// discoveryTransport wraps base to retry endpoint discovery on transient
+// failures, as set by Config.DiscoveryRetries.
+func discoveryTransport(base http.RoundTripper, cfg Config) http.RoundTripper {
+	policy := policyFromConfig(cfg)
+	policy.maxRetries = cfg.DiscoveryRetries
+	if policy.maxRetries == 0 {
+		policy.maxRetries = discoveryRetries
+	}
+	return &retryTransport{base: base, policy: policy}
 }
 
-// Refresh all the devices that are available.
+// NewSmartThings returns a SmartThings using an already authenticated client
+// and endpoint URI, skipping the OAuth flow and endpoint discovery done by
+// Connect. This is useful with custom transports and mock servers. A nil
+// client means http.DefaultClient. Devices are not loaded until Refresh is
+// called.
+func NewSmartThings(client *http.Client, endpoint string, cfg Config) *SmartThings {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	st := &SmartThings{&smartThings{
+		cfg:      cfg,
+		endpoint: endpoint,
+	}}
+	st.rateLimit = &rateLimitTransport{base: base, warn: cfg.RateLimitWarning, logf: st.logf}
+	st.retry = &retryTransport{
+		base:   st.rateLimit,
+		policy: policyFromConfig(cfg),
+	}
+	c := *client
+	c.Transport = &hookTransport{base: &headerTransport{base: st.retry, st: st}, st: st}
+	st.client = &c
+	return st
+}
+
+// Refresh all the devices that are available. Devices already known from a
+// previous refresh keep their identity (the same *Device), so pointers held
+// by callers remain valid. Use DeviceDelta to find out which devices were
+// added or removed.
 func (st *SmartThings) Refresh() error {
-	all, err := GetDevices(st.client, st.endpoint)
+	return st.RefreshContext(context.Background())
+}
+
+// RefreshContext works like Refresh, aborting the in-flight requests when ctx
+// is cancelled.
+func (st *SmartThings) RefreshContext(ctx context.Context) error {
+	if err := st.connected(); err != nil {
+		return err
+	}
+	ctx = st.withRetryBudget(ctx)
+	start := time.Now()
+	all, details, err := st.listDevicesWithStatus(ctx)
 	if err != nil {
 		return err
 	}
-	st.Devices = nil
+
+	// Index the current devices by ID so we can reuse them, and remember
+	// their rooms.
+	known := make(map[string]*Device)
+	rooms := make(map[string]string)
+	for _, d := range st.DeviceList() {
+		known[d.ID] = d
+		rooms[d.ID] = d.RoomID()
+	}
+
+	var (
+		devices []*Device
+		delta   DeviceDelta
+	)
 	for _, rd := range all {
-		nd := Device{
-			st: st,
-			ID: rd.ID,
-			attributes: make(map[string]float64),
+		nd, ok := known[rd.ID]
+		if !ok {
+			nd = &Device{
+				st:         st,
+				ID:         rd.ID,
+				attributes: make(map[string]float64),
+			}
+			delta.Added = append(delta.Added, rd.ID)
 		}
-		detail, err := GetDeviceInfo(st.client, st.endpoint, rd.ID)
-		if err != nil {
+		delete(known, rd.ID)
+		devices = append(devices, nd)
+	}
+
+	// Load the devices concurrently. Devices keep the order of the listing.
+	workers := st.config().RefreshWorkers
+	if workers <= 0 {
+		workers = refreshWorkers
+	}
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, len(devices))
+		sem  = make(chan struct{}, workers)
+	)
+	for i, nd := range devices {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, nd *Device) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			errs[i] = st.loadDevice(ctx, nd, details[nd.ID])
+		}(i, nd)
+	}
+	wg.Wait()
+	failed := make(map[string]error)
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		if !st.config().SkipDeviceErrors {
 			return err
 		}
+		failed[devices[i].ID] = err
+	}
+	if len(failed) > 0 {
+		// Keep the devices known from previous refreshes (with their old
+		// state), but leave out the new ones.
+		isNew := make(map[string]bool)
+		for _, id := range delta.Added {
+			isNew[id] = true
+		}
+		var kept []*Device
+		for _, d := range devices {
+			if _, ok := failed[d.ID]; !ok || !isNew[d.ID] {
+				kept = append(kept, d)
+			}
+		}
+		devices = kept
+		var added []string
+		for _, id := range delta.Added {
+			if _, ok := failed[id]; !ok {
+				added = append(added, id)
+			}
+		}
+		delta.Added = added
+	}
+
+	// Build the parent/child relationships.
+	children := make(map[string][]*Device)
+	for _, d := range devices {
+		if p, ok := d.ParentID(); ok {
+			children[p] = append(children[p], d)
+		}
+	}
+	for _, d := range devices {
+		d.mu.Lock()
+		d.children = children[d.ID]
+		d.mu.Unlock()
+	}
+
+	// Report the devices moved between rooms.
+	for _, d := range devices {
+		old, ok := rooms[d.ID]
+		if cur := d.RoomID(); ok && cur != old {
+			delta.Moved = append(delta.Moved, RoomChange{DeviceID: d.ID, OldRoom: old, NewRoom: cur})
+		}
+	}
+
+	// Whatever is left in known is gone.
+	for id := range known {
+		delta.Removed = append(delta.Removed, id)
+	}
+	sort.Strings(delta.Removed)
+
+	st.devMu.Lock()
+	st.devices = devices
+	st.devMu.Unlock()
+	st.mu.Lock()
+	st.delta = delta
+	if len(failed) == 0 {
+		st.refreshedAt = start
+	}
+	st.mu.Unlock()
+	if len(failed) > 0 {
+		return &RefreshError{Errors: failed}
+	}
+	return nil
+}
+
+// RefreshDevice re-reads the details, commands and attributes of a single
+// device, updating it in place. Returns an error wrapping ErrDeviceNotFound
+// if the device is not known.
+func (st *SmartThings) RefreshDevice(id string) error {
+	return st.RefreshDeviceContext(context.Background(), id)
+}
+
+// RefreshDeviceContext works like RefreshDevice, aborting the requests when
+// ctx is cancelled.
+func (st *SmartThings) RefreshDeviceContext(ctx context.Context, id string) error {
+	if err := st.connected(); err != nil {
+		return err
+	}
+	d, err := st.DeviceByID(id)
+	if err != nil {
+		return err
+	}
+	return st.loadDevice(st.withRetryBudget(ctx), d, nil)
+}
+
+// loadDevice reads the details (unless already read, as given in detail)
+// and commands of a device, and updates its attributes.
+func (st *SmartThings) loadDevice(ctx context.Context, nd *Device, detail *DeviceInfo) error {
+	if detail == nil {
+		var err error
+		if detail, err = st.deviceInfo(ctx, nd); err != nil {
+			return err
+		}
+	}
+	// Names rarely change; only writing them when they do keeps callers
+	// reading the fields directly from racing with every refresh.
+	nd.mu.Lock()
+	if nd.Name != detail.Name {
 		nd.Name = detail.Name
+	}
+	if nd.DisplayName != detail.DisplayName {
 		nd.DisplayName = detail.DisplayName
-		dcs, err := GetDeviceCommands(st.client, st.endpoint, rd.ID)
-		if err != nil {
+	}
+	nd.parentID = detail.ParentDeviceID
+	loaded := nd.commandsLoaded
+	nd.mu.Unlock()
+	ttl := st.config().CommandCacheTTL
+	if ttl <= 0 || loaded.IsZero() || time.Since(loaded) >= ttl {
+		if err := nd.loadCommands(ctx); err != nil {
 			return err
 		}
-		cmds := make(map[string]bool)
-		nd.Commands = nil
-		for _, dc := range dcs {
-			if cmds[dc.Command] {
-				continue
+	}
+	nd.update(detail)
+	return nil
+}
+
+// loadCommands reads the commands accepted by the device and their schema.
+// The new values are built apart and swapped in at once, so calls made
+// during a refresh see either the old or the new commands.
+func (d *Device) loadCommands(ctx context.Context) error {
+	if err := d.st.connected(); err != nil {
+		return err
+	}
+	var (
+		dcs []DeviceCommand
+		err error
+	)
+	if d.st.v1() {
+		dcs, err = d.st.v1Commands(ctx, d.ID)
+	} else {
+		dcs, err = GetDeviceCommands(ctx, d.st.client, d.st.endpoint, d.ID)
+	}
+	if err != nil {
+		return err
+	}
+	var (
+		seen     = make(map[string]bool)
+		commands []string
+		schema   = make(map[string][]ParamSchema)
+		params   = make(map[string]map[string]interface{})
+		cmdCaps  = make(map[string][]string)
+	)
+	for _, dc := range dcs {
+		if dc.Capability != "" {
+			cmdCaps[dc.Command] = append(cmdCaps[dc.Command], dc.Capability)
+		}
+		// Commands defined by several capabilities are listed once, with
+		// the parameters of all definitions (the first one wins).
+		if !seen[dc.Command] {
+			commands = append(commands, dc.Command)
+			params[dc.Command] = make(map[string]interface{})
+			seen[dc.Command] = true
+		}
+		for name, def := range dc.Params {
+			if _, ok := params[dc.Command][name]; !ok {
+				params[dc.Command][name] = def
 			}
-			nd.Commands = append(nd.Commands, dc.Command)
-			cmds[dc.Command] = true
 		}
-		err = nd.Refresh()
+	}
+	for cmd, p := range params {
+		schema[cmd] = parseParams(p)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.Commands, d.schema, d.params, d.cmdCaps = commands, schema, params, cmdCaps
+	d.commandsLoaded = time.Now()
+	return nil
+}
+
+// RefreshCommands re-reads the commands accepted by the device, bypassing
+// the command cache (see Config.CommandCacheTTL).
+func (d *Device) RefreshCommands() error {
+	return d.RefreshCommandsContext(context.Background())
+}
+
+// RefreshCommandsContext works like RefreshCommands, aborting the request
+// when ctx is cancelled.
+func (d *Device) RefreshCommandsContext(ctx context.Context) error {
+	return d.loadCommands(ctx)
+}
+
+// InstalledAppID returns the ID of the installed SmartApp, as discovered by
+// Connect.
+func (st *SmartThings) InstalledAppID() string {
+	if st.smartThings == nil {
+		return ""
+	}
+	return st.appID
+}
+
+// LocationID returns the ID of the location the SmartApp is installed in.
+func (st *SmartThings) LocationID() string {
+	if st.smartThings == nil {
+		return ""
+	}
+	return st.locationID
+}
+
+// DeviceList returns a copy of the device list. It is safe to call while
+// another goroutine is refreshing the devices.
+func (st *SmartThings) DeviceList() []*Device {
+	if st.smartThings == nil {
+		return nil
+	}
+	st.devMu.RLock()
+	defer st.devMu.RUnlock()
+	return append([]*Device(nil), st.devices...)
+}
+
+// AttributeTable returns the current attributes of all devices, keyed by
+// device ID and then by attribute name.
+func (st *SmartThings) AttributeTable() map[string]map[string]float64 {
+	table := make(map[string]map[string]float64)
+	for _, d := range st.DeviceList() {
+		table[d.ID] = d.Attributes()
+	}
+	return table
+}
+
+// Rooms returns the rooms in the location the SmartApp is installed in.
+func (st *SmartThings) Rooms() ([]Room, error) {
+	return st.RoomsContext(context.Background())
+}
+
+// RoomsContext works like Rooms, aborting the request when ctx is cancelled.
+func (st *SmartThings) RoomsContext(ctx context.Context) ([]Room, error) {
+	if err := st.connected(); err != nil {
+		return nil, err
+	}
+	return GetRooms(ctx, st.client, st.endpoint, "")
+}
+
+// oauthContext returns ctx set up so the OAuth library uses
+// Config.HTTPClient, if set.
+func (st *SmartThings) oauthContext(ctx context.Context) context.Context {
+	if st.cfg.HTTPClient == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, oauth2.HTTPClient, st.cfg.HTTPClient)
+}
+
+// httpClient returns a client sending requests through transport, with the
+// settings of Config.HTTPClient, if set.
+func (st *SmartThings) httpClient(transport http.RoundTripper) *http.Client {
+	c := &http.Client{}
+	if st.cfg.HTTPClient != nil {
+		*c = *st.cfg.HTTPClient
+	}
+	c.Transport = transport
+	return c
+}
+
+// connected returns ErrNotConnected if the client or endpoint are not set.
+func (st *SmartThings) connected() error {
+	if st == nil || st.smartThings == nil || st.client == nil || st.endpoint == "" {
+		return ErrNotConnected
+	}
+	return nil
+}
+
+// withRetryBudget returns ctx carrying a new retry budget for a high-level
+// operation, as set by Config.RetryBudget.
+func (st *SmartThings) withRetryBudget(ctx context.Context) context.Context {
+	return withRetryBudget(ctx, st.config().RetryBudget)
+}
+
+// RawDeviceInfo returns the unparsed response of the /devices/{id} endpoint.
+func (st *SmartThings) RawDeviceInfo(id string) (json.RawMessage, error) {
+	if err := st.connected(); err != nil {
+		return nil, err
+	}
+	contents, err := st.rawDeviceInfo(context.Background(), id, nil)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(contents), nil
+}
+
+// RawDeviceCommands returns the unparsed response of the
+// /devices/{id}/commands endpoint.
+func (st *SmartThings) RawDeviceCommands(id string) (json.RawMessage, error) {
+	if err := st.connected(); err != nil {
+		return nil, err
+	}
+	if st.v1() {
+		// The v1 API has no such endpoint; encode the commands defined
+		// by the device capabilities instead.
+		dcs, err := st.v1Commands(context.Background(), id)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		st.Devices = append(st.Devices, nd)
+		return json.Marshal(dcs)
 	}
-	return nil
+	contents, err := issueCommand(context.Background(), st.client, st.endpoint, "/devices/"+url.PathEscape(id)+"/commands")
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(contents), nil
+}
+
+// DeviceDelta lists the IDs of the devices added and removed by a refresh,
+// and the devices moved to another room.
+type DeviceDelta struct {
+	Added   []string
+	Removed []string
+	Moved   []RoomChange
 }
 
-// Device is a representation of a Device
+// RoomChange describes a device moved between rooms. A blank room ID means
+// the device was not assigned to a room.
+type RoomChange struct {
+	DeviceID         string
+	OldRoom, NewRoom string
+}
+
+// DeviceDelta returns the device IDs added and removed, and the devices
+// moved between rooms, by the last Refresh, compared to the refresh before
+// it. On the first refresh, all devices are reported as added.
+func (st *SmartThings) DeviceDelta() DeviceDelta {
+	if st.smartThings == nil {
+		return DeviceDelta{}
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.delta
+}
+
+// Device is a representation of a Device. Its methods are safe to call
+// while another goroutine refreshes it; the exported Name, DisplayName and
+// Commands fields are not (use Names and CommandList instead).
 type Device struct {
-	st *SmartThings
+	st                    *SmartThings
 	ID, Name, DisplayName string
-	Commands []string
-	mu sync.Mutex
-	attributes map[string]float64
+	Commands              []string
+	mu                    sync.Mutex
+	attributes            map[string]float64
+	raw                   map[string]interface{}
+	info                  *DeviceInfo
+	lastRefresh           time.Time
+	commandsLoaded        time.Time
+	lastCommand           time.Time
+	lastCall              string
+	lastCallTime          time.Time
+	pendingCalls          map[string]bool
+	latency               latencyStats
+	times                 map[string]time.Time
+	schema                map[string][]ParamSchema
+	params                map[string]map[string]interface{}
+	cmdCaps               map[string][]string
+	parentID              string
+	children              []*Device
+	tempUnit              string
 }
 
-// Attributes gets all attributes.
+// Attributes gets all attributes. String values are converted to numbers
+// (see AttributeType); those that cannot be are only available through
+// StringAttributes and RawAttributes.
 func (d *Device) Attributes() map[string]float64 {
 	d.mu.Lock()
 	defer d.mu.Unlock()
@@ -118,34 +918,226 @@ func (d *Device) Attribute(name string) float64 {
 	return d.attributes[name]
 }
 
-// Refresh the available device commands.
-func (d *Device) Refresh() error {
-	detail, err := GetDeviceInfo(d.st.client, d.st.endpoint, d.ID)
-	if err != nil {
-		return err
+// AttributeSnapshot returns the requested attributes, read under a single
+// lock so that all values come from the same refresh. Attributes not reported
+// by the device are omitted from the result.
+func (d *Device) AttributeSnapshot(names ...string) map[string]float64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make(map[string]float64)
+	for _, n := range names {
+		if v, ok := d.attributes[n]; ok {
+			out[n] = v
+		}
 	}
-	na := make(map[string]float64)
-	for k, v := range detail.Attributes {
+	return out
+}
+
+// StringAttributes returns all attributes as strings. String values are
+// returned as reported, numbers and booleans are formatted, and other values
+// (e.g. objects) are returned as JSON. Null values are omitted.
+func (d *Device) StringAttributes() map[string]string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make(map[string]string)
+	for k, v := range d.raw {
 		switch t := v.(type) {
-		default:
-			log.Printf("unhandled attribute type: %v", t)
-		case float64:
-			na[k] = t
+		case nil:
 		case string:
-			if t == "on" || t == "present" {
-				na[k] = 1.0
-			} else {
-				na[k] = 0.0
+			out[k] = t
+		case float64:
+			out[k] = strconv.FormatFloat(t, 'f', -1, 64)
+		case bool:
+			out[k] = strconv.FormatBool(t)
+		default:
+			if b, err := json.Marshal(t); err == nil {
+				out[k] = string(b)
 			}
 		}
 	}
+	return out
+}
+
+// AttributeString returns the value of a single attribute as a string,
+// formatted as in StringAttributes. Returns false if the attribute is absent
+// or null.
+func (d *Device) AttributeString(name string) (string, bool) {
+	d.mu.Lock()
+	v, ok := d.raw[name]
+	d.mu.Unlock()
+	if !ok || v == nil {
+		return "", false
+	}
+	switch t := v.(type) {
+	case string:
+		return t, true
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(t), true
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", false
+	}
+	return string(b), true
+}
+
+// BoolAttribute returns the value of a single attribute as a boolean. String
+// values are looked up in the truthy table (DefaultTruthyValues, extended by
+// Config.TruthyValues), where nonzero values are true: "on", "open",
+// "active", "present" and "locked" are true, and their counterparts ("off",
+// "closed", "inactive", "not present", "unlocked") are false. The second
+// value is false if the attribute is absent or not in the table.
+func (d *Device) BoolAttribute(name string) (bool, bool) {
+	d.mu.Lock()
+	v := d.raw[name]
+	d.mu.Unlock()
+	switch t := v.(type) {
+	case bool:
+		return t, true
+	case string:
+		f, ok := d.st.truthyValues()[strings.ToLower(t)]
+		return f != 0, ok
+	}
+	return false, false
+}
+
+// RawAttributes returns all attributes with the values decoded from the API
+// response, before any conversion to float64.
+func (d *Device) RawAttributes() map[string]interface{} {
 	d.mu.Lock()
 	defer d.mu.Unlock()
-	d.attributes = na
+	out := make(map[string]interface{})
+	for k, v := range d.raw {
+		out[k] = v
+	}
+	return out
+}
+
+// Refresh re-reads the attributes of the device. Use RefreshContext to set
+// a deadline on a single refresh.
+func (d *Device) Refresh() error {
+	return d.RefreshContext(context.Background())
+}
+
+// RefreshContext works like Refresh, aborting the request when ctx is
+// cancelled.
+func (d *Device) RefreshContext(ctx context.Context) error {
+	detail, err := d.st.deviceInfo(ctx, d)
+	if err != nil {
+		return err
+	}
+	d.update(detail)
 	return nil
 }
 
+// update sets the attributes of the device from detail, recording the
+// changes and evaluating the watchers.
+func (d *Device) update(detail *DeviceInfo) {
+	na := numericAttributes(detail.Attributes, detail.SupportedAttributes, d.st.truthyValues(), func(k string, v interface{}) {
+		d.st.logf("unhandled attribute type for %q of device %s: %v", k, d.ID, v)
+	})
+	for _, w := range detail.warnings {
+		d.st.logf("%s", w)
+	}
+	now := time.Now()
+	d.mu.Lock()
+	var changes []AttributeChange
+	if !d.lastRefresh.IsZero() {
+		changes = diffAttributes(d.ID, d.raw, detail.Attributes, now)
+	}
+	d.attributes = na
+	d.raw = detail.Attributes
+	d.tempUnit = attributesUnit(detail.Attributes, detail.details)
+	d.times = attributeTimes(detail.details)
+	d.info = detail
+	d.lastRefresh = now
+	d.mu.Unlock()
+
+	if len(changes) > 0 {
+		d.st.feed.add(d.st.config().ActivityFeedSize, changes)
+	}
+	d.st.evalAlerts(d)
+	d.st.evalConnectivity(d, now)
+	d.st.evalPresence(d, now)
+}
+
+// ForceRefresh asks the device to report its current state, using its
+// refresh command, and then re-reads its attributes. Refresh alone returns the
+// state cached by the hub, which may be stale for battery powered devices.
+// Devices without a refresh command are only re-read.
+func (d *Device) ForceRefresh() error {
+	if d.HasCommand("refresh") {
+		if err := d.CallIdempotent("refresh"); err != nil {
+			return err
+		}
+	}
+	return d.Refresh()
+}
+
+// stringAttribute returns the value of an attribute as a string, exactly as
+// reported by the API. Returns false if the attribute is absent or is not a
+// string.
+func (d *Device) stringAttribute(name string) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s, ok := d.raw[name].(string)
+	return s, ok
+}
+
+// ParentID returns the ID of the parent of a composite device. Returns false
+// if the device has no parent.
+func (d *Device) ParentID() (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.parentID, d.parentID != ""
+}
+
+// Children returns the child devices of a composite device, as found during
+// the last Refresh.
+func (d *Device) Children() []*Device {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]*Device(nil), d.children...)
+}
+
+// Names returns the name and display name of the device. Unlike reading the
+// Name and DisplayName fields, it is safe to call while the device is being
+// refreshed.
+func (d *Device) Names() (name, displayName string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.Name, d.DisplayName
+}
+
+// CommandList returns a copy of the commands accepted by the device. Unlike
+// reading the Commands field, it is safe to call while the device is being
+// refreshed.
+func (d *Device) CommandList() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.Commands...)
+}
+
+// Presentation returns the raw presentation metadata for the device.
+func (d *Device) Presentation() (json.RawMessage, error) {
+	return d.PresentationContext(context.Background())
+}
+
+// PresentationContext works like Presentation, aborting the request when
+// ctx is cancelled.
+func (d *Device) PresentationContext(ctx context.Context) (json.RawMessage, error) {
+	if err := d.st.connected(); err != nil {
+		return nil, err
+	}
+	return GetDevicePresentation(ctx, d.st.client, d.st.endpoint, d.ID)
+}
+
+// HasCommand returns true if the device accepts cmd.
 func (d *Device) HasCommand(cmd string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	for _, c := range d.Commands {
 		if c == cmd {
 			return true
@@ -154,31 +1146,228 @@ func (d *Device) HasCommand(cmd string) bool {
 	return false
 }
 
+// CommandCapability returns the capability the command originates from. If
+// more than one capability defines the command, the first one reported is
+// returned; use CommandCapabilities to get all of them. Returns false if the
+// API did not report the capability.
+func (d *Device) CommandCapability(cmd string) (string, bool) {
+	caps := d.CommandCapabilities(cmd)
+	if len(caps) == 0 {
+		return "", false
+	}
+	return caps[0], true
+}
+
+// CommandCapabilities returns all the capabilities defining cmd.
+func (d *Device) CommandCapabilities(cmd string) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.cmdCaps[cmd]...)
+}
+
+// paramSchema returns the parameters of cmd declared by the command schema.
+// The slice is shared and must not be modified.
+func (d *Device) paramSchema(cmd string) []ParamSchema {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.schema[cmd]
+}
+
+// Call issues a command to the device, with at most one numeric argument.
+// Use CallContext to set a deadline on a single command.
 func (d *Device) Call(cmd string, args ...float64) error {
-	found := false
-	for _, c := range d.Commands {
-		if cmd == c {
-			found = true
-		}
+	return d.CallContext(context.Background(), cmd, args...)
+}
+
+// CallContext works like Call, aborting the request when ctx is cancelled.
+func (d *Device) CallContext(ctx context.Context, cmd string, args ...float64) error {
+	if len(args) > 1 {
+		return errors.New("too many arguments")
+	}
+	if err := d.checkFloatArgs(cmd, args); err != nil {
+		return err
+	}
+	return d.call(ctx, cmd, floatArgs(args), nil, false)
+}
+
+// CallResult works like Call, and returns the raw response body sent by the
+// server (e.g. the new attribute value). The body is nil if the command was
+// suppressed as a duplicate (see Config.CommandDedupWindow).
+func (d *Device) CallResult(cmd string, args ...float64) ([]byte, error) {
+	return d.CallResultContext(context.Background(), cmd, args...)
+}
+
+// CallResultContext works like CallResult, aborting the request when ctx is
+// cancelled.
+func (d *Device) CallResultContext(ctx context.Context, cmd string, args ...float64) ([]byte, error) {
+	if len(args) > 1 {
+		return nil, errors.New("too many arguments")
 	}
-	if !found {
-		return fmt.Errorf("unavailable command: %v", cmd)
+	if err := d.checkFloatArgs(cmd, args); err != nil {
+		return nil, err
 	}
+	return d.send(ctx, cmd, floatArgs(args), nil, false)
+}
+
+// CallIdempotent works like Call, but marks this call as safe to retry on
+// transient failures regardless of Config.IdempotentCommands.
+func (d *Device) CallIdempotent(cmd string, args ...float64) error {
+	return d.CallIdempotentContext(context.Background(), cmd, args...)
+}
+
+// CallIdempotentContext works like CallIdempotent, aborting the request when
+// ctx is cancelled.
+func (d *Device) CallIdempotentContext(ctx context.Context, cmd string, args ...float64) error {
 	if len(args) > 1 {
 		return errors.New("too many arguments")
 	}
-	path := fmt.Sprintf("/devices/%s/%s", d.ID, cmd)
-	if len(args) > 0 {
-		var sargs []string
-		for _, a := range args {
-			sargs = append(sargs, fmt.Sprintf("%v", a))
+	if err := d.checkFloatArgs(cmd, args); err != nil {
+		return err
+	}
+	return d.call(ctx, cmd, floatArgs(args), nil, true)
+}
+
+// hookArgs converts command arguments back to numbers for
+// Config.BeforeCommand. Arguments that are not numbers become NaN.
+func hookArgs(args []string) []float64 {
+	var ret []float64
+	for _, a := range args {
+		f, err := strconv.ParseFloat(a, 64)
+		if err != nil {
+			f = math.NaN()
 		}
-		path = fmt.Sprintf("%s/%v", path, strings.Join(sargs, "/"))
+		ret = append(ret, f)
 	}
-	_, err := issueCommand(d.st.client, d.st.endpoint, path)
+	return ret
+}
+
+// floatArgs formats numeric command arguments, without exponents or
+// trailing zeros.
+func floatArgs(args []float64) []string {
+	var ret []string
+	for _, a := range args {
+		ret = append(ret, strconv.FormatFloat(a, 'f', -1, 64))
+	}
+	return ret
+}
+
+// call issues a command to the device. Args are appended to the command
+// path, and query (if not empty) is sent as the query string. The command is
+// retried on transient failures only if idempotent is set or the command is
+// listed in Config.IdempotentCommands.
+func (d *Device) call(ctx context.Context, cmd string, args []string, query url.Values, idempotent bool) error {
+	_, err := d.send(ctx, cmd, args, query, idempotent)
 	return err
 }
 
+// send works like call, and returns the response body. The body is nil if
+// the command was suppressed as a duplicate.
+func (d *Device) send(ctx context.Context, cmd string, args []string, query url.Values, idempotent bool) ([]byte, error) {
+	if err := d.st.connected(); err != nil {
+		return nil, err
+	}
+	if err := d.st.writable(); err != nil {
+		return nil, err
+	}
+	if !d.HasCommand(cmd) {
+		return nil, fmt.Errorf("%w: %v", ErrCommandUnavailable, cmd)
+	}
+	if !d.st.commandAllowed(cmd) {
+		return nil, fmt.Errorf("%w: %v", ErrCommandNotAllowed, cmd)
+	}
+	if hook := d.st.config().BeforeCommand; hook != nil {
+		if err := hook(d.ID, cmd, hookArgs(args)); err != nil {
+			return nil, err
+		}
+	}
+	path := fmt.Sprintf("/devices/%s/%s", url.PathEscape(d.ID), url.PathEscape(cmd))
+	for _, a := range args {
+		path += "/" + url.PathEscape(a)
+	}
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	if !d.reserveCall(path) {
+		return nil, nil
+	}
+	defer d.releaseCall(path)
+	undoCooldown, err := d.checkCooldown()
+	if err != nil {
+		return nil, err
+	}
+	sent := false
+	defer func() {
+		if !sent {
+			undoCooldown()
+		}
+	}()
+	var req *http.Request
+	if d.st.v1() {
+		req, err = d.v1CommandRequest(ctx, cmd, args, query, idempotent)
+	} else {
+		req, err = d.st.commandRequest(ctx, cmd, path, idempotent)
+	}
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	contents, err := doRequest(d.st.client, req)
+	if err != nil {
+		return nil, err
+	}
+	elapsed := time.Since(start)
+	d.st.latency.add(elapsed)
+	d.recordLatency(elapsed)
+	if err := commandError(d.ID, cmd, contents); err != nil {
+		return contents, err
+	}
+	d.recordCall(path)
+	sent = true
+	d.st.Invalidate(d.ID)
+	return contents, nil
+}
+
+// CommandError is returned when a command is accepted by the server (2xx
+// status) but the response body carries an error envelope.
+type CommandError struct {
+	DeviceID string
+	Command  string
+	Message  string
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("command %v on device %s failed: %s", e.Command, e.DeviceID, e.Message)
+}
+
+// commandError inspects a command response body and returns a *CommandError
+// if it contains an error envelope such as {"error": "..."}.
+func commandError(id, cmd string, contents []byte) error {
+	var env struct {
+		Error   interface{} `json:"error"`
+		Message string      `json:"message"`
+	}
+	if json.Unmarshal(contents, &env) != nil || env.Error == nil || env.Error == false {
+		return nil
+	}
+
+	msg := env.Message
+	switch t := env.Error.(type) {
+	case string:
+		if t == "" {
+			return nil
+		}
+		msg = t
+	case map[string]interface{}:
+		if m, ok := t["message"].(string); ok {
+			msg = m
+		}
+	}
+	if msg == "" {
+		msg = "unknown error"
+	}
+	return &CommandError{DeviceID: id, Command: cmd, Message: msg}
+}
+
 // DeviceList holds the list of devices returned by /devices
 type DeviceList struct {
 	ID          string `json:"id"`
@@ -189,38 +1378,226 @@ type DeviceList struct {
 // DeviceInfo holds information about a specific device.
 type DeviceInfo struct {
 	DeviceList
-	Attributes map[string]interface{} `json:"attributes"`
+	ParentDeviceID string                 `json:"parentDeviceId"`
+	LocationID     string                 `json:"locationId"`
+	RoomID         string                 `json:"roomId"`
+	Attributes     map[string]interface{} `json:"attributes"`
+	// TypeName is the name of the device handler (e.g. "Z-Wave Switch").
+	TypeName string `json:"typeName"`
+	// Virtual is true if the API flags the device as virtual.
+	Virtual bool `json:"virtual"`
+	// Status is the health status of the device (e.g. "ONLINE",
+	// "OFFLINE"), if reported.
+	Status string `json:"status"`
+	// TypeID is the ID of the device handler. Blank if not reported.
+	TypeID string `json:"-"`
+	// Fingerprint holds the manufacturer specific identification of the
+	// device (clusters, endpoints, product codes), if reported.
+	Fingerprint map[string]interface{} `json:"fingerprint"`
+	// Data holds the device data set by the device handler, if reported.
+	Data map[string]interface{} `json:"data"`
+	// LastActivity is the time the device last reported to the hub. Zero
+	// if not reported.
+	LastActivity time.Time `json:"-"`
+	// InstalledAt is the time the device was added. Zero if not reported.
+	InstalledAt time.Time `json:"-"`
+	// SupportedAttributes holds the attribute types declared by the device
+	// capabilities, if reported.
+	SupportedAttributes []AttributeType `json:"supportedAttributes"`
+	// Capabilities holds the capabilities of the device and their
+	// versions, if reported.
+	Capabilities []Capability `json:"capabilities"`
+
+	// details holds the attributes with their metadata.
+	details map[string]AttributeDetail
+	// warnings holds the problems found while decoding the response.
+	warnings []string
+}
+
+// UnmarshalJSON decodes a device info response. Attributes are decoded one
+// by one, so a single malformed attribute is skipped (and reported to the
+// Logger on refresh) instead of failing the whole device.
+func (di *DeviceInfo) UnmarshalJSON(b []byte) error {
+	type alias DeviceInfo
+	aux := struct {
+		*alias
+		Attributes   json.RawMessage `json:"attributes"`
+		LastActivity interface{}     `json:"lastActivity"`
+		InstalledAt  interface{}     `json:"installedAt"`
+		DateCreated  interface{}     `json:"dateCreated"`
+		TypeID       interface{}     `json:"typeId"`
+	}{alias: (*alias)(di)}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+	di.Attributes, di.details, di.warnings = parseAttributes(di.ID, aux.Attributes)
+	di.LastActivity, _ = parseTime(aux.LastActivity)
+	switch t := aux.TypeID.(type) {
+	case string:
+		di.TypeID = t
+	case float64:
+		di.TypeID = strconv.FormatFloat(t, 'f', -1, 64)
+	}
+	if t, ok := parseTime(aux.InstalledAt); ok {
+		di.InstalledAt = t
+	} else {
+		di.InstalledAt, _ = parseTime(aux.DateCreated)
+	}
+	return nil
+}
+
+// parseAttributes decodes a raw attributes object, skipping any attribute
+// that cannot be decoded. Attribute objects carrying metadata (see
+// AttributeDetail) are reduced to their value. Returns the attributes, their
+// details and a description of each problem found.
+func parseAttributes(id string, raw json.RawMessage) (map[string]interface{}, map[string]AttributeDetail, []string) {
+	ret := make(map[string]interface{})
+	details := make(map[string]AttributeDetail)
+	if len(raw) == 0 || string(raw) == "null" {
+		return ret, details, nil
+	}
+
+	var (
+		attrs    map[string]json.RawMessage
+		warnings []string
+	)
+	if err := json.Unmarshal(raw, &attrs); err != nil {
+		return ret, details, []string{fmt.Sprintf("malformed attributes for device %s: %v", id, err)}
+	}
+	for k, v := range attrs {
+		var value interface{}
+		if err := json.Unmarshal(v, &value); err != nil {
+			warnings = append(warnings, fmt.Sprintf("malformed attribute %q for device %s: %v", k, id, err))
+			continue
+		}
+		ad := attributeDetail(k, value)
+		ret[k] = ad.Value
+		details[k] = ad
+	}
+	return ret, details, warnings
 }
 
 // DeviceCommand holds one command a device can accept.
 type DeviceCommand struct {
 	Command string                 `json:"command"`
 	Params  map[string]interface{} `json:"params"`
+	// Capability is the capability defining the command, if reported.
+	Capability string `json:"capability"`
 }
 
 // GetDevices returns the list of devices from smartthings using
-// the specified http.client and endpoint URI.
-func GetDevices(client *http.Client, endpoint string) ([]DeviceList, error) {
-	ret := []DeviceList{}
+// the specified http.client and endpoint URI. Paginated lists are read in
+// full (up to 100 pages).
+func GetDevices(ctx context.Context, client *http.Client, endpoint string) ([]DeviceList, error) {
+	return getDeviceList(ctx, client, endpoint, "/devices", parseDevicePage)
+}
 
-	contents, err := issueCommand(client, endpoint, "/devices")
+// GetDevicesChangedSince returns the list of devices changed on the server
+// since t. Servers not supporting the query reply with an *HTTPError (see
+// SmartThings.RefreshChangedSince).
+func GetDevicesChangedSince(ctx context.Context, client *http.Client, endpoint string, t time.Time) ([]DeviceList, error) {
+	ms := t.UnixNano() / int64(time.Millisecond)
+	return getDeviceList(ctx, client, endpoint, "/devices?updatedSince="+strconv.FormatInt(ms, 10), parseDevicePage)
+}
+
+// getDeviceList reads the device list starting at path, following the
+// pagination links. Each page is decoded by parse.
+func getDeviceList(ctx context.Context, client *http.Client, endpoint string, path string, parse func([]byte) ([]DeviceList, string, error)) ([]DeviceList, error) {
+	ret := []DeviceList{}
+	err := getPages(ctx, client, endpoint, path, func(contents []byte) (string, error) {
+		items, next, err := parse(contents)
+		ret = append(ret, items...)
+		return next, err
+	})
 	if err != nil {
 		return nil, err
 	}
+	return ret, nil
+}
 
-	if err := json.Unmarshal(contents, &ret); err != nil {
-		return nil, err
+// getPages reads the (possibly paginated) device list starting at path,
+// passing each page to fn, which returns the link to the next page.
+func getPages(ctx context.Context, client *http.Client, endpoint string, path string, fn func([]byte) (string, error)) error {
+	seen := make(map[string]bool)
+	for page := 0; path != ""; page++ {
+		if page >= maxDevicePages {
+			return fmt.Errorf("device list exceeds %d pages", maxDevicePages)
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		seen[path] = true
+		contents, err := issueCommand(ctx, client, endpoint, path)
+		if err != nil {
+			return err
+		}
+		next, err := fn(contents)
+		if err != nil {
+			return err
+		}
+		if path, err = nextPagePath(endpoint, next); err != nil {
+			return err
+		}
+		if seen[path] {
+			return fmt.Errorf("device list pagination loops back to %q", next)
+		}
 	}
-	return ret, nil
+	return nil
+}
+
+// parseDevicePage decodes one page of the device list. A page is either a
+// plain array of devices or an object holding the devices in "items" and
+// the link to the next page in "_links.next.href". Returns the devices and
+// the next page link, blank on the last page.
+func parseDevicePage(contents []byte) ([]DeviceList, string, error) {
+	var items []DeviceList
+	if err := json.Unmarshal(contents, &items); err == nil {
+		return items, "", nil
+	}
+	var page struct {
+		Items []DeviceList `json:"items"`
+		Links struct {
+			Next struct {
+				Href string `json:"href"`
+			} `json:"next"`
+		} `json:"_links"`
+	}
+	if err := json.Unmarshal(contents, &page); err != nil {
+		return nil, "", err
+	}
+	return page.Items, page.Links.Next.Href, nil
+}
+
+// nextPagePath converts a next page link (absolute, or relative to
+// endpoint) into a path under endpoint. Links pointing outside the endpoint
+// are rejected, so credentials are never sent elsewhere.
+func nextPagePath(endpoint, next string) (string, error) {
+	if next == "" {
+		return "", nil
+	}
+	base, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(next)
+	if err != nil {
+		return "", fmt.Errorf("invalid next page link %q: %v", next, err)
+	}
+	endpoint = strings.TrimSuffix(endpoint, "/")
+	abs := base.ResolveReference(ref).String()
+	if !strings.HasPrefix(abs, endpoint+"/") {
+		return "", fmt.Errorf("next page link %q is outside the endpoint", next)
+	}
+	return strings.TrimPrefix(abs, endpoint), nil
 }
 
 // GetDeviceInfo returns device specific information about a particular device.
-func GetDeviceInfo(client *http.Client, endpoint string, id string) (*DeviceInfo, error) {
+func GetDeviceInfo(ctx context.Context, client *http.Client, endpoint string, id string) (*DeviceInfo, error) {
 	ret := &DeviceInfo{}
 
-	contents, err := issueCommand(client, endpoint, "/devices/"+id)
+	contents, err := issueCommand(ctx, client, endpoint, "/devices/"+url.PathEscape(id))
 	if err != nil {
-		return nil, err
+		return nil, notFound(err, id)
 	}
 
 	if err := json.Unmarshal(contents, &ret); err != nil {
@@ -230,10 +1607,50 @@ func GetDeviceInfo(client *http.Client, endpoint string, id string) (*DeviceInfo
 }
 
 // GetDeviceCommands returns a slice of commands a specific device accepts.
-func GetDeviceCommands(client *http.Client, endpoint string, id string) ([]DeviceCommand, error) {
+func GetDeviceCommands(ctx context.Context, client *http.Client, endpoint string, id string) ([]DeviceCommand, error) {
 	ret := []DeviceCommand{}
 
-	contents, err := issueCommand(client, endpoint, "/devices/"+id+"/commands")
+	contents, err := issueCommand(ctx, client, endpoint, "/devices/"+url.PathEscape(id)+"/commands")
+	if err != nil {
+		return nil, notFound(err, id)
+	}
+
+	if err := json.Unmarshal(contents, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// GetDevicePresentation returns the raw presentation metadata for a device.
+// The presentation describes how the device controls should be rendered.
+func GetDevicePresentation(ctx context.Context, client *http.Client, endpoint string, id string) (json.RawMessage, error) {
+	contents, err := issueCommand(ctx, client, endpoint, "/devices/"+url.PathEscape(id)+"/presentation")
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(contents) {
+		return nil, fmt.Errorf("invalid presentation JSON for device %s", id)
+	}
+	return json.RawMessage(contents), nil
+}
+
+// Room holds a room as returned by the rooms endpoint.
+type Room struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	LocationID string `json:"locationId"`
+}
+
+// GetRooms returns the list of rooms in a location. If locationID is blank,
+// the rooms for the location the SmartApp is installed in are returned.
+func GetRooms(ctx context.Context, client *http.Client, endpoint string, locationID string) ([]Room, error) {
+	ret := []Room{}
+
+	path := "/rooms"
+	if locationID != "" {
+		path = "/locations/" + locationID + "/rooms"
+	}
+	contents, err := issueCommand(ctx, client, endpoint, path)
 	if err != nil {
 		return nil, err
 	}
@@ -244,17 +1661,111 @@ func GetDeviceCommands(client *http.Client, endpoint string, id string) ([]Devic
 	return ret, nil
 }
 
-// issueCommand sends a given command to an URI and returns the contents
-func issueCommand(client *http.Client, endpoint string, cmd string) ([]byte, error) {
-	uri := endpoint + cmd
-	resp, err := client.Get(uri)
+// issueCommand sends a given command to an URI and returns the contents.
+// Identical requests sent with the client of the same SmartThings while one
+// is in flight share its result (see flightGroup.do).
+func issueCommand(ctx context.Context, client *http.Client, endpoint string, cmd string) ([]byte, error) {
+	g := flightsFor(client)
+	if g == nil {
+		return issueGet(ctx, client, endpoint, cmd)
+	}
+	return g.do(ctx, endpoint+cmd, func(ctx context.Context) ([]byte, error) {
+		return issueGet(ctx, client, endpoint, cmd)
+	})
+}
+
+// flightsFor returns the group coalescing the GET requests sent with client,
+// owned by the SmartThings that built it. Returns nil for other clients,
+// whose requests are not coalesced.
+func flightsFor(client *http.Client) *flightGroup {
+	if client == nil {
+		return nil
+	}
+	if t, ok := client.Transport.(*hookTransport); ok {
+		return &t.st.flights
+	}
+	return nil
+}
+
+// issueAction works like issueCommand, but always sends its own request and
+// never retries it. Use it for requests that change state (e.g. setting the
+// location mode), which carry no idempotency key.
+func issueAction(ctx context.Context, client *http.Client, endpoint string, cmd string) ([]byte, error) {
+	return issueGet(context.WithValue(ctx, noRetryKey{}, true), client, endpoint, cmd)
+}
+
+// issueGet sends a GET request for cmd to endpoint and returns the contents.
+func issueGet(ctx context.Context, client *http.Client, endpoint string, cmd string) ([]byte, error) {
+	if client == nil || endpoint == "" {
+		return nil, ErrNotConnected
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint+cmd, nil)
 	if err != nil {
 		return nil, err
 	}
-	contents, err := ioutil.ReadAll(resp.Body)
-	resp.Body.Close()
+	return doRequest(client, req)
+}
+
+// issuePost sends body JSON encoded in a POST request for cmd to endpoint
+// and returns the contents. Like issueAction, failures are not retried.
+func issuePost(ctx context.Context, client *http.Client, endpoint string, cmd string, body interface{}) ([]byte, error) {
+	if client == nil || endpoint == "" {
+		return nil, ErrNotConnected
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	ctx = context.WithValue(ctx, noRetryKey{}, true)
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint+cmd, bytes.NewReader(b))
 	if err != nil {
 		return nil, err
 	}
+	req.Header.Set("Content-Type", "application/json")
+	return doRequest(client, req)
+}
+
+// readBody reads and closes the body of resp, decompressing it if the
+// server sent it gzip encoded and the transport did not decode it. Bodies
+// over Config.MaxResponseBytes (32MB without the SmartThings transport),
+// after decompression, are rejected with ErrResponseTooLarge.
+func readBody(resp *http.Response) ([]byte, error) {
+	defer resp.Body.Close()
+	gz := strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip")
+	var limit int64
+	if b, ok := resp.Body.(bufferedBody); ok {
+		if !gz {
+			return ioutil.ReadAll(resp.Body)
+		}
+		limit = b.limit
+	}
+	if !gz {
+		return readLimited(resp.Body, 0)
+	}
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding gzip response: %v", err)
+	}
+	defer zr.Close()
+	return readLimited(zr, limit)
+}
+
+// doRequest sends req using client and returns the response contents.
+// Responses with a non-2xx status are returned as an *HTTPError.
+func doRequest(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := readBody(resp)
+	if err == io.ErrUnexpectedEOF {
+		return nil, ErrTruncatedResponse
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, newHTTPError(resp.StatusCode, contents)
+	}
 	return contents, nil
 }
@@ -0,0 +1,1377 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smoogle/gosmart"
+	"github.com/smoogle/gosmart/gosmarttest"
+	"golang.org/x/net/context"
+)
+
+// lamp returns a dimmable switch fixture.
+func lamp(id string) gosmarttest.Device {
+	return gosmarttest.Device{
+		ID:          id,
+		Name:        "Dimmer " + id,
+		DisplayName: "Lamp " + id,
+		Attributes:  map[string]interface{}{"switch": "off", "level": 0.0},
+		Commands: []gosmart.DeviceCommand{
+			{Command: "on", Capability: "Switch"},
+			{Command: "off", Capability: "Switch"},
+			{Command: "setLevel", Capability: "Switch Level", Params: map[string]interface{}{
+				"level": map[string]interface{}{"type": "NUMBER", "min": 0.0, "max": 100.0},
+			}},
+		},
+	}
+}
+
+// thermostat returns a thermostat fixture, in heating mode.
+func thermostat(id string) gosmarttest.Device {
+	number := map[string]interface{}{"setpoint": "NUMBER"}
+	return gosmarttest.Device{
+		ID:          id,
+		Name:        "Thermostat " + id,
+		DisplayName: "Thermostat " + id,
+		Attributes: map[string]interface{}{
+			"temperature":              20.0,
+			"heatingSetpoint":          18.0,
+			"coolingSetpoint":          26.0,
+			"thermostatMode":           "heat",
+			"thermostatOperatingState": "idle",
+		},
+		Commands: []gosmart.DeviceCommand{
+			{Command: "setHeatingSetpoint", Capability: "Thermostat", Params: number},
+			{Command: "setCoolingSetpoint", Capability: "Thermostat", Params: number},
+			{Command: "heat", Capability: "Thermostat"},
+			{Command: "cool", Capability: "Thermostat"},
+			{Command: "auto", Capability: "Thermostat"},
+		},
+	}
+}
+
+// newServer starts a mock server closed when the test finishes.
+func newServer(t *testing.T, devices ...gosmarttest.Device) *gosmarttest.Server {
+	t.Helper()
+	s := gosmarttest.NewServer(devices...)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// connect returns a SmartThings using s, with all devices loaded.
+func connect(t *testing.T, s *gosmarttest.Server, cfg gosmart.Config) *gosmart.SmartThings {
+	t.Helper()
+	st, err := s.Connect(cfg)
+	if err != nil {
+		t.Fatalf("cannot connect to the mock server: %v", err)
+	}
+	return st
+}
+
+// device returns the device with the given ID, failing the test if unknown.
+func device(t *testing.T, st *gosmart.SmartThings, id string) *gosmart.Device {
+	t.Helper()
+	d, err := st.DeviceByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// waitFor polls cond until it returns true, failing the test after a few
+// seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// fastRetries returns a configuration retrying transient failures without
+// delay.
+func fastRetries(n int) gosmart.Config {
+	return gosmart.Config{MaxRetries: n, RetryBaseDelay: time.Millisecond}
+}
+
+// logger is a gosmart.Logger keeping the messages logged.
+type logger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *logger) Printf(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+// logged returns the messages containing substr.
+func (l *logger) logged(substr string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var ret []string
+	for _, s := range l.lines {
+		if strings.Contains(s, substr) {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
+func TestConnect(t *testing.T) {
+	s := newServer(t, lamp("1"), lamp("2"))
+	st, err := gosmart.Connect(context.Background(), gosmart.Config{Endpoint: s.URL + "/", AccessToken: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := st.Endpoint(); got != s.URL {
+		t.Errorf("Endpoint() = %q, want %q", got, s.URL)
+	}
+	if n := len(st.DeviceList()); n != 2 {
+		t.Fatalf("got %d devices, want 2", n)
+	}
+	for _, r := range s.Requests() {
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("request %s sent Authorization %q", r.Path, got)
+		}
+	}
+}
+
+func TestConnectWithToken(t *testing.T) {
+	s := newServer(t, lamp("1"), thermostat("2"))
+	st, err := gosmart.ConnectWithToken(context.Background(), s.URL, "personal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := deviceIDs(st.DeviceList()); !reflect.DeepEqual(got, []string{"1", "2"}) {
+		t.Fatalf("DeviceList() = %q, want [1 2]", got)
+	}
+	if err := device(t, &st, "1").Call("on"); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range s.Requests() {
+		if got := r.Header.Get("Authorization"); got != "Bearer personal" {
+			t.Errorf("request %s sent Authorization %q, want the token", r.Path, got)
+		}
+	}
+	if st.GrantedScopes() != nil {
+		t.Errorf("GrantedScopes() = %q, want none for a personal token", st.GrantedScopes())
+	}
+}
+
+func TestNotConnected(t *testing.T) {
+	var zero gosmart.SmartThings
+	if err := zero.Refresh(); err != gosmart.ErrNotConnected {
+		t.Errorf("Refresh() on a zero SmartThings = %v, want ErrNotConnected", err)
+	}
+	st := gosmart.NewSmartThings(http.DefaultClient, "", gosmart.Config{})
+	if err := st.Refresh(); err != gosmart.ErrNotConnected {
+		t.Errorf("Refresh() without an endpoint = %v, want ErrNotConnected", err)
+	}
+	var d gosmart.Device
+	if err := d.Call("on"); err != gosmart.ErrNotConnected {
+		t.Errorf("Call() on an unattached device = %v, want ErrNotConnected", err)
+	}
+	if _, err := gosmart.GetDevices(context.Background(), http.DefaultClient, ""); err != gosmart.ErrNotConnected {
+		t.Errorf("GetDevices() without an endpoint = %v, want ErrNotConnected", err)
+	}
+}
+
+// TestZeroSmartThings checks that every method of a zero SmartThings returns
+// ErrNotConnected (or an empty result) instead of panicking.
+func TestZeroSmartThings(t *testing.T) {
+	var st gosmart.SmartThings
+	ctx := context.Background()
+	var buf bytes.Buffer
+	calls := map[string]func() error{
+		"Refresh":             func() error { return st.Refresh() },
+		"RefreshDevice":       func() error { return st.RefreshDevice("1") },
+		"Rooms":               func() error { _, err := st.Rooms(); return err },
+		"RawDeviceInfo":       func() error { _, err := st.RawDeviceInfo("1"); return err },
+		"RawDeviceCommands":   func() error { _, err := st.RawDeviceCommands("1"); return err },
+		"StartAutoRefresh":    func() error { return st.StartAutoRefresh(time.Second, nil) },
+		"Poll":                func() error { return st.Poll(ctx, time.Second, nil, nil) },
+		"RefreshChangedSince": func() error { return st.RefreshChangedSince(time.Now()) },
+		"RefreshDiff":         func() error { _, err := st.RefreshDiff(); return err },
+		"AwaitEvent":          func() error { _, err := st.AwaitEvent(ctx, gosmart.CorrelationToken{DeviceID: "1"}); return err },
+		"Token":               func() error { _, err := st.Token(); return err },
+		"Groups":              func() error { _, err := st.Groups(); return err },
+		"StartHealthCheck":    func() error { return st.StartHealthCheck(time.Second, 1) },
+		"HubLocalAddress":     func() error { _, err := st.HubLocalAddress(); return err },
+		"InstalledAppConfig":  func() error { _, err := st.InstalledAppConfig(); return err },
+		"Locations":           func() error { _, err := st.Locations(); return err },
+		"Location":            func() error { _, err := st.Location(); return err },
+		"LocationGeo":         func() error { _, _, err := st.LocationGeo(); return err },
+		"DeviceByID":          func() error { _, err := st.DeviceByID("1"); return err },
+		"DeviceByName":        func() error { _, err := st.DeviceByName("lamp"); return err },
+		"CurrentMode":         func() error { _, err := st.CurrentMode(); return err },
+		"SetMode":             func() error { return st.SetMode("Home") },
+		"SetModeAndConfirm":   func() error { return st.SetModeAndConfirm(ctx, "Home", time.Second) },
+		"SubscribeDevice":     func() error { return st.SubscribeDevice("1", nil) },
+		"RampLevel":           func() error { return st.RampLevel(ctx, []string{"1"}, 0, 100, 2, time.Millisecond) },
+		"RefreshScenes":       func() error { return st.RefreshScenes() },
+		"RunScene":            func() error { return st.RunScene("Movie") },
+		"Reconcile":           func() error { return st.Reconcile(ctx, gosmart.Snapshot{}, time.Second, nil) },
+		"Watch":               func() error { _, err := st.Watch(ctx, time.Second); return err },
+		"ExportDOT":           func() error { return st.ExportDOT(&buf) },
+		"ExportSchema":        func() error { return st.ExportSchema(&buf) },
+		"ExportInflux":        func() error { return st.ExportInflux(&buf, "m") },
+		"UpdateConfig":        func() error { return st.UpdateConfig(gosmart.Config{}) },
+		"ApplyState":          func() error { return st.ApplyState([]gosmart.DesiredState{{DeviceID: "1"}})[0] },
+	}
+	for name, call := range calls {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("%s panicked on a zero SmartThings: %v", name, r)
+				}
+			}()
+			if err := call(); !errors.Is(err, gosmart.ErrNotConnected) {
+				t.Errorf("%s on a zero SmartThings = %v, want ErrNotConnected", name, err)
+			}
+		}()
+	}
+
+	// Methods without an error return empty results.
+	others := map[string]func(){
+		"AddAlert":                     func() { st.AddAlert("1", "switch", nil, nil).Cancel() },
+		"WatchPresence":                func() { _, h := st.WatchPresence(); h.Cancel() },
+		"WatchConnectivity":            func() { _, h := st.WatchConnectivity(); h.Cancel() },
+		"EventHandler":                 func() { st.EventHandler(nil) },
+		"Endpoint":                     func() { st.Endpoint() },
+		"InstalledAppID":               func() { st.InstalledAppID(); st.LocationID() },
+		"LatencyPercentiles":           func() { st.LatencyPercentiles() },
+		"Healthy":                      func() { st.Healthy(); st.StopHealthCheck() },
+		"Invalidate":                   func() { st.Invalidate("1"); st.InvalidateAll() },
+		"SetAllowedCommands":           func() { st.SetAllowedCommands(nil) },
+		"GrantedScopes":                func() { st.GrantedScopes() },
+		"RateLimit":                    func() { st.RateLimitStatus(); st.RateLimit() },
+		"ActivityFeed":                 func() { st.ActivityFeed(10) },
+		"DeviceDelta":                  func() { st.DeviceDelta(); st.LastRefresh() },
+		"DevicesWithCapabilityVersion": func() { st.DevicesWithCapabilityVersion("Switch", 1) },
+		"AutoRefresh": func() {
+			st.PauseAutoRefresh()
+			st.ResumeAutoRefresh()
+			st.AutoRefreshPaused()
+			st.StopAutoRefresh()
+		},
+		"Lists": func() {
+			st.DeviceList()
+			st.SceneList()
+			st.AttributeTable()
+			st.PhysicalDevices()
+			st.OverdueDevices()
+			st.BatteryPoweredDevices()
+		},
+		"Select": func() {
+			st.Select().Devices()
+			st.DevicesWithCommand("on")
+			st.DevicesWithCapability("Switch")
+			st.DevicesInRoom("r")
+		},
+		"Batch": func() {
+			st.ForEachSwitch(nil)
+			st.BatchCall(nil, "on")
+			st.CallAll(nil, "on")
+		},
+	}
+	for name, call := range others {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("%s panicked on a zero SmartThings: %v", name, r)
+				}
+			}()
+			call()
+		}()
+	}
+	// The device and scene lists are only reachable through accessors, so
+	// no field of the unset connection state can be read.
+	if devices, scenes := st.DeviceList(), st.SceneList(); len(devices) != 0 || len(scenes) != 0 {
+		t.Errorf("zero SmartThings lists %d devices and %d scenes, want none", len(devices), len(scenes))
+	}
+	if fields := exportedFields(reflect.TypeOf(st)); len(fields) != 0 {
+		t.Errorf("SmartThings exports fields %v, which panic on a zero value", fields)
+	}
+	if ch, _ := st.WatchPresence(); ch != nil {
+		if _, ok := <-ch; ok {
+			t.Error("WatchPresence on a zero SmartThings returned an open channel")
+		}
+	}
+}
+
+// exportedFields returns the names of the exported fields of struct type t,
+// including those promoted from embedded structs (or pointers to them).
+func exportedFields(t reflect.Type) []string {
+	var ret []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				ret = append(ret, exportedFields(ft)...)
+			}
+			continue
+		}
+		if f.PkgPath == "" {
+			ret = append(ret, f.Name)
+		}
+	}
+	return ret
+}
+
+func TestRefresh(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	st := connect(t, s, gosmart.Config{})
+	d := device(t, st, "1")
+	if d.Name != "Dimmer 1" || d.DisplayName != "Lamp 1" {
+		t.Errorf("got name %q, display name %q", d.Name, d.DisplayName)
+	}
+	if v, _ := d.AttributeString("switch"); v != "off" {
+		t.Errorf("switch is %q, want off", v)
+	}
+
+	s.SetAttribute("1", "switch", "on")
+	s.SetAttribute("1", "level", 40.0)
+	if err := st.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if d != device(t, st, "1") {
+		t.Error("Refresh replaced a known device")
+	}
+	if v, _ := d.AttributeString("switch"); v != "on" {
+		t.Errorf("switch is %q after refresh, want on", v)
+	}
+	if got := d.Attribute("level"); got != 40 {
+		t.Errorf("level is %v after refresh, want 40", got)
+	}
+}
+
+func TestCall(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	st := connect(t, s, gosmart.Config{})
+	d := device(t, st, "1")
+	if err := d.Call("on"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Call("setLevel", 75); err != nil {
+		t.Fatal(err)
+	}
+	calls := s.Calls()
+	if len(calls) != 2 || calls[0].Command != "on" || calls[1].Command != "setLevel" || len(calls[1].Args) != 1 || calls[1].Args[0] != "75" {
+		t.Fatalf("server received %+v", calls)
+	}
+	if err := d.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := d.AttributeString("switch"); v != "on" || d.Attribute("level") != 75 {
+		t.Errorf("got switch %q and level %v, want on and 75", v, d.Attribute("level"))
+	}
+}
+
+func TestEscapedDeviceID(t *testing.T) {
+	s := newServer(t, lamp("a/b"))
+	st := connect(t, s, gosmart.Config{})
+	d := device(t, st, "a/b")
+	if err := d.Call("on"); err != nil {
+		t.Fatal(err)
+	}
+	if calls := s.Calls(); len(calls) != 1 || calls[0].DeviceID != "a/b" || calls[0].Command != "on" {
+		t.Errorf("server received %+v", calls)
+	}
+	if err := d.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := d.AttributeString("switch"); v != "on" {
+		t.Errorf("got switch %q, want on", v)
+	}
+	events, err := d.Events(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) == 0 || events[len(events)-1].Value != "on" {
+		t.Errorf("Events() = %+v, want the switch turned on last", events)
+	}
+	if _, err := d.EventsSince("switch", time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCallErrors(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	st := connect(t, s, gosmart.Config{})
+	d := device(t, st, "1")
+
+	if err := d.Call("lock"); !errors.Is(err, gosmart.ErrCommandUnavailable) {
+		t.Errorf("unknown command returned %v, want ErrCommandUnavailable", err)
+	}
+	if err := d.Call("setLevel", 1, 2); err == nil {
+		t.Error("too many arguments accepted")
+	}
+	if len(s.Calls()) != 0 {
+		t.Errorf("invalid calls reached the server: %+v", s.Calls())
+	}
+
+	s.Fail(1, http.StatusInternalServerError, "boom")
+	err := d.Call("on")
+	var herr *gosmart.HTTPError
+	if !errors.As(err, &herr) || herr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("failed call returned %v, want an *HTTPError with status 500", err)
+	}
+
+	s.Fail(1, http.StatusUnauthorized, "")
+	if err := st.Refresh(); !errors.Is(err, gosmart.ErrUnauthorized) {
+		t.Errorf("rejected refresh returned %v, want ErrUnauthorized", err)
+	}
+	s.Fail(1, http.StatusForbidden, "")
+	if err := st.Refresh(); !errors.Is(err, gosmart.ErrForbidden) || errors.Is(err, gosmart.ErrUnauthorized) {
+		t.Errorf("forbidden refresh returned %v, want ErrForbidden only", err)
+	}
+	if err := st.RefreshDevice("nope"); !errors.Is(err, gosmart.ErrDeviceNotFound) {
+		t.Errorf("refreshing an unknown device returned %v, want ErrDeviceNotFound", err)
+	}
+	s.RemoveDevice("1")
+	if err := d.Refresh(); !errors.Is(err, gosmart.ErrDeviceNotFound) {
+		t.Errorf("refreshing a removed device returned %v, want ErrDeviceNotFound", err)
+	}
+}
+
+func TestCallErrorBody(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	st := connect(t, s, gosmart.Config{})
+
+	explanation := `{"error": "invalid level"}` + strings.Repeat(" ", 600) + "end"
+	s.Fail(1, http.StatusBadRequest, explanation)
+	err := device(t, st, "1").Call("setLevel", 50)
+	var herr *gosmart.HTTPError
+	if !errors.As(err, &herr) || herr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("rejected call returned %v, want an *HTTPError with status 400", err)
+	}
+	if string(herr.RawBody) != explanation {
+		t.Errorf("RawBody = %q, want the whole response body", herr.RawBody)
+	}
+	if !strings.HasPrefix(explanation, herr.Body) || !strings.Contains(herr.Body, "invalid level") {
+		t.Errorf("Body = %q, want the beginning of the response body", herr.Body)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	st := connect(t, s, fastRetries(2))
+	d := device(t, st, "1")
+
+	// Reads are retried.
+	s.Fail(2, http.StatusServiceUnavailable, "")
+	if err := st.Refresh(); err != nil {
+		t.Fatalf("refresh not retried: %v", err)
+	}
+
+	// Idempotent commands are retried, keeping their idempotency key.
+	before := len(s.Requests())
+	s.Fail(2, http.StatusBadGateway, "")
+	if err := d.Call("on"); err != nil {
+		t.Fatalf("idempotent command not retried: %v", err)
+	}
+	reqs := s.Requests()[before:]
+	if len(reqs) != 3 {
+		t.Fatalf("got %d requests, want 3", len(reqs))
+	}
+	key := reqs[0].Header.Get("Idempotency-Key")
+	for _, r := range reqs {
+		if r.Header.Get("Idempotency-Key") != key || key == "" {
+			t.Errorf("retry sent idempotency key %q, want %q", r.Header.Get("Idempotency-Key"), key)
+		}
+	}
+
+	// Other commands are sent once.
+	before = len(s.Requests())
+	s.Fail(1, http.StatusServiceUnavailable, "")
+	if err := d.Call("setLevel", 10); err == nil {
+		t.Error("failed command returned no error")
+	}
+	if n := len(s.Requests()) - before; n != 1 {
+		t.Errorf("non-idempotent command sent %d times, want 1", n)
+	}
+
+	// Retries stop once MaxRetries is reached.
+	s.Fail(3, http.StatusServiceUnavailable, "")
+	if err := d.Call("off"); err == nil {
+		t.Error("command succeeded after exhausting the retries")
+	}
+}
+
+// throttled serves /mode on s, replying 429 with the given Retry-After
+// header to the first n requests.
+func throttled(s *gosmarttest.Server, n int, retryAfter string) {
+	var mu sync.Mutex
+	s.HandleFunc("/mode", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		n--
+		fail := n >= 0
+		mu.Unlock()
+		if fail {
+			w.Header().Set("Retry-After", retryAfter)
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		gosmarttest.JSON(gosmart.Mode{ID: "home", Name: "Home"})(w, r)
+	})
+}
+
+func TestRetryBackoff(t *testing.T) {
+	s := newServer(t)
+	cfg := fastRetries(3)
+	cfg.RetryBaseDelay = 10 * time.Millisecond
+	st := connect(t, s, cfg)
+
+	// The delay doubles on every retry: 10ms, 20ms and 40ms.
+	s.Fail(3, http.StatusServiceUnavailable, "")
+	start := time.Now()
+	if _, err := st.CurrentMode(); err == nil {
+		t.Fatal("CurrentMode succeeded without a mode handler")
+	}
+	if elapsed := time.Since(start); elapsed < 70*time.Millisecond {
+		t.Errorf("three retries took %v, want at least 70ms", elapsed)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	s := newServer(t)
+	throttled(s, 1, "1")
+	st := connect(t, s, fastRetries(2))
+
+	// Retry-After overrides the (much shorter) base delay.
+	start := time.Now()
+	if _, err := st.CurrentMode(); err != nil {
+		t.Fatalf("CurrentMode: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, want the 1s asked by Retry-After", elapsed)
+	}
+
+	// RetryMaxDelay caps it.
+	throttled(s, 1, "60")
+	cfg := fastRetries(2)
+	cfg.RetryMaxDelay = 20 * time.Millisecond
+	if err := st.UpdateConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	start = time.Now()
+	if _, err := st.CurrentMode(); err != nil {
+		t.Fatalf("CurrentMode: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("retried after %v, want RetryMaxDelay to cap Retry-After", elapsed)
+	}
+
+	// A cancelled context stops the wait.
+	throttled(s, 1, "60")
+	if err := st.UpdateConfig(fastRetries(2)); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	if _, err := st.CurrentModeContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("CurrentModeContext() = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("cancelled retry took %v", elapsed)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	s := newServer(t, lamp("1"), lamp("2"), lamp("3"), lamp("4"))
+	cfg := fastRetries(5)
+	cfg.RetryBudget = 3
+	st := connect(t, s, cfg)
+	devices := st.DeviceList()
+
+	// A batch stops retrying once the budget is used up, however many
+	// devices fail.
+	before := len(s.Requests())
+	s.Fail(len(devices)+cfg.RetryBudget, http.StatusServiceUnavailable, "")
+	for id, o := range st.BatchCall(devices, "on") {
+		if o.Err == nil {
+			t.Errorf("device %s: command succeeded during the outage", id)
+		}
+	}
+	if n := len(s.Requests()) - before; n != len(devices)+cfg.RetryBudget {
+		t.Errorf("batch sent %d requests, want %d", n, len(devices)+cfg.RetryBudget)
+	}
+
+	// Every operation gets a new budget.
+	for i := 0; i < 2; i++ {
+		s.Fail(cfg.RetryBudget, http.StatusServiceUnavailable, "")
+		if err := st.Refresh(); err != nil {
+			t.Fatalf("refresh %d: %v", i, err)
+		}
+	}
+
+	// Single calls are not limited by the budget.
+	s.Fail(cfg.MaxRetries, http.StatusServiceUnavailable, "")
+	if err := devices[0].Call("on"); err != nil {
+		t.Errorf("call not retried past the budget: %v", err)
+	}
+}
+
+func TestDeviceDelta(t *testing.T) {
+	s := newServer(t, lamp("1"), lamp("2"))
+	st := connect(t, s, gosmart.Config{})
+	if d := st.DeviceDelta(); len(d.Added) != 2 || len(d.Removed) != 0 {
+		t.Errorf("first refresh delta = %+v, want both devices added", d)
+	}
+	kept := device(t, st, "2")
+
+	s.RemoveDevice("1")
+	s.AddDevice(lamp("3"))
+	if err := st.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	d := st.DeviceDelta()
+	if len(d.Added) != 1 || d.Added[0] != "3" || len(d.Removed) != 1 || d.Removed[0] != "1" {
+		t.Errorf("delta = %+v, want 3 added and 1 removed", d)
+	}
+	if device(t, st, "2") != kept {
+		t.Error("the device kept across refreshes changed identity")
+	}
+
+	if err := st.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if d := st.DeviceDelta(); len(d.Added) != 0 || len(d.Removed) != 0 {
+		t.Errorf("delta = %+v after an unchanged refresh, want none", d)
+	}
+}
+
+func TestDeviceDeltaRooms(t *testing.T) {
+	kitchen := lamp("1")
+	kitchen.RoomID = "kitchen"
+	s := newServer(t, kitchen, lamp("2"), lamp("3"))
+	st := connect(t, s, gosmart.Config{})
+	if d := st.DeviceDelta(); len(d.Moved) != 0 {
+		t.Errorf("first refresh reported moves: %+v", d.Moved)
+	}
+
+	// Between rooms, into a room and out of one.
+	s.SetRoom("1", "hall")
+	s.SetRoom("2", "kitchen")
+	if err := st.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	want := []gosmart.RoomChange{
+		{DeviceID: "1", OldRoom: "kitchen", NewRoom: "hall"},
+		{DeviceID: "2", OldRoom: "", NewRoom: "kitchen"},
+	}
+	if d := st.DeviceDelta(); !reflect.DeepEqual(d.Moved, want) {
+		t.Errorf("moved = %+v, want %+v", d.Moved, want)
+	}
+	if room := device(t, st, "1").RoomID(); room != "hall" {
+		t.Errorf("RoomID() = %q, want hall", room)
+	}
+
+	s.SetRoom("2", "")
+	s.AddDevice(lamp("4"))
+	if err := st.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	want = []gosmart.RoomChange{{DeviceID: "2", OldRoom: "kitchen", NewRoom: ""}}
+	if d := st.DeviceDelta(); !reflect.DeepEqual(d.Moved, want) {
+		t.Errorf("moved = %+v, want %+v (new devices are not moves)", d.Moved, want)
+	}
+
+	if err := st.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if d := st.DeviceDelta(); len(d.Moved) != 0 {
+		t.Errorf("moved = %+v after an unchanged refresh, want none", d.Moved)
+	}
+}
+
+func TestPresentation(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	const presentation = `{"dashboard":{"states":[{"capability":"switch"}]}}`
+	s.HandleFunc("/devices/1/presentation", func(w http.ResponseWriter, _ *http.Request) {
+		io.WriteString(w, presentation)
+	})
+	st := connect(t, s, gosmart.Config{})
+	got, err := device(t, st, "1").Presentation()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != presentation {
+		t.Errorf("Presentation() = %s, want %s", got, presentation)
+	}
+
+	s.HandleFunc("/devices/1/presentation", func(w http.ResponseWriter, _ *http.Request) {
+		io.WriteString(w, `{"dashboard":`)
+	})
+	if _, err := device(t, st, "1").Presentation(); err == nil {
+		t.Error("invalid presentation JSON accepted")
+	}
+}
+
+func TestRooms(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	rooms := []gosmart.Room{{ID: "r1", Name: "Kitchen", LocationID: "l1"}, {ID: "r2", Name: "Den", LocationID: "l1"}}
+	s.HandleFunc("/rooms", gosmarttest.JSON(rooms))
+	s.HandleFunc("/locations/l2/rooms", gosmarttest.JSON([]gosmart.Room{{ID: "r3", Name: "Attic", LocationID: "l2"}}))
+	st := connect(t, s, gosmart.Config{})
+
+	got, err := st.Rooms()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, rooms) {
+		t.Errorf("Rooms() = %+v, want %+v", got, rooms)
+	}
+	other, err := gosmart.GetRooms(context.Background(), s.Client(), s.URL, "l2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(other) != 1 || other[0].Name != "Attic" {
+		t.Errorf("GetRooms for another location = %+v", other)
+	}
+}
+
+func TestStringAttributes(t *testing.T) {
+	dev := thermostat("1")
+	dev.Attributes["switch"] = "on"
+	dev.Attributes["lock"] = "locked"
+	dev.Attributes["enabled"] = true
+	dev.Attributes["color"] = map[string]interface{}{"hue": 10.0}
+	dev.Attributes["missing"] = nil
+	s := newServer(t, dev)
+	st := connect(t, s, gosmart.Config{})
+	d := device(t, st, "1")
+
+	want := map[string]string{
+		"temperature":              "20",
+		"heatingSetpoint":          "18",
+		"coolingSetpoint":          "26",
+		"thermostatMode":           "heat",
+		"thermostatOperatingState": "idle",
+		"switch":                   "on",
+		"lock":                     "locked",
+		"enabled":                  "true",
+		"color":                    `{"hue":10}`,
+	}
+	if got := d.StringAttributes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("StringAttributes() = %v, want %v", got, want)
+	}
+	raw := d.RawAttributes()
+	if raw["thermostatMode"] != "heat" || raw["enabled"] != true || raw["temperature"] != 20.0 {
+		t.Errorf("RawAttributes() = %v, want the values as reported", raw)
+	}
+	if v, ok := raw["missing"]; !ok || v != nil {
+		t.Errorf("RawAttributes() lost the null attribute: %v", raw)
+	}
+
+	// The numeric view is kept for compatibility.
+	if d.Attribute("switch") != 1 || d.Attribute("temperature") != 20 {
+		t.Errorf("Attribute() = switch %v, temperature %v; want 1, 20", d.Attribute("switch"), d.Attribute("temperature"))
+	}
+}
+
+func TestBoolAttribute(t *testing.T) {
+	attrs := map[string]interface{}{
+		"switch":   "on",
+		"contact":  "Closed",
+		"motion":   "active",
+		"presence": "not present",
+		"lock":     "unlocked",
+		"enabled":  true,
+		"smoke":    "detected",
+		"water":    "dry",
+		"door":     "jammed",
+		"mode":     "heat",
+		"level":    1.0,
+		"missing":  nil,
+	}
+	s := newServer(t, gosmarttest.Device{ID: "1", Attributes: attrs})
+	st := connect(t, s, gosmart.Config{TruthyValues: map[string]float64{"Jammed": 1}})
+	d := device(t, st, "1")
+
+	cases := []struct {
+		name  string
+		v, ok bool
+	}{
+		{"switch", true, true},
+		{"contact", false, true},
+		{"motion", true, true},
+		{"presence", false, true},
+		{"lock", false, true},
+		{"enabled", true, true},
+		{"smoke", true, true},
+		{"water", false, true},
+		// Added by Config.TruthyValues.
+		{"door", true, true},
+		// Not two-state values, or not reported.
+		{"mode", false, false},
+		{"level", false, false},
+		{"missing", false, false},
+		{"battery", false, false},
+	}
+	for _, c := range cases {
+		if v, ok := d.BoolAttribute(c.name); v != c.v || ok != c.ok {
+			t.Errorf("BoolAttribute(%q) = %v, %v; want %v, %v", c.name, v, ok, c.v, c.ok)
+		}
+	}
+	// The boolean and numeric views of string values agree.
+	for _, c := range cases {
+		if _, ok := attrs[c.name].(string); ok && c.ok && (d.Attribute(c.name) != 0) != c.v {
+			t.Errorf("Attribute(%q) = %v, but BoolAttribute = %v", c.name, d.Attribute(c.name), c.v)
+		}
+	}
+	if v, ok := d.AttributeString("contact"); !ok || v != "Closed" {
+		t.Errorf("AttributeString(contact) = %q, %v; want the raw value", v, ok)
+	}
+	if v, ok := d.AttributeString("level"); !ok || v != "1" {
+		t.Errorf("AttributeString(level) = %q, %v; want 1", v, ok)
+	}
+	for _, name := range []string{"missing", "battery"} {
+		if v, ok := d.AttributeString(name); ok {
+			t.Errorf("AttributeString(%q) = %q, want none", name, v)
+		}
+	}
+}
+
+func TestForceRefresh(t *testing.T) {
+	live := thermostat("1")
+	live.Commands = append(live.Commands, gosmart.DeviceCommand{Command: "refresh", Capability: "Refresh"})
+	s := newServer(t, live, thermostat("2"))
+	s.Handle("refresh", func(d *gosmarttest.Device, _ []string, _ url.Values) {
+		d.Attributes["temperature"] = 23.0
+	})
+	st := connect(t, s, gosmart.Config{})
+
+	d := device(t, st, "1")
+	if err := d.ForceRefresh(); err != nil {
+		t.Fatalf("ForceRefresh: %v", err)
+	}
+	if calls := s.Calls(); len(calls) != 1 || calls[0].Command != "refresh" || calls[0].DeviceID != "1" {
+		t.Errorf("got calls %+v, want a refresh of device 1", calls)
+	}
+	if v := d.Attribute("temperature"); v != 23 {
+		t.Errorf("temperature = %v after ForceRefresh, want 23", v)
+	}
+
+	// Devices without a refresh command are only re-read.
+	s.SetAttribute("2", "temperature", 21.0)
+	d = device(t, st, "2")
+	if err := d.ForceRefresh(); err != nil {
+		t.Fatalf("ForceRefresh: %v", err)
+	}
+	if n := len(s.Calls()); n != 1 {
+		t.Errorf("got %d calls, want no new ones", n)
+	}
+	if v := d.Attribute("temperature"); v != 21 {
+		t.Errorf("temperature = %v after ForceRefresh, want 21", v)
+	}
+}
+
+func TestAttributeTable(t *testing.T) {
+	s := newServer(t, lamp("1"), thermostat("2"))
+	st := connect(t, s, gosmart.Config{})
+	if err := device(t, st, "1").Call("setLevel", 30); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	table := st.AttributeTable()
+	if len(table) != 2 {
+		t.Fatalf("AttributeTable() has %d devices, want 2: %v", len(table), table)
+	}
+	if got := table["1"]["level"]; got != 30 {
+		t.Errorf("lamp level = %v, want 30", got)
+	}
+	want := map[string]float64{"temperature": 20, "heatingSetpoint": 18, "coolingSetpoint": 26}
+	for k, v := range want {
+		if got, ok := table["2"][k]; !ok || got != v {
+			t.Errorf("thermostat %s = %v (present %v), want %v", k, got, ok, v)
+		}
+	}
+	table["1"]["level"] = 99
+	if device(t, st, "1").Attribute("level") != 30 {
+		t.Error("changing the table changed the device")
+	}
+}
+
+func TestAttributeSnapshot(t *testing.T) {
+	const spread = 8.0
+	s := newServer(t, thermostat("1"))
+	st := connect(t, s, gosmart.Config{})
+	d := device(t, st, "1")
+
+	done := make(chan error)
+	go func() {
+		for i := 0; i < 100; i++ {
+			th := thermostat("1")
+			th.Attributes["heatingSetpoint"] = float64(i)
+			th.Attributes["coolingSetpoint"] = float64(i) + spread
+			s.AddDevice(th)
+			if err := st.Refresh(); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	for {
+		snap := d.AttributeSnapshot("heatingSetpoint", "coolingSetpoint", "missing")
+		if len(snap) != 2 {
+			t.Fatalf("snapshot = %v, want both setpoints only", snap)
+		}
+		if got := snap["coolingSetpoint"] - snap["heatingSetpoint"]; got != spread {
+			t.Fatalf("snapshot %v mixes two refreshes", snap)
+		}
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+			if snap := d.AttributeSnapshot("heatingSetpoint"); snap["heatingSetpoint"] != 99 {
+				t.Errorf("last snapshot = %v, want the last refresh", snap)
+			}
+			return
+		default:
+		}
+	}
+}
+
+func TestChildren(t *testing.T) {
+	hub := gosmarttest.Device{ID: "h", Name: "Multi Sensor", DisplayName: "Hallway"}
+	left, right := lamp("c1"), lamp("c2")
+	left.ParentID, right.ParentID = "h", "h"
+	s := newServer(t, hub, left, right, lamp("x"))
+	st := connect(t, s, gosmart.Config{})
+
+	h := device(t, st, "h")
+	if id, ok := h.ParentID(); ok {
+		t.Errorf("hub has parent %q", id)
+	}
+	kids := h.Children()
+	if len(kids) != 2 || kids[0].ID != "c1" || kids[1].ID != "c2" {
+		t.Fatalf("hub children = %v, want c1 and c2", kids)
+	}
+	for _, k := range kids {
+		if id, ok := k.ParentID(); !ok || id != "h" {
+			t.Errorf("child %s parent = %q, %v; want h", k.ID, id, ok)
+		}
+		if len(k.Children()) != 0 {
+			t.Errorf("child %s has children", k.ID)
+		}
+	}
+	if len(device(t, st, "x").Children()) != 0 {
+		t.Error("standalone device has children")
+	}
+
+	// Children are rebuilt on every refresh.
+	s.RemoveDevice("c2")
+	if err := st.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if kids := h.Children(); len(kids) != 1 || kids[0].ID != "c1" {
+		t.Errorf("hub children after removing c2 = %v, want c1", kids)
+	}
+}
+
+func TestMalformedAttribute(t *testing.T) {
+	s := newServer(t, lamp("1"), lamp("2"))
+	s.HandleFunc("/devices/1", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"id": "1", "name": "Dimmer 1", "displayName": "Lamp 1",
+			"attributes": {"switch": "on", "level": 40, "power": 1e999}}`)
+	})
+	s.HandleFunc("/devices/2", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"id": "2", "name": "Dimmer 2", "displayName": "Lamp 2", "attributes": ["on"]}`)
+	})
+	log := &logger{}
+	st := connect(t, s, gosmart.Config{Logger: log})
+
+	d := device(t, st, "1")
+	if d.Attribute("switch") != 1 || d.Attribute("level") != 40 {
+		t.Errorf("valid attributes lost: %v", d.Attributes())
+	}
+	if _, ok := d.Attributes()["power"]; ok {
+		t.Error("malformed attribute kept")
+	}
+	if len(log.logged(`malformed attribute "power" for device 1`)) != 1 {
+		t.Errorf("malformed attribute not logged: %q", log.lines)
+	}
+
+	// A malformed attributes object still keeps the device.
+	if d := device(t, st, "2"); d.DisplayName != "Lamp 2" || len(d.Attributes()) != 0 {
+		t.Errorf("device 2 = %q with %v", d.DisplayName, d.Attributes())
+	}
+	if len(log.logged("malformed attributes for device 2")) != 1 {
+		t.Errorf("malformed attributes not logged: %q", log.lines)
+	}
+}
+
+func TestCommandErrorEnvelope(t *testing.T) {
+	cases := []struct {
+		body string
+		msg  string
+	}{
+		{`{"error": "device offline"}`, "device offline"},
+		{`{"error": {"code": 42, "message": "hub unreachable"}}`, "hub unreachable"},
+		{`{"error": true, "message": "rejected"}`, "rejected"},
+		{`{"error": true}`, "unknown error"},
+		{`{"error": false}`, ""},
+		{`{"error": ""}`, ""},
+		{`{}`, ""},
+		{`not json`, ""},
+	}
+	for _, c := range cases {
+		s := newServer(t, lamp("1"))
+		body := c.body
+		s.HandleFunc("/devices/1/on", func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, body)
+		})
+		st := connect(t, s, gosmart.Config{})
+
+		err := device(t, st, "1").Call("on")
+		var ce *gosmart.CommandError
+		switch {
+		case c.msg == "" && err != nil:
+			t.Errorf("%s: Call() = %v, want success", c.body, err)
+		case c.msg != "" && !errors.As(err, &ce):
+			t.Errorf("%s: Call() = %v, want a *CommandError", c.body, err)
+		case c.msg != "" && (ce.Message != c.msg || ce.DeviceID != "1" || ce.Command != "on"):
+			t.Errorf("%s: error = %+v, want message %q", c.body, ce, c.msg)
+		}
+	}
+}
+
+func TestRawDeviceCommands(t *testing.T) {
+	const raw = `[{"command":"on","params":{},"capability":"Switch","x-vendor":{"since":"2016"}}]`
+	s := newServer(t, lamp("1"))
+	st := connect(t, s, gosmart.Config{})
+	s.HandleFunc("/devices/1/commands", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, raw)
+	})
+
+	got, err := st.RawDeviceCommands("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != raw {
+		t.Errorf("RawDeviceCommands() = %s, want %s", got, raw)
+	}
+	if _, err := st.RawDeviceCommands("9"); err == nil {
+		t.Error("RawDeviceCommands succeeded for an unknown device")
+	}
+}
+
+// truncating returns a handler announcing body but closing the connection
+// halfway through it, the first n times it is called.
+func truncating(n int, body string) http.HandlerFunc {
+	var mu sync.Mutex
+	return func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		cut := n > 0
+		n--
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+		if !cut {
+			io.WriteString(w, body)
+			return
+		}
+		io.WriteString(w, body[:len(body)/2])
+		w.(http.Flusher).Flush()
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}
+}
+
+func TestTruncatedResponse(t *testing.T) {
+	const body = `[{"id": "r1", "name": "Kitchen", "locationId": "l1"}]`
+	s := newServer(t, lamp("1"))
+
+	st := connect(t, s, gosmart.Config{})
+	s.HandleFunc("/rooms", truncating(1, body))
+	if _, err := st.Rooms(); !errors.Is(err, gosmart.ErrTruncatedResponse) {
+		t.Errorf("Rooms() on a truncated response = %v, want ErrTruncatedResponse", err)
+	}
+
+	// Truncated responses are retried.
+	st = connect(t, s, fastRetries(2))
+	s.HandleFunc("/rooms", truncating(2, body))
+	rooms, err := st.Rooms()
+	if err != nil || len(rooms) != 1 || rooms[0].Name != "Kitchen" {
+		t.Errorf("Rooms() = %+v, %v; want the kitchen after retrying", rooms, err)
+	}
+}
+
+func TestMaxResponseBytes(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	st := connect(t, s, gosmart.Config{MaxResponseBytes: 1024})
+	// rooms serves a room list of about n bytes.
+	rooms := func(n int) {
+		body := `[{"id": "r1", "name": "` + strings.Repeat("x", n) + `"}]`
+		s.HandleFunc("/rooms", func(w http.ResponseWriter, _ *http.Request) {
+			io.WriteString(w, body)
+		})
+	}
+
+	rooms(900)
+	if _, err := st.Rooms(); err != nil {
+		t.Errorf("response within the limit: %v", err)
+	}
+	rooms(1100)
+	before := len(s.Requests())
+	if _, err := st.Rooms(); !errors.Is(err, gosmart.ErrResponseTooLarge) {
+		t.Errorf("response over the limit returned %v, want ErrResponseTooLarge", err)
+	}
+	if n := len(s.Requests()) - before; n != 1 {
+		t.Errorf("response over the limit requested %d times, want 1", n)
+	}
+
+	// Device details are checked too.
+	s.SetAttribute("1", "label", strings.Repeat("x", 2000))
+	if err := device(t, st, "1").Refresh(); !errors.Is(err, gosmart.ErrResponseTooLarge) {
+		t.Errorf("Refresh() of a large device = %v, want ErrResponseTooLarge", err)
+	}
+}
+
+func TestGzipResponse(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	// The client does not ask for gzip, so the transport leaves decoding
+	// it to gosmart.
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	st := connect(t, s, gosmart.Config{HTTPClient: client, MaxResponseBytes: 1024})
+	// rooms serves a gzip encoded room list of about n bytes.
+	rooms := func(n int) {
+		body := `[{"id": "r1", "name": "` + strings.Repeat("x", n) + `"}]`
+		s.HandleFunc("/rooms", func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Encoding", "gzip")
+			zw := gzip.NewWriter(w)
+			io.WriteString(zw, body)
+			zw.Close()
+		})
+	}
+
+	rooms(900)
+	got, err := st.Rooms()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ID != "r1" || len(got[0].Name) != 900 {
+		t.Errorf("Rooms() = %+v, want the decoded room", got)
+	}
+	// The limit applies to the decoded body, not to what was sent.
+	rooms(100000)
+	if _, err := st.Rooms(); !errors.Is(err, gosmart.ErrResponseTooLarge) {
+		t.Errorf("gzip response decoding over the limit returned %v, want ErrResponseTooLarge", err)
+	}
+
+	s.HandleFunc("/rooms", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		io.WriteString(w, "this is not gzip encoded")
+	})
+	if _, err := st.Rooms(); err == nil || !strings.Contains(err.Error(), "gzip") {
+		t.Errorf("corrupt gzip response returned %v", err)
+	}
+}
+
+func TestContextVariants(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	st := connect(t, s, gosmart.Config{CallbackURL: "https://example.com/events", CallbackSecret: "s3cret"})
+	d := device(t, st, "1")
+	s.SetDelay(time.Minute)
+
+	calls := map[string]func(context.Context) error{
+		"RefreshDeviceContext":   func(ctx context.Context) error { return st.RefreshDeviceContext(ctx, "1") },
+		"RefreshCommandsContext": func(ctx context.Context) error { return d.RefreshCommandsContext(ctx) },
+		"RoomsContext": func(ctx context.Context) error {
+			_, err := st.RoomsContext(ctx)
+			return err
+		},
+		"PresentationContext": func(ctx context.Context) error {
+			_, err := d.PresentationContext(ctx)
+			return err
+		},
+		"CallResultContext": func(ctx context.Context) error {
+			_, err := d.CallResultContext(ctx, "setLevel", 10)
+			return err
+		},
+		"CallIdempotentContext": func(ctx context.Context) error { return d.CallIdempotentContext(ctx, "on") },
+		"CallStringContext":     func(ctx context.Context) error { return d.CallStringContext(ctx, "setLevel", "20") },
+		"CallNamedContext": func(ctx context.Context) error {
+			return d.CallNamedContext(ctx, "setLevel", map[string]interface{}{"level": 30})
+		},
+		"CallWithArgsContext": func(ctx context.Context) error { return d.CallWithArgsContext(ctx, "setLevel", 40) },
+		"EventsContext": func(ctx context.Context) error {
+			_, err := d.EventsContext(ctx, 10)
+			return err
+		},
+		"EventsSinceContext": func(ctx context.Context) error {
+			_, err := d.EventsSinceContext(ctx, "", time.Now().Add(-time.Hour))
+			return err
+		},
+		"HubLocalAddressContext": func(ctx context.Context) error {
+			_, err := st.HubLocalAddressContext(ctx)
+			return err
+		},
+		"LocationsContext": func(ctx context.Context) error {
+			_, err := st.LocationsContext(ctx)
+			return err
+		},
+		"LocationContext": func(ctx context.Context) error {
+			_, err := st.LocationContext(ctx)
+			return err
+		},
+		"LocationGeoContext": func(ctx context.Context) error {
+			_, _, err := st.LocationGeoContext(ctx)
+			return err
+		},
+		"InstalledAppConfigContext": func(ctx context.Context) error {
+			_, err := st.InstalledAppConfigContext(ctx)
+			return err
+		},
+		"SubscribeDeviceContext": func(ctx context.Context) error { return st.SubscribeDeviceContext(ctx, "1", nil) },
+		"CustomDataContext": func(ctx context.Context) error {
+			_, err := d.CustomDataContext(ctx)
+			return err
+		},
+		"SetCustomDataContext": func(ctx context.Context) error { return d.SetCustomDataContext(ctx, "k", 1) },
+		"PreferencesContext": func(ctx context.Context) error {
+			_, err := d.PreferencesContext(ctx)
+			return err
+		},
+		"SetPreferenceContext": func(ctx context.Context) error { return d.SetPreferenceContext(ctx, "k", 1) },
+		"HealthContext": func(ctx context.Context) error {
+			_, err := d.HealthContext(ctx)
+			return err
+		},
+		"GroupsContext": func(ctx context.Context) error {
+			_, err := st.GroupsContext(ctx)
+			return err
+		},
+		"RefreshScenesContext": func(ctx context.Context) error { return st.RefreshScenesContext(ctx) },
+	}
+	for name, call := range calls {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		start := time.Now()
+		if err := call(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s() = %v, want context.DeadlineExceeded", name, err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("%s took %v, want it cut short by ctx", name, elapsed)
+		}
+		cancel()
+	}
+}
+
+func TestRefreshConcurrentReads(t *testing.T) {
+	s := newServer(t, lamp("1"), lamp("2"))
+	st := connect(t, s, gosmart.Config{})
+	d := device(t, st, "1")
+
+	done := make(chan error)
+	go func() {
+		for i := 0; i < 50; i++ {
+			l := lamp("1")
+			l.DisplayName = fmt.Sprintf("Lamp %d", i)
+			s.AddDevice(l)
+			if err := st.Refresh(); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("refresh: %v", err)
+			}
+			if _, name := d.Names(); name != "Lamp 49" {
+				t.Errorf("display name = %q after the refreshes, want Lamp 49", name)
+			}
+			return
+		default:
+		}
+		if !d.HasCommand("on") || len(d.CommandList()) != 3 || len(d.CommandParams("setLevel")) != 1 {
+			t.Fatal("commands missing during a refresh")
+		}
+		if _, ok := d.CommandCapability("on"); !ok {
+			t.Fatal("command capability missing during a refresh")
+		}
+		d.Names()
+		d.Children()
+		d.ParentID()
+		if err := d.Call("on"); err != nil {
+			t.Fatalf("call during a refresh: %v", err)
+		}
+	}
+}
+
+func TestRefreshConcurrentListing(t *testing.T) {
+	s := newServer(t, lamp("1"), lamp("2"), thermostat("3"))
+	st := connect(t, s, gosmart.Config{})
+
+	done := make(chan error)
+	go func() {
+		for i := 0; i < 30; i++ {
+			if err := st.Refresh(); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("refresh: %v", err)
+			}
+			return
+		default:
+		}
+		if n := len(st.DeviceList()); n != 3 {
+			t.Fatalf("got %d devices during a refresh, want 3", n)
+		}
+		if _, err := st.DeviceByName("Lamp 2"); err != nil {
+			t.Fatalf("DeviceByName during a refresh: %v", err)
+		}
+		if err := st.ExportSchema(ioutil.Discard); err != nil {
+			t.Fatalf("ExportSchema during a refresh: %v", err)
+		}
+		for _, d := range st.DeviceList() {
+			_ = d.String()
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"time"
+)
+
+// AttributeDetail holds an attribute together with the metadata reported
+// with it. Attributes may be reported either as plain values or as objects
+// with "value", "unit", "timestamp" (or "date", "lastUpdated") and "data"
+// keys; only the latter carry metadata.
+type AttributeDetail struct {
+	Name string
+	// Value is the attribute value, as decoded from the API response.
+	Value interface{}
+	// Unit is the unit of the value (e.g. "F", "%"). Blank if not reported.
+	Unit string
+	// Timestamp is the time the value was reported. Zero if not reported.
+	Timestamp time.Time
+	// Data holds any additional data reported with the value.
+	Data map[string]interface{}
+}
+
+// AttributeDetail returns the named attribute with its metadata, as read by
+// the last refresh. Returns false if the device does not report it.
+func (d *Device) AttributeDetail(name string) (AttributeDetail, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.info == nil {
+		return AttributeDetail{}, false
+	}
+	ad, ok := d.info.details[name]
+	return ad, ok
+}
+
+// attributeDetail decodes one attribute value. Objects with a "value" key
+// are taken as values with metadata.
+func attributeDetail(name string, v interface{}) AttributeDetail {
+	ad := AttributeDetail{Name: name, Value: v}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return ad
+	}
+	value, ok := m["value"]
+	if !ok {
+		return ad
+	}
+	ad.Value = value
+	ad.Unit, _ = m["unit"].(string)
+	for _, k := range []string{"timestamp", "date", "lastUpdated"} {
+		if t, ok := parseTime(m[k]); ok {
+			ad.Timestamp = t
+			break
+		}
+	}
+	ad.Data, _ = m["data"].(map[string]interface{})
+	return ad
+}
+
+// AttributeTime returns the time the named attribute was last reported, as
+// read by the last refresh or pushed event (see EventHandler). Returns false
+// if the API did not report a timestamp for it.
+func (d *Device) AttributeTime(name string) (time.Time, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	t, ok := d.times[name]
+	return t, ok
+}
+
+// attributeTimes returns the timestamps found in details, keyed by
+// attribute name.
+func attributeTimes(details map[string]AttributeDetail) map[string]time.Time {
+	ret := make(map[string]time.Time)
+	for name, ad := range details {
+		if !ad.Timestamp.IsZero() {
+			ret[name] = ad.Timestamp
+		}
+	}
+	return ret
+}
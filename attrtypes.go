@@ -0,0 +1,155 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"strconv"
+	"strings"
+)
+
+// AttributeType describes an attribute declared by the capabilities of a
+// device, as reported in the supportedAttributes field of the device info.
+type AttributeType struct {
+	Name string `json:"name"`
+	// DataType is the declared type (e.g. "ENUM", "NUMBER", "STRING").
+	DataType string `json:"dataType"`
+	// Values lists the allowed values of ENUM attributes.
+	Values []string `json:"values,omitempty"`
+}
+
+// AttributeType returns the declared type of the named attribute. Returns
+// false if the API did not report it.
+func (d *Device) AttributeType(name string) (AttributeType, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.info == nil {
+		return AttributeType{}, false
+	}
+	return findAttributeType(d.info.SupportedAttributes, name)
+}
+
+// HasAttribute returns true if the device supports the named attribute: it
+// is declared in the supported attributes of the device, or currently
+// reported. Unlike checking Attributes, this is true for supported
+// attributes that have no value yet.
+func (d *Device) HasAttribute(name string) bool {
+	if _, ok := d.AttributeType(name); ok {
+		return true
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.raw[name]
+	return ok
+}
+
+// findAttributeType returns the entry for the named attribute in types.
+func findAttributeType(types []AttributeType, name string) (AttributeType, bool) {
+	for _, t := range types {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return AttributeType{}, false
+}
+
+// DefaultTruthyValues maps the two-state attribute values to the numbers
+// stored in the attributes map. Config.TruthyValues overrides or extends it.
+var DefaultTruthyValues = map[string]float64{
+	"on":          1,
+	"off":         0,
+	"open":        1,
+	"closed":      0,
+	"active":      1,
+	"inactive":    0,
+	"present":     1,
+	"not present": 0,
+	"locked":      1,
+	"unlocked":    0,
+	"detected":    1,
+	"clear":       0,
+	"wet":         1,
+	"dry":         0,
+	"true":        1,
+	"false":       0,
+}
+
+// truthyValues returns DefaultTruthyValues merged with Config.TruthyValues,
+// with lowercase keys.
+func (st *SmartThings) truthyValues() map[string]float64 {
+	extra := st.config().TruthyValues
+	if len(extra) == 0 {
+		return DefaultTruthyValues
+	}
+	ret := make(map[string]float64)
+	for k, v := range DefaultTruthyValues {
+		ret[k] = v
+	}
+	for k, v := range extra {
+		ret[strings.ToLower(k)] = v
+	}
+	return ret
+}
+
+// numericAttributes converts raw attribute values to the numbers kept in the
+// attributes map, using the declared attribute types and the truthy table.
+// Values of unsupported types are passed to unhandled, if not nil.
+func numericAttributes(raw map[string]interface{}, types []AttributeType, truthy map[string]float64, unhandled func(name string, v interface{})) map[string]float64 {
+	ret := make(map[string]float64)
+	for k, v := range raw {
+		switch t := v.(type) {
+		default:
+			if unhandled != nil {
+				unhandled(k, t)
+			}
+		case float64:
+			ret[k] = t
+		case string:
+			at, typed := findAttributeType(types, k)
+			if f, ok := numericValue(t, at, typed, truthy); ok {
+				ret[k] = f
+			}
+		}
+	}
+	return ret
+}
+
+// numericValue converts a string attribute value to the number stored in
+// the attributes map. Without type information, values found in truthy map
+// to their number and anything else to 0. When the type is declared, only
+// enums whose values are all listed in truthy are coerced that way; numbers
+// are parsed, and other strings (including other enums, even two-state
+// ones such as "heat"/"cool") are not stored as numbers at all.
+func numericValue(v string, t AttributeType, typed bool, truthy map[string]float64) (float64, bool) {
+	f := truthy[strings.ToLower(v)]
+	if !typed {
+		return f, true
+	}
+	switch strings.ToUpper(t.DataType) {
+	case "ENUM":
+		if allTruthy(t.Values, truthy) {
+			return f, true
+		}
+	case "NUMBER", "DECIMAL", "INTEGER":
+		if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			return f, true
+		}
+	}
+	return 0, false
+}
+
+// allTruthy returns true if all values are listed in truthy.
+func allTruthy(values []string, truthy map[string]float64) bool {
+	if len(values) == 0 {
+		return false
+	}
+	for _, v := range values {
+		if _, ok := truthy[strings.ToLower(v)]; !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,114 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"testing"
+
+	"github.com/smoogle/gosmart"
+	"github.com/smoogle/gosmart/gosmarttest"
+)
+
+func TestDeclaredAttributeTypes(t *testing.T) {
+	attrs := map[string]interface{}{
+		"switch":         "on",
+		"thermostatMode": "off",
+		"level":          "42",
+		"status":         "active",
+		"fanMode":        "cool",
+		"battery":        80.0,
+	}
+	typed := gosmarttest.Device{
+		ID:         "1",
+		Attributes: attrs,
+		AttributeTypes: []gosmart.AttributeType{
+			{Name: "switch", DataType: "ENUM", Values: []string{"on", "off"}},
+			{Name: "thermostatMode", DataType: "ENUM", Values: []string{"heat", "cool", "off"}},
+			{Name: "level", DataType: "NUMBER"},
+			{Name: "status", DataType: "STRING"},
+			{Name: "fanMode", DataType: "ENUM", Values: []string{"heat", "cool"}},
+			{Name: "contact", DataType: "ENUM", Values: []string{"open", "closed"}},
+		},
+	}
+	untyped := gosmarttest.Device{ID: "2", Attributes: attrs}
+	s := newServer(t, typed, untyped)
+	st := connect(t, s, gosmart.Config{})
+
+	// Only enums of truthy values are coerced; the three-state mode is not
+	// stored as a number at all, even though "off" is a truthy value, and
+	// neither is the two-state fan mode, whose values are not truthy.
+	got := device(t, st, "1").Attributes()
+	want := map[string]float64{"switch": 1, "level": 42, "battery": 80}
+	if len(got) != len(want) {
+		t.Errorf("Attributes() = %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if f, ok := got[k]; !ok || f != v {
+			t.Errorf("%s = %v (present %v), want %v", k, f, ok, v)
+		}
+	}
+	if v, ok := device(t, st, "1").AttributeString("thermostatMode"); !ok || v != "off" {
+		t.Errorf("AttributeString(thermostatMode) = %q, %v; want the raw value", v, ok)
+	}
+
+	// Declared but unreported attributes are supported, with no value.
+	d := device(t, st, "1")
+	if at, ok := d.AttributeType("thermostatMode"); !ok || at.DataType != "ENUM" || len(at.Values) != 3 {
+		t.Errorf("AttributeType(thermostatMode) = %+v, %v", at, ok)
+	}
+	if !d.HasAttribute("contact") || d.HasAttribute("humidity") {
+		t.Error("HasAttribute does not follow the declared attributes")
+	}
+
+	// Without declared types, every string is coerced with the truthy
+	// table, as before.
+	got = device(t, st, "2").Attributes()
+	want = map[string]float64{"switch": 1, "thermostatMode": 0, "level": 0, "status": 1, "fanMode": 0, "battery": 80}
+	for k, v := range want {
+		if f, ok := got[k]; !ok || f != v {
+			t.Errorf("untyped %s = %v (present %v), want %v", k, f, ok, v)
+		}
+	}
+	if _, ok := device(t, st, "2").AttributeType("switch"); ok {
+		t.Error("AttributeType reported for a device without declared types")
+	}
+}
+
+func TestHasAttribute(t *testing.T) {
+	sensor := gosmarttest.Device{
+		ID:         "1",
+		Attributes: map[string]interface{}{"temperature": 0.0, "battery": 80.0},
+		AttributeTypes: []gosmart.AttributeType{
+			{Name: "temperature", DataType: "NUMBER"},
+			{Name: "humidity", DataType: "NUMBER"},
+		},
+	}
+	s := newServer(t, sensor)
+	st := connect(t, s, gosmart.Config{})
+	d := device(t, st, "1")
+
+	cases := map[string]bool{
+		"temperature": true, // declared and reported (as zero)
+		"humidity":    true, // declared, no value yet
+		"battery":     true, // reported without a declaration
+		"contact":     false,
+	}
+	for name, want := range cases {
+		if got := d.HasAttribute(name); got != want {
+			t.Errorf("HasAttribute(%q) = %v, want %v", name, got, want)
+		}
+	}
+	// Both read as zero; only HasAttribute tells them apart.
+	if d.Attribute("humidity") != 0 || d.Attribute("contact") != 0 {
+		t.Error("unreported attributes do not read as zero")
+	}
+
+	var unattached gosmart.Device
+	if unattached.HasAttribute("temperature") {
+		t.Error("HasAttribute true on a device never refreshed")
+	}
+}
@@ -0,0 +1,295 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"errors"
+	"golang.org/x/net/context"
+	"time"
+)
+
+// StartAutoRefresh starts a background goroutine that calls Refresh every
+// interval. Errors returned by Refresh are passed to onError, if not nil.
+// Only one auto-refresh loop may run at a time.
+//
+// If Config.AttributeIntervals is set, the loop instead refreshes each
+// device only when one of its attributes is due, according to the interval
+// configured for that attribute (attributes not listed use interval). In
+// this mode the device list is re-read every interval, and all devices are
+// refreshed when some were added or removed.
+//
+// If Config.DevicePriority is set, devices are likewise refreshed only when
+// due, polling high priority devices more often (the loop ticks as often as
+// the highest priority demands). Priorities are read when the loop starts.
+func (st *SmartThings) StartAutoRefresh(interval time.Duration, onError func(error)) error {
+	if err := st.connected(); err != nil {
+		return err
+	}
+	if interval <= 0 {
+		return errors.New("auto-refresh interval must be positive")
+	}
+
+	st.arMu.Lock()
+	defer st.arMu.Unlock()
+	if st.arStop != nil {
+		return errors.New("auto-refresh already running")
+	}
+	st.arStop = make(chan struct{})
+	st.arDone = make(chan struct{})
+	st.arPaused = false
+	go st.autoRefresh(interval, onError, st.arStop, st.arDone)
+	return nil
+}
+
+// StopAutoRefresh stops the background auto-refresh loop, if running,
+// cancelling any refresh in progress, and waits for the loop to exit. It
+// must not be called from onError.
+func (st *SmartThings) StopAutoRefresh() {
+	if st.smartThings == nil {
+		return
+	}
+	st.arMu.Lock()
+	stop, done := st.arStop, st.arDone
+	st.arStop, st.arDone = nil, nil
+	st.arMu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+// PauseAutoRefresh temporarily stops the auto-refresh loop from issuing
+// requests. The loop itself keeps running and can be resumed with
+// ResumeAutoRefresh.
+func (st *SmartThings) PauseAutoRefresh() {
+	if st.smartThings == nil {
+		return
+	}
+	st.arMu.Lock()
+	defer st.arMu.Unlock()
+	st.arPaused = true
+}
+
+// ResumeAutoRefresh resumes a loop paused by PauseAutoRefresh.
+func (st *SmartThings) ResumeAutoRefresh() {
+	if st.smartThings == nil {
+		return
+	}
+	st.arMu.Lock()
+	defer st.arMu.Unlock()
+	st.arPaused = false
+}
+
+// AutoRefreshPaused returns true if the auto-refresh loop is paused.
+func (st *SmartThings) AutoRefreshPaused() bool {
+	if st.smartThings == nil {
+		return false
+	}
+	st.arMu.Lock()
+	defer st.arMu.Unlock()
+	return st.arPaused
+}
+
+// autoRefresh implements the auto-refresh loop. It runs until stop is closed,
+// and closes done when it exits.
+func (st *SmartThings) autoRefresh(interval time.Duration, onError func(error), stop, done chan struct{}) {
+	defer close(done)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	tick := interval
+	for _, p := range st.config().DevicePriority {
+		if t := scaleInterval(interval, p); t < tick {
+			tick = t
+		}
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	listed := time.Now()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if st.AutoRefreshPaused() {
+				continue
+			}
+			var err error
+			cfg := st.config()
+			switch {
+			case len(cfg.AttributeIntervals) == 0 && len(cfg.DevicePriority) == 0:
+				err = st.RefreshContext(ctx)
+			case time.Since(listed)+tick/2 >= interval:
+				// Pick up the devices added or removed.
+				listed = time.Now()
+				var changed bool
+				changed, err = st.devicesChanged(ctx)
+				if err == nil && changed {
+					err = st.RefreshContext(ctx)
+				} else if err == nil {
+					err = st.refreshDue(ctx, interval, tick)
+				}
+			default:
+				err = st.refreshDue(ctx, interval, tick)
+			}
+			if err != nil && ctx.Err() == nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// Poll refreshes all devices every interval, calling onUpdate after each
+// successful refresh, until ctx is cancelled or onUpdate returns an error. If
+// onError is not nil, refresh errors are passed to it and polling continues;
+// otherwise the first refresh error stops the loop. Poll blocks until the
+// loop stops, and returns the error that stopped it (ctx.Err() when
+// cancelled).
+func (st *SmartThings) Poll(ctx context.Context, interval time.Duration, onUpdate func(*SmartThings) error, onError func(error)) error {
+	if interval <= 0 {
+		return errors.New("poll interval must be positive")
+	}
+	if err := st.connected(); err != nil {
+		return err
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		if err := st.RefreshContext(ctx); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if onError == nil {
+				return err
+			}
+			onError(err)
+			continue
+		}
+		if onUpdate != nil {
+			if err := onUpdate(st); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// refreshDue refreshes the devices due for a refresh. Interval is the
+// auto-refresh interval, used for attributes without a configured interval,
+// and tick the period of the loop. Returns the first error found.
+func (st *SmartThings) refreshDue(ctx context.Context, interval, tick time.Duration) error {
+	ctx = st.withRetryBudget(ctx)
+
+	var ret error
+	now := time.Now()
+	for _, d := range st.DeviceList() {
+		if !d.due(now, interval, tick) {
+			continue
+		}
+		if err := d.RefreshContext(ctx); err != nil && ret == nil {
+			ret = err
+		}
+	}
+	return ret
+}
+
+// devicesChanged re-reads the device list and returns true if devices were
+// added or removed since the last refresh.
+func (st *SmartThings) devicesChanged(ctx context.Context) (bool, error) {
+	list, err := st.listDevices(ctx)
+	if err != nil {
+		return false, err
+	}
+	known := make(map[string]bool)
+	for _, d := range st.DeviceList() {
+		known[d.ID] = true
+	}
+	for _, dl := range list {
+		if !known[dl.ID] {
+			return true, nil
+		}
+		delete(known, dl.ID)
+	}
+	return len(known) > 0, nil
+}
+
+// due returns true if the device must be refreshed at time now. A device is
+// due when the shortest interval among its attributes (interval for those
+// not configured), scaled by the device priority, has elapsed since its last
+// refresh. Half a tick of slack absorbs ticker jitter.
+func (d *Device) due(now time.Time, interval, tick time.Duration) bool {
+	cfg := d.st.config()
+	intervals := cfg.AttributeIntervals
+	priority := d.priority(cfg.DevicePriority)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.lastRefresh.IsZero() {
+		return true
+	}
+	min := time.Duration(0)
+	for name := range d.attributes {
+		iv, ok := intervals[name]
+		if !ok || iv <= 0 {
+			iv = interval
+		}
+		if min == 0 || iv < min {
+			min = iv
+		}
+	}
+	if min == 0 {
+		min = interval
+	}
+	return now.Sub(d.lastRefresh)+tick/2 >= scaleInterval(min, priority)
+}
+
+// priority returns the polling priority of the device, from priorities keyed
+// by device ID or capability name.
+func (d *Device) priority(priorities map[string]int) int {
+	if p, ok := priorities[d.ID]; ok {
+		return p
+	}
+	ret, found := 0, false
+	for name, p := range priorities {
+		if (!found || p > ret) && d.HasCapability(name) {
+			ret, found = p, true
+		}
+	}
+	return ret
+}
+
+// scaleInterval halves interval for each priority step above zero and
+// doubles it for each step below.
+func scaleInterval(interval time.Duration, priority int) time.Duration {
+	const maxSteps = 10
+	if priority > maxSteps {
+		priority = maxSteps
+	}
+	if priority < -maxSteps {
+		priority = -maxSteps
+	}
+	for ; priority > 0; priority-- {
+		interval /= 2
+	}
+	for ; priority < 0; priority++ {
+		interval *= 2
+	}
+	return interval
+}
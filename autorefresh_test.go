@@ -0,0 +1,177 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/smoogle/gosmart"
+	"github.com/smoogle/gosmart/gosmarttest"
+	"golang.org/x/net/context"
+)
+
+func TestPauseAutoRefresh(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	st := connect(t, s, gosmart.Config{})
+	if err := st.StartAutoRefresh(5*time.Millisecond, func(err error) { t.Error(err) }); err != nil {
+		t.Fatal(err)
+	}
+	defer st.StopAutoRefresh()
+	if err := st.StartAutoRefresh(time.Second, nil); err == nil {
+		t.Error("a second auto-refresh loop was started")
+	}
+
+	n := len(s.Requests())
+	waitFor(t, "an auto-refresh", func() bool { return len(s.Requests()) > n })
+
+	st.PauseAutoRefresh()
+	if !st.AutoRefreshPaused() {
+		t.Error("AutoRefreshPaused() = false after pausing")
+	}
+	// Let a refresh started before pausing complete.
+	time.Sleep(20 * time.Millisecond)
+	n = len(s.Requests())
+	time.Sleep(50 * time.Millisecond)
+	if got := len(s.Requests()); got != n {
+		t.Fatalf("%d requests sent while paused", got-n)
+	}
+
+	st.ResumeAutoRefresh()
+	waitFor(t, "an auto-refresh after resuming", func() bool { return len(s.Requests()) > n })
+}
+
+// reads returns the number of times the details of device id were read.
+func reads(s *gosmarttest.Server, id string) int {
+	n := 0
+	for _, r := range s.Requests() {
+		if r.Path == "/devices/"+id {
+			n++
+		}
+	}
+	return n
+}
+
+func TestAttributeIntervals(t *testing.T) {
+	s := newServer(t,
+		sensor("slow", map[string]interface{}{"temperature": 20.0}),
+		sensor("mixed", map[string]interface{}{"temperature": 20.0, "motion": "inactive"}),
+		lamp("fast"),
+	)
+	const interval = 10 * time.Millisecond
+	st := connect(t, s, gosmart.Config{
+		AttributeIntervals: map[string]time.Duration{"temperature": 20 * interval},
+	})
+	slow, mixed, fast := reads(s, "slow"), reads(s, "mixed"), reads(s, "fast")
+	if err := st.StartAutoRefresh(interval, func(err error) { t.Error(err) }); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "20 refreshes of the lamp", func() bool { return reads(s, "fast")-fast >= 20 })
+	st.StopAutoRefresh()
+
+	// Only listed attributes are read less often: the unlisted motion
+	// attribute makes the mixed sensor due every interval, like the lamp.
+	slow, mixed, fast = reads(s, "slow")-slow, reads(s, "mixed")-mixed, reads(s, "fast")-fast
+	if slow > fast/4 {
+		t.Errorf("temperature sensor read %d times and lamp %d times, want the sensor read much less often", slow, fast)
+	}
+	if mixed < fast/2 {
+		t.Errorf("motion and temperature sensor read %d times and lamp %d times, want it read about as often", mixed, fast)
+	}
+}
+
+func TestAttributeIntervalsNewDevices(t *testing.T) {
+	s := newServer(t, thermostat("1"))
+	st := connect(t, s, gosmart.Config{
+		AttributeIntervals: map[string]time.Duration{"temperature": time.Hour},
+	})
+	if err := st.StartAutoRefresh(10*time.Millisecond, func(err error) { t.Error(err) }); err != nil {
+		t.Fatal(err)
+	}
+	defer st.StopAutoRefresh()
+
+	s.AddDevice(lamp("2"))
+	waitFor(t, "the new device", func() bool { return len(st.DeviceList()) == 2 })
+	s.RemoveDevice("1")
+	waitFor(t, "the removed device to go", func() bool { return len(st.DeviceList()) == 1 })
+}
+
+func TestDevicePriority(t *testing.T) {
+	s := newServer(t, frontDoor("1"), lamp("2"), lamp("3"))
+	const interval = 20 * time.Millisecond
+	st := connect(t, s, gosmart.Config{
+		// The door by capability, the second lamp by ID.
+		DevicePriority: map[string]int{"Lock": 2, "3": -1},
+	})
+	high, normal, low := reads(s, "1"), reads(s, "2"), reads(s, "3")
+	if err := st.StartAutoRefresh(interval, func(err error) { t.Error(err) }); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "32 refreshes of the door", func() bool { return reads(s, "1")-high >= 32 })
+	st.StopAutoRefresh()
+
+	// Each step doubles the polling rate: about 32, 8 and 4 reads.
+	high, normal, low = reads(s, "1")-high, reads(s, "2")-normal, reads(s, "3")-low
+	if normal == 0 || high < 2*normal || low >= normal {
+		t.Errorf("read the door %d times, the lamp %d times and the low priority lamp %d times; want higher priorities polled more often", high, normal, low)
+	}
+}
+
+func TestPoll(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	st := connect(t, s, gosmart.Config{})
+	if err := st.Poll(context.Background(), 0, nil, nil); err == nil {
+		t.Error("Poll accepted a zero interval")
+	}
+
+	// Each update sees the state read by the refresh before it, and an
+	// error from onUpdate stops the loop.
+	stop := errors.New("stop")
+	var levels []float64
+	err := st.Poll(context.Background(), time.Millisecond, func(st *gosmart.SmartThings) error {
+		d, _ := st.DeviceByID("1")
+		levels = append(levels, d.Attribute("level"))
+		s.SetAttribute("1", "level", float64(10*len(levels)))
+		if len(levels) == 3 {
+			return stop
+		}
+		return nil
+	}, nil)
+	if err != stop {
+		t.Errorf("Poll() = %v, want the onUpdate error", err)
+	}
+	if !reflect.DeepEqual(levels, []float64{0, 10, 20}) {
+		t.Errorf("updates saw levels %v, want 0, 10, 20", levels)
+	}
+
+	// Without onError, the first refresh error stops the loop.
+	s.Fail(1, http.StatusBadRequest, `{"error": "bad request"}`)
+	if err := st.Poll(context.Background(), time.Millisecond, nil, nil); err == nil {
+		t.Error("Poll ignored a refresh error")
+	}
+
+	// With onError, errors are reported and polling goes on until ctx is
+	// cancelled.
+	s.Fail(2, http.StatusBadRequest, `{"error": "bad request"}`)
+	ctx, cancel := context.WithCancel(context.Background())
+	var errs, updates int
+	err = st.Poll(ctx, time.Millisecond, func(*gosmart.SmartThings) error {
+		if updates++; updates == 2 {
+			cancel()
+		}
+		return nil
+	}, func(error) { errs++ })
+	if err != context.Canceled {
+		t.Errorf("Poll() = %v, want context.Canceled", err)
+	}
+	if errs != 2 || updates != 2 {
+		t.Errorf("got %d errors and %d updates, want 2 of each", errs, updates)
+	}
+}
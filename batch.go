@@ -0,0 +1,160 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"golang.org/x/net/context"
+	"sync"
+	"time"
+)
+
+const (
+	// Maximum number of commands in flight during a batch.
+	batchWorkers = 8
+)
+
+// CommandOutcome holds the result of one command in a batch.
+type CommandOutcome struct {
+	Err      error
+	Duration time.Duration
+}
+
+// BatchCall issues cmd with args to all devices concurrently and returns
+// the outcome of each command, keyed by device ID. At most batchWorkers
+// commands are in flight at any time.
+func (st *SmartThings) BatchCall(devices []*Device, cmd string, args ...float64) map[string]CommandOutcome {
+	return st.batchCall(context.Background(), devices, cmd, args...)
+}
+
+// batchCall implements BatchCall, aborting the commands when ctx is
+// cancelled.
+func (st *SmartThings) batchCall(ctx context.Context, devices []*Device, cmd string, args ...float64) map[string]CommandOutcome {
+	ctx = st.withRetryBudget(ctx)
+
+	var (
+		mu  sync.Mutex
+		ret = make(map[string]CommandOutcome)
+	)
+	each(devices, func(d *Device) {
+		start := time.Now()
+		err := d.CallContext(ctx, cmd, args...)
+		mu.Lock()
+		ret[d.ID] = CommandOutcome{Err: err, Duration: time.Since(start)}
+		mu.Unlock()
+	})
+	return ret
+}
+
+// each calls fn for all devices concurrently, with at most batchWorkers
+// calls in flight at any time, and returns when all calls are done.
+func each(devices []*Device, fn func(*Device)) {
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, batchWorkers)
+	)
+	for _, d := range devices {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(d *Device) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			fn(d)
+		}(d)
+	}
+	wg.Wait()
+}
+
+// CallAll works like BatchCall, returning only the error of each command,
+// keyed by device ID (nil on success). Devices not supporting cmd get an
+// error wrapping ErrCommandUnavailable.
+func (st *SmartThings) CallAll(devices []*Device, cmd string, args ...float64) map[string]error {
+	ret := make(map[string]error)
+	for id, o := range st.BatchCall(devices, cmd, args...) {
+		ret[id] = o.Err
+	}
+	return ret
+}
+
+// forEach calls fn concurrently (as BatchCall) for every device, and returns
+// the error of each call keyed by device ID. Devices for which fn returns
+// false (not supporting the capability) are left out of the result.
+func (st *SmartThings) forEach(fn func(*Device) (bool, error)) map[string]error {
+	var (
+		mu  sync.Mutex
+		ret = make(map[string]error)
+	)
+	each(st.DeviceList(), func(d *Device) {
+		ok, err := fn(d)
+		if !ok {
+			return
+		}
+		mu.Lock()
+		ret[d.ID] = err
+		mu.Unlock()
+	})
+	return ret
+}
+
+// ForEachSwitch calls fn for every device implementing Switch (see
+// Device.As) and returns the error of each call, keyed by device ID. Calls
+// run concurrently, so fn must be safe for concurrent use.
+func (st *SmartThings) ForEachSwitch(fn func(Switch) error) map[string]error {
+	return st.forEach(func(d *Device) (bool, error) {
+		var c Switch
+		if !d.As(&c) {
+			return false, nil
+		}
+		return true, fn(c)
+	})
+}
+
+// ForEachDimmer works like ForEachSwitch, for devices implementing Dimmer.
+func (st *SmartThings) ForEachDimmer(fn func(Dimmer) error) map[string]error {
+	return st.forEach(func(d *Device) (bool, error) {
+		var c Dimmer
+		if !d.As(&c) {
+			return false, nil
+		}
+		return true, fn(c)
+	})
+}
+
+// ForEachThermostat works like ForEachSwitch, for devices implementing
+// Thermostat.
+func (st *SmartThings) ForEachThermostat(fn func(Thermostat) error) map[string]error {
+	return st.forEach(func(d *Device) (bool, error) {
+		var c Thermostat
+		if !d.As(&c) {
+			return false, nil
+		}
+		return true, fn(c)
+	})
+}
+
+// ForEachLock works like ForEachSwitch, for devices implementing Lock.
+func (st *SmartThings) ForEachLock(fn func(Lock) error) map[string]error {
+	return st.forEach(func(d *Device) (bool, error) {
+		var c Lock
+		if !d.As(&c) {
+			return false, nil
+		}
+		return true, fn(c)
+	})
+}
+
+// ForEachSensor works like ForEachSwitch, for devices implementing Sensor.
+func (st *SmartThings) ForEachSensor(fn func(Sensor) error) map[string]error {
+	return st.forEach(func(d *Device) (bool, error) {
+		var c Sensor
+		if !d.As(&c) {
+			return false, nil
+		}
+		return true, fn(c)
+	})
+}
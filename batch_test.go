@@ -0,0 +1,150 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smoogle/gosmart"
+	"github.com/smoogle/gosmart/gosmarttest"
+)
+
+func TestBatchCall(t *testing.T) {
+	s := newServer(t, lamp("1"), lamp("2"), lamp("3"), thermostat("4"))
+	st := connect(t, s, gosmart.Config{})
+	const delay = 20 * time.Millisecond
+	s.SetDelay(delay)
+
+	out := st.BatchCall(st.DeviceList(), "on")
+	if len(out) != 4 {
+		t.Fatalf("BatchCall returned %d outcomes, want 4", len(out))
+	}
+	for _, id := range []string{"1", "2", "3"} {
+		o := out[id]
+		if o.Err != nil {
+			t.Errorf("device %s: %v", id, o.Err)
+		}
+		if o.Duration < delay {
+			t.Errorf("device %s took %v, want at least the server delay (%v)", id, o.Duration, delay)
+		}
+	}
+	if err := out["4"].Err; !errors.Is(err, gosmart.ErrCommandUnavailable) {
+		t.Errorf("thermostat outcome = %v, want ErrCommandUnavailable", err)
+	}
+	if n := len(s.Calls()); n != 3 {
+		t.Errorf("server received %d commands, want 3", n)
+	}
+
+	errs := st.CallAll(st.DeviceList()[:2], "off")
+	if len(errs) != 2 || errs["1"] != nil || errs["2"] != nil {
+		t.Errorf("CallAll() = %v, want two successes", errs)
+	}
+}
+
+func TestCallAll(t *testing.T) {
+	var devs []gosmarttest.Device
+	for i := 1; i <= 15; i++ {
+		devs = append(devs, lamp(strconv.Itoa(i)))
+	}
+	s := newServer(t, append(devs, frontDoor("door"))...)
+	st := connect(t, s, gosmart.Config{})
+	const delay = 30 * time.Millisecond
+	s.SetDelay(delay)
+
+	start := time.Now()
+	errs := st.CallAll(st.DeviceList(), "setLevel", 30)
+	elapsed := time.Since(start)
+	if len(errs) != 16 {
+		t.Fatalf("CallAll returned %d errors, want one per device", len(errs))
+	}
+	for i := 1; i <= 15; i++ {
+		if err := errs[strconv.Itoa(i)]; err != nil {
+			t.Errorf("lamp %d: %v", i, err)
+		}
+	}
+	// The door does not abort the batch.
+	if err := errs["door"]; !errors.Is(err, gosmart.ErrCommandUnavailable) {
+		t.Errorf("door = %v, want ErrCommandUnavailable", err)
+	}
+	calls := s.Calls()
+	if len(calls) != 15 {
+		t.Fatalf("server received %d commands, want 15", len(calls))
+	}
+	for _, c := range calls {
+		if c.Command != "setLevel" || len(c.Args) != 1 || c.Args[0] != "30" {
+			t.Errorf("server received %+v", c)
+		}
+	}
+
+	// Commands run concurrently, but with a bounded number in flight: 15
+	// commands take at least two rounds of the server delay.
+	if elapsed < 2*delay || elapsed >= 8*delay {
+		t.Errorf("CallAll took %v, want between %v and %v", elapsed, 2*delay, 8*delay)
+	}
+}
+
+func TestForEachSwitch(t *testing.T) {
+	s := newServer(t, lamp("1"), lamp("2"), thermostat("3"), frontDoor("4"), lamp("5"))
+	s.HandleFunc("/devices/2/on", func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, `{"error": "bulb unreachable"}`, http.StatusBadRequest)
+	})
+	st := connect(t, s, gosmart.Config{})
+
+	var (
+		mu   sync.Mutex
+		seen int
+	)
+	errs := st.ForEachSwitch(func(sw gosmart.Switch) error {
+		mu.Lock()
+		seen++
+		mu.Unlock()
+		return sw.On()
+	})
+	// Only the switches are iterated, and one failure does not stop the
+	// others.
+	if seen != 3 || len(errs) != 3 {
+		t.Fatalf("called for %d switches, returned %v; want the 3 lamps", seen, errs)
+	}
+	if errs["1"] != nil || errs["5"] != nil {
+		t.Errorf("ForEachSwitch() = %v, want lamps 1 and 5 switched on", errs)
+	}
+	if errs["2"] == nil {
+		t.Error("failed command reported as a success")
+	}
+	var ids []string
+	for _, c := range s.Calls() {
+		if c.Command != "on" {
+			t.Errorf("server received %+v", c)
+		}
+		ids = append(ids, c.DeviceID)
+	}
+	sort.Strings(ids)
+	if !reflect.DeepEqual(ids, []string{"1", "5"}) {
+		t.Errorf("switched on %q, want 1 and 5", ids)
+	}
+
+	// The other capability interfaces.
+	locks := st.ForEachLock(func(l gosmart.Lock) error { return l.Unlock() })
+	if len(locks) != 1 || locks["4"] != nil {
+		t.Errorf("ForEachLock() = %v, want the door unlocked", locks)
+	}
+	thermostats := st.ForEachThermostat(func(th gosmart.Thermostat) error { return th.SetHeatingSetpoint(21) })
+	if len(thermostats) != 1 || thermostats["3"] != nil {
+		t.Errorf("ForEachThermostat() = %v, want the thermostat set", thermostats)
+	}
+	dimmers := st.ForEachDimmer(func(gosmart.Dimmer) error { return nil })
+	if len(dimmers) != 3 {
+		t.Errorf("ForEachDimmer() = %v, want the 3 lamps", dimmers)
+	}
+}
@@ -0,0 +1,149 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"encoding/json"
+	"errors"
+	"golang.org/x/net/context"
+	"net/http"
+	"time"
+)
+
+// ErrBulkStatusUnsupported is returned by GetDevicesWithStatus when the
+// endpoint does not include the device details in the device list.
+var ErrBulkStatusUnsupported = errors.New("endpoint does not support device status in the device list")
+
+// GetDevicesWithStatus returns the details of all devices, attributes
+// included, with a single request (/devices?expand=status) where possible.
+// Paginated lists are read in full. Returns ErrBulkStatusUnsupported if the
+// endpoint ignores the query, or an *HTTPError if it rejects it.
+func GetDevicesWithStatus(ctx context.Context, client *http.Client, endpoint string) ([]*DeviceInfo, error) {
+	infos, _, err := getDevicesWithStatus(ctx, client, endpoint)
+	return infos, err
+}
+
+// getDevicesWithStatus works like GetDevicesWithStatus, and also returns the
+// raw details of each device, keyed by ID.
+func getDevicesWithStatus(ctx context.Context, client *http.Client, endpoint string) ([]*DeviceInfo, map[string][]byte, error) {
+	var ret []*DeviceInfo
+	raw := make(map[string][]byte)
+	err := getPages(ctx, client, endpoint, "/devices?expand=status", func(contents []byte) (string, error) {
+		items, next, err := parseStatusPage(contents)
+		if err != nil {
+			return "", err
+		}
+		for _, item := range items {
+			var probe struct {
+				Attributes json.RawMessage `json:"attributes"`
+			}
+			if err := json.Unmarshal(item, &probe); err != nil {
+				return "", err
+			}
+			if len(probe.Attributes) == 0 {
+				return "", ErrBulkStatusUnsupported
+			}
+			di := &DeviceInfo{}
+			if err := json.Unmarshal(item, di); err != nil {
+				return "", err
+			}
+			ret = append(ret, di)
+			raw[di.ID] = item
+		}
+		return next, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return ret, raw, nil
+}
+
+// parseStatusPage splits one page of the device list into its raw entries.
+// Pages have the same shapes as in parseDevicePage.
+func parseStatusPage(contents []byte) ([]json.RawMessage, string, error) {
+	var items []json.RawMessage
+	if err := json.Unmarshal(contents, &items); err == nil {
+		return items, "", nil
+	}
+	var page struct {
+		Items []json.RawMessage `json:"items"`
+		Links struct {
+			Next struct {
+				Href string `json:"href"`
+			} `json:"next"`
+		} `json:"_links"`
+	}
+	if err := json.Unmarshal(contents, &page); err != nil {
+		return nil, "", err
+	}
+	return page.Items, page.Links.Next.Href, nil
+}
+
+// listDevicesWithStatus returns the device list and, if the endpoint
+// supports it (see Config.DisableBulkStatus), the details of each device
+// keyed by ID. The details are nil when they must be read one by one. In
+// bulk mode, while the cached details of all the known devices are fresh
+// (see Config.CacheTTL), the list is served from the cache and no request is
+// sent.
+func (st *SmartThings) listDevicesWithStatus(ctx context.Context) ([]DeviceList, map[string]*DeviceInfo, error) {
+	st.mu.Lock()
+	bulk := !st.noBulkStatus
+	st.mu.Unlock()
+
+	cfg := st.config()
+	if bulk && !st.v1() && !cfg.DisableBulkStatus {
+		ttl := cfg.CacheTTL
+		if all, ok := st.cachedList(ttl); ok {
+			return all, nil, nil
+		}
+		infos, raw, err := getDevicesWithStatus(ctx, st.client, st.endpoint)
+		if err == nil {
+			var all []DeviceList
+			details := make(map[string]*DeviceInfo)
+			for _, di := range infos {
+				all = append(all, di.DeviceList)
+				details[di.ID] = di
+				if ttl > 0 {
+					st.cache.put(di.ID, raw[di.ID], time.Now())
+				}
+			}
+			return all, details, nil
+		}
+		if !errors.Is(err, ErrBulkStatusUnsupported) && !unsupportedQuery(err) {
+			return nil, nil, err
+		}
+		// Do not try again on this connection.
+		st.mu.Lock()
+		st.noBulkStatus = true
+		st.mu.Unlock()
+	}
+	all, err := st.listDevices(ctx)
+	return all, nil, err
+}
+
+// cachedList returns the device list rebuilt from the cached details of the
+// devices known to st, if all of them are younger than ttl.
+func (st *SmartThings) cachedList(ttl time.Duration) ([]DeviceList, bool) {
+	known := st.DeviceList()
+	if ttl <= 0 || len(known) == 0 {
+		return nil, false
+	}
+	now := time.Now()
+	var ret []DeviceList
+	for _, d := range known {
+		contents, ok := st.cache.get(d.ID, ttl, now)
+		if !ok {
+			return nil, false
+		}
+		var dl DeviceList
+		if err := json.Unmarshal(contents, &dl); err != nil {
+			return nil, false
+		}
+		ret = append(ret, dl)
+	}
+	return ret, true
+}
@@ -0,0 +1,146 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/smoogle/gosmart"
+	"github.com/smoogle/gosmart/gosmarttest"
+	"golang.org/x/net/context"
+)
+
+// bulkStatus makes the device list of s include the details of the lamps
+// with the given IDs when requested with expand=status.
+func bulkStatus(s *gosmarttest.Server, ids ...string) {
+	s.HandleFunc("/devices", func(w http.ResponseWriter, r *http.Request) {
+		var list []map[string]interface{}
+		for _, id := range ids {
+			item := map[string]interface{}{"id": id, "name": "Dimmer " + id, "displayName": "Lamp " + id}
+			if r.URL.Query().Get("expand") == "status" {
+				sw, _ := s.Attribute(id, "switch")
+				level, _ := s.Attribute(id, "level")
+				item["attributes"] = map[string]interface{}{"switch": sw, "level": level}
+			}
+			list = append(list, item)
+		}
+		gosmarttest.JSON(list)(w, r)
+	})
+}
+
+// detailReads returns the number of requests for the details of a single
+// device.
+func detailReads(s *gosmarttest.Server) int {
+	var n int
+	for _, r := range s.Requests() {
+		if r.Path == "/devices/1" || r.Path == "/devices/2" {
+			n++
+		}
+	}
+	return n
+}
+
+// listReads returns the number of device list requests.
+func listReads(s *gosmarttest.Server) int {
+	var n int
+	for _, r := range s.Requests() {
+		if r.Path == "/devices" {
+			n++
+		}
+	}
+	return n
+}
+
+func TestGetDevicesWithStatus(t *testing.T) {
+	s := newServer(t, lamp("1"), lamp("2"))
+	s.SetAttribute("2", "switch", "on")
+	bulkStatus(s, "1", "2")
+	infos, err := gosmart.GetDevicesWithStatus(context.Background(), s.Client(), s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 || infos[1].ID != "2" || infos[1].DisplayName != "Lamp 2" || infos[1].Attributes["switch"] != "on" {
+		t.Errorf("GetDevicesWithStatus() = %+v", infos)
+	}
+	if n := len(s.Requests()); n != 1 {
+		t.Errorf("sent %d requests, want 1", n)
+	}
+
+	// The mock server does not expand the list by itself.
+	plain := newServer(t, lamp("1"))
+	if _, err := gosmart.GetDevicesWithStatus(context.Background(), plain.Client(), plain.URL); !errors.Is(err, gosmart.ErrBulkStatusUnsupported) {
+		t.Errorf("GetDevicesWithStatus on a plain list = %v, want ErrBulkStatusUnsupported", err)
+	}
+}
+
+func TestRefreshBulkStatus(t *testing.T) {
+	s := newServer(t, lamp("1"), lamp("2"))
+	bulkStatus(s, "1", "2")
+	st := connect(t, s, gosmart.Config{})
+	if n := detailReads(s); n != 0 {
+		t.Errorf("read the details of %d devices one by one, want none", n)
+	}
+	s.SetAttribute("1", "level", 30.0)
+	if err := st.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if v := device(t, st, "1").Attribute("level"); v != 30 {
+		t.Errorf("level = %v, want 30", v)
+	}
+
+	// Disabling the fast path reads each device.
+	cfg := gosmart.Config{DisableBulkStatus: true}
+	st = connect(t, s, cfg)
+	if n := detailReads(s); n != 2 {
+		t.Errorf("read the details of %d devices one by one, want 2", n)
+	}
+
+	// Endpoints without bulk status fall back to reading each device.
+	plain := newServer(t, lamp("1"), lamp("2"))
+	connect(t, plain, gosmart.Config{})
+	if n := detailReads(plain); n != 2 {
+		t.Errorf("read the details of %d devices one by one, want 2", n)
+	}
+}
+
+func TestRefreshBulkStatusCacheTTL(t *testing.T) {
+	s := newServer(t, lamp("1"), lamp("2"))
+	bulkStatus(s, "1", "2")
+	st := connect(t, s, gosmart.Config{CacheTTL: time.Hour})
+	lists := listReads(s)
+
+	// Refreshes within the TTL are served from memory.
+	s.SetAttribute("1", "level", 30.0)
+	if err := st.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if n := listReads(s) - lists; n != 0 {
+		t.Errorf("sent %d device list requests within the TTL, want none", n)
+	}
+	if n := detailReads(s); n != 0 {
+		t.Errorf("read %d device details within the TTL, want none", n)
+	}
+	d := device(t, st, "1")
+	if v := d.Attribute("level"); v != 0 {
+		t.Errorf("level = %v, want the cached 0", v)
+	}
+
+	// Invalidating a device reads the list again.
+	st.Invalidate("1")
+	if err := st.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if n := listReads(s) - lists; n != 1 {
+		t.Errorf("sent %d device list requests after Invalidate, want 1", n)
+	}
+	if v := d.Attribute("level"); v != 30 {
+		t.Errorf("level = %v after Invalidate, want 30", v)
+	}
+}
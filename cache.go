@@ -0,0 +1,132 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"encoding/json"
+	"golang.org/x/net/context"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// infoCache holds recent device info responses, keyed by device ID.
+type infoCache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+// cacheEntry is one cached response.
+type cacheEntry struct {
+	contents []byte
+	at       time.Time
+}
+
+// get returns the response cached for id, if younger than ttl.
+func (c *infoCache) get(id string, ttl time.Duration, now time.Time) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[id]
+	if !ok || now.Sub(e.at) >= ttl {
+		return nil, false
+	}
+	return copyBytes(e.contents), true
+}
+
+// put caches the response for id.
+func (c *infoCache) put(id string, contents []byte, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]cacheEntry)
+	}
+	c.entries[id] = cacheEntry{contents: copyBytes(contents), at: now}
+}
+
+// drop removes the response cached for id, or all of them if all is true.
+func (c *infoCache) drop(id string, all bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if all {
+		c.entries = nil
+		return
+	}
+	delete(c.entries, id)
+}
+
+// Invalidate discards the cached details of a device, so the next read
+// (e.g. Refresh) requests them from the API. See Config.CacheTTL.
+func (st *SmartThings) Invalidate(deviceID string) {
+	if st.smartThings == nil {
+		return
+	}
+	st.cache.drop(deviceID, false)
+}
+
+// InvalidateAll discards the cached details of all devices.
+func (st *SmartThings) InvalidateAll() {
+	if st.smartThings == nil {
+		return
+	}
+	st.cache.drop("", true)
+}
+
+// Info returns the details of the device, served from the cache while
+// fresh (see Config.CacheTTL). The attributes of the device are not
+// updated; use Refresh for that.
+func (d *Device) Info() (*DeviceInfo, error) {
+	return d.st.deviceInfo(context.Background(), d)
+}
+
+// deviceInfo works like GetDeviceInfo for device d, using the cache.
+func (st *SmartThings) deviceInfo(ctx context.Context, d *Device) (*DeviceInfo, error) {
+	if err := st.connected(); err != nil {
+		return nil, err
+	}
+	contents, err := st.rawDeviceInfo(ctx, d.ID, d)
+	if err != nil {
+		return nil, err
+	}
+	ret := &DeviceInfo{}
+	if err := json.Unmarshal(contents, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// rawDeviceInfo returns the response of the /devices/{id} endpoint, from
+// the cache if enabled and fresh. If d is not nil, the time taken by the
+// request is added to its latency stats.
+func (st *SmartThings) rawDeviceInfo(ctx context.Context, id string, d *Device) ([]byte, error) {
+	ttl := st.config().CacheTTL
+	if ttl > 0 {
+		if contents, ok := st.cache.get(id, ttl, time.Now()); ok {
+			return contents, nil
+		}
+	}
+	start := time.Now()
+	var (
+		contents []byte
+		err      error
+	)
+	if st.v1() {
+		contents, err = getV1DeviceInfo(ctx, st.client, st.endpoint, id)
+	} else {
+		contents, err = issueCommand(ctx, st.client, st.endpoint, "/devices/"+url.PathEscape(id))
+		err = notFound(err, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if d != nil {
+		d.recordLatency(time.Since(start))
+	}
+	if ttl > 0 {
+		st.cache.put(id, contents, time.Now())
+	}
+	return contents, nil
+}
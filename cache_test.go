@@ -0,0 +1,130 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smoogle/gosmart"
+	"github.com/smoogle/gosmart/gosmarttest"
+)
+
+// infoReads returns the number of requests for the details of device id
+// since request number from.
+func infoReads(s *gosmarttest.Server, id string, from int) int {
+	n := 0
+	for _, r := range s.Requests()[from:] {
+		if r.Path == "/devices/"+id {
+			n++
+		}
+	}
+	return n
+}
+
+func TestCacheTTL(t *testing.T) {
+	s := newServer(t, lamp("1"), lamp("2"))
+	st := connect(t, s, gosmart.Config{CacheTTL: time.Minute})
+	d1, d2 := device(t, st, "1"), device(t, st, "2")
+
+	// Refreshes within the TTL are served from the cache, stale values
+	// included.
+	s.SetAttribute("1", "level", 40.0)
+	before := len(s.Requests())
+	for i := 0; i < 3; i++ {
+		if err := d1.Refresh(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d1.Info(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := infoReads(s, "1", before); n != 0 {
+		t.Errorf("cached device read %d times, want 0", n)
+	}
+	if v := d1.Attribute("level"); v != 0 {
+		t.Errorf("cached level = %v, want the cached 0", v)
+	}
+
+	// Invalidate drops a single device.
+	st.Invalidate("1")
+	before = len(s.Requests())
+	if err := d1.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d2.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if n := infoReads(s, "1", before); n != 1 {
+		t.Errorf("invalidated device read %d times, want 1", n)
+	}
+	if n := infoReads(s, "2", before); n != 0 {
+		t.Errorf("other device read %d times, want 0", n)
+	}
+	if v := d1.Attribute("level"); v != 40 {
+		t.Errorf("level after Invalidate = %v, want 40", v)
+	}
+
+	// InvalidateAll drops them all.
+	st.InvalidateAll()
+	before = len(s.Requests())
+	for _, d := range []*gosmart.Device{d1, d2, d1, d2} {
+		if err := d.Refresh(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n1, n2 := infoReads(s, "1", before), infoReads(s, "2", before); n1 != 1 || n2 != 1 {
+		t.Errorf("devices read %d and %d times after InvalidateAll, want once each", n1, n2)
+	}
+
+	// Commands drop the device they are sent to.
+	if err := d2.Call("on"); err != nil {
+		t.Fatal(err)
+	}
+	before = len(s.Requests())
+	if err := d2.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if n := infoReads(s, "2", before); n != 1 {
+		t.Errorf("device read %d times after a command, want 1", n)
+	}
+	if v := d2.Attribute("switch"); v != 1 {
+		t.Errorf("switch after a command = %v, want on", v)
+	}
+}
+
+func TestCacheTTLExpires(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	ttl := 50 * time.Millisecond
+	st := connect(t, s, gosmart.Config{CacheTTL: ttl})
+	d := device(t, st, "1")
+
+	before := len(s.Requests())
+	if err := d.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(ttl)
+	if err := d.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if n := infoReads(s, "1", before); n != 1 {
+		t.Errorf("device read %d times, want once after the TTL", n)
+	}
+
+	// Without a TTL, every refresh reads the device.
+	st = connect(t, s, gosmart.Config{})
+	d = device(t, st, "1")
+	before = len(s.Requests())
+	for i := 0; i < 3; i++ {
+		if err := d.Refresh(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := infoReads(s, "1", before); n != 3 {
+		t.Errorf("device read %d times without a cache, want 3", n)
+	}
+}
@@ -0,0 +1,311 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"fmt"
+	"time"
+)
+
+// Capability interfaces. A single Device struct cannot conditionally
+// implement these, so use Device.As to obtain a value implementing the
+// interface when the device supports it:
+//
+//	var sw gosmart.Switch
+//	if dev.As(&sw) {
+//		sw.On()
+//	}
+
+// Switch is implemented by devices that can be turned on and off.
+type Switch interface {
+	On() error
+	Off() error
+	IsOn() bool
+}
+
+// Dimmer is implemented by switches with a dimmable level.
+type Dimmer interface {
+	Switch
+	Level() float64
+	SetLevel(level float64) error
+}
+
+// Thermostat is implemented by devices with heating and cooling setpoints.
+type Thermostat interface {
+	Temperature() float64
+	HeatingSetpoint() float64
+	CoolingSetpoint() float64
+	SetHeatingSetpoint(t float64) error
+	SetCoolingSetpoint(t float64) error
+	// RuntimeToday returns how long the unit has been heating and cooling
+	// since local midnight, computed from the operating state history.
+	// Returns ErrUnsupported if the unit does not report its operating
+	// state (thermostatOperatingState).
+	RuntimeToday() (heating, cooling time.Duration, err error)
+	// HumiditySetpoint returns the humidifier setpoint (percent). Returns
+	// false if the unit does not report it.
+	HumiditySetpoint() (float64, bool)
+	// SetHumiditySetpoint sets the humidifier setpoint (percent). The value
+	// is checked against the range declared by the command schema (or
+	// 0-100 if none) before the command is sent. Returns ErrUnsupported if
+	// the unit controls no humidifier (accepts no setHumiditySetpoint).
+	SetHumiditySetpoint(h float64) error
+}
+
+// Lock is implemented by devices that can be locked and unlocked.
+type Lock interface {
+	Lock() error
+	Unlock() error
+	Locked() bool
+}
+
+// Sensor is implemented by devices reporting environmental readings. Each
+// method returns false if the device does not report that reading.
+type Sensor interface {
+	Temperature() (float64, bool)
+	Humidity() (float64, bool)
+	Illuminance() (float64, bool)
+	Battery() (float64, bool)
+	// Motion returns true if motion is currently detected ("active").
+	Motion() (bool, bool)
+	// Contact returns true if the contact is open.
+	Contact() (bool, bool)
+}
+
+// Controller holds the basic device operations. It is implemented by
+// *Device; code accepting a Controller can be tested with a fake device.
+type Controller interface {
+	Attribute(name string) float64
+	Attributes() map[string]float64
+	HasCommand(cmd string) bool
+	Call(cmd string, args ...float64) error
+}
+
+// Device must implement Controller.
+var _ Controller = (*Device)(nil)
+
+// sensorAttributes lists the attributes that make a device a Sensor.
+var sensorAttributes = []string{"temperature", "humidity", "illuminance", "battery", "motion", "contact"}
+
+// As checks whether the device supports the capability interface pointed to
+// by target and, if so, sets target to a value implementing it. Target must
+// be a non-nil pointer to one of Switch, Dimmer, Thermostat, Lock or
+// Sensor.
+func (d *Device) As(target interface{}) bool {
+	switch t := target.(type) {
+	case *Switch:
+		if d.Controllable() {
+			*t = switchCap{d}
+			return true
+		}
+	case *Dimmer:
+		if d.HasCommand("on") && d.HasCommand("off") && d.HasCommand("setLevel") {
+			*t = dimmerCap{switchCap{d}}
+			return true
+		}
+	case *Thermostat:
+		if d.HasCommand("setHeatingSetpoint") && d.HasCommand("setCoolingSetpoint") {
+			*t = thermostatCap{d}
+			return true
+		}
+	case *Lock:
+		if d.HasCommand("lock") && d.HasCommand("unlock") {
+			*t = lockCap{d}
+			return true
+		}
+	case *Sensor:
+		for _, a := range sensorAttributes {
+			if d.hasAttribute(a) {
+				*t = sensorCap{d}
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AsSensor returns the device as a Sensor, grouping all the common sensor
+// readings in one value. Returns false if the device reports none of them.
+func (d *Device) AsSensor() (Sensor, bool) {
+	var s Sensor
+	ok := d.As(&s)
+	return s, ok
+}
+
+// Controllable returns true if the device switch can be commanded. Devices
+// reporting a switch attribute without accepting both the on and off commands
+// are status-only and return false.
+func (d *Device) Controllable() bool {
+	return d.HasCommand("on") && d.HasCommand("off")
+}
+
+// hasAttribute returns true if the device reported the named attribute.
+func (d *Device) hasAttribute(name string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.attributes[name]
+	return ok
+}
+
+// switchCap implements Switch.
+type switchCap struct {
+	d *Device
+}
+
+func (c switchCap) On() error  { return c.d.Call("on") }
+func (c switchCap) Off() error { return c.d.Call("off") }
+func (c switchCap) IsOn() bool { return c.d.Attribute("switch") == 1.0 }
+
+// dimmerCap implements Dimmer.
+type dimmerCap struct {
+	switchCap
+}
+
+func (c dimmerCap) Level() float64               { return c.d.Attribute("level") }
+func (c dimmerCap) SetLevel(level float64) error { return c.d.Call("setLevel", level) }
+
+// thermostatCap implements Thermostat.
+type thermostatCap struct {
+	d *Device
+}
+
+func (c thermostatCap) Temperature() float64 {
+	return c.d.localTemperature(c.d.Attribute("temperature"))
+}
+
+func (c thermostatCap) HeatingSetpoint() float64 {
+	return c.d.localTemperature(c.d.Attribute("heatingSetpoint"))
+}
+
+func (c thermostatCap) CoolingSetpoint() float64 {
+	return c.d.localTemperature(c.d.Attribute("coolingSetpoint"))
+}
+
+func (c thermostatCap) SetHeatingSetpoint(t float64) error {
+	return c.d.Call("setHeatingSetpoint", c.d.deviceTemperature(t))
+}
+
+func (c thermostatCap) SetCoolingSetpoint(t float64) error {
+	return c.d.Call("setCoolingSetpoint", c.d.deviceTemperature(t))
+}
+
+func (c thermostatCap) RuntimeToday() (time.Duration, time.Duration, error) {
+	if !c.d.hasAttribute("thermostatOperatingState") {
+		return 0, 0, fmt.Errorf("%w: no operating state reported by device %s", ErrUnsupported, c.d.ID)
+	}
+	now := time.Now()
+	y, m, day := now.Date()
+	midnight := time.Date(y, m, day, 0, 0, 0, 0, now.Location())
+	events, err := c.d.EventsSince("thermostatOperatingState", midnight)
+	if err != nil {
+		return 0, 0, err
+	}
+	heating, cooling := runtime(events, midnight, now)
+	return heating, cooling, nil
+}
+
+func (c thermostatCap) HumiditySetpoint() (float64, bool) {
+	return c.d.reading("humiditySetpoint")
+}
+
+func (c thermostatCap) SetHumiditySetpoint(h float64) error {
+	if !c.d.HasCommand("setHumiditySetpoint") {
+		return fmt.Errorf("%w: no humidifier controlled by device %s", ErrUnsupported, c.d.ID)
+	}
+	if err := c.d.checkRange("setHumiditySetpoint", 0, h, 0, 100); err != nil {
+		return err
+	}
+	return c.d.Call("setHumiditySetpoint", h)
+}
+
+// lockCap implements Lock.
+type lockCap struct {
+	d *Device
+}
+
+func (c lockCap) Lock() error   { return c.d.Call("lock") }
+func (c lockCap) Unlock() error { return c.d.Call("unlock") }
+
+func (c lockCap) Locked() bool {
+	s, _ := c.d.stringAttribute("lock")
+	return s == "locked"
+}
+
+// LockState returns the lock attribute as reported (e.g. "locked",
+// "unlocked", "jammed" or "unknown"). Returns false if the device does not
+// report it.
+func (d *Device) LockState() (string, bool) {
+	return d.stringAttribute("lock")
+}
+
+// IsJammed returns true if the lock reports being jammed.
+func (d *Device) IsJammed() bool {
+	s, _ := d.LockState()
+	return s == "jammed"
+}
+
+// sensorCap implements Sensor.
+type sensorCap struct {
+	d *Device
+}
+
+func (c sensorCap) Temperature() (float64, bool) { return c.d.Temperature() }
+func (c sensorCap) Humidity() (float64, bool)    { return c.d.reading("humidity") }
+func (c sensorCap) Illuminance() (float64, bool) { return c.d.reading("illuminance") }
+func (c sensorCap) Battery() (float64, bool)     { return c.d.reading("battery") }
+
+func (c sensorCap) Motion() (bool, bool) {
+	s, ok := c.d.stringAttribute("motion")
+	return s == "active", ok
+}
+
+func (c sensorCap) Contact() (bool, bool) {
+	s, ok := c.d.stringAttribute("contact")
+	return s == "open", ok
+}
+
+// reading returns the value of a numeric attribute and whether it is present.
+func (d *Device) reading(name string) (float64, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	v, ok := d.attributes[name]
+	return v, ok
+}
+
+// runtime adds up the time spent heating and cooling between from and to,
+// given a time sorted list of events. The operating state at from is taken
+// from the last event before it.
+func runtime(events []DeviceEvent, from, to time.Time) (heating, cooling time.Duration) {
+	var (
+		state string
+		since = from
+	)
+	add := func(until time.Time) {
+		switch state {
+		case "heating":
+			heating += until.Sub(since)
+		case "cooling":
+			cooling += until.Sub(since)
+		}
+	}
+
+	for _, e := range events {
+		if e.Name != "thermostatOperatingState" {
+			continue
+		}
+		if e.Time.After(to) {
+			break
+		}
+		if e.Time.After(from) {
+			add(e.Time)
+			since = e.Time
+		}
+		state = e.Value
+	}
+	add(to)
+	return heating, cooling
+}
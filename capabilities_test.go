@@ -0,0 +1,416 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/smoogle/gosmart"
+	"github.com/smoogle/gosmart/gosmarttest"
+)
+
+// frontDoor returns a lock fixture with a contact sensor.
+func frontDoor(id string) gosmarttest.Device {
+	return gosmarttest.Device{
+		ID:          id,
+		Name:        "Lock " + id,
+		DisplayName: "Front Door",
+		Attributes:  map[string]interface{}{"lock": "locked", "contact": "closed", "battery": 80.0},
+		Commands: []gosmart.DeviceCommand{
+			{Command: "lock", Capability: "Lock"},
+			{Command: "unlock", Capability: "Lock"},
+		},
+	}
+}
+
+func TestAs(t *testing.T) {
+	s := newServer(t, lamp("1"), thermostat("2"), frontDoor("3"))
+	st := connect(t, s, gosmart.Config{})
+
+	var (
+		sw   gosmart.Switch
+		dim  gosmart.Dimmer
+		th   gosmart.Thermostat
+		lock gosmart.Lock
+		sen  gosmart.Sensor
+	)
+	cases := []struct {
+		id     string
+		target interface{}
+		want   bool
+	}{
+		{"1", &sw, true},
+		{"1", &dim, true},
+		{"1", &th, false},
+		{"1", &lock, false},
+		{"1", &sen, false},
+		{"2", &th, true},
+		{"2", &sen, true},
+		{"2", &sw, false},
+		{"3", &lock, true},
+		{"3", &sen, true},
+		{"3", &dim, false},
+		{"1", new(int), false},
+	}
+	for _, c := range cases {
+		if got := device(t, st, c.id).As(c.target); got != c.want {
+			t.Errorf("device %s As(%T) = %v, want %v", c.id, c.target, got, c.want)
+		}
+	}
+}
+
+func TestCapabilityCalls(t *testing.T) {
+	s := newServer(t, lamp("1"), thermostat("2"), frontDoor("3"))
+	st := connect(t, s, gosmart.Config{})
+
+	var dim gosmart.Dimmer
+	if !device(t, st, "1").As(&dim) {
+		t.Fatal("lamp is not a Dimmer")
+	}
+	if err := dim.SetLevel(40); err != nil {
+		t.Fatal(err)
+	}
+	if err := dim.On(); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if !dim.IsOn() || dim.Level() != 40 {
+		t.Errorf("dimmer is on=%v level=%v, want on at 40", dim.IsOn(), dim.Level())
+	}
+
+	var th gosmart.Thermostat
+	if !device(t, st, "2").As(&th) {
+		t.Fatal("thermostat is not a Thermostat")
+	}
+	if th.Temperature() != 20 || th.HeatingSetpoint() != 18 || th.CoolingSetpoint() != 26 {
+		t.Errorf("thermostat reads %v/%v/%v, want 20/18/26", th.Temperature(), th.HeatingSetpoint(), th.CoolingSetpoint())
+	}
+
+	var lock gosmart.Lock
+	if !device(t, st, "3").As(&lock) {
+		t.Fatal("front door is not a Lock")
+	}
+	if !lock.Locked() {
+		t.Error("Locked() = false, want true")
+	}
+	sen, ok := device(t, st, "3").AsSensor()
+	if !ok {
+		t.Fatal("front door is not a Sensor")
+	}
+	if open, ok := sen.Contact(); open || !ok {
+		t.Errorf("Contact() = %v, %v; want closed", open, ok)
+	}
+	if b, ok := sen.Battery(); b != 80 || !ok {
+		t.Errorf("Battery() = %v, %v; want 80", b, ok)
+	}
+	if _, ok := sen.Motion(); ok {
+		t.Error("Motion() reported on a device without a motion sensor")
+	}
+}
+
+func TestLockState(t *testing.T) {
+	jammed, unknown := frontDoor("2"), frontDoor("3")
+	jammed.Attributes["lock"] = "jammed"
+	unknown.Attributes["lock"] = "unknown"
+	s := newServer(t, frontDoor("1"), jammed, unknown, lamp("4"))
+	st := connect(t, s, gosmart.Config{})
+
+	cases := []struct {
+		id     string
+		state  string
+		ok     bool
+		jammed bool
+		locked bool
+	}{
+		{"1", "locked", true, false, true},
+		{"2", "jammed", true, true, false},
+		{"3", "unknown", true, false, false},
+		{"4", "", false, false, false},
+	}
+	for _, c := range cases {
+		d := device(t, st, c.id)
+		if state, ok := d.LockState(); state != c.state || ok != c.ok {
+			t.Errorf("device %s: LockState() = %q, %v; want %q, %v", c.id, state, ok, c.state, c.ok)
+		}
+		if j := d.IsJammed(); j != c.jammed {
+			t.Errorf("device %s: IsJammed() = %v, want %v", c.id, j, c.jammed)
+		}
+		var lock gosmart.Lock
+		if d.As(&lock) && lock.Locked() != c.locked {
+			t.Errorf("device %s: Locked() = %v, want %v", c.id, lock.Locked(), c.locked)
+		}
+	}
+
+	// A lock clearing its jam is seen on the next refresh.
+	s.SetAttribute("2", "lock", "locked")
+	d := device(t, st, "2")
+	if err := d.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if d.IsJammed() {
+		t.Error("IsJammed() = true after the lock was cleared")
+	}
+}
+
+func TestAsSensor(t *testing.T) {
+	multi := gosmarttest.Device{
+		ID:          "1",
+		Name:        "Multipurpose Sensor",
+		DisplayName: "Garage",
+		Attributes: map[string]interface{}{
+			"temperature": 18.5,
+			"humidity":    61.0,
+			"illuminance": 120.0,
+			"battery":     92.0,
+			"motion":      "active",
+			"contact":     "open",
+		},
+	}
+	s := newServer(t, multi, lamp("2"))
+	st := connect(t, s, gosmart.Config{})
+
+	sen, ok := device(t, st, "1").AsSensor()
+	if !ok {
+		t.Fatal("multi sensor is not a Sensor")
+	}
+	for name, read := range map[string]func() (float64, bool){
+		"temperature": sen.Temperature,
+		"humidity":    sen.Humidity,
+		"illuminance": sen.Illuminance,
+		"battery":     sen.Battery,
+	} {
+		if v, ok := read(); !ok || v != multi.Attributes[name] {
+			t.Errorf("%s = %v, %v; want %v", name, v, ok, multi.Attributes[name])
+		}
+	}
+	if m, ok := sen.Motion(); !m || !ok {
+		t.Errorf("Motion() = %v, %v; want active", m, ok)
+	}
+	if c, ok := sen.Contact(); !c || !ok {
+		t.Errorf("Contact() = %v, %v; want open", c, ok)
+	}
+
+	s.SetAttribute("1", "motion", "inactive")
+	s.SetAttribute("1", "contact", "closed")
+	if err := st.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if m, _ := sen.Motion(); m {
+		t.Error("Motion() still active after refresh")
+	}
+	if c, _ := sen.Contact(); c {
+		t.Error("Contact() still open after refresh")
+	}
+
+	if sen, ok := device(t, st, "2").AsSensor(); ok || sen != nil {
+		t.Errorf("lamp AsSensor() = %v, %v; want nil, false", sen, ok)
+	}
+}
+
+func TestRuntimeToday(t *testing.T) {
+	now := time.Now()
+	y, m, day := now.Date()
+	midnight := time.Date(y, m, day, 0, 0, 0, 0, now.Location())
+	elapsed := now.Sub(midnight)
+	if elapsed < time.Minute {
+		t.Skip("too close to midnight")
+	}
+
+	s := newServer(t, thermostat("1"))
+	// Yesterday's history, which should not be read past the last state
+	// change before midnight.
+	for i := 0; i < 300; i++ {
+		s.AddEvent("1", "thermostatOperatingState", "heating", midnight.Add(-time.Hour-time.Duration(i)*time.Second))
+	}
+	s.AddEvent("1", "thermostatOperatingState", "cooling", midnight.Add(-time.Minute))
+
+	// Today's history, cycling through the states, with temperature events in
+	// between. Times are kept to the millisecond, as sent by the server.
+	states := []string{"heating", "idle", "cooling", "fan only"}
+	const n = 300
+	var times []time.Time
+	for i := 1; i <= n; i++ {
+		at := midnight.Add(elapsed * time.Duration(i) / (n + 1)).Truncate(time.Millisecond)
+		times = append(times, at)
+		s.AddEvent("1", "thermostatOperatingState", states[i%len(states)], at)
+		s.AddEvent("1", "temperature", 20.0, at.Add(time.Millisecond/2))
+	}
+	st := connect(t, s, gosmart.Config{})
+
+	var th gosmart.Thermostat
+	if !device(t, st, "1").As(&th) {
+		t.Fatal("thermostat is not a Thermostat")
+	}
+	before := len(s.Requests())
+	heating, cooling, err := th.RuntimeToday()
+	if err != nil {
+		t.Fatal(err)
+	}
+	end := time.Now()
+
+	// Cooling since yesterday until the first change, then the cycle.
+	wantHeating, wantCooling := time.Duration(0), times[0].Sub(midnight)
+	for i, at := range times {
+		next := end
+		if i+1 < len(times) {
+			next = times[i+1]
+		}
+		switch states[(i+1)%len(states)] {
+		case "heating":
+			wantHeating += next.Sub(at)
+		case "cooling":
+			wantCooling += next.Sub(at)
+		}
+	}
+	slack := end.Sub(now) + time.Millisecond
+	if d := wantHeating - heating; d < 0 || d > slack {
+		t.Errorf("heating = %v, want %v", heating, wantHeating)
+	}
+	if d := wantCooling - cooling; d < 0 || d > slack {
+		t.Errorf("cooling = %v, want %v", cooling, wantCooling)
+	}
+
+	// Two pages cover today, and only state changes are requested.
+	reqs := s.Requests()[before:]
+	if len(reqs) != 2 {
+		t.Errorf("history read in %d requests, want 2", len(reqs))
+	}
+	for _, r := range reqs {
+		if r.Query.Get("attribute") != "thermostatOperatingState" {
+			t.Errorf("requested events for %q", r.Query.Get("attribute"))
+		}
+	}
+
+	// Thermostats without an operating state do not report runtimes.
+	plain := thermostat("3")
+	delete(plain.Attributes, "thermostatOperatingState")
+	s.AddDevice(plain)
+	if err := st.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if !device(t, st, "3").As(&th) {
+		t.Fatal("thermostat without an operating state is not a Thermostat")
+	}
+	if _, _, err := th.RuntimeToday(); !errors.Is(err, gosmart.ErrUnsupported) {
+		t.Errorf("RuntimeToday() without an operating state returned %v, want ErrUnsupported", err)
+	}
+}
+
+// humidifying returns a thermostat also controlling a humidifier.
+func humidifying(id string) gosmarttest.Device {
+	d := thermostat(id)
+	d.Attributes["humiditySetpoint"] = 40.0
+	d.Commands = append(d.Commands, gosmart.DeviceCommand{
+		Command:    "setHumiditySetpoint",
+		Capability: "Thermostat",
+		Params:     map[string]interface{}{"humidity": "NUMBER"},
+	})
+	return d
+}
+
+func TestThermostatHumidity(t *testing.T) {
+	plain := humidifying("2")
+	delete(plain.Attributes, "thermostatOperatingState")
+	s := newServer(t, humidifying("1"), plain, thermostat("3"))
+	st := connect(t, s, gosmart.Config{})
+
+	var th gosmart.Thermostat
+	for _, id := range []string{"1", "2"} {
+		if !device(t, st, id).As(&th) {
+			t.Fatalf("device %s: As(*Thermostat) = false", id)
+		}
+		if v, ok := th.HumiditySetpoint(); !ok || v != 40 {
+			t.Errorf("device %s: HumiditySetpoint() = %v, %v; want 40", id, v, ok)
+		}
+		if err := th.SetHumiditySetpoint(55); err != nil {
+			t.Fatalf("device %s: %v", id, err)
+		}
+		if err := th.SetHumiditySetpoint(120); err == nil {
+			t.Errorf("device %s: out of range setpoint accepted", id)
+		}
+	}
+	calls := s.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("server received %+v, want one call per device", calls)
+	}
+	for _, c := range calls {
+		if c.Command != "setHumiditySetpoint" || len(c.Args) != 1 || c.Args[0] != "55" {
+			t.Errorf("server received %+v", c)
+		}
+	}
+
+	// Humidity and runtimes combine.
+	device(t, st, "1").As(&th)
+	if _, _, err := th.RuntimeToday(); err != nil {
+		t.Errorf("humidity thermostat reporting its operating state: RuntimeToday() = %v", err)
+	}
+	device(t, st, "2").As(&th)
+	if _, _, err := th.RuntimeToday(); !errors.Is(err, gosmart.ErrUnsupported) {
+		t.Errorf("thermostat without an operating state: RuntimeToday() = %v, want ErrUnsupported", err)
+	}
+
+	// Thermostats without a humidifier report no setpoint and reject
+	// setting one.
+	device(t, st, "3").As(&th)
+	if v, ok := th.HumiditySetpoint(); ok {
+		t.Errorf("thermostat without a humidifier: HumiditySetpoint() = %v, true", v)
+	}
+	if err := th.SetHumiditySetpoint(55); !errors.Is(err, gosmart.ErrUnsupported) {
+		t.Errorf("thermostat without a humidifier: SetHumiditySetpoint() = %v, want ErrUnsupported", err)
+	}
+	if n := len(s.Calls()); n != 2 {
+		t.Errorf("unsupported setpoint sent a command")
+	}
+}
+
+func TestCommandCapability(t *testing.T) {
+	multi := lamp("1")
+	multi.Commands = append(multi.Commands,
+		gosmart.DeviceCommand{Command: "refresh", Capability: "Refresh"},
+		gosmart.DeviceCommand{Command: "refresh", Capability: "Health Check"},
+	)
+	s := newServer(t, multi)
+	st := connect(t, s, gosmart.Config{})
+	d := device(t, st, "1")
+
+	if c, ok := d.CommandCapability("refresh"); !ok || c != "Refresh" {
+		t.Errorf("CommandCapability(refresh) = %q, %v; want the first capability", c, ok)
+	}
+	if caps := d.CommandCapabilities("refresh"); !reflect.DeepEqual(caps, []string{"Refresh", "Health Check"}) {
+		t.Errorf("CommandCapabilities(refresh) = %q, want both capabilities", caps)
+	}
+	if c, ok := d.CommandCapability("setLevel"); !ok || c != "Switch Level" {
+		t.Errorf("CommandCapability(setLevel) = %q, %v; want Switch Level", c, ok)
+	}
+	if c, ok := d.CommandCapability("lock"); ok {
+		t.Errorf("CommandCapability(lock) = %q, want none", c)
+	}
+	if caps := d.CommandCapabilities("lock"); len(caps) != 0 {
+		t.Errorf("CommandCapabilities(lock) = %q, want none", caps)
+	}
+}
+
+func TestControllable(t *testing.T) {
+	status := lamp("2")
+	status.Commands = nil
+	onOnly := lamp("3")
+	onOnly.Commands = onOnly.Commands[:1]
+	s := newServer(t, lamp("1"), status, onOnly)
+	st := connect(t, s, gosmart.Config{})
+
+	want := map[string]bool{"1": true, "2": false, "3": false}
+	for id, w := range want {
+		if got := device(t, st, id).Controllable(); got != w {
+			t.Errorf("device %s: Controllable() = %v, want %v", id, got, w)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Capability identifies a capability of a device and its version, as
+// reported in the capabilities field of the device info.
+type Capability struct {
+	ID string `json:"id"`
+	// Version is the capability version. Capabilities reported without
+	// one are version 1.
+	Version int `json:"version"`
+}
+
+// UnmarshalJSON decodes a capability given either as a plain name or as an
+// object with "id" (or "name") and "version" keys. The version may be a
+// number or a string.
+func (c *Capability) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		*c = Capability{ID: name, Version: 1}
+		return nil
+	}
+	var raw struct {
+		ID      string      `json:"id"`
+		Name    string      `json:"name"`
+		Version interface{} `json:"version"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*c = Capability{ID: raw.ID, Version: 1}
+	if c.ID == "" {
+		c.ID = raw.Name
+	}
+	switch t := raw.Version.(type) {
+	case float64:
+		c.Version = int(t)
+	case string:
+		if v, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(t), "v")); err == nil {
+			c.Version = v
+		}
+	}
+	return nil
+}
+
+// CapabilityVersion returns the version of the named capability (case
+// insensitive), as reported with the device details. Returns false if the
+// device does not report the capability.
+func (d *Device) CapabilityVersion(capability string) (int, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.info == nil {
+		return 0, false
+	}
+	for _, c := range d.info.Capabilities {
+		if strings.EqualFold(c.ID, capability) {
+			return c.Version, true
+		}
+	}
+	return 0, false
+}
+
+// Capabilities returns the capabilities of the device: those reported with
+// the device details, followed by those defining its commands (sorted), as
+// read by the last refresh.
+func (d *Device) Capabilities() []string {
+	var ret []string
+	seen := make(map[string]bool)
+	add := func(c string) {
+		if k := capabilityKey(c); c != "" && !seen[k] {
+			seen[k] = true
+			ret = append(ret, c)
+		}
+	}
+	d.mu.Lock()
+	if d.info != nil {
+		for _, c := range d.info.Capabilities {
+			add(c.ID)
+		}
+	}
+	var fromCmds []string
+	for _, caps := range d.cmdCaps {
+		fromCmds = append(fromCmds, caps...)
+	}
+	d.mu.Unlock()
+
+	sort.Strings(fromCmds)
+	for _, c := range fromCmds {
+		add(c)
+	}
+	return ret
+}
+
+// HasCapability returns true if the device has the named capability (see
+// Capabilities). Names are compared ignoring case and spaces, so
+// "switchLevel" matches "Switch Level".
+func (d *Device) HasCapability(capability string) bool {
+	k := capabilityKey(capability)
+	for _, c := range d.Capabilities() {
+		if capabilityKey(c) == k {
+			return true
+		}
+	}
+	return false
+}
+
+// capabilityKey normalizes a capability name for comparison.
+func capabilityKey(capability string) string {
+	return strings.ToLower(strings.Replace(capability, " ", "", -1))
+}
+
+// DevicesWithCapabilityVersion returns the devices reporting capability
+// (case insensitive) at version minVersion or later. Devices not reporting
+// their capabilities with the device details are left out.
+func (st *SmartThings) DevicesWithCapabilityVersion(capability string, minVersion int) []*Device {
+	return st.Select().Where(func(d *Device) bool {
+		v, ok := d.CapabilityVersion(capability)
+		return ok && v >= minVersion
+	}).Devices()
+}
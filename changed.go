@@ -0,0 +1,132 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"errors"
+	"golang.org/x/net/context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// LastRefresh returns the time the last successful Refresh or
+// RefreshChangedSince started. Zero if the devices were never refreshed.
+func (st *SmartThings) LastRefresh() time.Time {
+	if st.smartThings == nil {
+		return time.Time{}
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.refreshedAt
+}
+
+// RefreshChangedSince refreshes only the devices the server reports as
+// changed since t (usually LastRefresh), which is much cheaper than Refresh
+// for large, mostly static accounts. It falls back to a full Refresh if the
+// server does not support the query, or reports a device not yet known.
+// Removed devices are only detected by a full Refresh. In v1 mode (see
+// Config.APIVersion), the query is not available and a full Refresh is done.
+func (st *SmartThings) RefreshChangedSince(t time.Time) error {
+	if err := st.connected(); err != nil {
+		return err
+	}
+	if st.v1() {
+		return st.Refresh()
+	}
+	ctx := st.withRetryBudget(context.Background())
+	start := time.Now()
+	changed, err := GetDevicesChangedSince(ctx, st.client, st.endpoint, t)
+	if err != nil {
+		if unsupportedQuery(err) {
+			return st.RefreshContext(ctx)
+		}
+		return err
+	}
+
+	var devices []*Device
+	for _, dl := range changed {
+		d, err := st.DeviceByID(dl.ID)
+		if err != nil {
+			return st.RefreshContext(ctx)
+		}
+		devices = append(devices, d)
+	}
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+	)
+	each(devices, func(d *Device) {
+		if err := st.loadDevice(ctx, d, nil); err != nil {
+			mu.Lock()
+			if firstErr == nil {
+				firstErr = err
+			}
+			mu.Unlock()
+		}
+	})
+	if firstErr != nil {
+		return firstErr
+	}
+	st.mu.Lock()
+	st.refreshedAt = start
+	st.mu.Unlock()
+	return nil
+}
+
+// unsupportedQuery returns true if err means the server does not support
+// the changed devices query.
+func unsupportedQuery(err error) bool {
+	var he *HTTPError
+	if !errors.As(err, &he) {
+		return false
+	}
+	switch he.StatusCode {
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusNotImplemented:
+		return true
+	}
+	return false
+}
+
+// RefreshResult describes what changed in a refresh: the devices added,
+// removed and moved (as in DeviceDelta), and the attribute changes of the
+// devices known before the refresh, keyed by device ID. Devices without
+// changes are not listed in Changed.
+type RefreshResult struct {
+	DeviceDelta
+	Changed map[string][]AttributeChange
+}
+
+// RefreshDiff works like Refresh, and returns what changed compared to the
+// state before the refresh. If Refresh fails with a *RefreshError (see
+// Config.SkipDeviceErrors), the result covers the devices loaded and the
+// error is returned along with it.
+func (st *SmartThings) RefreshDiff() (*RefreshResult, error) {
+	old := make(map[string]map[string]interface{})
+	for _, d := range st.DeviceList() {
+		old[d.ID] = d.RawAttributes()
+	}
+	err := st.Refresh()
+	var re *RefreshError
+	if err != nil && !errors.As(err, &re) {
+		return nil, err
+	}
+
+	ret := &RefreshResult{DeviceDelta: st.DeviceDelta(), Changed: make(map[string][]AttributeChange)}
+	now := time.Now()
+	for _, d := range st.DeviceList() {
+		prev, ok := old[d.ID]
+		if !ok {
+			continue
+		}
+		if changes := diffAttributes(d.ID, prev, d.RawAttributes(), now); len(changes) > 0 {
+			ret.Changed[d.ID] = changes
+		}
+	}
+	return ret, err
+}
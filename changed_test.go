@@ -0,0 +1,84 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smoogle/gosmart"
+	"github.com/smoogle/gosmart/gosmarttest"
+)
+
+// detailFetches returns the IDs of the devices whose details or commands
+// were read in requests, sorted and without duplicates.
+func detailFetches(requests []gosmarttest.Request) []string {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, r := range requests {
+		parts := strings.Split(strings.Trim(r.Path, "/"), "/")
+		if r.Method != http.MethodGet || len(parts) < 2 || parts[0] != "devices" || seen[parts[1]] {
+			continue
+		}
+		seen[parts[1]] = true
+		ids = append(ids, parts[1])
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestRefreshChangedSince(t *testing.T) {
+	s := newServer(t, lamp("1"), lamp("2"), lamp("3"))
+	// Keep the fixtures clear of the millisecond the refresh starts in.
+	time.Sleep(5 * time.Millisecond)
+	st := connect(t, s, gosmart.Config{})
+	since := st.LastRefresh()
+	if since.IsZero() {
+		t.Fatal("LastRefresh() is zero after connecting")
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	s.SetAttribute("2", "switch", "on")
+	time.Sleep(5 * time.Millisecond)
+	before := len(s.Requests())
+	if err := st.RefreshChangedSince(since); err != nil {
+		t.Fatal(err)
+	}
+	if got := detailFetches(s.Requests()[before:]); !reflect.DeepEqual(got, []string{"2"}) {
+		t.Errorf("re-fetched devices %q, want only the changed one", got)
+	}
+	if device(t, st, "2").Attribute("switch") != 1 {
+		t.Error("device 2 not refreshed")
+	}
+	if !st.LastRefresh().After(since) {
+		t.Errorf("LastRefresh() = %v, want it moved past %v", st.LastRefresh(), since)
+	}
+
+	// Nothing changed: nothing is fetched.
+	since = st.LastRefresh()
+	time.Sleep(5 * time.Millisecond)
+	before = len(s.Requests())
+	if err := st.RefreshChangedSince(since); err != nil {
+		t.Fatal(err)
+	}
+	if got := detailFetches(s.Requests()[before:]); len(got) != 0 {
+		t.Errorf("re-fetched devices %q, want none", got)
+	}
+
+	// A new device falls back to a full refresh.
+	s.AddDevice(lamp("4"))
+	if err := st.RefreshChangedSince(st.LastRefresh()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.DeviceByID("4"); err != nil {
+		t.Errorf("new device not found after the fallback refresh: %v", err)
+	}
+}
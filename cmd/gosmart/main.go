@@ -0,0 +1,245 @@
+// Command gosmart is a minimal command line interface to SmartThings.
+//
+// Usage:
+//
+//	gosmart [flags] list
+//	gosmart [flags] get <device> <attribute>
+//	gosmart [flags] call <device> <command> [args...]
+//	gosmart [flags] watch
+//
+// Devices may be given by ID, name or display name. The connection flags
+// may also be read from a JSON configuration file given with -config, e.g.
+//
+//	{"client": "...", "secret": "...", "tokenfile": "/home/me/.gosmart-token.json"}
+//
+// Flags given on the command line override the file.
+//
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/smoogle/gosmart"
+	"golang.org/x/net/context"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// errUsage is returned for invalid command lines.
+var errUsage = errors.New("usage: gosmart [flags] list | get <device> <attribute> | call <device> <command> [args...] | watch")
+
+// settings holds the connection settings, given as flags or read from the
+// configuration file.
+type settings struct {
+	Client    string `json:"client"`
+	Secret    string `json:"secret"`
+	TokenFile string `json:"tokenfile"`
+	Token     string `json:"token"`
+	Endpoint  string `json:"endpoint"`
+}
+
+// command is a validated subcommand and its arguments.
+type command struct {
+	name string
+	args []string
+}
+
+func main() {
+	// No date on log messages
+	log.SetFlags(0)
+
+	if err := cli(context.Background(), os.Args[1:], os.Stdout); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// cli runs the command line in args (without the program name), writing the
+// output to w. The subcommand is checked before connecting, so an invalid
+// command line never starts the OAuth login.
+func cli(ctx context.Context, args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("gosmart", flag.ContinueOnError)
+	var s settings
+	fs.StringVar(&s.Client, "client", "", "OAuth Client ID")
+	fs.StringVar(&s.Secret, "secret", "", "OAuth Secret")
+	fs.StringVar(&s.TokenFile, "tokenfile", "", "Token filename")
+	fs.StringVar(&s.Token, "token", "", "Personal access token (skips OAuth)")
+	fs.StringVar(&s.Endpoint, "endpoint", "", "Endpoint URI (skips discovery)")
+	configFile := fs.String("config", "", "JSON file holding the settings above (flags given override it)")
+	interval := fs.Duration("interval", 30*time.Second, "Refresh interval for watch")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cmd, err := parseCommand(fs.Args())
+	if err != nil {
+		return err
+	}
+	if *configFile != "" {
+		saved, err := loadSettings(*configFile)
+		if err != nil {
+			return err
+		}
+		s = s.merge(saved)
+	}
+	st, err := gosmart.Connect(ctx, s.config())
+	if err != nil {
+		return err
+	}
+	return run(ctx, &st, cmd, w, *interval)
+}
+
+// loadSettings reads the settings from a JSON configuration file.
+func loadSettings(fname string) (settings, error) {
+	var s settings
+	contents, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(contents, &s); err != nil {
+		return s, fmt.Errorf("invalid configuration file %s: %v", fname, err)
+	}
+	return s, nil
+}
+
+// merge returns s with its blank fields set from o.
+func (s settings) merge(o settings) settings {
+	for _, f := range []struct{ dst, src *string }{
+		{&s.Client, &o.Client},
+		{&s.Secret, &o.Secret},
+		{&s.TokenFile, &o.TokenFile},
+		{&s.Token, &o.Token},
+		{&s.Endpoint, &o.Endpoint},
+	} {
+		if *f.dst == "" {
+			*f.dst = *f.src
+		}
+	}
+	return s
+}
+
+// config returns the gosmart configuration for s.
+func (s settings) config() gosmart.Config {
+	cfg := gosmart.Config{
+		ClientID:    s.Client,
+		Secret:      s.Secret,
+		Endpoint:    s.Endpoint,
+		AccessToken: s.Token,
+	}
+	if s.TokenFile != "" {
+		cfg.TokenStore = gosmart.NewFileTokenStore(s.TokenFile)
+	}
+	return cfg
+}
+
+// parseCommand checks the subcommand in args and its number of arguments.
+func parseCommand(args []string) (command, error) {
+	if len(args) == 0 {
+		return command{}, errUsage
+	}
+	var ok bool
+	switch args[0] {
+	case "list", "watch":
+		ok = len(args) == 1
+	case "get":
+		ok = len(args) == 3
+	case "call":
+		ok = len(args) >= 3
+	default:
+		return command{}, fmt.Errorf("unknown command %q\n%v", args[0], errUsage)
+	}
+	if !ok {
+		return command{}, errUsage
+	}
+	return command{name: args[0], args: args[1:]}, nil
+}
+
+// run dispatches cmd, writing its output to w.
+func run(ctx context.Context, st *gosmart.SmartThings, cmd command, w io.Writer, interval time.Duration) error {
+	switch cmd.name {
+	case "list":
+		return list(st, w)
+	case "get":
+		return get(st, w, cmd.args[0], cmd.args[1])
+	case "call":
+		return call(st, cmd.args[0], cmd.args[1], cmd.args[2:])
+	case "watch":
+		return watch(ctx, st, w, interval)
+	}
+	return errUsage
+}
+
+// findDevice returns the device with the given ID or name.
+func findDevice(st *gosmart.SmartThings, name string) (*gosmart.Device, error) {
+	if d, err := st.DeviceByID(name); err == nil {
+		return d, nil
+	}
+	return st.DeviceByName(name)
+}
+
+// list prints the ID and display name of all devices.
+func list(st *gosmart.SmartThings, w io.Writer) error {
+	for _, d := range st.DeviceList() {
+		fmt.Fprintf(w, "%s\t%s\n", d.ID, d.DisplayName)
+	}
+	return nil
+}
+
+// get prints the value of one attribute of a device.
+func get(st *gosmart.SmartThings, w io.Writer, device, attr string) error {
+	d, err := findDevice(st, device)
+	if err != nil {
+		return err
+	}
+	v, ok := d.RawAttributes()[attr]
+	if !ok {
+		return fmt.Errorf("device %q has no attribute %q", device, attr)
+	}
+	fmt.Fprintln(w, v)
+	return nil
+}
+
+// call issues a command on a device.
+func call(st *gosmart.SmartThings, device, cmd string, args []string) error {
+	d, err := findDevice(st, device)
+	if err != nil {
+		return err
+	}
+	var iargs []interface{}
+	for _, a := range args {
+		iargs = append(iargs, a)
+	}
+	return d.CallWithArgs(cmd, iargs...)
+}
+
+// watch prints the attribute changes of all devices, refreshed every
+// interval, until ctx is done.
+func watch(ctx context.Context, st *gosmart.SmartThings, w io.Writer, interval time.Duration) error {
+	ch, err := st.Watch(ctx, interval)
+	if err != nil {
+		return err
+	}
+	for c := range ch {
+		fmt.Fprintf(w, "%s %s %s: %v -> %v\n", c.Time.Format(time.RFC3339), c.DeviceID, c.Name, value(c.Old), value(c.New))
+	}
+	return nil
+}
+
+// value formats an attribute value for display.
+func value(v interface{}) string {
+	if v == nil {
+		return "-"
+	}
+	return strings.TrimSpace(fmt.Sprint(v))
+}
@@ -0,0 +1,192 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smoogle/gosmart"
+	"github.com/smoogle/gosmart/gosmarttest"
+	"golang.org/x/net/context"
+)
+
+// lamp returns a switch fixture.
+func lamp(id string) gosmarttest.Device {
+	return gosmarttest.Device{
+		ID:          id,
+		Name:        "Dimmer " + id,
+		DisplayName: "Lamp " + id,
+		Attributes:  map[string]interface{}{"switch": "off", "level": 0.0},
+		Commands: []gosmart.DeviceCommand{
+			{Command: "on", Capability: "Switch"},
+			{Command: "off", Capability: "Switch"},
+			{Command: "setLevel", Capability: "Switch Level", Params: map[string]interface{}{"level": "NUMBER"}},
+		},
+	}
+}
+
+// newServer starts a mock server closed when the test finishes.
+func newServer(t *testing.T, devices ...gosmarttest.Device) *gosmarttest.Server {
+	t.Helper()
+	s := gosmarttest.NewServer(devices...)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestParseCommand(t *testing.T) {
+	valid := map[string]command{
+		"list":                  {name: "list", args: []string{}},
+		"watch":                 {name: "watch", args: []string{}},
+		"get lamp switch":       {name: "get", args: []string{"lamp", "switch"}},
+		"call lamp on":          {name: "call", args: []string{"lamp", "on"}},
+		"call lamp setLevel 50": {name: "call", args: []string{"lamp", "setLevel", "50"}},
+	}
+	for line, want := range valid {
+		got, err := parseCommand(strings.Fields(line))
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("parseCommand(%q) = %+v, %v; want %+v", line, got, err, want)
+		}
+	}
+	for _, line := range []string{"", "list all", "watch 5", "get lamp", "get lamp switch level", "call lamp", "bogus"} {
+		if got, err := parseCommand(strings.Fields(line)); err == nil {
+			t.Errorf("parseCommand(%q) = %+v, want an error", line, got)
+		}
+	}
+}
+
+func TestSettings(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "gosmart.json")
+	if err := ioutil.WriteFile(fname, []byte(`{"client": "file-client", "secret": "file-secret", "tokenfile": "token.json", "endpoint": "http://file"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := loadSettings(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Flags given override the file.
+	got := settings{Client: "flag-client"}.merge(saved)
+	want := settings{Client: "flag-client", Secret: "file-secret", TokenFile: "token.json", Endpoint: "http://file"}
+	if got != want {
+		t.Errorf("merged settings = %+v, want %+v", got, want)
+	}
+	cfg := got.config()
+	if cfg.ClientID != "flag-client" || cfg.Secret != "file-secret" || cfg.Endpoint != "http://file" || cfg.TokenStore == nil {
+		t.Errorf("config() = %+v", cfg)
+	}
+
+	if _, err := loadSettings(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("missing configuration file accepted")
+	}
+	if err := ioutil.WriteFile(fname, []byte(`{"client": `), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadSettings(fname); err == nil {
+		t.Error("invalid configuration file accepted")
+	}
+}
+
+func TestCLI(t *testing.T) {
+	s := newServer(t, lamp("1"), lamp("2"))
+	fname := filepath.Join(t.TempDir(), "gosmart.json")
+	if err := ioutil.WriteFile(fname, []byte(`{"token": "secret", "endpoint": "`+s.URL+`"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	exec := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		err := cli(context.Background(), append([]string{"-config", fname}, args...), &out)
+		return out.String(), err
+	}
+
+	if out, err := exec("list"); err != nil || out != "1\tLamp 1\n2\tLamp 2\n" {
+		t.Errorf("list printed %q, %v", out, err)
+	}
+	if _, err := exec("call", "Lamp 2", "setLevel", "40"); err != nil {
+		t.Fatal(err)
+	}
+	calls := s.Calls()
+	if len(calls) != 1 || calls[0].DeviceID != "2" || calls[0].Command != "setLevel" || !reflect.DeepEqual(calls[0].Args, []string{"40"}) {
+		t.Errorf("server received %+v", calls)
+	}
+	if out, err := exec("get", "2", "level"); err != nil || out != "40\n" {
+		t.Errorf("get printed %q, %v; want 40", out, err)
+	}
+	if _, err := exec("get", "2", "color"); err == nil {
+		t.Error("get of an unknown attribute succeeded")
+	}
+	if _, err := exec("call", "Lamp 9", "on"); err == nil {
+		t.Error("call on an unknown device succeeded")
+	}
+
+	// Invalid command lines are rejected before connecting.
+	before := len(s.Requests())
+	for _, args := range [][]string{{}, {"bogus"}, {"get", "1"}} {
+		if _, err := exec(args...); err == nil {
+			t.Errorf("command line %q accepted", args)
+		}
+	}
+	if n := len(s.Requests()) - before; n != 0 {
+		t.Errorf("invalid command lines sent %d requests", n)
+	}
+}
+
+func TestCLIWatch(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	st, err := s.Connect(gosmart.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := &syncBuffer{}
+	done := make(chan error, 1)
+	go func() {
+		done <- run(ctx, st, command{name: "watch"}, out, 10*time.Millisecond)
+	}()
+
+	// Wait for the watch to poll, then change the device.
+	before := len(s.Requests())
+	for deadline := time.Now().Add(5 * time.Second); len(s.Requests()) == before; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("watch is not polling")
+		}
+	}
+	s.SetAttribute("1", "switch", "on")
+	for deadline := time.Now().Add(5 * time.Second); !strings.Contains(out.String(), " 1 switch: off -> on\n"); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("watch printed %q, want the switch change", out.String())
+		}
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+}
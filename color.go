@@ -0,0 +1,196 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"fmt"
+	"math"
+)
+
+// SmartThings describes colors using the hue, saturation and level
+// attributes, all in the 0-100 range. Hue is a fraction of the color wheel
+// (0 and 100 are red, 33.3 green, 66.7 blue), and level is the brightness.
+// We treat these as the HSV color model, with V being the level.
+
+// ColorRGB returns the current color of the device as RGB, converted from
+// its hue, saturation and level attributes. If the device does not report a
+// level, full brightness is assumed. Returns false if the device does not
+// report hue and saturation.
+func (d *Device) ColorRGB() (r, g, b uint8, ok bool) {
+	snap := d.AttributeSnapshot("hue", "saturation", "level")
+	h, hok := snap["hue"]
+	s, sok := snap["saturation"]
+	if !hok || !sok {
+		return 0, 0, 0, false
+	}
+	v, vok := snap["level"]
+	if !vok {
+		v = 100
+	}
+	r, g, b = hsvToRGB(h, s, v)
+	return r, g, b, true
+}
+
+// SetColorRGB sets the color of the device from RGB values. The color is
+// converted into hue, saturation and level and sent with the setColor
+// command. Devices without setColor get separate setHue and setSaturation
+// commands instead (and the level is left unchanged).
+func (d *Device) SetColorRGB(r, g, b uint8) error {
+	if err := d.st.writable(); err != nil {
+		return err
+	}
+	h, s, v := rgbToHSV(r, g, b)
+	if d.HasCommand("setColor") {
+		return d.CallNamed("setColor", map[string]interface{}{
+			"hue":        h,
+			"saturation": s,
+			"level":      v,
+		})
+	}
+	if !d.HasCommand("setHue") || !d.HasCommand("setSaturation") {
+		return fmt.Errorf("%w: no color commands on device %s", ErrCommandUnavailable, d.ID)
+	}
+	if err := d.Call("setHue", h); err != nil {
+		return err
+	}
+	return d.Call("setSaturation", s)
+}
+
+// SetColor sets the color of the device from hue and saturation (both
+// 0-100), sent as the named hue and saturation arguments of the setColor
+// command (see CallNamed): query parameters of the command request, or JSON
+// command arguments in v1 mode. The level is left unchanged.
+func (d *Device) SetColor(hue, saturation float64) error {
+	if err := d.st.writable(); err != nil {
+		return err
+	}
+	if !d.HasCommand("setColor") {
+		return fmt.Errorf("%w: setColor on device %s", ErrCommandUnavailable, d.ID)
+	}
+	if hue < 0 || hue > 100 || saturation < 0 || saturation > 100 {
+		return fmt.Errorf("invalid color hue %v, saturation %v, expected 0 to 100", hue, saturation)
+	}
+	return d.CallNamed("setColor", map[string]interface{}{
+		"hue":        hue,
+		"saturation": saturation,
+	})
+}
+
+// SetColorTemperature sets the white color temperature of the device, in
+// Kelvin, sent as the argument of the setColorTemperature command. The value
+// is checked against the range declared by the command schema (or
+// 1000-30000 if none) before the command is sent.
+func (d *Device) SetColorTemperature(kelvin int) error {
+	if err := d.st.writable(); err != nil {
+		return err
+	}
+	if !d.HasCommand("setColorTemperature") {
+		return fmt.Errorf("%w: setColorTemperature on device %s", ErrCommandUnavailable, d.ID)
+	}
+	if err := d.checkRange("setColorTemperature", 0, float64(kelvin), 1000, 30000); err != nil {
+		return err
+	}
+	return d.Call("setColorTemperature", float64(kelvin))
+}
+
+// Color modes, as reported by the colorMode attribute.
+const (
+	// ColorModeRGB means the device supports setting a color.
+	ColorModeRGB = "RGB"
+	// ColorModeTemperature means the device supports setting a white color
+	// temperature.
+	ColorModeTemperature = "CT"
+)
+
+// SupportedColorModes returns the color modes the device supports: the
+// values declared for its colorMode attribute, if reported, or else the
+// modes inferred from its capabilities and commands (ColorModeRGB for
+// Color Control, ColorModeTemperature for Color Temperature). Returns nil
+// for devices without color support.
+func (d *Device) SupportedColorModes() []string {
+	if t, ok := d.AttributeType("colorMode"); ok && len(t.Values) > 0 {
+		return append([]string(nil), t.Values...)
+	}
+	var ret []string
+	if d.HasCapability("Color Control") || d.HasCommand("setColor") || d.HasCommand("setHue") {
+		ret = append(ret, ColorModeRGB)
+	}
+	if d.HasCapability("Color Temperature") || d.HasCommand("setColorTemperature") {
+		ret = append(ret, ColorModeTemperature)
+	}
+	return ret
+}
+
+// hsvToRGB converts hue, saturation and value (all 0-100) to RGB.
+func hsvToRGB(h, s, v float64) (r, g, b uint8) {
+	h = math.Mod(clamp(h, 0, 100)/100*360, 360)
+	s = clamp(s, 0, 100) / 100
+	v = clamp(v, 0, 100) / 100
+
+	c := v * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := v - c
+
+	var rf, gf, bf float64
+	switch {
+	case h < 60:
+		rf, gf, bf = c, x, 0
+	case h < 120:
+		rf, gf, bf = x, c, 0
+	case h < 180:
+		rf, gf, bf = 0, c, x
+	case h < 240:
+		rf, gf, bf = 0, x, c
+	case h < 300:
+		rf, gf, bf = x, 0, c
+	default:
+		rf, gf, bf = c, 0, x
+	}
+	return to8bit(rf + m), to8bit(gf + m), to8bit(bf + m)
+}
+
+// rgbToHSV converts RGB to hue, saturation and value (all 0-100, rounded to
+// two decimal places).
+func rgbToHSV(r, g, b uint8) (h, s, v float64) {
+	rf, gf, bf := float64(r)/255, float64(g)/255, float64(b)/255
+	max := math.Max(rf, math.Max(gf, bf))
+	min := math.Min(rf, math.Min(gf, bf))
+	delta := max - min
+
+	switch {
+	case delta == 0:
+		h = 0
+	case max == rf:
+		h = 60 * math.Mod((gf-bf)/delta, 6)
+	case max == gf:
+		h = 60 * ((bf-rf)/delta + 2)
+	default:
+		h = 60 * ((rf-gf)/delta + 4)
+	}
+	if h < 0 {
+		h += 360
+	}
+	if max > 0 {
+		s = delta / max
+	}
+	return round2(h / 360 * 100), round2(s * 100), round2(max * 100)
+}
+
+// clamp limits v to the [min, max] range.
+func clamp(v, min, max float64) float64 {
+	return math.Max(min, math.Min(max, v))
+}
+
+// to8bit converts a 0-1 color component to 0-255.
+func to8bit(f float64) uint8 {
+	return uint8(math.Round(clamp(f, 0, 1) * 255))
+}
+
+// round2 rounds f to two decimal places.
+func round2(f float64) float64 {
+	return math.Round(f*100) / 100
+}
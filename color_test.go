@@ -0,0 +1,179 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/smoogle/gosmart"
+	"github.com/smoogle/gosmart/gosmarttest"
+)
+
+// bulb returns a color bulb fixture, showing red at full brightness.
+func bulb(id string) gosmarttest.Device {
+	d := lamp(id)
+	d.Attributes["hue"] = 0.0
+	d.Attributes["saturation"] = 100.0
+	d.Attributes["level"] = 100.0
+	d.Commands = append(d.Commands, gosmart.DeviceCommand{Command: "setColor", Capability: "Color Control"})
+	return d
+}
+
+// setColor applies the named arguments of setColor to the device.
+func setColor(d *gosmarttest.Device, _ []string, query url.Values) {
+	for _, attr := range []string{"hue", "saturation", "level"} {
+		if f, err := strconv.ParseFloat(query.Get(attr), 64); err == nil {
+			d.Attributes[attr] = f
+		}
+	}
+}
+
+func TestColorRGB(t *testing.T) {
+	s := newServer(t, bulb("1"), lamp("2"))
+	s.Handle("setColor", setColor)
+	st := connect(t, s, gosmart.Config{})
+	d := device(t, st, "1")
+
+	if r, g, b, ok := d.ColorRGB(); r != 255 || g != 0 || b != 0 || !ok {
+		t.Errorf("ColorRGB() = %d, %d, %d, %v; want 255, 0, 0, true", r, g, b, ok)
+	}
+	if _, _, _, ok := device(t, st, "2").ColorRGB(); ok {
+		t.Error("ColorRGB() reported a color for a device without hue and saturation")
+	}
+
+	colors := [][3]uint8{
+		{255, 0, 0},
+		{0, 255, 0},
+		{0, 0, 255},
+		{255, 255, 0},
+		{0, 255, 255},
+		{255, 0, 255},
+		{255, 255, 255},
+		{0, 0, 0},
+	}
+	for _, c := range colors {
+		if err := d.SetColorRGB(c[0], c[1], c[2]); err != nil {
+			t.Fatalf("SetColorRGB(%v): %v", c, err)
+		}
+		if err := st.Refresh(); err != nil {
+			t.Fatalf("refresh: %v", err)
+		}
+		if r, g, b, _ := d.ColorRGB(); r != c[0] || g != c[1] || b != c[2] {
+			t.Errorf("SetColorRGB(%v) round-tripped to %v", c, [3]uint8{r, g, b})
+		}
+	}
+}
+
+func TestSetColorRGBHueSaturation(t *testing.T) {
+	dev := lamp("1")
+	dev.Attributes["level"] = 100.0
+	dev.Commands = append(dev.Commands,
+		gosmart.DeviceCommand{Command: "setHue", Capability: "Color Control"},
+		gosmart.DeviceCommand{Command: "setSaturation", Capability: "Color Control"},
+	)
+	s := newServer(t, dev, lamp("2"))
+	st := connect(t, s, gosmart.Config{})
+
+	if err := device(t, st, "1").SetColorRGB(0, 0, 255); err != nil {
+		t.Fatalf("SetColorRGB: %v", err)
+	}
+	if h, _ := s.Attribute("1", "hue"); h != 66.67 {
+		t.Errorf("hue = %v, want 66.67", h)
+	}
+	if sat, _ := s.Attribute("1", "saturation"); sat != 100.0 {
+		t.Errorf("saturation = %v, want 100", sat)
+	}
+	if err := device(t, st, "2").SetColorRGB(0, 0, 255); err == nil {
+		t.Error("SetColorRGB succeeded on a device without color commands")
+	}
+}
+
+func TestSetColorRequests(t *testing.T) {
+	dev := bulb("1")
+	dev.Commands = append(dev.Commands, gosmart.DeviceCommand{Command: "setColorTemperature", Capability: "Color Temperature"})
+	s := newServer(t, dev, lamp("2"))
+	st := connect(t, s, gosmart.Config{})
+	d := device(t, st, "1")
+	// last returns the request sent by fn, failing if it sent another
+	// number.
+	last := func(what string, fn func() error) gosmarttest.Request {
+		t.Helper()
+		before := len(s.Requests())
+		if err := fn(); err != nil {
+			t.Fatalf("%s: %v", what, err)
+		}
+		reqs := s.Requests()[before:]
+		if len(reqs) != 1 {
+			t.Fatalf("%s sent %d requests, want 1", what, len(reqs))
+		}
+		return reqs[0]
+	}
+
+	r := last("SetColor", func() error { return d.SetColor(50, 75.5) })
+	want := url.Values{"hue": {"50"}, "saturation": {"75.5"}}
+	if r.Path != "/devices/1/setColor" || !reflect.DeepEqual(r.Query, want) {
+		t.Errorf("SetColor sent %s %s?%v, want /devices/1/setColor?%v", r.Method, r.Path, r.Query, want)
+	}
+	r = last("SetColorTemperature", func() error { return d.SetColorTemperature(2700) })
+	if r.Path != "/devices/1/setColorTemperature/2700" || len(r.Query) != 0 {
+		t.Errorf("SetColorTemperature sent %s %s?%v, want /devices/1/setColorTemperature/2700", r.Method, r.Path, r.Query)
+	}
+
+	// Invalid values and devices without the commands send nothing.
+	before := len(s.Requests())
+	if err := d.SetColor(120, 50); err == nil {
+		t.Error("SetColor(120, 50) succeeded")
+	}
+	if err := d.SetColorTemperature(500); err == nil {
+		t.Error("SetColorTemperature(500) succeeded")
+	}
+	l := device(t, st, "2")
+	if err := l.SetColor(50, 50); !errors.Is(err, gosmart.ErrCommandUnavailable) {
+		t.Errorf("SetColor on a lamp = %v, want ErrCommandUnavailable", err)
+	}
+	if err := l.SetColorTemperature(2700); !errors.Is(err, gosmart.ErrCommandUnavailable) {
+		t.Errorf("SetColorTemperature on a lamp = %v, want ErrCommandUnavailable", err)
+	}
+	if n := len(s.Requests()) - before; n != 0 {
+		t.Errorf("rejected color commands sent %d requests", n)
+	}
+}
+
+func TestSupportedColorModes(t *testing.T) {
+	// A tunable white bulb, supporting only color temperature.
+	white := lamp("1")
+	white.Attributes["colorTemperature"] = 2700.0
+	white.Commands = append(white.Commands, gosmart.DeviceCommand{Command: "setColorTemperature", Capability: "Color Temperature"})
+	both := bulb("2")
+	both.Commands = append(both.Commands, gosmart.DeviceCommand{Command: "setColorTemperature", Capability: "Color Temperature"})
+	// A bulb declaring its modes, which take precedence.
+	declared := bulb("3")
+	declared.AttributeTypes = []gosmart.AttributeType{{Name: "colorMode", DataType: "ENUM", Values: []string{"CT"}}}
+	// Capabilities reported without commands.
+	reported := lamp("4")
+	reported.Capabilities = []gosmart.Capability{{ID: "colorControl"}}
+	s := newServer(t, white, both, declared, reported, bulb("5"), lamp("6"))
+	st := connect(t, s, gosmart.Config{})
+
+	want := map[string][]string{
+		"1": {gosmart.ColorModeTemperature},
+		"2": {gosmart.ColorModeRGB, gosmart.ColorModeTemperature},
+		"3": {gosmart.ColorModeTemperature},
+		"4": {gosmart.ColorModeRGB},
+		"5": {gosmart.ColorModeRGB},
+		"6": nil,
+	}
+	for id, w := range want {
+		if got := device(t, st, id).SupportedColorModes(); !reflect.DeepEqual(got, w) {
+			t.Errorf("device %s: SupportedColorModes() = %q, want %q", id, got, w)
+		}
+	}
+}
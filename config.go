@@ -0,0 +1,125 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// config returns the current configuration.
+func (st *SmartThings) config() Config {
+	if st == nil || st.smartThings == nil {
+		return Config{}
+	}
+	st.cfgMu.RLock()
+	defer st.cfgMu.RUnlock()
+	return st.cfg
+}
+
+// UpdateConfig applies cfg to a live connection without re-authenticating.
+// Only the fields read on every request or operation (retries, timeouts,
+// cooldowns, intervals, hooks, logging, rate limit warning, idempotent and
+// allowed commands, and similar tuning) can change. The fields only used by
+// Connect to authenticate and set up the connection (ClientID, Secret,
+// AccessToken, Scopes, TokenStore, TokenPrefix, Credentials, RedirectURL,
+// APIVersion, Endpoint, HTTPClient and DiscoveryRetries) must be left as
+// they were: changing any of them returns an error and leaves the
+// configuration untouched. ReadOnly can be turned on, but never off: once
+// read-only, a connection stays read-only for its whole life, and a new
+// one must be created with Connect to send commands again.
+func (st *SmartThings) UpdateConfig(cfg Config) error {
+	if st.smartThings == nil {
+		return ErrNotConnected
+	}
+	st.cfgMu.Lock()
+	defer st.cfgMu.Unlock()
+
+	if st.cfg.ReadOnly && !cfg.ReadOnly {
+		return fmt.Errorf("%w: ReadOnly cannot be turned off on a live connection", ErrReadOnly)
+	}
+	if changed := connectFieldsChanged(st.cfg, cfg); len(changed) > 0 {
+		return fmt.Errorf("%s cannot be changed without reconnecting", strings.Join(changed, ", "))
+	}
+	st.cfg = cfg
+	if st.retry != nil {
+		st.retry.setPolicy(policyFromConfig(cfg))
+	}
+	if st.rateLimit != nil {
+		st.rateLimit.setWarning(cfg.RateLimitWarning)
+	}
+	return nil
+}
+
+// connectFieldsChanged returns the names of the fields only read by Connect
+// that differ between old and cfg.
+func connectFieldsChanged(old, cfg Config) []string {
+	fields := []struct {
+		name     string
+		old, new interface{}
+	}{
+		{"ClientID", old.ClientID, cfg.ClientID},
+		{"Secret", old.Secret, cfg.Secret},
+		{"AccessToken", old.AccessToken, cfg.AccessToken},
+		{"Scopes", old.Scopes, cfg.Scopes},
+		{"TokenStore", old.TokenStore, cfg.TokenStore},
+		{"TokenPrefix", old.TokenPrefix, cfg.TokenPrefix},
+		{"Credentials", old.Credentials, cfg.Credentials},
+		{"RedirectURL", old.RedirectURL, cfg.RedirectURL},
+		{"APIVersion", old.APIVersion, cfg.APIVersion},
+		{"Endpoint", old.Endpoint, cfg.Endpoint},
+		{"HTTPClient", old.HTTPClient, cfg.HTTPClient},
+		{"DiscoveryRetries", old.DiscoveryRetries, cfg.DiscoveryRetries},
+	}
+	var ret []string
+	for _, f := range fields {
+		if !reflect.DeepEqual(f.old, f.new) {
+			ret = append(ret, f.name)
+		}
+	}
+	return ret
+}
+
+// SetAllowedCommands replaces the list of commands that may be sent to
+// devices (see Config.AllowedCommands). A nil list allows all commands. Safe
+// to call while commands are in flight.
+func (st *SmartThings) SetAllowedCommands(cmds []string) {
+	if st.smartThings == nil {
+		return
+	}
+	st.cfgMu.Lock()
+	defer st.cfgMu.Unlock()
+	if cmds != nil {
+		cmds = append([]string{}, cmds...)
+	}
+	st.cfg.AllowedCommands = cmds
+}
+
+// writable returns ErrReadOnly if Config.ReadOnly is set. Unconnected
+// instances are writable, and fail later with ErrNotConnected.
+func (st *SmartThings) writable() error {
+	if st.connected() == nil && st.config().ReadOnly {
+		return ErrReadOnly
+	}
+	return nil
+}
+
+// commandAllowed returns true if cmd may be sent to devices.
+func (st *SmartThings) commandAllowed(cmd string) bool {
+	st.cfgMu.RLock()
+	defer st.cfgMu.RUnlock()
+	if st.cfg.AllowedCommands == nil {
+		return true
+	}
+	for _, c := range st.cfg.AllowedCommands {
+		if c == cmd {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,216 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smoogle/gosmart"
+	"github.com/smoogle/gosmart/gosmarttest"
+	"golang.org/x/net/context"
+)
+
+func TestUpdateConfig(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	quota(s, http.Header{"X-Ratelimit-Remaining": {"5"}, "X-Ratelimit-Limit": {"250"}})
+	log := &logger{}
+	cfg := gosmart.Config{Logger: log}
+	st := connect(t, s, cfg)
+
+	if _, err := st.CurrentMode(); err != nil {
+		t.Fatalf("CurrentMode: %v", err)
+	}
+	if len(log.logged("rate limit low")) != 0 {
+		t.Fatal("warning logged with the warning disabled")
+	}
+	cfg.RateLimitWarning = 10
+	if err := st.UpdateConfig(cfg); err != nil {
+		t.Fatalf("UpdateConfig: %v", err)
+	}
+	if _, err := st.CurrentMode(); err != nil {
+		t.Fatalf("CurrentMode: %v", err)
+	}
+	if len(log.logged("rate limit low")) != 1 {
+		t.Error("updated rate limit warning not applied")
+	}
+}
+
+func TestUpdateConfigConnectFields(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	quota(s, http.Header{"X-Ratelimit-Remaining": {"5"}, "X-Ratelimit-Limit": {"250"}})
+	log := &logger{}
+	cfg := gosmart.Config{Logger: log}
+	st := connect(t, s, cfg)
+
+	changes := map[string]func(*gosmart.Config){
+		"ClientID":         func(c *gosmart.Config) { c.ClientID = "other" },
+		"Secret":           func(c *gosmart.Config) { c.Secret = "other" },
+		"AccessToken":      func(c *gosmart.Config) { c.AccessToken = "other" },
+		"Scopes":           func(c *gosmart.Config) { c.Scopes = []string{"app"} },
+		"TokenPrefix":      func(c *gosmart.Config) { c.TokenPrefix = "other" },
+		"Credentials":      func(c *gosmart.Config) { c.Credentials = []gosmart.Credential{{ClientID: "other"}} },
+		"RedirectURL":      func(c *gosmart.Config) { c.RedirectURL = "http://localhost/other" },
+		"APIVersion":       func(c *gosmart.Config) { c.APIVersion = gosmart.APIV1 },
+		"Endpoint":         func(c *gosmart.Config) { c.Endpoint = "http://localhost/other" },
+		"HTTPClient":       func(c *gosmart.Config) { c.HTTPClient = &http.Client{} },
+		"DiscoveryRetries": func(c *gosmart.Config) { c.DiscoveryRetries = 7 },
+	}
+	for name, change := range changes {
+		c := cfg
+		change(&c)
+		c.RateLimitWarning = 10
+		if err := st.UpdateConfig(c); err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("changing %s: UpdateConfig() = %v, want an error naming it", name, err)
+		}
+	}
+
+	// None of the rejected updates enabled the warning.
+	if _, err := st.CurrentMode(); err != nil {
+		t.Fatalf("CurrentMode: %v", err)
+	}
+	if len(log.logged("rate limit low")) != 0 {
+		t.Error("rejected update applied")
+	}
+}
+
+func TestSetAllowedCommands(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	st := connect(t, s, gosmart.Config{AllowedCommands: []string{"on"}})
+	d := device(t, st, "1")
+
+	if err := d.Call("off"); !errors.Is(err, gosmart.ErrCommandNotAllowed) {
+		t.Errorf("Call(off) = %v, want ErrCommandNotAllowed", err)
+	}
+	allowed := []string{"on", "off"}
+	st.SetAllowedCommands(allowed)
+	allowed[1] = "setLevel"
+	if err := d.Call("off"); err != nil {
+		t.Errorf("Call(off) = %v after allowing it", err)
+	}
+	st.SetAllowedCommands(nil)
+	if err := d.Call("setLevel", 10); err != nil {
+		t.Errorf("Call(setLevel) = %v with all commands allowed", err)
+	}
+
+	// Tighten and relax the list while calls run.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if err := d.Call("on"); err != nil && !errors.Is(err, gosmart.ErrCommandNotAllowed) {
+					t.Errorf("Call(on): %v", err)
+				}
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		if i%2 == 0 {
+			st.SetAllowedCommands([]string{"off"})
+		} else {
+			st.SetAllowedCommands(nil)
+		}
+	}
+	wg.Wait()
+
+	st.SetAllowedCommands([]string{})
+	if err := d.Call("on"); !errors.Is(err, gosmart.ErrCommandNotAllowed) {
+		t.Errorf("Call(on) = %v with an empty list, want ErrCommandNotAllowed", err)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	s := newServer(t, lamp("1"), bulb("2"), frontDoor("3"))
+	s.HandleFunc("/groups", gosmarttest.JSON([]gosmart.Group{{ID: "g1", Name: "Lamps", DeviceIDs: []string{"1", "2"}}}))
+	cfg := gosmart.Config{ReadOnly: true}
+	s.HandleFunc("/scenes", gosmarttest.JSON([]gosmart.Scene{{ID: "s1", Name: "Movie Time"}}))
+	st := connect(t, s, cfg)
+	dimmer, color := device(t, st, "1"), device(t, st, "2")
+	groups, err := st.Groups()
+	if err != nil || len(groups) != 1 {
+		t.Fatalf("Groups() = %v, %v", groups, err)
+	}
+	var lock gosmart.Lock
+	if !device(t, st, "3").As(&lock) {
+		t.Fatal("door is not a lock")
+	}
+	ctx := context.Background()
+
+	writes := map[string]func() error{
+		"Call":                func() error { return dimmer.Call("on") },
+		"CallContext":         func() error { return dimmer.CallContext(ctx, "setLevel", 50) },
+		"CallResult":          func() error { _, err := dimmer.CallResult("on"); return err },
+		"CallIdempotent":      func() error { return dimmer.CallIdempotent("off") },
+		"CallString":          func() error { return dimmer.CallString("setLevel", "50") },
+		"CallNamed":           func() error { return dimmer.CallNamed("setLevel", map[string]interface{}{"level": 50}) },
+		"CallWithArgs":        func() error { return dimmer.CallWithArgs("setLevel", 50) },
+		"CallSticky":          func() error { return dimmer.CallSticky(ctx, "on", "switch", "on", 2) },
+		"SetColor":            func() error { return color.SetColor(50, 50) },
+		"SetColorRGB":         func() error { return color.SetColorRGB(255, 0, 0) },
+		"SetColorTemperature": func() error { return color.SetColorTemperature(2700) },
+		"Lock.Unlock":         lock.Unlock,
+		"SetPreference":       func() error { return dimmer.SetPreference("delay", 10) },
+		"SetCustomData":       func() error { return dimmer.SetCustomData("note", "x") },
+		"Group.Call":          func() error { return groups[0].Call("on") },
+		"CallAll":             func() error { return st.CallAll(st.DeviceList(), "on")["1"] },
+		"BatchCall":           func() error { return st.BatchCall(st.DeviceList(), "on")["1"].Err },
+		"ForEachSwitch":       func() error { return st.ForEachSwitch(gosmart.Switch.On)["1"] },
+		"ApplyState":          func() error { return st.ApplyState([]gosmart.DesiredState{{DeviceID: "1", Command: "on"}})[0] },
+		"RampLevel":           func() error { return st.RampLevel(ctx, []string{"1"}, 0, 100, 2, time.Millisecond) },
+		"RunScene":            func() error { return st.RunScene("Movie Time") },
+		"SetMode":             func() error { return st.SetMode("Away") },
+		"SetModeContext":      func() error { return st.SetModeContext(ctx, "Away") },
+		"SetModeAndConfirm":   func() error { return st.SetModeAndConfirm(ctx, "Away", time.Second) },
+		"ApplyAndConfirm": func() error {
+			_, err := st.ApplyAndConfirm(ctx, []gosmart.DesiredState{{DeviceID: "1", Command: "on"}}, time.Second)
+			return err
+		},
+	}
+	before := len(s.Requests())
+	for name, write := range writes {
+		if err := write(); !errors.Is(err, gosmart.ErrReadOnly) {
+			t.Errorf("%s = %v, want ErrReadOnly", name, err)
+		}
+	}
+	if n := len(s.Requests()) - before; n != 0 {
+		t.Errorf("%d requests sent in read-only mode: %+v", n, s.Requests()[before:])
+	}
+	if len(s.Calls()) != 0 {
+		t.Errorf("server received commands %+v", s.Calls())
+	}
+
+	// Reading still works, and read-only mode cannot be turned off.
+	if err := st.Refresh(); err != nil {
+		t.Error(err)
+	}
+	cfg.ReadOnly = false
+	if err := st.UpdateConfig(cfg); !errors.Is(err, gosmart.ErrReadOnly) {
+		t.Errorf("UpdateConfig turning ReadOnly off = %v, want ErrReadOnly", err)
+	}
+	if err := dimmer.Call("on"); !errors.Is(err, gosmart.ErrReadOnly) {
+		t.Errorf("Call after UpdateConfig = %v, want ErrReadOnly", err)
+	}
+}
+
+func TestReadOnlyTurnedOn(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	cfg := gosmart.Config{}
+	st := connect(t, s, cfg)
+	cfg.ReadOnly = true
+	if err := st.UpdateConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := device(t, st, "1").Call("on"); !errors.Is(err, gosmart.ErrReadOnly) {
+		t.Errorf("Call = %v, want ErrReadOnly", err)
+	}
+}
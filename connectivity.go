@@ -0,0 +1,108 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"time"
+)
+
+const (
+	// Size of the channels returned by WatchConnectivity.
+	connectivityBuffer = 16
+)
+
+// ConnectivityChange reports a device going offline or coming back online.
+type ConnectivityChange struct {
+	DeviceID string
+	Online   bool
+	// When is the time the transition was detected.
+	When time.Time
+}
+
+// connWatcher holds one channel registered by WatchConnectivity.
+type connWatcher struct {
+	ch chan ConnectivityChange
+}
+
+// WatchConnectivity returns a channel receiving a ConnectivityChange each
+// time a device goes offline or comes back online, as detected when devices
+// are refreshed (use StartAutoRefresh to poll them). Only transitions are
+// reported; the first state seen for a device is not. Changes are dropped if
+// the channel is full. The returned handle stops the watch and closes the
+// channel.
+func (st *SmartThings) WatchConnectivity() (<-chan ConnectivityChange, *Handle) {
+	if st.smartThings == nil {
+		ch := make(chan ConnectivityChange)
+		close(ch)
+		return ch, newHandle(func() {})
+	}
+	w := &connWatcher{ch: make(chan ConnectivityChange, connectivityBuffer)}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.connWatchers = append(st.connWatchers, w)
+	return w.ch, newHandle(func() { st.removeConnWatcher(w) })
+}
+
+// removeConnWatcher unregisters w and closes its channel.
+func (st *SmartThings) removeConnWatcher(w *connWatcher) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for i, x := range st.connWatchers {
+		if x == w {
+			st.connWatchers = append(st.connWatchers[:i], st.connWatchers[i+1:]...)
+			close(w.ch)
+			return
+		}
+	}
+}
+
+// evalConnectivity records the online state of the device and notifies the
+// watchers if it changed since the previous refresh.
+func (st *SmartThings) evalConnectivity(d *Device, now time.Time) {
+	online, ok := d.online(now)
+	if !ok {
+		return
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.connState == nil {
+		st.connState = make(map[string]bool)
+	}
+	prev, seen := st.connState[d.ID]
+	st.connState[d.ID] = online
+	if !seen || prev == online {
+		return
+	}
+	c := ConnectivityChange{DeviceID: d.ID, Online: online, When: now}
+	for _, w := range st.connWatchers {
+		select {
+		case w.ch <- c:
+		default:
+		}
+	}
+}
+
+// online returns the connectivity state of the device, from its health
+// status or, failing that, from its check interval and last activity.
+// Returns false if the state cannot be determined.
+func (d *Device) online(now time.Time) (bool, bool) {
+	switch d.HealthStatus() {
+	case "ONLINE":
+		return true, true
+	case "OFFLINE":
+		return false, true
+	}
+	interval, ok := d.CheckInterval()
+	if !ok {
+		return false, false
+	}
+	last, ok := d.LastActivity()
+	if !ok {
+		return false, false
+	}
+	return now.Sub(last) <= interval, true
+}
@@ -0,0 +1,77 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smoogle/gosmart"
+)
+
+func TestWatchConnectivity(t *testing.T) {
+	health := lamp("1")
+	health.Attributes["healthStatus"] = "online"
+	s := newServer(t, health, reporting("2", 60, time.Now()), lamp("3"))
+	st := connect(t, s, gosmart.Config{})
+	ch, h := st.WatchConnectivity()
+
+	// refresh refreshes all the devices and returns the changes reported.
+	refresh := func() []gosmart.ConnectivityChange {
+		t.Helper()
+		if err := st.Refresh(); err != nil {
+			t.Fatal(err)
+		}
+		var ret []gosmart.ConnectivityChange
+		for {
+			select {
+			case c := <-ch:
+				ret = append(ret, c)
+			default:
+				return ret
+			}
+		}
+	}
+
+	// The first state seen is not a transition.
+	if got := refresh(); len(got) != 0 {
+		t.Errorf("changes reported without transitions: %+v", got)
+	}
+
+	// Going offline, from the health status and from the last activity.
+	s.SetAttribute("1", "healthStatus", "offline")
+	s.AddDevice(reporting("2", 60, time.Now().Add(-time.Hour)))
+	got := refresh()
+	if len(got) != 2 {
+		t.Fatalf("got changes %+v, want both devices going offline", got)
+	}
+	for _, c := range got {
+		if c.Online || (c.DeviceID != "1" && c.DeviceID != "2") || c.When.IsZero() {
+			t.Errorf("unexpected change %+v", c)
+		}
+	}
+	if got := refresh(); len(got) != 0 {
+		t.Errorf("changes reported while staying offline: %+v", got)
+	}
+
+	// Coming back online.
+	s.SetAttribute("1", "healthStatus", "online")
+	got = refresh()
+	if len(got) != 1 || got[0].DeviceID != "1" || !got[0].Online {
+		t.Errorf("got changes %+v, want device 1 back online", got)
+	}
+
+	// Cancelling the watch closes the channel.
+	h.Cancel()
+	if _, ok := <-ch; ok {
+		t.Error("channel open after Cancel")
+	}
+	s.SetAttribute("1", "healthStatus", "offline")
+	if err := st.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,101 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"fmt"
+	"time"
+)
+
+// ErrThrottled is returned by Device.Call when a command is issued to a
+// device before its cooldown period (Config.CommandCooldown) has elapsed.
+type ErrThrottled struct {
+	DeviceID string
+	// RetryAfter is the time remaining until the device accepts commands.
+	RetryAfter time.Duration
+}
+
+func (e *ErrThrottled) Error() string {
+	return fmt.Sprintf("device %s throttled, retry after %v", e.DeviceID, e.RetryAfter)
+}
+
+// checkCooldown returns an *ErrThrottled if the device is still within its
+// command cooldown period, which starts when a command succeeds (see
+// recordCall). Otherwise the cooldown is started at once, so concurrent
+// commands are throttled while this one is sent, and the returned function
+// undoes that if the command fails.
+func (d *Device) checkCooldown() (func(), error) {
+	cooldown := d.st.config().CommandCooldown
+	if cooldown <= 0 {
+		return func() {}, nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	if elapsed := now.Sub(d.lastCommand); !d.lastCommand.IsZero() && elapsed < cooldown {
+		return nil, &ErrThrottled{DeviceID: d.ID, RetryAfter: cooldown - elapsed}
+	}
+	prev := d.lastCommand
+	d.lastCommand = now
+	return func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if d.lastCommand.Equal(now) {
+			d.lastCommand = prev
+		}
+	}, nil
+}
+
+// reserveCall returns false if path is identical to a command being sent to
+// the device, or to the last successful one sent within
+// Config.CommandDedupWindow. Otherwise path is reserved, so identical calls
+// made while it is sent are suppressed too, until releaseCall.
+func (d *Device) reserveCall(path string) bool {
+	window := d.st.config().CommandDedupWindow
+	if window <= 0 {
+		return true
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.pendingCalls[path] || path == d.lastCall && time.Since(d.lastCallTime) < window {
+		return false
+	}
+	if d.pendingCalls == nil {
+		d.pendingCalls = make(map[string]bool)
+	}
+	d.pendingCalls[path] = true
+	return true
+}
+
+// releaseCall clears the reservation of path made by reserveCall. After a
+// successful command, recordCall must be called first so the command is
+// still recognized as a duplicate.
+func (d *Device) releaseCall(path string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.pendingCalls, path)
+}
+
+// recordCall saves path as the last successful command sent to the device,
+// starting its cooldown period.
+func (d *Device) recordCall(path string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.lastCall = path
+	d.lastCallTime = time.Now()
+	d.lastCommand = d.lastCallTime
+}
+
+// forgetCall clears the last command sent to the device, so the next one is
+// not suppressed as a duplicate.
+func (d *Device) forgetCall() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.lastCall = ""
+}
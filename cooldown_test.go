@@ -0,0 +1,215 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smoogle/gosmart"
+)
+
+func TestCommandCooldown(t *testing.T) {
+	s := newServer(t, lamp("1"), lamp("2"))
+	cooldown := time.Minute
+	st := connect(t, s, gosmart.Config{CommandCooldown: cooldown})
+	d := device(t, st, "1")
+
+	if err := d.Call("on"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	before := len(s.Requests())
+	err := d.Call("off")
+	var te *gosmart.ErrThrottled
+	if !errors.As(err, &te) {
+		t.Fatalf("second call returned %v, want *ErrThrottled", err)
+	}
+	if te.DeviceID != "1" {
+		t.Errorf("throttled device = %q, want 1", te.DeviceID)
+	}
+	if te.RetryAfter <= 0 || te.RetryAfter > cooldown-50*time.Millisecond {
+		t.Errorf("RetryAfter = %v, want the cooldown left (under %v)", te.RetryAfter, cooldown-50*time.Millisecond)
+	}
+	if n := len(s.Requests()) - before; n != 0 {
+		t.Errorf("throttled call sent %d requests", n)
+	}
+
+	// The cooldown is per device.
+	if err := device(t, st, "2").Call("on"); err != nil {
+		t.Errorf("other device throttled: %v", err)
+	}
+}
+
+func TestCommandCooldownExpires(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	st := connect(t, s, gosmart.Config{CommandCooldown: 100 * time.Millisecond})
+	d := device(t, st, "1")
+
+	if err := d.Call("on"); err != nil {
+		t.Fatal(err)
+	}
+	var te *gosmart.ErrThrottled
+	if err := d.Call("off"); !errors.As(err, &te) {
+		t.Fatalf("second call returned %v, want *ErrThrottled", err)
+	}
+	time.Sleep(te.RetryAfter)
+	if err := d.Call("off"); err != nil {
+		t.Errorf("call after RetryAfter failed: %v", err)
+	}
+}
+
+func TestCommandCooldownAfterFailure(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	st := connect(t, s, gosmart.Config{CommandCooldown: time.Minute})
+	d := device(t, st, "1")
+
+	// A failed command does not start the cooldown, so it can be retried
+	// at once.
+	s.Fail(1, http.StatusInternalServerError, "")
+	if err := d.Call("on"); err == nil {
+		t.Fatal("Call(on) succeeded with the server failing")
+	}
+	if err := d.Call("on"); err != nil {
+		t.Fatalf("retry after a failure returned %v, want success", err)
+	}
+	var te *gosmart.ErrThrottled
+	if err := d.Call("off"); !errors.As(err, &te) {
+		t.Errorf("call after a success returned %v, want *ErrThrottled", err)
+	}
+}
+
+func TestCommandCooldownConcurrent(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	st := connect(t, s, gosmart.Config{CommandCooldown: time.Minute})
+	d := device(t, st, "1")
+
+	// Commands made while the first one is being sent are throttled.
+	s.SetDelay(50 * time.Millisecond)
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		throttled int
+	)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var te *gosmart.ErrThrottled
+			err := d.Call("on")
+			switch {
+			case errors.As(err, &te):
+				mu.Lock()
+				throttled++
+				mu.Unlock()
+			case err != nil:
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := len(s.Calls()); n != 1 || throttled != 4 {
+		t.Errorf("concurrent calls sent %d commands and %d were throttled, want 1 and 4", n, throttled)
+	}
+}
+
+func TestCommandDedup(t *testing.T) {
+	s := newServer(t, lamp("1"), lamp("2"))
+	const window = 200 * time.Millisecond
+	st := connect(t, s, gosmart.Config{CommandDedupWindow: window})
+	d := device(t, st, "1")
+
+	for i := 0; i < 3; i++ {
+		if err := d.Call("setLevel", 30); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(s.Calls()); n != 1 {
+		t.Errorf("identical calls sent %d commands, want 1", n)
+	}
+
+	// Other arguments, commands or devices are not duplicates.
+	for _, c := range []struct {
+		d    *gosmart.Device
+		cmd  string
+		args []float64
+	}{
+		{d, "setLevel", []float64{40}},
+		{d, "on", nil},
+		{device(t, st, "2"), "on", nil},
+	} {
+		if err := c.d.Call(c.cmd, c.args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(s.Calls()); n != 4 {
+		t.Errorf("distinct calls sent %d commands, want 4", n)
+	}
+
+	// The same call is sent again once the window is over.
+	time.Sleep(window)
+	if err := device(t, st, "2").Call("on"); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(s.Calls()); n != 5 {
+		t.Errorf("call after the window sent %d commands in all, want 5", n)
+	}
+}
+
+func TestCommandDedupConcurrent(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	st := connect(t, s, gosmart.Config{CommandDedupWindow: time.Minute})
+	d := device(t, st, "1")
+
+	// Identical calls made while the first one is being sent are
+	// duplicates too.
+	s.SetDelay(50 * time.Millisecond)
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := d.Call("setLevel", 30); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := len(s.Calls()); n != 1 {
+		t.Errorf("concurrent identical calls sent %d commands, want 1", n)
+	}
+
+	// A failed call does not suppress its retry.
+	s.SetDelay(0)
+	s.Fail(1, http.StatusInternalServerError, "")
+	if err := d.Call("setLevel", 40); err == nil {
+		t.Fatal("Call(setLevel) succeeded with the server failing")
+	}
+	if err := d.Call("setLevel", 40); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(s.Calls()); n != 2 {
+		t.Errorf("retry after a failure sent %d commands in all, want 2", n)
+	}
+}
+
+func TestCommandDedupOff(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	st := connect(t, s, gosmart.Config{})
+	d := device(t, st, "1")
+	for i := 0; i < 2; i++ {
+		if err := d.Call("on"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(s.Calls()); n != 2 {
+		t.Errorf("sent %d commands without dedup, want 2", n)
+	}
+}
@@ -0,0 +1,218 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"fmt"
+	"golang.org/x/net/context"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Number of recent events searched by AwaitEvent on each poll.
+	awaitEventLimit = 20
+
+	// Events up to this long before a command was issued still count as
+	// its effect in AwaitEvent, allowing for the difference between the
+	// local clock and the server clock.
+	maxClockSkew = 2 * time.Second
+
+	// Number of pushed events buffered for each AwaitEvent call.
+	awaitEventBuffer = 16
+)
+
+// commandEffect is the change a command makes to a device: the attributes
+// it may set, and the value it sets them to.
+type commandEffect struct {
+	attributes []string
+	value      string
+}
+
+// commandEffects lists the effect of the standard commands not named after
+// their attribute (see expectedEffect).
+var commandEffects = map[string]commandEffect{
+	"on":            {[]string{"switch"}, "on"},
+	"off":           {[]string{"switch", "alarm"}, "off"},
+	"lock":          {[]string{"lock"}, "locked"},
+	"unlock":        {[]string{"lock"}, "unlocked"},
+	"open":          {[]string{"door", "valve", "windowShade"}, "open"},
+	"close":         {[]string{"door", "valve", "windowShade"}, "closed"},
+	"heat":          {[]string{"thermostatMode"}, "heat"},
+	"cool":          {[]string{"thermostatMode"}, "cool"},
+	"auto":          {[]string{"thermostatMode"}, "auto"},
+	"emergencyHeat": {[]string{"thermostatMode"}, "emergency heat"},
+	"fanOn":         {[]string{"thermostatFanMode"}, "on"},
+	"fanAuto":       {[]string{"thermostatFanMode"}, "auto"},
+	"fanCirculate":  {[]string{"thermostatFanMode"}, "circulate"},
+	"setColor":      {[]string{"color", "hue", "saturation"}, ""},
+	"siren":         {[]string{"alarm"}, "siren"},
+	"strobe":        {[]string{"alarm"}, "strobe"},
+	"both":          {[]string{"alarm"}, "both"},
+}
+
+// CorrelationToken identifies a command issued with CallCorrelated, so the
+// event it caused can be found with AwaitEvent.
+type CorrelationToken struct {
+	DeviceID string
+	Command  string
+	// Issued is the time the command was sent.
+	Issued time.Time
+	// Attributes lists the attributes whose events count as the effect of
+	// the command. CallCorrelated fills it in for the standard commands
+	// ("on" and "off" change "switch", "setLevel" changes "level", and so
+	// on); set it for other commands. If empty, any event counts.
+	Attributes []string
+	// Value is the attribute value set by the command: "off" for "off",
+	// "40" for "setLevel" with argument 40, and so on. Events reporting
+	// another value do not count (numbers are compared by value). If empty,
+	// any value counts.
+	Value string
+}
+
+// CallCorrelated issues a command like Call and returns a token that can be
+// passed to AwaitEvent to wait for the resulting event.
+func (d *Device) CallCorrelated(cmd string, args ...float64) (CorrelationToken, error) {
+	effect := expectedEffect(cmd, args)
+	token := CorrelationToken{
+		DeviceID:   d.ID,
+		Command:    cmd,
+		Issued:     time.Now(),
+		Attributes: effect.attributes,
+		Value:      effect.value,
+	}
+	if err := d.Call(cmd, args...); err != nil {
+		return CorrelationToken{}, err
+	}
+	return token, nil
+}
+
+// expectedEffect returns the effect of cmd called with args: the one listed
+// in commandEffects or, for "setX" commands, attribute "x" set to the first
+// argument.
+func expectedEffect(cmd string, args []float64) commandEffect {
+	if effect, ok := commandEffects[cmd]; ok {
+		effect.attributes = append([]string(nil), effect.attributes...)
+		return effect
+	}
+	if len(cmd) > 3 && strings.HasPrefix(cmd, "set") {
+		name := cmd[3:]
+		effect := commandEffect{attributes: []string{strings.ToLower(name[:1]) + name[1:]}}
+		if len(args) > 0 {
+			effect.value = strconv.FormatFloat(args[0], 'f', -1, 64)
+		}
+		return effect
+	}
+	return commandEffect{}
+}
+
+// matches returns true if e may be the effect of the command identified by
+// the token: an event setting one of its attributes to its value, no older
+// than the command (with maxClockSkew to spare). Event times only have
+// millisecond precision, so an event in the same millisecond as the command
+// counts.
+func (token CorrelationToken) matches(e DeviceEvent) bool {
+	if e.Time.Before(token.Issued.Truncate(time.Millisecond).Add(-maxClockSkew)) {
+		return false
+	}
+	if token.Value != "" && !sameValue(e.Value, token.Value) {
+		return false
+	}
+	if len(token.Attributes) == 0 {
+		return true
+	}
+	for _, a := range token.Attributes {
+		if a == e.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// sameValue returns true if the attribute values a and b are equal, as
+// numbers if both are numeric ("40" and "40.0" are the same level).
+func sameValue(a, b string) bool {
+	fa, erra := strconv.ParseFloat(a, 64)
+	fb, errb := strconv.ParseFloat(b, 64)
+	if erra == nil && errb == nil {
+		return fa == fb
+	}
+	return a == b
+}
+
+// lookupEffect returns the event in events (oldest first) that best matches
+// the token: the newest one reported after the command was issued or, if
+// there is none, the newest one reported within maxClockSkew before it.
+func (token CorrelationToken) lookupEffect(events []DeviceEvent) (DeviceEvent, bool) {
+	issued := token.Issued.Truncate(time.Millisecond)
+	var ret DeviceEvent
+	found, after := false, false
+	for _, e := range events {
+		if !token.matches(e) {
+			continue
+		}
+		if a := !e.Time.Before(issued); a || !after {
+			ret, found, after = e, true, a
+		}
+	}
+	return ret, found
+}
+
+// AwaitEvent blocks until the device targeted by token reports an event
+// setting one of token.Attributes to token.Value after the command was
+// issued, and returns that event (the newest one, if several are found).
+// Events reported up to two seconds before the command count only if no
+// later one does, since the server clock may differ from the local one.
+// The device event history is polled for it, unless an event handler (see
+// SmartThings.EventHandler) receives the events: the history is then only
+// read once, and the pushed events are waited for. Returns ctx.Err() if ctx
+// is done first.
+func (st *SmartThings) AwaitEvent(ctx context.Context, token CorrelationToken) (DeviceEvent, error) {
+	if err := st.connected(); err != nil {
+		return DeviceEvent{}, err
+	}
+	d := st.deviceByID(token.DeviceID)
+	if d == nil {
+		return DeviceEvent{}, fmt.Errorf("%w: %s", ErrDeviceNotFound, token.DeviceID)
+	}
+
+	// Listen before reading the history, so no pushed event is missed.
+	pushed, cancel := st.awaitPushed(d.ID)
+	defer cancel()
+
+	ticker := time.NewTicker(confirmPollInterval)
+	defer ticker.Stop()
+	for {
+		events, err := d.EventsContext(ctx, awaitEventLimit)
+		if err != nil {
+			return DeviceEvent{}, err
+		}
+		if e, ok := token.lookupEffect(events); ok {
+			return e, nil
+		}
+		if pushed != nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return DeviceEvent{}, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return DeviceEvent{}, ctx.Err()
+		case e := <-pushed:
+			de := DeviceEvent{Name: e.Name, Value: e.Value, Unit: e.Unit, Time: e.Time}
+			if token.matches(de) {
+				return de, nil
+			}
+		}
+	}
+}
@@ -0,0 +1,182 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smoogle/gosmart"
+	"golang.org/x/net/context"
+)
+
+func TestAwaitEvent(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	s.AddEvent("1", "switch", "on", time.Now().Add(-time.Hour))
+	st := connect(t, s, gosmart.Config{})
+	d := device(t, st, "1")
+
+	token, err := d.CallCorrelated("setLevel", 40)
+	if err != nil {
+		t.Fatalf("CallCorrelated: %v", err)
+	}
+	if token.DeviceID != "1" || token.Command != "setLevel" {
+		t.Errorf("got token %+v", token)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	e, err := st.AwaitEvent(ctx, token)
+	if err != nil {
+		t.Fatalf("AwaitEvent: %v", err)
+	}
+	if e.Name != "level" || e.Value != "40" {
+		t.Errorf("AwaitEvent() = %s=%s, want level=40", e.Name, e.Value)
+	}
+}
+
+func TestAwaitEventTimeout(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	st := connect(t, s, gosmart.Config{})
+
+	// Turning off a lamp already off changes nothing.
+	token, err := device(t, st, "1").CallCorrelated("off")
+	if err != nil {
+		t.Fatalf("CallCorrelated: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if e, err := st.AwaitEvent(ctx, token); err != context.DeadlineExceeded {
+		t.Errorf("AwaitEvent() = %+v, %v; want context.DeadlineExceeded", e, err)
+	}
+
+	if _, err := st.AwaitEvent(ctx, gosmart.CorrelationToken{DeviceID: "99"}); err == nil {
+		t.Error("AwaitEvent accepted an unknown device")
+	}
+}
+
+func TestAwaitEventAttributes(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	st := connect(t, s, gosmart.Config{})
+	d := device(t, st, "1")
+
+	token, err := d.CallCorrelated("setLevel", 40)
+	if err != nil {
+		t.Fatalf("CallCorrelated: %v", err)
+	}
+	if len(token.Attributes) != 1 || token.Attributes[0] != "level" {
+		t.Errorf("token attributes = %q, want level", token.Attributes)
+	}
+	// A newer report of an unrelated attribute is not the command's effect.
+	s.AddEvent("1", "battery", 80, time.Now().Add(time.Second))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	e, err := st.AwaitEvent(ctx, token)
+	if err != nil {
+		t.Fatalf("AwaitEvent: %v", err)
+	}
+	if e.Name != "level" {
+		t.Errorf("AwaitEvent() = %s=%s, want the level event", e.Name, e.Value)
+	}
+}
+
+func TestAwaitEventPreceding(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	st := connect(t, s, gosmart.Config{})
+	d := device(t, st, "1")
+
+	// The lamp is switched on and then off at once: the switch=on event of
+	// the first command is within the clock skew allowance of the second.
+	if _, err := d.CallCorrelated("on"); err != nil {
+		t.Fatalf("CallCorrelated: %v", err)
+	}
+	token, err := d.CallCorrelated("off")
+	if err != nil {
+		t.Fatalf("CallCorrelated: %v", err)
+	}
+	if token.Value != "off" {
+		t.Errorf("token value = %q, want off", token.Value)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	e, err := st.AwaitEvent(ctx, token)
+	if err != nil {
+		t.Fatalf("AwaitEvent: %v", err)
+	}
+	if e.Name != "switch" || e.Value != "off" {
+		t.Errorf("AwaitEvent() = %s=%s, want switch=off", e.Name, e.Value)
+	}
+
+	// Of two matching events, the one after the command wins over the one
+	// before it.
+	token, err = d.CallCorrelated("setLevel", 40)
+	if err != nil {
+		t.Fatalf("CallCorrelated: %v", err)
+	}
+	s.AddEvent("1", "level", 40, token.Issued.Add(-time.Second))
+	e, err = st.AwaitEvent(ctx, token)
+	if err != nil {
+		t.Fatalf("AwaitEvent: %v", err)
+	}
+	if e.Time.Before(token.Issued.Truncate(time.Millisecond)) {
+		t.Errorf("AwaitEvent() returned the event at %v, before the command at %v", e.Time, token.Issued)
+	}
+}
+
+func TestAwaitEventClockSkew(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	st := connect(t, s, gosmart.Config{})
+
+	token, err := device(t, st, "1").CallCorrelated("off")
+	if err != nil {
+		t.Fatalf("CallCorrelated: %v", err)
+	}
+	// The server clock is a second behind.
+	s.AddEvent("1", "switch", "off", token.Issued.Add(-time.Second))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if e, err := st.AwaitEvent(ctx, token); err != nil || e.Name != "switch" {
+		t.Errorf("AwaitEvent() = %+v, %v; want the switch event", e, err)
+	}
+}
+
+func TestAwaitEventPushed(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	st := connect(t, s, gosmart.Config{CallbackSecret: secret})
+	srv := httptest.NewServer(st.EventHandler(nil))
+	defer srv.Close()
+
+	token, err := device(t, st, "1").CallCorrelated("off")
+	if err != nil {
+		t.Fatalf("CallCorrelated: %v", err)
+	}
+	body := `{"deviceId": "1", "name": "switch", "value": "off"}`
+	req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(gosmart.SignatureHeader, gosmart.SignEvent(secret, []byte(body)))
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		if resp, err := http.DefaultClient.Do(req); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	// The event is not in the history, so only the pushed one can be found
+	// (well before the next poll would be due).
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	e, err := st.AwaitEvent(ctx, token)
+	if err != nil {
+		t.Fatalf("AwaitEvent: %v", err)
+	}
+	if e.Name != "switch" || e.Value != "off" {
+		t.Errorf("AwaitEvent() = %s=%s, want switch=off", e.Name, e.Value)
+	}
+}
@@ -0,0 +1,73 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"encoding/json"
+	"golang.org/x/net/context"
+	"net/http"
+	"net/url"
+)
+
+// GetDeviceData returns the custom data stored by the SmartApp with a
+// device, keyed by name.
+func GetDeviceData(ctx context.Context, client *http.Client, endpoint string, id string) (map[string]interface{}, error) {
+	ret := make(map[string]interface{})
+
+	contents, err := issueCommand(ctx, client, endpoint, "/devices/"+url.PathEscape(id)+"/data")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(contents, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// SetDeviceData stores one custom data value with a device. The value is
+// sent JSON encoded, so any value encoding/json supports can be stored.
+func SetDeviceData(ctx context.Context, client *http.Client, endpoint string, id string, key string, value interface{}) error {
+	v, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	path := "/devices/" + url.PathEscape(id) + "/data/" + url.PathEscape(key) + "/" + url.PathEscape(string(v))
+	_, err = issueAction(ctx, client, endpoint, path)
+	return err
+}
+
+// CustomData returns the custom data stored by the SmartApp with the
+// device (e.g. tags or the last time an automation triggered).
+func (d *Device) CustomData() (map[string]interface{}, error) {
+	return d.CustomDataContext(context.Background())
+}
+
+// CustomDataContext is like CustomData, but honors ctx.
+func (d *Device) CustomDataContext(ctx context.Context) (map[string]interface{}, error) {
+	if err := d.st.connected(); err != nil {
+		return nil, err
+	}
+	return GetDeviceData(ctx, d.st.client, d.st.endpoint, d.ID)
+}
+
+// SetCustomData stores one custom data value with the device. See
+// SetDeviceData.
+func (d *Device) SetCustomData(key string, value interface{}) error {
+	return d.SetCustomDataContext(context.Background(), key, value)
+}
+
+// SetCustomDataContext is like SetCustomData, but honors ctx.
+func (d *Device) SetCustomDataContext(ctx context.Context, key string, value interface{}) error {
+	if err := d.st.writable(); err != nil {
+		return err
+	}
+	if err := d.st.connected(); err != nil {
+		return err
+	}
+	return SetDeviceData(ctx, d.st.client, d.st.endpoint, d.ID, key, value)
+}
@@ -0,0 +1,77 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/smoogle/gosmart"
+)
+
+func TestCustomData(t *testing.T) {
+	l := lamp("1")
+	l.Data = map[string]interface{}{"room": "den"}
+	s := newServer(t, l, lamp("2"))
+	st := connect(t, s, gosmart.Config{})
+	d := device(t, st, "1")
+
+	got, err := d.CustomData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, l.Data) {
+		t.Errorf("CustomData() = %v, want %v", got, l.Data)
+	}
+
+	values := map[string]interface{}{
+		"tags":        []interface{}{"night", "away/home"},
+		"lastTrigger": "2016-03-01T10:20:30Z",
+		"count":       3.0,
+		"armed":       true,
+		"zone":        map[string]interface{}{"x": 1.0, "y": 2.0},
+	}
+	for key, value := range values {
+		if err := d.SetCustomData(key, value); err != nil {
+			t.Fatalf("SetCustomData(%q, %v): %v", key, value, err)
+		}
+	}
+	values["room"] = "den"
+	if got, err := d.CustomData(); err != nil || !reflect.DeepEqual(got, values) {
+		t.Errorf("CustomData() after setting = %v, %v; want %v", got, err, values)
+	}
+	// The data is kept per device.
+	if got, err := device(t, st, "2").CustomData(); err != nil || len(got) != 0 {
+		t.Errorf("other device data = %v, %v; want none", got, err)
+	}
+}
+
+func TestCustomDataErrors(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	st := connect(t, s, gosmart.Config{})
+	d := device(t, st, "1")
+
+	// Values that cannot be encoded are not sent.
+	before := len(s.Requests())
+	if err := d.SetCustomData("callback", func() {}); err == nil {
+		t.Error("SetCustomData with a func succeeded")
+	}
+	if n := len(s.Requests()) - before; n != 0 {
+		t.Errorf("unencodable value sent %d requests", n)
+	}
+
+	s.RemoveDevice("1")
+	var herr *gosmart.HTTPError
+	if _, err := d.CustomData(); !errors.As(err, &herr) || herr.StatusCode != http.StatusNotFound {
+		t.Errorf("CustomData() of a removed device = %v, want a 404", err)
+	}
+	if err := d.SetCustomData("room", "den"); !errors.As(err, &herr) || herr.StatusCode != http.StatusNotFound {
+		t.Errorf("SetCustomData() on a removed device = %v, want a 404", err)
+	}
+}
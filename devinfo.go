@@ -0,0 +1,250 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"encoding/json"
+	"golang.org/x/net/context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Health holds the health details of a device, as returned by the health
+// endpoint.
+type Health struct {
+	// State is the health state in upper case (e.g. "ONLINE", "OFFLINE").
+	State string
+	// LastUpdated is the time the state was last updated. Zero if not
+	// reported.
+	LastUpdated time.Time
+	// Reason explains the state (e.g. why the device is offline), if
+	// reported.
+	Reason string
+}
+
+// UnmarshalJSON decodes the health endpoint response. The last update time
+// may be a timestamp string or milliseconds since the epoch.
+func (h *Health) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		State           string      `json:"state"`
+		Status          string      `json:"status"`
+		LastUpdatedDate interface{} `json:"lastUpdatedDate"`
+		LastUpdated     interface{} `json:"lastUpdated"`
+		Reason          string      `json:"reason"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	h.State = raw.State
+	if h.State == "" {
+		h.State = raw.Status
+	}
+	h.State = strings.ToUpper(h.State)
+	h.Reason = raw.Reason
+	h.LastUpdated = time.Time{}
+	if t, ok := parseTime(raw.LastUpdatedDate); ok {
+		h.LastUpdated = t
+	} else if t, ok := parseTime(raw.LastUpdated); ok {
+		h.LastUpdated = t
+	}
+	return nil
+}
+
+// GetDeviceHealth returns the health details of a device.
+func GetDeviceHealth(ctx context.Context, client *http.Client, endpoint string, id string) (Health, error) {
+	var ret Health
+	contents, err := issueCommand(ctx, client, endpoint, "/devices/"+url.PathEscape(id)+"/health")
+	if err != nil {
+		return ret, err
+	}
+	if err := json.Unmarshal(contents, &ret); err != nil {
+		return ret, err
+	}
+	return ret, nil
+}
+
+// Health returns the health details of the device, read from the health
+// endpoint. See HealthStatus for the status reported with the device details.
+func (d *Device) Health() (Health, error) {
+	return d.HealthContext(context.Background())
+}
+
+// HealthContext is like Health, but honors ctx.
+func (d *Device) HealthContext(ctx context.Context) (Health, error) {
+	if err := d.st.connected(); err != nil {
+		return Health{}, err
+	}
+	return GetDeviceHealth(ctx, d.st.client, d.st.endpoint, d.ID)
+}
+
+// RoomID returns the ID of the room the device is assigned to, or blank if
+// it is not assigned to a room.
+func (d *Device) RoomID() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.info == nil {
+		return ""
+	}
+	return d.info.RoomID
+}
+
+// LocationID returns the ID of the location the device belongs to, or blank
+// if not reported.
+func (d *Device) LocationID() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.info == nil {
+		return ""
+	}
+	return d.info.LocationID
+}
+
+// HealthStatus returns the health status of the device in upper case (e.g.
+// "ONLINE", "OFFLINE"), from the status reported with the device details or,
+// failing that, its healthStatus attribute. Blank if neither is reported.
+func (d *Device) HealthStatus() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.info != nil && d.info.Status != "" {
+		return strings.ToUpper(d.info.Status)
+	}
+	s, _ := d.raw["healthStatus"].(string)
+	return strings.ToUpper(s)
+}
+
+// Online returns false if the device is reported offline, meaning its
+// attribute values may be stale. Devices not reporting their health status
+// are assumed to be online.
+func (d *Device) Online() bool {
+	return d.HealthStatus() != "OFFLINE"
+}
+
+// TypeID returns the ID of the device handler, or blank if not reported.
+func (d *Device) TypeID() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.info == nil {
+		return ""
+	}
+	return d.info.TypeID
+}
+
+// fingerprintKeys lists the device data entries describing the hardware of
+// Zigbee and Z-Wave devices.
+var fingerprintKeys = []string{
+	"manufacturer", "model", "application", "deviceId", "profileId",
+	"endpointId", "inClusters", "outClusters", "MSR", "zwaveInfo",
+}
+
+// Fingerprint returns the manufacturer specific fingerprint of the device
+// (clusters, endpoints, product codes). If the API does not report one, it
+// is assembled from the hardware entries of the device data. Returns false
+// if neither is available.
+func (d *Device) Fingerprint() (map[string]interface{}, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.info == nil {
+		return nil, false
+	}
+	ret := make(map[string]interface{})
+	if len(d.info.Fingerprint) > 0 {
+		for k, v := range d.info.Fingerprint {
+			ret[k] = v
+		}
+		return ret, true
+	}
+	for _, k := range fingerprintKeys {
+		if v, ok := d.info.Data[k]; ok {
+			ret[k] = v
+		}
+	}
+	return ret, len(ret) > 0
+}
+
+// LastActivity returns the time the device last reported to the hub.
+// Returns false if the API did not report it.
+func (d *Device) LastActivity() (time.Time, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.info == nil || d.info.LastActivity.IsZero() {
+		return time.Time{}, false
+	}
+	return d.info.LastActivity, true
+}
+
+// InstalledAt returns the time the device was added. Returns false if the
+// API did not report it.
+func (d *Device) InstalledAt() (time.Time, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.info == nil || d.info.InstalledAt.IsZero() {
+		return time.Time{}, false
+	}
+	return d.info.InstalledAt, true
+}
+
+// IsVirtual returns true if the device is a virtual or simulated device,
+// either because the API flags it as such or because its device handler is
+// named like one (e.g. "Virtual Switch", "Simulated Lock").
+func (d *Device) IsVirtual() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.info == nil {
+		return false
+	}
+	if d.info.Virtual {
+		return true
+	}
+	t := strings.ToLower(d.info.TypeName)
+	return strings.Contains(t, "virtual") || strings.Contains(t, "simulated")
+}
+
+// PhysicalDevices returns the devices that are not virtual (see IsVirtual).
+func (st *SmartThings) PhysicalDevices() []*Device {
+	var ret []*Device
+	for _, d := range st.DeviceList() {
+		if !d.IsVirtual() {
+			ret = append(ret, d)
+		}
+	}
+	return ret
+}
+
+// CheckInterval returns the interval within which the device is expected to
+// report, from the checkInterval attribute (in seconds). Returns false if
+// the device does not report it.
+func (d *Device) CheckInterval() (time.Duration, bool) {
+	v, ok := d.reading("checkInterval")
+	if !ok || v <= 0 {
+		return 0, false
+	}
+	return time.Duration(v * float64(time.Second)), true
+}
+
+// OverdueDevices returns the devices that have not reported within their
+// check interval. Devices without a check interval or last activity time
+// are never considered overdue.
+func (st *SmartThings) OverdueDevices() []*Device {
+	var ret []*Device
+	now := time.Now()
+	for _, d := range st.DeviceList() {
+		interval, ok := d.CheckInterval()
+		if !ok {
+			continue
+		}
+		last, ok := d.LastActivity()
+		if !ok {
+			continue
+		}
+		if now.Sub(last) > interval {
+			ret = append(ret, d)
+		}
+	}
+	return ret
+}
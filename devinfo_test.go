@@ -0,0 +1,246 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/smoogle/gosmart"
+	"github.com/smoogle/gosmart/gosmarttest"
+)
+
+// reporting returns a sensor fixture expected to report every interval
+// seconds (if positive), last heard from at last (if not zero).
+func reporting(id string, interval float64, last time.Time) gosmarttest.Device {
+	d := gosmarttest.Device{
+		ID:           id,
+		Name:         "Sensor " + id,
+		DisplayName:  "Sensor " + id,
+		Attributes:   map[string]interface{}{"temperature": 20.0},
+		LastActivity: last,
+	}
+	if interval > 0 {
+		d.Attributes["checkInterval"] = interval
+	}
+	return d
+}
+
+// serveInfo serves info, with the ID, names and an empty set of attributes
+// added, as the metadata of device id on s.
+func serveInfo(s *gosmarttest.Server, id string, info map[string]interface{}) {
+	info["id"], info["name"], info["displayName"] = id, "Sensor "+id, "Sensor "+id
+	info["attributes"] = map[string]interface{}{}
+	s.HandleFunc("/devices/"+id, gosmarttest.JSON(info))
+}
+
+func TestOverdueDevices(t *testing.T) {
+	ago := time.Now().Add(-5 * time.Minute)
+	s := newServer(t,
+		reporting("silent", 60, ago),
+		reporting("fine", 3600, ago),
+		reporting("unknown", 0, ago),
+		reporting("never", 60, time.Time{}),
+	)
+	st := connect(t, s, gosmart.Config{})
+
+	if iv, ok := device(t, st, "silent").CheckInterval(); !ok || iv != time.Minute {
+		t.Errorf("CheckInterval() = %v, %v; want 1m", iv, ok)
+	}
+	if _, ok := device(t, st, "unknown").CheckInterval(); ok {
+		t.Error("CheckInterval() reported for a device without one")
+	}
+	if last, ok := device(t, st, "fine").LastActivity(); !ok || !last.Truncate(time.Millisecond).Equal(ago.Truncate(time.Millisecond)) {
+		t.Errorf("LastActivity() = %v, %v; want %v", last, ok, ago)
+	}
+
+	overdue := st.OverdueDevices()
+	if len(overdue) != 1 || overdue[0].ID != "silent" {
+		var ids []string
+		for _, d := range overdue {
+			ids = append(ids, d.ID)
+		}
+		t.Errorf("OverdueDevices() = %v, want [silent]", ids)
+	}
+}
+
+func TestInstalledAt(t *testing.T) {
+	want := time.Date(2016, 3, 1, 12, 30, 0, 0, time.UTC)
+	payloads := map[string]map[string]interface{}{
+		"rfc3339": {"installedAt": "2016-03-01T12:30:00Z"},
+		"millis":  {"installedAt": float64(want.UnixNano() / int64(time.Millisecond))},
+		"offset":  {"installedAt": "2016-03-01T12:30:00.000+0000"},
+		"spaced":  {"installedAt": " 2016-03-01 12:30:00 UTC "},
+		"created": {"dateCreated": "2016-03-01T12:30:00Z"},
+		"missing": {},
+		"garbage": {"installedAt": "last tuesday"},
+	}
+	var devs []gosmarttest.Device
+	for id := range payloads {
+		devs = append(devs, reporting(id, 0, time.Time{}))
+	}
+	s := newServer(t, devs...)
+	for id, p := range payloads {
+		serveInfo(s, id, p)
+	}
+	st := connect(t, s, gosmart.Config{})
+
+	for id := range payloads {
+		got, ok := device(t, st, id).InstalledAt()
+		if id == "missing" || id == "garbage" {
+			if ok {
+				t.Errorf("%s: InstalledAt() = %v, want none", id, got)
+			}
+			continue
+		}
+		if !ok || !got.Equal(want) {
+			t.Errorf("%s: InstalledAt() = %v, %v; want %v", id, got, ok, want)
+		}
+	}
+}
+
+func TestPhysicalDevices(t *testing.T) {
+	infos := map[string]map[string]interface{}{
+		"flagged":   {"virtual": true, "typeName": "Z-Wave Switch"},
+		"virtual":   {"typeName": "Virtual Switch"},
+		"simulated": {"typeName": "Simulated Lock"},
+		"physical":  {"typeName": "Z-Wave Switch"},
+		"unknown":   {},
+	}
+	var devs []gosmarttest.Device
+	for id := range infos {
+		devs = append(devs, reporting(id, 0, time.Time{}))
+	}
+	s := newServer(t, devs...)
+	for id, info := range infos {
+		serveInfo(s, id, info)
+	}
+	st := connect(t, s, gosmart.Config{})
+
+	for id := range infos {
+		want := id == "flagged" || id == "virtual" || id == "simulated"
+		if got := device(t, st, id).IsVirtual(); got != want {
+			t.Errorf("%s: IsVirtual() = %v, want %v", id, got, want)
+		}
+	}
+	var ids []string
+	for _, d := range st.PhysicalDevices() {
+		ids = append(ids, d.ID)
+	}
+	sort.Strings(ids)
+	if !reflect.DeepEqual(ids, []string{"physical", "unknown"}) {
+		t.Errorf("PhysicalDevices() = %v, want [physical unknown]", ids)
+	}
+}
+
+func TestTypeID(t *testing.T) {
+	infos := map[string]map[string]interface{}{
+		"string": {"typeId": "a1b2-c3"},
+		"number": {"typeId": 1234.0},
+		"absent": {},
+	}
+	var devs []gosmarttest.Device
+	for id := range infos {
+		devs = append(devs, reporting(id, 0, time.Time{}))
+	}
+	s := newServer(t, devs...)
+	for id, info := range infos {
+		serveInfo(s, id, info)
+	}
+	st := connect(t, s, gosmart.Config{})
+
+	want := map[string]string{"string": "a1b2-c3", "number": "1234", "absent": ""}
+	for id, w := range want {
+		if got := device(t, st, id).TypeID(); got != w {
+			t.Errorf("%s: TypeID() = %q, want %q", id, got, w)
+		}
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	zigbee := map[string]interface{}{
+		"profileId":    "0104",
+		"endpointId":   "01",
+		"inClusters":   "0000,0001,0402",
+		"outClusters":  "0019",
+		"manufacturer": "CentraLite",
+		"model":        "3320-L",
+	}
+	infos := map[string]map[string]interface{}{
+		"reported": {"fingerprint": zigbee, "data": map[string]interface{}{"MSR": "ignored"}},
+		"data": {"data": map[string]interface{}{
+			"manufacturer": "Aeotec",
+			"MSR":          "0086-0102-0064",
+			"zwaveInfo":    map[string]interface{}{"zw": "L"},
+			"firmware":     "1.2",
+		}},
+		"unrelated": {"data": map[string]interface{}{"firmware": "1.2"}},
+		"absent":    {},
+	}
+	var devs []gosmarttest.Device
+	for id := range infos {
+		devs = append(devs, reporting(id, 0, time.Time{}))
+	}
+	s := newServer(t, devs...)
+	for id, info := range infos {
+		serveInfo(s, id, info)
+	}
+	st := connect(t, s, gosmart.Config{})
+
+	// A reported fingerprint is used as is.
+	if fp, ok := device(t, st, "reported").Fingerprint(); !ok || !reflect.DeepEqual(fp, zigbee) {
+		t.Errorf("Fingerprint() = %v, %v; want %v", fp, ok, zigbee)
+	}
+	// Otherwise it is taken from the hardware entries of the device data.
+	want := map[string]interface{}{
+		"manufacturer": "Aeotec",
+		"MSR":          "0086-0102-0064",
+		"zwaveInfo":    map[string]interface{}{"zw": "L"},
+	}
+	if fp, ok := device(t, st, "data").Fingerprint(); !ok || !reflect.DeepEqual(fp, want) {
+		t.Errorf("Fingerprint() = %v, %v; want %v", fp, ok, want)
+	}
+	for _, id := range []string{"unrelated", "absent"} {
+		if fp, ok := device(t, st, id).Fingerprint(); ok {
+			t.Errorf("%s: Fingerprint() = %v, want none", id, fp)
+		}
+	}
+}
+
+func TestHealth(t *testing.T) {
+	s := newServer(t, reporting("1", 0, time.Time{}), reporting("2", 0, time.Time{}), reporting("3", 0, time.Time{}))
+	updated := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	s.HandleFunc("/devices/1/health", gosmarttest.JSON(map[string]interface{}{
+		"state":           "online",
+		"lastUpdatedDate": updated.Format(time.RFC3339),
+	}))
+	s.HandleFunc("/devices/2/health", gosmarttest.JSON(map[string]interface{}{
+		"status":      "Offline",
+		"lastUpdated": float64(updated.UnixNano() / int64(time.Millisecond)),
+		"reason":      "battery depleted",
+	}))
+	st := connect(t, s, gosmart.Config{})
+
+	want := map[string]gosmart.Health{
+		"1": {State: "ONLINE", LastUpdated: updated},
+		"2": {State: "OFFLINE", LastUpdated: updated, Reason: "battery depleted"},
+	}
+	for id, w := range want {
+		h, err := device(t, st, id).Health()
+		if err != nil {
+			t.Fatalf("device %s: %v", id, err)
+		}
+		if h.State != w.State || !h.LastUpdated.Equal(w.LastUpdated) || h.Reason != w.Reason {
+			t.Errorf("device %s: Health() = %+v, want %+v", id, h, w)
+		}
+	}
+	if h, err := device(t, st, "3").Health(); err == nil {
+		t.Errorf("Health() without a health endpoint = %+v, want an error", h)
+	}
+}
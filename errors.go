@@ -0,0 +1,151 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	// Maximum number of response body bytes kept in an HTTPError.
+	httpErrorBodyLimit = 512
+)
+
+var (
+	// ErrTruncatedResponse is returned when the connection is closed before
+	// the whole response body is received.
+	ErrTruncatedResponse = errors.New("truncated response")
+
+	// ErrNotConnected is returned when a request is attempted before the
+	// client and endpoint are set up (e.g. on a SmartThings value not
+	// obtained from Connect).
+	ErrNotConnected = errors.New("not connected: use Connect to set up the client and endpoint")
+
+	// ErrCommandNotAllowed is returned when a command is not in the allowed
+	// command list (see Config.AllowedCommands).
+	ErrCommandNotAllowed = errors.New("command not allowed")
+
+	// ErrReadOnly is returned by commands and other requests changing state
+	// when Config.ReadOnly is set. No request is sent.
+	ErrReadOnly = errors.New("read-only mode: request not sent")
+
+	// ErrDeviceNotFound is returned when looking up an unknown device, or
+	// when the server does not know the device.
+	ErrDeviceNotFound = errors.New("device not found")
+
+	// ErrCommandUnavailable is returned when a device does not accept a
+	// command.
+	ErrCommandUnavailable = errors.New("unavailable command")
+
+	// ErrUnsupported is returned by capability methods the device does not
+	// support, such as Thermostat.SetHumiditySetpoint on a thermostat
+	// controlling no humidifier.
+	ErrUnsupported = errors.New("unsupported by device")
+
+	// ErrUnauthorized is returned (wrapped in an *HTTPError) when the server
+	// rejects the credentials (HTTP 401), e.g. with an expired or revoked
+	// token.
+	ErrUnauthorized = errors.New("unauthorized")
+
+	// ErrForbidden is returned (wrapped in an *HTTPError) when the server
+	// accepts the credentials but denies the request (HTTP 403), e.g. for
+	// lack of an OAuth scope. Re-authenticating with the same scopes does
+	// not help.
+	ErrForbidden = errors.New("forbidden")
+
+	// ErrResponseTooLarge is returned when a response body exceeds the size
+	// limit (see Config.MaxResponseBytes).
+	ErrResponseTooLarge = errors.New("response too large")
+
+	// ErrRateLimited is returned (wrapped in an *HTTPError) when the server
+	// rejects a request for exceeding the rate limit (HTTP 429).
+	ErrRateLimited = errors.New("rate limited")
+)
+
+// HTTPError is returned when the server replies with a non-2xx status.
+type HTTPError struct {
+	StatusCode int
+	// Body holds the beginning of the response body (up to 512 bytes).
+	Body string
+	// RawBody holds the whole response body, e.g. the explanation of the
+	// hub when it rejects a command.
+	RawBody []byte
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("http status %d: %s", e.StatusCode, e.Body)
+}
+
+// Unwrap returns the sentinel error matching the status code, if any, so
+// errors.Is(err, ErrUnauthorized), errors.Is(err, ErrForbidden) and
+// errors.Is(err, ErrRateLimited) work.
+func (e *HTTPError) Unwrap() error {
+	switch e.StatusCode {
+	case http.StatusUnauthorized:
+		return ErrUnauthorized
+	case http.StatusForbidden:
+		return ErrForbidden
+	case http.StatusTooManyRequests:
+		return ErrRateLimited
+	}
+	return nil
+}
+
+// RefreshError is returned by Refresh when some devices could not be loaded
+// and Config.SkipDeviceErrors is set.
+type RefreshError struct {
+	// Errors holds the error of each device that failed, keyed by ID.
+	Errors map[string]error
+}
+
+func (e *RefreshError) Error() string {
+	var ids []string
+	for id := range e.Errors {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	var msgs []string
+	for _, id := range ids {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", id, e.Errors[id]))
+	}
+	return fmt.Sprintf("refresh failed for %d devices: %s", len(ids), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the device errors, so errors.Is and errors.As match any of
+// them.
+func (e *RefreshError) Unwrap() []error {
+	var ret []error
+	for _, err := range e.Errors {
+		ret = append(ret, err)
+	}
+	return ret
+}
+
+// notFound converts an HTTP 404 error for device id into an error wrapping
+// ErrDeviceNotFound. Other errors are returned unchanged.
+func notFound(err error, id string) error {
+	var herr *HTTPError
+	if errors.As(err, &herr) && herr.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", ErrDeviceNotFound, id)
+	}
+	return err
+}
+
+// newHTTPError returns an *HTTPError for a response with the given status
+// and body.
+func newHTTPError(status int, body []byte) *HTTPError {
+	e := &HTTPError{StatusCode: status, RawBody: body}
+	if len(body) > httpErrorBodyLimit {
+		body = body[:httpErrorBodyLimit]
+	}
+	e.Body = string(body)
+	return e
+}
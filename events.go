@@ -0,0 +1,210 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"encoding/json"
+	"fmt"
+	"golang.org/x/net/context"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	// Number of recent events searched by LastEventValue.
+	lastEventLimit = 50
+
+	// Number of events requested per page by GetDeviceEventsSince.
+	eventPage = 200
+)
+
+// DeviceEvent holds one entry of a device event history.
+type DeviceEvent struct {
+	// Name is the name of the attribute the event refers to.
+	Name string `json:"name"`
+	// Value is the new attribute value, as a string.
+	Value string `json:"-"`
+	Unit  string `json:"unit"`
+	// Time is the time the event happened.
+	Time time.Time `json:"-"`
+}
+
+// UnmarshalJSON decodes a device event, converting the value to a string and
+// the timestamp to a time.Time. The timestamp is read from "date" or, if
+// absent or unparseable, from "isoDate" or "time".
+func (e *DeviceEvent) UnmarshalJSON(b []byte) error {
+	type alias DeviceEvent
+	aux := struct {
+		*alias
+		Value   interface{} `json:"value"`
+		Date    interface{} `json:"date"`
+		ISODate interface{} `json:"isoDate"`
+		When    interface{} `json:"time"`
+	}{alias: (*alias)(e)}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+	switch t := aux.Value.(type) {
+	case nil:
+		e.Value = ""
+	case string:
+		e.Value = t
+	case float64:
+		e.Value = strconv.FormatFloat(t, 'f', -1, 64)
+	default:
+		e.Value = fmt.Sprintf("%v", t)
+	}
+	e.Time = time.Time{}
+	for _, v := range []interface{}{aux.Date, aux.ISODate, aux.When} {
+		if t, ok := parseTime(v); ok {
+			e.Time = t
+			break
+		}
+	}
+	return nil
+}
+
+// GetDeviceEvents returns up to limit of the most recent events of a device,
+// sorted by time, oldest first. A limit of zero or less lets the server
+// decide how many events to return.
+func GetDeviceEvents(ctx context.Context, client *http.Client, endpoint string, id string, limit int) ([]DeviceEvent, error) {
+	ret := []DeviceEvent{}
+
+	path := "/devices/" + url.PathEscape(id) + "/events"
+	if limit > 0 {
+		path += "?max=" + strconv.Itoa(limit)
+	}
+	contents, err := issueCommand(ctx, client, endpoint, path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(contents, &ret); err != nil {
+		return nil, err
+	}
+	sortEvents(ret)
+	return ret, nil
+}
+
+// sortEvents sorts events sent newest first by time, oldest first. Events
+// with the same timestamp keep the order they happened in.
+func sortEvents(events []DeviceEvent) {
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time.Before(events[j].Time)
+	})
+}
+
+// GetDeviceEventsSince returns the events of a device for attr (all
+// attributes if blank) since t, oldest first, plus the last one before t
+// (so the value at t is known). The history is read in pages, newest first,
+// asking the server for events of attr older than the oldest seen so far.
+func GetDeviceEventsSince(ctx context.Context, client *http.Client, endpoint string, id string, attr string, t time.Time) ([]DeviceEvent, error) {
+	var (
+		ret    []DeviceEvent
+		before time.Time
+	)
+	for {
+		query := url.Values{"max": {strconv.Itoa(eventPage)}}
+		if attr != "" {
+			query.Set("attribute", attr)
+		}
+		if !before.IsZero() {
+			query.Set("before", strconv.FormatInt(before.UnixNano()/int64(time.Millisecond), 10))
+		}
+		contents, err := issueCommand(ctx, client, endpoint, "/devices/"+url.PathEscape(id)+"/events?"+query.Encode())
+		if err != nil {
+			return nil, err
+		}
+		var page []DeviceEvent
+		if err := json.Unmarshal(contents, &page); err != nil {
+			return nil, err
+		}
+
+		done := len(page) < eventPage
+		oldest := before
+		for _, e := range page {
+			// Servers ignoring the query send events already seen.
+			if !before.IsZero() && !e.Time.Before(before) {
+				continue
+			}
+			if oldest.IsZero() || e.Time.Before(oldest) {
+				oldest = e.Time
+			}
+			if attr != "" && e.Name != attr {
+				continue
+			}
+			ret = append(ret, e)
+			if !e.Time.After(t) {
+				done = true
+			}
+		}
+		if done || oldest.Equal(before) {
+			break
+		}
+		before = oldest
+	}
+	sortEvents(ret)
+	return ret, nil
+}
+
+// Events returns up to limit of the most recent device events, oldest first.
+func (d *Device) Events(limit int) ([]DeviceEvent, error) {
+	return d.EventsContext(context.Background(), limit)
+}
+
+// EventsContext works like Events, aborting the request when ctx is
+// cancelled.
+func (d *Device) EventsContext(ctx context.Context, limit int) ([]DeviceEvent, error) {
+	if err := d.st.connected(); err != nil {
+		return nil, err
+	}
+	return GetDeviceEvents(ctx, d.st.client, d.st.endpoint, d.ID, limit)
+}
+
+// EventsSince returns the device events for attr (all attributes if blank)
+// since t, as GetDeviceEventsSince.
+func (d *Device) EventsSince(attr string, t time.Time) ([]DeviceEvent, error) {
+	return d.EventsSinceContext(context.Background(), attr, t)
+}
+
+// EventsSinceContext works like EventsSince, aborting the requests when ctx
+// is cancelled.
+func (d *Device) EventsSinceContext(ctx context.Context, attr string, t time.Time) ([]DeviceEvent, error) {
+	if err := d.st.connected(); err != nil {
+		return nil, err
+	}
+	return GetDeviceEventsSince(ctx, d.st.client, d.st.endpoint, d.ID, attr, t)
+}
+
+// LastEventValue returns the value of the most recent event for attr, as a
+// string. This captures momentary values (e.g. a button "pushed" action) that
+// the attribute snapshot does not keep. Returns false if no such event is
+// found in the recent history or the history cannot be read.
+func (d *Device) LastEventValue(attr string) (string, bool) {
+	e, ok := d.lastEvent(attr)
+	return e.Value, ok
+}
+
+// lastEvent returns the most recent event for attr in the recent history.
+func (d *Device) lastEvent(attr string) (DeviceEvent, bool) {
+	events, err := d.Events(lastEventLimit)
+	if err != nil {
+		return DeviceEvent{}, false
+	}
+	for i := len(events) - 1; i >= 0; i-- {
+		if events[i].Name == attr {
+			return events[i], true
+		}
+	}
+	return DeviceEvent{}, false
+}
@@ -0,0 +1,64 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smoogle/gosmart"
+	"github.com/smoogle/gosmart/gosmarttest"
+)
+
+func TestLastEventValue(t *testing.T) {
+	button := gosmarttest.Device{
+		ID:          "1",
+		Name:        "Button",
+		DisplayName: "Doorbell",
+		Attributes:  map[string]interface{}{"battery": 90.0},
+	}
+	s := newServer(t, button)
+	now := time.Now()
+	s.AddEvent("1", "button", "pushed", now.Add(-3*time.Minute))
+	s.AddEvent("1", "button", "held", now.Add(-2*time.Minute))
+	s.AddEvent("1", "battery", 89.0, now.Add(-time.Minute))
+	st := connect(t, s, gosmart.Config{})
+	d := device(t, st, "1")
+
+	if v, ok := d.LastEventValue("button"); !ok || v != "held" {
+		t.Errorf("LastEventValue(button) = %q, %v; want held", v, ok)
+	}
+	if v, ok := d.LastEventValue("battery"); !ok || v != "89" {
+		t.Errorf("LastEventValue(battery) = %q, %v; want 89", v, ok)
+	}
+	if v, ok := d.LastEventValue("contact"); ok {
+		t.Errorf("LastEventValue(contact) = %q, want none", v)
+	}
+
+	s.AddEvent("1", "button", "double", now)
+	if v, _ := d.LastEventValue("button"); v != "double" {
+		t.Errorf("LastEventValue(button) after a new event = %q, want double", v)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	st := connect(t, s, gosmart.Config{})
+	d := device(t, st, "1")
+	for _, cmd := range []string{"on", "off", "on"} {
+		if err := d.Call(cmd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	events, err := d.Events(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Value != "off" || events[1].Value != "on" {
+		t.Errorf("Events(2) = %+v, want the last two switch events, oldest first", events)
+	}
+}
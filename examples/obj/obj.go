@@ -11,8 +11,8 @@ import (
 )
 
 var (
-	flagClient    = flag.String("client", "", "OAuth Client ID")
-	flagSecret    = flag.String("secret", "", "OAuth Secret")
+	flagClient = flag.String("client", "", "OAuth Client ID")
+	flagSecret = flag.String("secret", "", "OAuth Secret")
 )
 
 func main() {
@@ -24,20 +24,20 @@ func main() {
 	ctx := context.Background()
 	cfg := gosmart.Config{
 		ClientID: *flagClient,
-		Secret: *flagSecret,
+		Secret:   *flagSecret,
 	}
 	st, err := gosmart.Connect(ctx, cfg)
 	if err != nil {
 		log.Fatalln(err)
 	}
 
-	for _, dev := range st.Devices {
+	for _, dev := range st.DeviceList() {
 		fmt.Printf("\nDevice ID:      %s\n", dev.ID)
 		fmt.Printf("  Name:         %s\n", dev.Name)
 		fmt.Printf("  Display Name: %s\n", dev.DisplayName)
-		if len(dev.Attributes) > 0 {
+		if len(dev.Attributes()) > 0 {
 			fmt.Printf("  Attributes:\n")
-			for k, v := range dev.Attributes {
+			for k, v := range dev.Attributes() {
 				fmt.Printf("    %v: %v\n", k, v)
 			}
 		}
@@ -52,9 +52,9 @@ func main() {
 
 	fmt.Println()
 	fmt.Printf("Turning all devices on...\n")
-	for _, dev := range st.Devices {
-		err := dev.Call("setLevel", 100)
-		if err != nil {
+	errs := st.CallAll(st.DeviceList(), "setLevel", 100)
+	for _, dev := range st.DeviceList() {
+		if err := errs[dev.ID]; err != nil {
 			fmt.Printf("[%v] %s: %v\n", dev.ID, dev.Name, err)
 		} else {
 			fmt.Printf("[%v] %s: OK\n", dev.ID, dev.Name)
@@ -66,7 +66,7 @@ func main() {
 
 	// Retrieve Endpoints URI. All future accesses to the smartthings API
 	// for this session should use this URL, followed by the desired URL path.
-	endpoint, err := gosmart.GetEndPointsURI(client)
+	endpoint, err := gosmart.GetEndPointsURI(ctx, client)
 	if err != nil {
 		log.Fatalln(err)
 	}
@@ -78,7 +78,7 @@ func main() {
 	}
 	// List all info about devices if --all specified
 	if *flagAll {
-		devs, err := gosmart.GetDevices(client, endpoint)
+		devs, err := gosmart.GetDevices(ctx, client, endpoint)
 		if err != nil {
 			log.Fatalln(err)
 		}
@@ -88,7 +88,7 @@ func main() {
 	}
 
 	if len(devices) == 0 {
-		devs, err := gosmart.GetDevices(client, endpoint)
+		devs, err := gosmart.GetDevices(ctx, client, endpoint)
 		if err != nil {
 			log.Fatalln(err)
 		}
@@ -97,7 +97,7 @@ func main() {
 		}
 	} else {
 		for _, id := range devices {
-			dev, err := gosmart.GetDeviceInfo(client, endpoint, id)
+			dev, err := gosmart.GetDeviceInfo(ctx, client, endpoint, id)
 			if err != nil {
 				log.Fatalln(err)
 			}
@@ -110,7 +110,7 @@ func main() {
 			}
 
 			fmt.Printf("  Commands & Parameters:\n")
-			cmds, err := gosmart.GetDeviceCommands(client, endpoint, id)
+			cmds, err := gosmart.GetDeviceCommands(ctx, client, endpoint, id)
 			for _, cmd := range cmds {
 				fmt.Printf("    %s", cmd.Command)
 				if len(cmd.Params) != 0 {
@@ -0,0 +1,240 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ExportDOT writes a Graphviz DOT graph of all devices to w, clustered by
+// room. Node shapes reflect the device capabilities (switches are boxes,
+// locks octagons, thermostats houses and everything else an ellipse).
+// Parent/child relationships are drawn as edges.
+func (st *SmartThings) ExportDOT(w io.Writer) error {
+	if err := st.connected(); err != nil {
+		return err
+	}
+	// Room names are a nicety. Fall back to IDs if we can't fetch them.
+	names := make(map[string]string)
+	if rooms, err := st.Rooms(); err == nil {
+		for _, r := range rooms {
+			names[r.ID] = r.Name
+		}
+	}
+
+	// Group devices by room.
+	byRoom := make(map[string][]*Device)
+	var roomIDs []string
+	for _, d := range st.DeviceList() {
+		id := d.RoomID()
+		if _, ok := byRoom[id]; !ok {
+			roomIDs = append(roomIDs, id)
+		}
+		byRoom[id] = append(byRoom[id], d)
+	}
+	sort.Strings(roomIDs)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph smartthings {")
+	for i, id := range roomIDs {
+		indent := "\t"
+		if id != "" {
+			label := names[id]
+			if label == "" {
+				label = id
+			}
+			fmt.Fprintf(bw, "\tsubgraph cluster_%d {\n", i)
+			fmt.Fprintf(bw, "\t\tlabel=%s;\n", dotQuote(label))
+			indent = "\t\t"
+		}
+		for _, d := range byRoom[id] {
+			_, displayName := d.Names()
+			fmt.Fprintf(bw, "%s%s [label=%s, shape=%s];\n", indent, dotQuote(d.ID), dotQuote(displayName), dotShape(d))
+		}
+		if id != "" {
+			fmt.Fprintln(bw, "\t}")
+		}
+	}
+	for _, d := range st.DeviceList() {
+		for _, c := range d.Children() {
+			fmt.Fprintf(bw, "\t%s -> %s;\n", dotQuote(d.ID), dotQuote(c.ID))
+		}
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+// dotQuote returns s as a quoted DOT string.
+func dotQuote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	return `"` + s + `"`
+}
+
+// dotShape returns the DOT node shape for a device, based on capabilities.
+func dotShape(d *Device) string {
+	var (
+		sw Switch
+		lk Lock
+		th Thermostat
+	)
+	switch {
+	case d.As(&lk):
+		return "octagon"
+	case d.As(&th):
+		return "house"
+	case d.As(&sw):
+		return "box"
+	}
+	return "ellipse"
+}
+
+// schemaDevice is the exported schema of one device.
+type schemaDevice struct {
+	ID          string                 `json:"id"`
+	Name        string                 `json:"name"`
+	DisplayName string                 `json:"displayName"`
+	Commands    []schemaCommand        `json:"commands"`
+	Attributes  map[string]interface{} `json:"attributes"`
+}
+
+// schemaCommand is the exported schema of one command.
+type schemaCommand struct {
+	Name         string        `json:"name"`
+	Capabilities []string      `json:"capabilities,omitempty"`
+	Params       []ParamSchema `json:"params"`
+}
+
+// ExportSchema writes a JSON document describing every device: its commands
+// (with their capabilities and parameters, including types, ranges and enum
+// values) and its current attributes. The output is meant for offline tools
+// such as UI or code generators.
+func (st *SmartThings) ExportSchema(w io.Writer) error {
+	if err := st.connected(); err != nil {
+		return err
+	}
+	devices := []schemaDevice{}
+	for _, d := range st.DeviceList() {
+		name, displayName := d.Names()
+		sd := schemaDevice{
+			ID:          d.ID,
+			Name:        name,
+			DisplayName: displayName,
+			Commands:    []schemaCommand{},
+			Attributes:  d.RawAttributes(),
+		}
+		for _, cmd := range d.CommandList() {
+			params := d.paramSchema(cmd)
+			if params == nil {
+				params = []ParamSchema{}
+			}
+			sd.Commands = append(sd.Commands, schemaCommand{
+				Name:         cmd,
+				Capabilities: d.CommandCapabilities(cmd),
+				Params:       params,
+			})
+		}
+		devices = append(devices, sd)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]interface{}{"devices": devices})
+}
+
+// ExportInflux writes the current attributes of every device to w in
+// InfluxDB line protocol, one line per device: the given measurement, tags
+// for the device ID and display name, one field per attribute and the time
+// of the last refresh. Numbers are written as floats, booleans as booleans,
+// strings as string fields, and other values (e.g. objects) as JSON strings.
+// Devices without attributes are skipped.
+func (st *SmartThings) ExportInflux(w io.Writer, measurement string) error {
+	if err := st.connected(); err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	for _, d := range st.DeviceList() {
+		raw := d.RawAttributes()
+		var names []string
+		for k, v := range raw {
+			if v != nil {
+				names = append(names, k)
+			}
+		}
+		if len(names) == 0 {
+			continue
+		}
+		sort.Strings(names)
+
+		d.mu.Lock()
+		ts := d.lastRefresh
+		d.mu.Unlock()
+
+		bw.WriteString(influxEscape(measurement, ", "))
+		bw.WriteString(",device_id=" + influxEscape(d.ID, ",= "))
+		if _, displayName := d.Names(); displayName != "" {
+			bw.WriteString(",name=" + influxEscape(displayName, ",= "))
+		}
+		for i, k := range names {
+			sep := ","
+			if i == 0 {
+				sep = " "
+			}
+			bw.WriteString(sep + influxEscape(k, ",= ") + "=" + influxField(raw[k]))
+		}
+		fmt.Fprintf(bw, " %d\n", ts.UnixNano())
+	}
+	return bw.Flush()
+}
+
+// influxEscape backslash-escapes the characters in chars (and newlines,
+// which cannot be escaped, are replaced by spaces).
+func influxEscape(s, chars string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r == '\n' {
+			r = ' '
+		}
+		if strings.ContainsRune(chars, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// influxField formats an attribute value as a line protocol field value.
+func influxField(v interface{}) string {
+	switch t := v.(type) {
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(t)
+	case string:
+		return influxString(t)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return influxString(fmt.Sprint(v))
+	}
+	return influxString(string(b))
+}
+
+// influxString returns s as a quoted line protocol string field. Newlines
+// are replaced by spaces, keeping one record per line.
+func influxString(s string) string {
+	s = strings.Replace(s, "\n", " ", -1)
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	return `"` + s + `"`
+}
@@ -0,0 +1,162 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smoogle/gosmart"
+	"github.com/smoogle/gosmart/gosmarttest"
+)
+
+func TestExportDOT(t *testing.T) {
+	kitchen := lamp("1")
+	kitchen.RoomID = "r1"
+	kitchen.DisplayName = `Lamp "by the sink"`
+	hall := thermostat("2")
+	hall.RoomID = "r2"
+	sensor := lamp("4")
+	sensor.ParentID = "3"
+	s := newServer(t, kitchen, hall, frontDoor("3"), sensor)
+	s.HandleFunc("/rooms", gosmarttest.JSON([]gosmart.Room{{ID: "r1", Name: "Kitchen"}}))
+	st := connect(t, s, gosmart.Config{})
+
+	var buf bytes.Buffer
+	if err := st.ExportDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.HasPrefix(out, "digraph smartthings {\n") || !strings.HasSuffix(out, "}\n") {
+		t.Errorf("output is not a digraph:\n%s", out)
+	}
+	if n := strings.Count(out, "\tsubgraph cluster_"); n != 2 {
+		t.Errorf("output has %d clusters, want 2:\n%s", n, out)
+	}
+	for _, want := range []string{
+		" {\n\t\tlabel=\"Kitchen\";\n\t\t\"1\" [label=\"Lamp \\\"by the sink\\\"\", shape=box];\n\t}\n",
+		" {\n\t\tlabel=\"r2\";\n\t\t\"2\" [label=\"Thermostat 2\", shape=house];\n\t}\n",
+		"\t\"3\" [label=\"Front Door\", shape=octagon];\n",
+		"\t\"3\" -> \"4\";\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestExportSchema(t *testing.T) {
+	s := newServer(t, modeThermostat("1"), lamp("2"))
+	st := connect(t, s, gosmart.Config{})
+
+	var buf bytes.Buffer
+	if err := st.ExportSchema(&buf); err != nil {
+		t.Fatalf("ExportSchema: %v", err)
+	}
+	var doc struct {
+		Devices []struct {
+			ID          string
+			DisplayName string
+			Commands    []struct {
+				Name         string
+				Capabilities []string
+				Params       []gosmart.ParamSchema
+			}
+			Attributes map[string]interface{}
+		}
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("cannot decode the schema: %v\n%s", err, buf.String())
+	}
+	if len(doc.Devices) != 2 {
+		t.Fatalf("got %d devices, want 2", len(doc.Devices))
+	}
+
+	th := doc.Devices[0]
+	if th.ID != "1" || th.DisplayName != "Thermostat 1" || th.Attributes["thermostatMode"] != "heat" {
+		t.Errorf("got device %s (%q) with attributes %v", th.ID, th.DisplayName, th.Attributes)
+	}
+	params := make(map[string][]gosmart.ParamSchema)
+	for _, c := range th.Commands {
+		if c.Params == nil {
+			t.Errorf("command %s exported without a params list", c.Name)
+		}
+		params[c.Name] = c.Params
+	}
+	if p := params["setThermostatMode"]; len(p) != 1 || p[0].Type != "ENUM" || !reflect.DeepEqual(p[0].Enum, []string{"heat", "cool", "auto", "off"}) {
+		t.Errorf("setThermostatMode params = %+v, want the mode enum", p)
+	}
+	if p := params["setHeatingSetpoint"]; len(p) != 1 || p[0].Name != "setpoint" || p[0].Type != "NUMBER" {
+		t.Errorf("setHeatingSetpoint params = %+v, want a NUMBER setpoint", p)
+	}
+	if p, ok := params["heat"]; !ok || len(p) != 0 {
+		t.Errorf("heat params = %+v, want none", p)
+	}
+
+	var level gosmart.ParamSchema
+	for _, c := range doc.Devices[1].Commands {
+		if c.Name == "setLevel" && len(c.Params) == 1 {
+			level = c.Params[0]
+			if !reflect.DeepEqual(c.Capabilities, []string{"Switch Level"}) {
+				t.Errorf("setLevel capabilities = %v", c.Capabilities)
+			}
+		}
+	}
+	if level.Min == nil || level.Max == nil || *level.Min != 0 || *level.Max != 100 {
+		t.Errorf("setLevel param = %+v, want the 0-100 range", level)
+	}
+}
+
+func TestExportInflux(t *testing.T) {
+	odd := gosmarttest.Device{
+		ID:          "id 2",
+		DisplayName: "Hall, upstairs=1",
+		Attributes: map[string]interface{}{
+			"level":       12.5,
+			"motion":      "active",
+			"note":        "say \"hi\"\nnow",
+			"color map":   map[string]interface{}{"hue": 10.0},
+			"tamper,flag": true,
+			"gone":        nil,
+		},
+	}
+	s := newServer(t, lamp("1"), odd, gosmarttest.Device{ID: "3"})
+	before := time.Now()
+	st := connect(t, s, gosmart.Config{})
+	after := time.Now()
+
+	var b bytes.Buffer
+	if err := st.ExportInflux(&b, "smart things"); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	want := []string{
+		`smart\ things,device_id=1,name=Lamp\ 1 level=0,switch="off"`,
+		`smart\ things,device_id=id\ 2,name=Hall\,\ upstairs\=1 color\ map="{\"hue\":10}",level=12.5,motion="active",note="say \"hi\" now",tamper\,flag=true`,
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d (devices without attributes skipped):\n%s", len(lines), len(want), b.String())
+	}
+	for i, line := range lines {
+		sp := strings.LastIndex(line, " ")
+		if got := line[:sp]; got != want[i] {
+			t.Errorf("line %d = %s\nwant       %s", i, got, want[i])
+		}
+		ns, err := strconv.ParseInt(line[sp+1:], 10, 64)
+		if err != nil {
+			t.Fatalf("line %d: invalid timestamp: %v", i, err)
+		}
+		if ts := time.Unix(0, ns); ts.Before(before) || ts.After(after) {
+			t.Errorf("line %d: timestamp %v, want the time of the refresh", i, ts)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// Default number of attribute changes kept for ActivityFeed.
+	activityFeedSize = 100
+)
+
+// AttributeChange describes a change of an attribute value, as detected
+// between two refreshes of a device.
+type AttributeChange struct {
+	DeviceID string
+	// Name is the name of the attribute.
+	Name string
+	// Old and New hold the raw attribute values. Old is nil if the
+	// attribute was not reported before, New is nil if it is gone.
+	Old, New interface{}
+	// Time is when the change was detected.
+	Time time.Time
+}
+
+// changeRing is a fixed size ring buffer of attribute changes.
+type changeRing struct {
+	mu   sync.Mutex
+	buf  []AttributeChange
+	next int
+	full bool
+	size int
+}
+
+// add appends changes to the ring, overwriting the oldest entries when full.
+func (r *changeRing) add(size int, changes []AttributeChange) {
+	if size <= 0 {
+		size = activityFeedSize
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if size != r.size {
+		// Resize, keeping the most recent entries.
+		old := r.recent(0)
+		r.buf, r.next, r.full, r.size = make([]AttributeChange, size), 0, false, size
+		for i := len(old) - 1; i >= 0; i-- {
+			r.push(old[i])
+		}
+	}
+	for _, c := range changes {
+		r.push(c)
+	}
+}
+
+// push appends one change. Must be called with r.mu held.
+func (r *changeRing) push(c AttributeChange) {
+	r.buf[r.next] = c
+	r.next = (r.next + 1) % len(r.buf)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// recent returns up to limit changes, newest first. A limit of zero or less
+// returns all of them. Must be called with r.mu held.
+func (r *changeRing) recent(limit int) []AttributeChange {
+	n := r.next
+	if r.full {
+		n = len(r.buf)
+	}
+	if limit <= 0 || limit > n {
+		limit = n
+	}
+	ret := make([]AttributeChange, 0, limit)
+	for i := 1; i <= limit; i++ {
+		ret = append(ret, r.buf[(r.next-i+len(r.buf))%len(r.buf)])
+	}
+	return ret
+}
+
+// ActivityFeed returns up to limit of the latest attribute changes across
+// all devices, newest first. Changes are detected when devices are
+// refreshed; the number kept is set by Config.ActivityFeedSize. A limit of
+// zero or less returns all the changes kept.
+func (st *SmartThings) ActivityFeed(limit int) []AttributeChange {
+	if st.smartThings == nil {
+		return nil
+	}
+	st.feed.mu.Lock()
+	defer st.feed.mu.Unlock()
+	if st.feed.buf == nil {
+		return nil
+	}
+	return st.feed.recent(limit)
+}
+
+// diffAttributes returns the changes between two raw attribute maps of a
+// device, sorted by attribute name.
+func diffAttributes(id string, old, cur map[string]interface{}, now time.Time) []AttributeChange {
+	var ret []AttributeChange
+	for k, v := range cur {
+		if o, ok := old[k]; !ok || !reflect.DeepEqual(o, v) {
+			ret = append(ret, AttributeChange{DeviceID: id, Name: k, Old: old[k], New: v, Time: now})
+		}
+	}
+	for k, o := range old {
+		if _, ok := cur[k]; !ok {
+			ret = append(ret, AttributeChange{DeviceID: id, Name: k, Old: o, Time: now})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
@@ -0,0 +1,69 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"testing"
+
+	"github.com/smoogle/gosmart"
+)
+
+func TestActivityFeed(t *testing.T) {
+	s := newServer(t, lamp("1"), lamp("2"))
+	st := connect(t, s, gosmart.Config{ActivityFeedSize: 3})
+	if feed := st.ActivityFeed(0); len(feed) != 0 {
+		t.Fatalf("feed before any change = %+v, want empty", feed)
+	}
+
+	// Each step changes one attribute, then refreshes its device.
+	steps := []struct {
+		id, name string
+		value    interface{}
+	}{
+		{"1", "level", 10.0},
+		{"2", "switch", "on"},
+		{"1", "level", 20.0},
+		{"2", "level", 30.0},
+	}
+	for _, c := range steps {
+		s.SetAttribute(c.id, c.name, c.value)
+		if err := device(t, st, c.id).Refresh(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Refreshing without changes adds nothing.
+	if err := device(t, st, "1").Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the last three are kept, newest first.
+	feed := st.ActivityFeed(0)
+	if len(feed) != 3 {
+		t.Fatalf("feed holds %d changes, want 3: %+v", len(feed), feed)
+	}
+	want := []gosmart.AttributeChange{
+		{DeviceID: "2", Name: "level", Old: 0.0, New: 30.0},
+		{DeviceID: "1", Name: "level", Old: 10.0, New: 20.0},
+		{DeviceID: "2", Name: "switch", Old: "off", New: "on"},
+	}
+	for i, w := range want {
+		c := feed[i]
+		if c.DeviceID != w.DeviceID || c.Name != w.Name || c.Old != w.Old || c.New != w.New {
+			t.Errorf("feed[%d] = %+v, want %+v", i, c, w)
+		}
+		if i > 0 && c.Time.After(feed[i-1].Time) {
+			t.Errorf("feed[%d] is newer than feed[%d]", i, i-1)
+		}
+	}
+
+	if feed := st.ActivityFeed(2); len(feed) != 2 || feed[0].New != 30.0 || feed[1].New != 20.0 {
+		t.Errorf("ActivityFeed(2) = %+v, want the two latest changes", feed)
+	}
+	if feed := st.ActivityFeed(10); len(feed) != 3 {
+		t.Errorf("ActivityFeed(10) returned %d changes, want all 3", len(feed))
+	}
+}
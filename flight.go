@@ -0,0 +1,104 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"golang.org/x/net/context"
+	"sync"
+	"time"
+)
+
+// flightCall is an in-flight or completed request of a flightGroup.
+type flightCall struct {
+	done     chan struct{}
+	contents []byte
+	err      error
+	// waiters is the number of callers still waiting for the call, and
+	// cancel abandons it once there are none left. Protected by the mutex
+	// of the group.
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// flightGroup coalesces identical concurrent requests: while a request for
+// a key is in flight, other callers asking for the same key wait for it and
+// share its result instead of issuing their own.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+// do runs fn for key, unless a call for key is already in flight, in which
+// case it waits for that call and returns its result. Each caller gets its
+// own copy of the contents, and stops waiting when its own ctx is done. fn
+// runs with the values of the first caller's ctx, but is only cancelled
+// once every caller has stopped waiting for it.
+func (g *flightGroup) do(ctx context.Context, key string, fn func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	c, ok := g.calls[key]
+	if !ok {
+		fctx, cancel := context.WithCancel(detachedContext{ctx})
+		c = &flightCall{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = c
+		go func() {
+			contents, err := fn(fctx)
+			g.mu.Lock()
+			c.contents, c.err = contents, err
+			g.forget(key, c)
+			g.mu.Unlock()
+			cancel()
+			close(c.done)
+		}()
+	}
+	c.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return copyBytes(c.contents), c.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		c.waiters--
+		if c.waiters == 0 {
+			// Nobody is waiting anymore: abandon the call, and let later
+			// callers start their own.
+			g.forget(key, c)
+			c.cancel()
+		}
+		g.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// forget removes c from the calls in flight, unless it was already replaced.
+// Must be called with g.mu held.
+func (g *flightGroup) forget(key string, c *flightCall) {
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+}
+
+// detachedContext carries the values of a context, but not its deadline or
+// cancellation.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// copyBytes returns a copy of b.
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte(nil), b...)
+}
@@ -0,0 +1,170 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smoogle/gosmart"
+	"github.com/smoogle/gosmart/gosmarttest"
+	"golang.org/x/net/context"
+)
+
+// held serves /mode on s, holding every reply until release is closed (or
+// the request is cancelled). It returns a function counting the /mode
+// requests received.
+func held(s *gosmarttest.Server, release chan struct{}) func() int {
+	s.HandleFunc("/mode", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		gosmarttest.JSON(gosmart.Mode{ID: "home", Name: "Home"})(w, r)
+	})
+	return func() int {
+		n := 0
+		for _, r := range s.Requests() {
+			if r.Path == "/mode" {
+				n++
+			}
+		}
+		return n
+	}
+}
+
+func TestCoalescedReads(t *testing.T) {
+	s := newServer(t)
+	release := make(chan struct{})
+	reads := held(s, release)
+	st := connect(t, s, gosmart.Config{})
+
+	const n = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m, err := st.CurrentMode()
+			if err == nil && m != "Home" {
+				t.Errorf("CurrentMode() = %q, want Home", m)
+			}
+			errs <- err
+		}()
+	}
+	waitFor(t, "the first read", func() bool { return reads() > 0 })
+	// Let the other callers join before replying.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if got := reads(); got != 1 {
+		t.Errorf("%d concurrent reads sent %d requests, want 1", n, got)
+	}
+
+	// Later reads send their own request.
+	if _, err := st.CurrentMode(); err != nil {
+		t.Fatal(err)
+	}
+	if got := reads(); got != 2 {
+		t.Errorf("got %d requests after a new read, want 2", got)
+	}
+}
+
+func TestCoalescedReadsPerConnection(t *testing.T) {
+	s := newServer(t)
+	release := make(chan struct{})
+	reads := held(s, release)
+	st1 := connect(t, s, gosmart.Config{})
+	st2 := connect(t, s, gosmart.Config{})
+
+	var wg sync.WaitGroup
+	for _, st := range []*gosmart.SmartThings{st1, st2} {
+		st := st
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := st.CurrentMode(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	waitFor(t, "a read per connection", func() bool { return reads() == 2 })
+	close(release)
+	wg.Wait()
+}
+
+func TestCoalescedReadsCancel(t *testing.T) {
+	s := newServer(t)
+	release := make(chan struct{})
+	reads := held(s, release)
+	st := connect(t, s, gosmart.Config{})
+
+	// The first caller gives up while a second one waits for the same read.
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := st.CurrentModeContext(ctx)
+		first <- err
+	}()
+	waitFor(t, "the first read", func() bool { return reads() > 0 })
+	second := make(chan error, 1)
+	go func() {
+		_, err := st.CurrentModeContext(context.Background())
+		second <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-first:
+		if err != context.Canceled {
+			t.Errorf("cancelled read returned %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancelled read still waiting")
+	}
+
+	// The read goes on for the second caller.
+	close(release)
+	if err := <-second; err != nil {
+		t.Errorf("second read failed with the first caller's context: %v", err)
+	}
+	if got := reads(); got != 1 {
+		t.Errorf("got %d requests, want 1", got)
+	}
+
+	// A caller whose deadline expires stops waiting, and the read is
+	// abandoned once nobody waits for it: the next caller sends its own.
+	hold := make(chan struct{})
+	defer close(hold)
+	slow := newServer(t)
+	slowReads := held(slow, hold)
+	st = connect(t, slow, gosmart.Config{})
+	for i := 1; i <= 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		start := time.Now()
+		if _, err := st.CurrentModeContext(ctx); err != context.DeadlineExceeded {
+			t.Errorf("read returned %v, want context.DeadlineExceeded", err)
+		}
+		cancel()
+		if d := time.Since(start); d > 2*time.Second {
+			t.Errorf("read returned after %v, want the deadline", d)
+		}
+		if got := slowReads(); got != i {
+			t.Errorf("got %d requests after %d reads, want %d", got, i, i)
+		}
+	}
+}
@@ -7,16 +7,24 @@
 package gosmart
 
 import (
+	"bytes"
 	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"golang.org/x/net/context"
 	"golang.org/x/oauth2"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
 	"os/user"
+	"path"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 )
 
 const (
@@ -36,14 +44,30 @@ const (
 
 	// default local HTTP server port
 	defaultPort = 4567
+
+	// Maximum time to wait for the browser to load the "done" page before
+	// stopping the local HTTP server.
+	authDoneTimeout = 5 * time.Second
 )
 
+// DefaultScopes are the OAuth scopes requested when none are configured.
+// The SmartApp endpoints only know the "app" scope, which grants access to
+// everything the SmartApp exposes: reading devices (Refresh and the Get*
+// functions) as well as sending commands.
+var DefaultScopes = []string{"app"}
+
 // Auth contains the SmartThings authentication related data.
 type Auth struct {
 	port             int
 	config           *oauth2.Config
 	rchan            chan oauthReturn
+	done             chan struct{}
 	oauthStateString string
+
+	// login is the URL the user visits to start the authentication, and
+	// callback the path of the OAuth redirect.
+	login    string
+	callback string
 }
 
 // oauthReturn contains the values returned by the OAuth callback handler.
@@ -52,27 +76,40 @@ type oauthReturn struct {
 	err   error
 }
 
-// endpoints holds the values returned by the SmartThings endpoints URI.
-type endpoints struct {
+// EndPoints holds the values returned by the SmartThings endpoints URI.
+type EndPoints struct {
 	OauthClient struct {
 		ClientID string `json:"clientId"`
-	}
+	} `json:"oauthClient"`
 	Location struct {
 		ID   string `json:"id"`
 		Name string `json:"name"`
-	}
+	} `json:"location"`
 	URI     string `json:"uri"`
 	BaseURL string `json:"base_url"`
 	URL     string `json:"url"`
 }
 
+// InstalledAppID returns the ID of the installed SmartApp, which is the last
+// element of the endpoint URL path. Blank if the URL is not known.
+func (e EndPoints) InstalledAppID() string {
+	if e.URL == "" {
+		return ""
+	}
+	return path.Base(e.URL)
+}
+
 // NewOAuthConfig creates a new oauth2.config structure with the
-// correct parameters to use smartthings.
-func NewOAuthConfig(client, secret string) *oauth2.Config {
+// correct parameters to use smartthings. The token is requested with the
+// given scopes, or DefaultScopes if none are given.
+func NewOAuthConfig(client, secret string, scopes ...string) *oauth2.Config {
+	if len(scopes) == 0 {
+		scopes = DefaultScopes
+	}
 	return &oauth2.Config{
 		ClientID:     client,
 		ClientSecret: secret,
-		Scopes:       []string{"app"},
+		Scopes:       append([]string(nil), scopes...),
 		Endpoint: oauth2.Endpoint{
 			AuthURL:  "https://graph.api.smartthings.com/oauth/authorize",
 			TokenURL: "https://graph.api.smartthings.com/oauth/token",
@@ -91,24 +128,86 @@ func NewAuth(port int, config *oauth2.Config) (*Auth, error) {
 		port:             port,
 		config:           config,
 		rchan:            make(chan oauthReturn),
+		done:             make(chan struct{}, 1),
 		oauthStateString: rnd,
+		login:            fmt.Sprintf("http://localhost:%d", port),
+		callback:         callbackPath,
 	}, nil
 }
 
+// NewAuthRedirect works like NewAuth, listening for the OAuth redirect at
+// redirectURL (e.g. "http://localhost:8080/callback") instead of
+// http://localhost:4567/OAuthCallback. The URL must match the redirect URI
+// registered for the SmartApp; it is sent with the authorization request so
+// SmartThings can check it.
+func NewAuthRedirect(redirectURL string, config *oauth2.Config) (*Auth, error) {
+	u, err := url.Parse(redirectURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redirect URL %q: %v", redirectURL, err)
+	}
+	if u.Scheme != "http" || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid redirect URL %q: must be an http URL with a host", redirectURL)
+	}
+	if u.Path == "" || u.Path == rootPath || u.Path == donePath {
+		return nil, fmt.Errorf("invalid redirect URL %q: path must not be blank, %q or %q", redirectURL, rootPath, donePath)
+	}
+	port := 80
+	if p := u.Port(); p != "" {
+		if port, err = strconv.Atoi(p); err != nil || port <= 0 || port > 65535 {
+			return nil, fmt.Errorf("invalid redirect URL %q: bad port %q", redirectURL, p)
+		}
+	}
+	if config.RedirectURL != "" && config.RedirectURL != redirectURL {
+		return nil, fmt.Errorf("redirect URL %q does not match the OAuth config redirect URL %q", redirectURL, config.RedirectURL)
+	}
+	c := *config
+	c.RedirectURL = redirectURL
+
+	g, err := NewAuth(port, &c)
+	if err != nil {
+		return nil, err
+	}
+	g.login = (&url.URL{Scheme: u.Scheme, Host: u.Host}).String()
+	g.callback = u.Path
+	return g, nil
+}
+
 // FetchOAuthToken sets up the handler and a local HTTP server and fetches an
-// Oauth token from the smartthings website.
+// Oauth token from the smartthings website. Returns an error if the local
+// port cannot be used (e.g. it is already taken).
 func (g *Auth) FetchOAuthToken() (*oauth2.Token, error) {
-	http.HandleFunc(rootPath, g.handleMain)
-	http.HandleFunc(donePath, g.handleDone)
-	http.HandleFunc(callbackPath, g.handleOAuthCallback)
+	mux := http.NewServeMux()
+	mux.HandleFunc(rootPath, g.handleMain)
+	mux.HandleFunc(donePath, g.handleDone)
+	mux.HandleFunc(g.callback, g.handleOAuthCallback)
 
-	go http.ListenAndServe(":"+strconv.Itoa(g.port), nil)
+	ln, err := net.Listen("tcp", ":"+strconv.Itoa(g.port))
+	if err != nil {
+		return nil, fmt.Errorf("cannot listen for the OAuth redirect on port %d (use another redirect URL): %v", g.port, err)
+	}
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(ln)
 
-	// Block on the return channel (this is set by handleOauthCallback)
+	// Block on the return channel (this is set by handleOauthCallback),
+	// then give the browser a chance to load the "done" page.
 	ret := <-g.rchan
+	if ret.err == nil {
+		select {
+		case <-g.done:
+		case <-time.After(authDoneTimeout):
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), authDoneTimeout)
+	defer cancel()
+	srv.Shutdown(ctx)
 	return ret.token, ret.err
 }
 
+// LoginURL returns the local URL the user must visit to authenticate.
+func (g *Auth) LoginURL() string {
+	return g.login
+}
+
 // handleMain redirects the user to the main authentication page.
 func (g *Auth) handleMain(w http.ResponseWriter, r *http.Request) {
 	url := g.config.AuthCodeURL(g.oauthStateString)
@@ -123,6 +222,10 @@ func (g *Auth) handleError(w http.ResponseWriter, r *http.Request) {
 // handleDone shows a page indicating the authentication is finished.
 func (g *Auth) handleDone(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, authDone)
+	select {
+	case g.done <- struct{}{}:
+	default:
+	}
 }
 
 // handleOauthCallback fetches the callback from the OAuth provider and parses
@@ -161,29 +264,48 @@ func (g *Auth) handleOAuthCallback(w http.ResponseWriter, r *http.Request) {
 
 // GetEndPointsURI returns the smartthing endpoints URI. The endpoints
 // URI is the base for all app requests.
-func GetEndPointsURI(client *http.Client) (string, error) {
+func GetEndPointsURI(ctx context.Context, client *http.Client) (string, error) {
+	ep, err := GetEndPoints(ctx, client)
+	if err != nil {
+		return "", err
+	}
+	return ep.URI, nil
+}
+
+// GetEndPoints returns all the information returned by the SmartThings
+// endpoints URI for the first (usually only) installation of the SmartApp.
+func GetEndPoints(ctx context.Context, client *http.Client) (EndPoints, error) {
 	// Fetch the JSON containing our endpoint URI
-	resp, err := client.Get(endPointsURI)
+	req, err := http.NewRequestWithContext(ctx, "GET", endPointsURI, nil)
 	if err != nil {
-		return "", fmt.Errorf("error getting endpoints URI %q", err)
+		return EndPoints{}, err
 	}
-	contents, err := ioutil.ReadAll(resp.Body)
-	resp.Body.Close()
-	if string(contents) == "[]" {
-		return "", fmt.Errorf("endpoint URI returned no content")
+	resp, err := client.Do(req)
+	if err != nil {
+		return EndPoints{}, fmt.Errorf("error getting endpoints URI %q", err)
+	}
+	contents, err := readBody(resp)
+	if err != nil {
+		return EndPoints{}, fmt.Errorf("error reading endpoints URI %q", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return EndPoints{}, newHTTPError(resp.StatusCode, contents)
 	}
 
-	// Only URI is fetched from JSON string.
-	var ep []endpoints
+	var ep []EndPoints
 	err = json.Unmarshal(contents, &ep)
 	if err != nil {
-		return "", fmt.Errorf("error decoding JSON: %q", err)
+		return EndPoints{}, fmt.Errorf("error decoding JSON: %q", err)
+	}
+	if len(ep) == 0 {
+		return EndPoints{}, fmt.Errorf("endpoint URI returned no content")
 	}
-	return ep[0].URI, nil
+	return ep[0], nil
 }
 
 // LoadToken loads the token from a file on disk. If nil is used for filename
-// a default filename user the user's directory is used.
+// a default filename user the user's directory is used. An empty or
+// unparseable file (e.g. truncated by a crash) returns an error naming it.
 func LoadToken(fname string) (*oauth2.Token, error) {
 	// Generate token filename
 	fname, err := makeTokenFile(fname)
@@ -196,16 +318,31 @@ func LoadToken(fname string) (*oauth2.Token, error) {
 	if err != nil {
 		return nil, err
 	}
-	token := &oauth2.Token{}
-	if err := json.Unmarshal(blob, token); err != nil {
-		return nil, err
+	if len(bytes.TrimSpace(blob)) == 0 {
+		return nil, fmt.Errorf("empty token file %s", fname)
+	}
+	var saved savedToken
+	if err := json.Unmarshal(blob, &saved); err != nil {
+		return nil, fmt.Errorf("corrupt token file %s: %v", fname, err)
+	}
+	token := &saved.Token
+	if saved.Scope != "" {
+		token = token.WithExtra(map[string]interface{}{"scope": saved.Scope})
 	}
 
 	return token, nil
 }
 
-// SaveToken saves the token to a file on disk. If nil is used for filename
-// a default filename user the user's directory is used.
+// savedToken is the format of the token file. It adds the granted scopes
+// (see GrantedScopes), which oauth2.Token does not keep, to the token.
+type savedToken struct {
+	oauth2.Token
+	Scope string `json:"scope,omitempty"`
+}
+
+// SaveToken saves the token to a file on disk, readable by the owner only
+// (mode 0600). If nil is used for filename a default filename user the
+// user's directory is used.
 func SaveToken(fname string, token *oauth2.Token) error {
 	// Generate token filename
 	fname, err := makeTokenFile(fname)
@@ -214,11 +351,63 @@ func SaveToken(fname string, token *oauth2.Token) error {
 	}
 
 	// Encode & Save
-	blob, err := json.Marshal(token)
+	blob, err := json.Marshal(savedToken{Token: *token, Scope: strings.Join(tokenScopes(token), " ")})
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(fname, blob, 0600); err != nil {
+		return fmt.Errorf("cannot write token file %s: %v", fname, err)
+	}
+	return nil
+}
+
+// checkTokenFile returns an error naming the token file if its directory is
+// not writable, so a new token would not be saved.
+func checkTokenFile(fname string) error {
+	fname, err := makeTokenFile(fname)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(fname), filepath.Base(fname)+".tmp")
+	if err != nil {
+		return fmt.Errorf("cannot write token file %s: %v", fname, err)
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return nil
+}
+
+// writeFileAtomic writes data to fname through a temporary file renamed over
+// fname, so readers never see a partially written file.
+func writeFileAtomic(fname string, data []byte, perm os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(fname), filepath.Base(fname)+".tmp")
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(fname, blob, 0600)
+	tmp := f.Name()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Chmod(tmp, perm); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, fname); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
 }
 
 // randomString generates a random string of bytes of the specified size
@@ -234,33 +423,63 @@ func randomString(size int) (string, error) {
 
 // GetToken returns the token for the ClientID and Secret specified in config.
 // The function attempts to load the token from tokenFile first, and failing
-// that, starts a full token authentication cycle with SmartThings. If
-// tokenFile is blank, the function uses a default name under the current
-// user's home directory. The token is saved to local disk before being
-// returned to the caller.
+// that (the file is missing, empty or corrupt), starts a full token
+// authentication cycle with SmartThings. If tokenFile is blank, the function
+// uses a default name under the current user's home directory. The token is
+// saved to local disk before being returned to the caller; an error naming
+// the file is returned before authenticating if it cannot be written.
 //
 // This function represents the most common (and possibly convenient) way to
 // retrieve a token for a given ClientID and Secret.
 func GetToken(tokenFile string, config *oauth2.Config) (*oauth2.Token, error) {
-	// Attempt to load token from local storage. Fallback to full auth cycle.
-	token, err := LoadToken(tokenFile)
-	if err != nil || !token.Valid() {
+	return GetTokenFromStore(NewFileTokenStore(tokenFile), config)
+}
+
+// GetTokenFromStore works like GetToken, but loads and saves the token using
+// store instead of a local file.
+func GetTokenFromStore(store TokenStore, config *oauth2.Config) (*oauth2.Token, error) {
+	return getTokenFromStore(store, config, "", nil)
+}
+
+// getTokenFromStore works like GetTokenFromStore, listening for the OAuth
+// redirect at redirectURL (see NewAuthRedirect), or the default if blank.
+// Saved tokens that cannot be read are reported to logger (if not nil).
+func getTokenFromStore(store TokenStore, config *oauth2.Config, redirectURL string, logger Logger) (*oauth2.Token, error) {
+	// Attempt to load token from the store. Fallback to full auth cycle.
+	// An expired token is still usable if it can be refreshed; the OAuth
+	// client refreshes it (and persistentClient saves it) on first use.
+	token, err := store.Load()
+	if err != nil || !usableToken(token) {
+		if err != nil && !os.IsNotExist(err) && logger != nil {
+			logger.Printf("Ignoring saved token: %v", err)
+		}
 		if config.ClientID == "" || config.ClientSecret == "" {
 			return nil, errors.New("Need ClientID and Secret to generate new Token")
 		}
-		gst, err := NewAuth(defaultPort, config)
+		// Fail before the user logs in if the new token cannot be saved.
+		if c, ok := store.(tokenChecker); ok {
+			if err := c.check(); err != nil {
+				return nil, err
+			}
+		}
+		var gst *Auth
+		if redirectURL != "" {
+			gst, err = NewAuthRedirect(redirectURL, config)
+		} else {
+			gst, err = NewAuth(defaultPort, config)
+		}
 		if err != nil {
 			return nil, err
 		}
 
-		fmt.Printf("Please login by visiting http://localhost:%d\n", defaultPort)
+		fmt.Printf("Please login by visiting %s\n", gst.LoginURL())
 		token, err = gst.FetchOAuthToken()
 		if err != nil {
 			return nil, err
 		}
 
-		// Once we have the token, save it locally for future use.
-		err = SaveToken(tokenFile, token)
+		// Once we have the token, save it for future use.
+		err = store.Save(token)
 		if err != nil {
 			return nil, err
 		}
@@ -268,6 +487,77 @@ func GetToken(tokenFile string, config *oauth2.Config) (*oauth2.Token, error) {
 	return token, nil
 }
 
+// tokenScopes returns the scopes granted to token, as reported by the scope
+// field of the token response (space or comma separated). Returns nil if not
+// reported.
+func tokenScopes(token *oauth2.Token) []string {
+	var ret []string
+	switch t := token.Extra("scope").(type) {
+	case string:
+		ret = strings.FieldsFunc(t, func(r rune) bool { return r == ' ' || r == ',' })
+	case []interface{}:
+		for _, v := range t {
+			if s, ok := v.(string); ok {
+				ret = append(ret, s)
+			}
+		}
+	}
+	return ret
+}
+
+// GrantedScopes returns the OAuth scopes granted to the token of the primary
+// credential when connecting, which may be narrower than those requested
+// (see Config.Scopes). Returns nil if the server did not report them, or
+// when connecting with Config.AccessToken.
+func (st *SmartThings) GrantedScopes() []string {
+	if st.smartThings == nil {
+		return nil
+	}
+	if st.rotate == nil || len(st.rotate.members) == 0 {
+		return nil
+	}
+	return append([]string(nil), st.rotate.members[0].scopes...)
+}
+
+// Endpoint returns the endpoint URI used by st, as discovered by Connect (or
+// given in Config.Endpoint). It can be passed to NewSmartThings or
+// Config.Endpoint to create other clients without discovering it again.
+func (st *SmartThings) Endpoint() string {
+	if st.smartThings == nil {
+		return ""
+	}
+	return st.endpoint
+}
+
+// Token returns the current token of the primary credential, refreshing it
+// first if it has expired, so it can be cached or shared with other clients.
+// Returns an error if st does not authenticate with OAuth2 (e.g. when created
+// by NewSmartThings with a plain HTTP client).
+func (st *SmartThings) Token() (*oauth2.Token, error) {
+	if err := st.connected(); err != nil {
+		return nil, err
+	}
+	var base http.RoundTripper
+	switch {
+	case st.rotate != nil && len(st.rotate.members) > 0:
+		st.rotate.mu.Lock()
+		base = st.rotate.members[0].base
+		st.rotate.mu.Unlock()
+	case st.rateLimit != nil:
+		base = st.rateLimit.base
+	}
+	t, ok := base.(*oauth2.Transport)
+	if !ok || t.Source == nil {
+		return nil, errors.New("no OAuth2 token source available")
+	}
+	return t.Source.Token()
+}
+
+// usableToken returns true if token is valid or can be refreshed.
+func usableToken(token *oauth2.Token) bool {
+	return token != nil && (token.Valid() || token.RefreshToken != "")
+}
+
 // tokenFile generates a filename to store the token.
 func makeTokenFile(fname string) (string, error) {
 	// If filename is an absolute path, return it as is.
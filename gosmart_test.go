@@ -0,0 +1,435 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smoogle/gosmart"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+)
+
+// discovery is an http.RoundTripper replying to every request with status
+// and body.
+type discovery struct {
+	status int
+	body   string
+	url    string
+}
+
+func (d *discovery) RoundTrip(r *http.Request) (*http.Response, error) {
+	d.url = r.URL.String()
+	return &http.Response{
+		StatusCode: d.status,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       ioutil.NopCloser(strings.NewReader(d.body)),
+		Request:    r,
+	}, nil
+}
+
+const discoveryResponse = `[{
+	"oauthClient": {"clientId": "f00-ba7"},
+	"location": {"id": "loc-1", "name": "Home"},
+	"uri": "https://graph-na02.api.smartthings.com:443/api/smartapps/installations/app-42",
+	"base_url": "https://graph-na02.api.smartthings.com:443",
+	"url": "/api/smartapps/installations/app-42"
+}, {
+	"uri": "https://graph-na02.api.smartthings.com:443/api/smartapps/installations/app-43"
+}]`
+
+func TestGetEndPoints(t *testing.T) {
+	rt := &discovery{status: http.StatusOK, body: discoveryResponse}
+	ep, err := gosmart.GetEndPoints(context.Background(), &http.Client{Transport: rt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(rt.url, "/api/smartapps/endpoints") {
+		t.Errorf("discovery requested %q", rt.url)
+	}
+	if ep.OauthClient.ClientID != "f00-ba7" {
+		t.Errorf("client ID = %q", ep.OauthClient.ClientID)
+	}
+	if ep.Location.ID != "loc-1" || ep.Location.Name != "Home" {
+		t.Errorf("location = %+v", ep.Location)
+	}
+	if ep.URI != "https://graph-na02.api.smartthings.com:443/api/smartapps/installations/app-42" {
+		t.Errorf("URI = %q", ep.URI)
+	}
+	if ep.BaseURL != "https://graph-na02.api.smartthings.com:443" {
+		t.Errorf("base URL = %q", ep.BaseURL)
+	}
+	if id := ep.InstalledAppID(); id != "app-42" {
+		t.Errorf("InstalledAppID() = %q, want app-42", id)
+	}
+
+	uri, err := gosmart.GetEndPointsURI(context.Background(), &http.Client{Transport: rt})
+	if err != nil || uri != ep.URI {
+		t.Errorf("GetEndPointsURI() = %q, %v; want %q", uri, err, ep.URI)
+	}
+}
+
+func TestGetEndPointsErrors(t *testing.T) {
+	cases := []struct {
+		status int
+		body   string
+	}{
+		{http.StatusOK, `[]`},
+		{http.StatusOK, `{"uri": "not a list"}`},
+		{http.StatusUnauthorized, `{"error": "invalid_token"}`},
+	}
+	for _, c := range cases {
+		if ep, err := gosmart.GetEndPoints(context.Background(), &http.Client{Transport: &discovery{status: c.status, body: c.body}}); err == nil {
+			t.Errorf("%d %s: got %+v, want an error", c.status, c.body, ep)
+		}
+	}
+}
+
+// localOnly is an http.RoundTripper sending requests to host and failing
+// (and recording) all others.
+type localOnly struct {
+	host    string
+	blocked []string
+}
+
+func (l *localOnly) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.URL.Host != l.host {
+		l.blocked = append(l.blocked, r.URL.String())
+		return nil, errors.New("network access blocked")
+	}
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestEndpointSkipsDiscovery(t *testing.T) {
+	s := newServer(t, lamp("1"), lamp("2"))
+	s.SetAttribute("2", "switch", "on")
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt := &localOnly{host: u.Host}
+	st, err := gosmart.Connect(context.Background(), gosmart.Config{
+		ClientID:   "client",
+		Secret:     "secret",
+		TokenStore: gosmart.NewMemoryTokenStore(token("abc")),
+		Endpoint:   s.URL,
+		HTTPClient: &http.Client{Transport: rt},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rt.blocked) != 0 {
+		t.Errorf("requests sent outside the endpoint: %q", rt.blocked)
+	}
+
+	// Devices are listed and refreshed from the endpoint.
+	if n := len(st.DeviceList()); n != 2 {
+		t.Fatalf("got %d devices, want 2", n)
+	}
+	s.SetAttribute("1", "switch", "on")
+	if err := st.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"1", "2"} {
+		if v, _ := device(t, &st, id).AttributeString("switch"); v != "on" {
+			t.Errorf("device %s: switch = %q, want on", id, v)
+		}
+	}
+	devices, err := gosmart.GetDevices(context.Background(), &http.Client{Transport: rt}, s.URL)
+	if err != nil || len(devices) != 2 {
+		t.Errorf("GetDevices() = %+v, %v; want both devices", devices, err)
+	}
+}
+
+// flakyDiscovery is an http.RoundTripper failing the first failures endpoint
+// discovery requests with 503 and then answering with endpoint. Other
+// requests are sent to the network.
+type flakyDiscovery struct {
+	mu       sync.Mutex
+	failures int
+	calls    int
+	endpoint string
+}
+
+func (f *flakyDiscovery) RoundTrip(r *http.Request) (*http.Response, error) {
+	if !strings.HasSuffix(r.URL.Path, "/smartapps/endpoints") {
+		return http.DefaultTransport.RoundTrip(r)
+	}
+	f.mu.Lock()
+	f.calls++
+	fail := f.calls <= f.failures
+	f.mu.Unlock()
+	status, body := http.StatusOK, `[{"uri": "`+f.endpoint+`"}]`
+	if fail {
+		status, body = http.StatusServiceUnavailable, `{"error": "try later"}`
+	}
+	return &http.Response{
+		StatusCode:    status,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       r,
+	}, nil
+}
+
+// attempts returns the number of discovery requests received.
+func (f *flakyDiscovery) attempts() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+func TestConnectDiscoveryRetries(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	connectWith := func(ctx context.Context, rt *flakyDiscovery, cfg gosmart.Config) (gosmart.SmartThings, error) {
+		cfg.ClientID, cfg.Secret = "client", "secret"
+		cfg.TokenStore = gosmart.NewMemoryTokenStore(token("abc"))
+		cfg.HTTPClient = &http.Client{Transport: rt}
+		if cfg.RetryBaseDelay == 0 {
+			cfg.RetryBaseDelay = time.Millisecond
+		}
+		return gosmart.Connect(ctx, cfg)
+	}
+
+	// Transient failures are retried, and Connect goes on to load devices.
+	rt := &flakyDiscovery{failures: 2, endpoint: s.URL}
+	st, err := connectWith(context.Background(), rt, gosmart.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := rt.attempts(); n != 3 {
+		t.Errorf("discovery attempted %d times, want 3", n)
+	}
+	if st.Endpoint() != s.URL || len(st.DeviceList()) != 1 {
+		t.Errorf("connected to %q with %d devices, want %q and 1", st.Endpoint(), len(st.DeviceList()), s.URL)
+	}
+
+	// Retries are bounded by DiscoveryRetries, or disabled.
+	rt = &flakyDiscovery{failures: 10, endpoint: s.URL}
+	if _, err := connectWith(context.Background(), rt, gosmart.Config{DiscoveryRetries: 4}); err == nil {
+		t.Error("Connect succeeded with discovery failing")
+	}
+	if n := rt.attempts(); n != 5 {
+		t.Errorf("discovery attempted %d times, want 5", n)
+	}
+	rt = &flakyDiscovery{failures: 1, endpoint: s.URL}
+	if _, err := connectWith(context.Background(), rt, gosmart.Config{DiscoveryRetries: -1}); err == nil {
+		t.Error("Connect succeeded with retries disabled")
+	}
+	if n := rt.attempts(); n != 1 {
+		t.Errorf("discovery attempted %d times with retries disabled, want 1", n)
+	}
+
+	// The context stops the retries.
+	rt = &flakyDiscovery{failures: 10, endpoint: s.URL}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = connectWith(ctx, rt, gosmart.Config{DiscoveryRetries: 10, RetryBaseDelay: time.Second})
+	if err == nil {
+		t.Error("Connect succeeded with discovery failing")
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("Connect returned after %v, want the context deadline", d)
+	}
+	if n := rt.attempts(); n != 1 {
+		t.Errorf("discovery attempted %d times before the deadline, want 1", n)
+	}
+}
+
+// freePort returns a local TCP port nobody is listening on.
+func freePort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestNewAuthRedirect(t *testing.T) {
+	config := &oauth2.Config{ClientID: "id", ClientSecret: "secret"}
+	for _, u := range []string{
+		"https://localhost:8080/callback",
+		"http:///callback",
+		"http://localhost:8080",
+		"http://localhost:8080/",
+		"http://localhost:8080/OauthDone",
+		"http://localhost:99999/callback",
+	} {
+		if _, err := gosmart.NewAuthRedirect(u, config); err == nil {
+			t.Errorf("NewAuthRedirect(%q) accepted an invalid redirect URL", u)
+		}
+	}
+	registered := &oauth2.Config{ClientID: "id", RedirectURL: "http://localhost:8080/callback"}
+	if _, err := gosmart.NewAuthRedirect("http://localhost:9090/callback", registered); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("NewAuthRedirect with another registered URL = %v, want a mismatch error", err)
+	}
+	g, err := gosmart.NewAuthRedirect("http://localhost:8080/callback", registered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := g.LoginURL(); got != "http://localhost:8080" {
+		t.Errorf("LoginURL() = %q, want http://localhost:8080", got)
+	}
+}
+
+func TestFetchOAuthTokenCustomPort(t *testing.T) {
+	tokens := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "c0de" || r.FormValue("redirect_uri") == "" {
+			http.Error(w, `{"error": "invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"access_token": "t0ken", "token_type": "Bearer", "expires_in": 3600}`)
+	}))
+	defer tokens.Close()
+
+	port := freePort(t)
+	redirect := fmt.Sprintf("http://localhost:%d/callback", port)
+	config := &oauth2.Config{
+		ClientID:     "id",
+		ClientSecret: "secret",
+		Endpoint:     oauth2.Endpoint{AuthURL: "https://auth.example.com/authorize", TokenURL: tokens.URL},
+	}
+	g, err := gosmart.NewAuthRedirect(redirect, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type result struct {
+		token *oauth2.Token
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		token, err := g.FetchOAuthToken()
+		done <- result{token, err}
+	}()
+
+	// Visiting the login page redirects to the authorization page, asking
+	// for the configured redirect URL.
+	noFollow := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	var resp *http.Response
+	waitFor(t, "the OAuth listener", func() bool {
+		resp, err = noFollow.Get(g.LoginURL())
+		return err == nil
+	})
+	resp.Body.Close()
+	auth, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := auth.Query().Get("redirect_uri"); got != redirect {
+		t.Errorf("authorization requested redirect_uri %q, want %q", got, redirect)
+	}
+
+	// The browser then follows the redirect back with the code.
+	resp, err = http.Get(redirect + "?code=c0de&state=" + url.QueryEscape(auth.Query().Get("state")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	select {
+	case r := <-done:
+		if r.err != nil || r.token.AccessToken != "t0ken" {
+			t.Errorf("FetchOAuthToken() = %+v, %v; want token t0ken", r.token, r.err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("FetchOAuthToken did not return")
+	}
+}
+
+func TestFetchOAuthTokenBusyPort(t *testing.T) {
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	g, err := gosmart.NewAuthRedirect(fmt.Sprintf("http://localhost:%d/callback", port), &oauth2.Config{ClientID: "id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = g.FetchOAuthToken()
+	if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("port %d", port)) {
+		t.Errorf("FetchOAuthToken on a busy port = %v, want an error naming the port", err)
+	}
+}
+
+func TestGrantedScopes(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	// connectWith connects with the token in store for the primary
+	// credential.
+	connectWith := func(store gosmart.TokenStore) gosmart.SmartThings {
+		t.Helper()
+		st, err := gosmart.Connect(context.Background(), gosmart.Config{
+			ClientID:   "client",
+			Secret:     "secret",
+			TokenStore: store,
+			Endpoint:   s.URL,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return st
+	}
+
+	cases := []struct {
+		scope interface{}
+		want  []string
+	}{
+		{"r:devices:* x:devices:*", []string{"r:devices:*", "x:devices:*"}},
+		{"r:devices:*,x:devices:*", []string{"r:devices:*", "x:devices:*"}},
+		{[]interface{}{"r:devices:*", "r:locations:*"}, []string{"r:devices:*", "r:locations:*"}},
+		{"", nil},
+		{nil, nil},
+	}
+	for _, c := range cases {
+		tok := token("abc")
+		if c.scope != nil {
+			tok = tok.WithExtra(map[string]interface{}{"scope": c.scope})
+		}
+		st := connectWith(gosmart.NewMemoryTokenStore(tok))
+		if got := st.GrantedScopes(); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("scope %#v: GrantedScopes() = %q, want %q", c.scope, got, c.want)
+		}
+	}
+
+	// The scopes are kept in token files.
+	fname := filepath.Join(t.TempDir(), "token.json")
+	if err := gosmart.SaveToken(fname, token("abc").WithExtra(map[string]interface{}{"scope": "r:devices:*"})); err != nil {
+		t.Fatal(err)
+	}
+	st := connectWith(gosmart.NewFileTokenStore(fname))
+	if got := st.GrantedScopes(); !reflect.DeepEqual(got, []string{"r:devices:*"}) {
+		t.Errorf("GrantedScopes() from a token file = %q, want [r:devices:*]", got)
+	}
+
+	// Static access tokens report none.
+	st, err := gosmart.Connect(context.Background(), gosmart.Config{Endpoint: s.URL, AccessToken: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := st.GrantedScopes(); got != nil {
+		t.Errorf("GrantedScopes() with an access token = %q, want nil", got)
+	}
+}
@@ -0,0 +1,117 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmarttest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/smoogle/gosmart"
+)
+
+// redacted replaces sensitive values in captured fixtures.
+const redacted = "REDACTED"
+
+// sensitiveKeys lists the (lower case) fragments of attribute and data keys
+// whose values are redacted by Capture.
+var sensitiveKeys = []string{"token", "secret", "password", "passcode", "apikey", "api_key", "lockcodes", "pin"}
+
+// Capture records the devices of a live account as fixtures for NewServer:
+// the details, attributes and commands of every device known to st, as
+// returned by the server. Values of attributes whose names look sensitive
+// (tokens, secrets, passwords, lock codes) are redacted.
+func Capture(st *gosmart.SmartThings) ([]Device, error) {
+	var ret []Device
+	for _, sd := range st.DeviceList() {
+		raw, err := st.RawDeviceInfo(sd.ID)
+		if err != nil {
+			return nil, err
+		}
+		var info struct {
+			ID                  string                  `json:"id"`
+			Name                string                  `json:"name"`
+			DisplayName         string                  `json:"displayName"`
+			RoomID              string                  `json:"roomId"`
+			Attributes          map[string]interface{}  `json:"attributes"`
+			SupportedAttributes []gosmart.AttributeType `json:"supportedAttributes"`
+			Capabilities        []gosmart.Capability    `json:"capabilities"`
+		}
+		if err := json.Unmarshal(raw, &info); err != nil {
+			return nil, fmt.Errorf("device %s: %v", sd.ID, err)
+		}
+		raw, err = st.RawDeviceCommands(sd.ID)
+		if err != nil {
+			return nil, err
+		}
+		var cmds []gosmart.DeviceCommand
+		if err := json.Unmarshal(raw, &cmds); err != nil {
+			return nil, fmt.Errorf("commands of device %s: %v", sd.ID, err)
+		}
+		d := Device{
+			ID:             sd.ID,
+			Name:           info.Name,
+			DisplayName:    info.DisplayName,
+			RoomID:         info.RoomID,
+			Attributes:     make(map[string]interface{}),
+			Commands:       cmds,
+			AttributeTypes: info.SupportedAttributes,
+			Capabilities:   info.Capabilities,
+		}
+		for k, v := range info.Attributes {
+			d.Attributes[k] = redact(k, v)
+		}
+		ret = append(ret, d)
+	}
+	return ret, nil
+}
+
+// WriteFixtures writes devices (usually obtained from Capture) as JSON.
+func WriteFixtures(w io.Writer, devices []Device) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(devices)
+}
+
+// ReadFixtures reads devices written by WriteFixtures, to be passed to
+// NewServer or New.
+func ReadFixtures(r io.Reader) ([]Device, error) {
+	var ret []Device
+	if err := json.NewDecoder(r).Decode(&ret); err != nil {
+		return nil, fmt.Errorf("invalid fixtures: %v", err)
+	}
+	return ret, nil
+}
+
+// redact returns v with the values of sensitive keys replaced, including
+// keys nested in objects.
+func redact(key string, v interface{}) interface{} {
+	if sensitive(key) {
+		return redacted
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return v
+	}
+	out := make(map[string]interface{})
+	for k, x := range m {
+		out[k] = redact(k, x)
+	}
+	return out
+}
+
+// sensitive returns true if key looks like it holds a secret.
+func sensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range sensitiveKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmarttest
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/smoogle/gosmart"
+)
+
+func TestCaptureRoundTrip(t *testing.T) {
+	door := Device{
+		ID:          "2",
+		Name:        "Lock 2",
+		DisplayName: "Front Door",
+		RoomID:      "hall",
+		Attributes: map[string]interface{}{
+			"lock":      "locked",
+			"lockCodes": `{"1":"4321"}`,
+			"battery":   80.0,
+			"codeInfo":  map[string]interface{}{"slot": 1.0, "pin": "4321"},
+		},
+		Commands:       []gosmart.DeviceCommand{{Command: "lock", Capability: "Lock"}, {Command: "unlock", Capability: "Lock"}},
+		AttributeTypes: []gosmart.AttributeType{{Name: "battery", DataType: "NUMBER"}},
+		Capabilities:   []gosmart.Capability{{ID: "lock", Version: 1}},
+	}
+	live := NewServer(switchDevice("1"), door)
+	defer live.Close()
+	st, err := live.Connect(gosmart.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	devices, err := Capture(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteFixtures(&buf, devices); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "4321") {
+		t.Errorf("secrets left in the fixtures:\n%s", buf.String())
+	}
+
+	fixtures, err := ReadFixtures(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fixtures, devices) {
+		t.Errorf("ReadFixtures() = %+v, want %+v", fixtures, devices)
+	}
+	replay := NewServer(fixtures...)
+	defer replay.Close()
+	st, err = replay.Connect(gosmart.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := Capture(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again, devices) {
+		t.Errorf("replayed fixtures captured as %+v, want %+v", again, devices)
+	}
+
+	d, err := st.DeviceByID("2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.DisplayName != "Front Door" || d.RoomID() != "hall" {
+		t.Errorf("replayed device = %+v", d)
+	}
+	if v, _ := d.AttributeString("lockCodes"); v != redacted {
+		t.Errorf("lockCodes = %q, want %q", v, redacted)
+	}
+	if v := d.Attribute("battery"); v != 80 {
+		t.Errorf("battery = %v, want 80", v)
+	}
+	if err := d.Call("unlock"); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := ReadFixtures(strings.NewReader("{")); err == nil {
+		t.Error("ReadFixtures accepted invalid JSON")
+	}
+}
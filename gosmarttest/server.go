@@ -0,0 +1,568 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+// Package gosmarttest provides a mock SmartThings SmartApp backend, so code
+// using gosmart can be exercised without credentials or network access.
+//
+// The mock server keeps the state of a set of devices, applies the commands
+// it receives to their attributes and records an event for every attribute
+// change. Devices may also evolve over simulated time (see Server.Simulate
+// and Server.Step). Other endpoints can be mocked with Server.HandleFunc,
+// and failures injected with Server.Fail.
+package gosmarttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smoogle/gosmart"
+)
+
+// Device describes a mock device.
+type Device struct {
+	ID          string
+	Name        string
+	DisplayName string
+	// RoomID is the room the device is assigned to, if any.
+	RoomID string
+	// ParentID is the parent of a child device of a composite device.
+	ParentID string
+	// LastActivity, if set, is reported as the time the device last
+	// reported to the hub.
+	LastActivity time.Time
+	// Attributes holds the attribute values (strings or float64 numbers).
+	Attributes map[string]interface{}
+	// Commands lists the commands the device accepts.
+	Commands []gosmart.DeviceCommand
+	// AttributeTypes, if set, is reported as the supported attributes of
+	// the device.
+	AttributeTypes []gosmart.AttributeType
+	// Capabilities, if set, is reported as the capabilities of the device.
+	Capabilities []gosmart.Capability
+	// Preferences holds the device settings (strings, bools or float64
+	// numbers), served by the preferences endpoint.
+	Preferences map[string]interface{}
+	// Data holds the custom data stored by the SmartApp with the device,
+	// served by the data endpoint.
+	Data map[string]interface{}
+}
+
+// CommandFunc applies a command to a device. Args holds the path arguments
+// and query the named arguments of the command.
+type CommandFunc func(d *Device, args []string, query url.Values)
+
+// Call records a command received by the server.
+type Call struct {
+	DeviceID string
+	Command  string
+	Args     []string
+}
+
+// Request records a request received by the server.
+type Request struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+}
+
+// failure is a reply programmed with Fail.
+type failure struct {
+	status int
+	body   string
+}
+
+// event is one entry of a device event history.
+type event struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+	Date  int64       `json:"date"`
+}
+
+// Server is a mock SmartApp backend.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	order    []string
+	devices  map[string]*Device
+	handlers map[string]CommandFunc
+	rules    map[string][]Rule
+	events   map[string][]event
+	calls    []Call
+	requests []Request
+	routes   map[string]http.HandlerFunc
+	failures []failure
+	delay    time.Duration
+	// updated holds the (wall clock) time each device last changed.
+	updated map[string]time.Time
+	// ahead is how far Step moved the simulated clock ahead of the wall
+	// clock.
+	ahead time.Duration
+}
+
+// NewServer starts a mock server holding the given devices. The devices are
+// copied, so later changes to them do not affect the server. Call Close
+// when done.
+func NewServer(devices ...Device) *Server {
+	s := &Server{
+		devices:  make(map[string]*Device),
+		handlers: defaultHandlers(),
+		rules:    make(map[string][]Rule),
+		events:   make(map[string][]event),
+		routes:   make(map[string]http.HandlerFunc),
+		updated:  make(map[string]time.Time),
+	}
+	for _, d := range devices {
+		s.add(d)
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// add adds a copy of d to the devices of the server. Must be called with
+// s.mu held (or before the server starts).
+func (s *Server) add(d Device) {
+	c := d
+	c.Attributes = make(map[string]interface{})
+	for k, v := range d.Attributes {
+		c.Attributes[k] = v
+	}
+	c.Commands = append([]gosmart.DeviceCommand(nil), d.Commands...)
+	c.Preferences = make(map[string]interface{})
+	for k, v := range d.Preferences {
+		c.Preferences[k] = v
+	}
+	c.Data = make(map[string]interface{})
+	for k, v := range d.Data {
+		c.Data[k] = v
+	}
+	if _, ok := s.devices[c.ID]; !ok {
+		s.order = append(s.order, c.ID)
+	}
+	s.devices[c.ID] = &c
+	s.updated[c.ID] = time.Now()
+}
+
+// AddDevice adds a device to the server (replacing the device with the same
+// ID, if any). The device is copied.
+func (s *Server) AddDevice(d Device) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.add(d)
+}
+
+// RemoveDevice removes a device from the server.
+func (s *Server) RemoveDevice(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.devices[id]; !ok {
+		return
+	}
+	delete(s.devices, id)
+	delete(s.updated, id)
+	for i, o := range s.order {
+		if o == id {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// HandleFunc serves requests for path (an exact match, such as "/modes")
+// with fn instead of the built-in device endpoints. Use it to mock the
+// endpoints the server does not implement. Fn is called without holding
+// the server lock, so it may call the other methods of the server.
+func (s *Server) HandleFunc(path string, fn http.HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.routes[path] = fn
+}
+
+// Fail makes the server reply to the next n requests with status and body,
+// without serving them, e.g. to exercise retries and error handling.
+func (s *Server) Fail(n int, status int, body string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < n; i++ {
+		s.failures = append(s.failures, failure{status: status, body: body})
+	}
+}
+
+// SetDelay delays every reply by d (or until the request is cancelled).
+// Zero disables the delay.
+func (s *Server) SetDelay(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delay = d
+}
+
+// Requests returns the requests received so far, in order, including
+// those answered by Fail and HandleFunc.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Connect returns a SmartThings using the mock server, with all devices
+// loaded.
+func (s *Server) Connect(cfg gosmart.Config) (*gosmart.SmartThings, error) {
+	st := gosmart.NewSmartThings(s.Client(), s.URL, cfg)
+	return st, st.Refresh()
+}
+
+// New starts a mock server holding the given devices and returns a
+// SmartThings connected to it, with all devices loaded. The server is closed
+// when the test finishes, and the test fails immediately if the devices
+// cannot be loaded. Use NewServer for access to the server state.
+func New(t testing.TB, devices ...Device) *gosmart.SmartThings {
+	t.Helper()
+	s := NewServer(devices...)
+	t.Cleanup(s.Close)
+	st, err := s.Connect(gosmart.Config{})
+	if err != nil {
+		t.Fatalf("gosmarttest: cannot load devices: %v", err)
+	}
+	return st
+}
+
+// Handle sets the function applied when cmd is received, replacing the
+// default behavior (if any) for that command.
+func (s *Server) Handle(cmd string, fn CommandFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[cmd] = fn
+}
+
+// SetAttribute changes an attribute of a device, recording an event.
+func (s *Server) SetAttribute(id, name string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d, ok := s.devices[id]; ok {
+		s.update(d, func() { d.Attributes[name] = value })
+	}
+}
+
+// SetRoom assigns a device to another room.
+func (s *Server) SetRoom(id, roomID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d, ok := s.devices[id]; ok {
+		d.RoomID = roomID
+		s.updated[id] = time.Now()
+	}
+}
+
+// Attribute returns the current value of a device attribute.
+func (s *Server) Attribute(id, name string) (interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.devices[id]
+	if !ok {
+		return nil, false
+	}
+	v, ok := d.Attributes[name]
+	return v, ok
+}
+
+// AddEvent adds an event at time t to the history of a device, e.g. to mock
+// past activity. The device attributes are left unchanged.
+func (s *Server) AddEvent(id, name string, value interface{}, t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := event{Name: name, Value: value, Date: t.UnixNano() / int64(time.Millisecond)}
+	events := s.events[id]
+	i := sort.Search(len(events), func(i int) bool { return events[i].Date > e.Date })
+	events = append(events, event{})
+	copy(events[i+1:], events[i:])
+	events[i] = e
+	s.events[id] = events
+}
+
+// Calls returns the commands received so far, in order.
+func (s *Server) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Call(nil), s.calls...)
+}
+
+// update runs fn, which changes the attributes of d, and records an event
+// for each attribute changed. Must be called with s.mu held.
+func (s *Server) update(d *Device, fn func()) {
+	before := make(map[string]interface{})
+	for k, v := range d.Attributes {
+		before[k] = v
+	}
+	fn()
+
+	var names []string
+	for k, v := range d.Attributes {
+		if old, ok := before[k]; !ok || !reflect.DeepEqual(old, v) {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	if len(names) > 0 {
+		s.updated[d.ID] = time.Now()
+	}
+	for _, n := range names {
+		s.events[d.ID] = append(s.events[d.ID], event{
+			Name:  n,
+			Value: d.Attributes[n],
+			Date:  s.clock().UnixNano() / int64(time.Millisecond),
+		})
+	}
+}
+
+// serve records the request and replies to it, applying the programmed
+// delay, failures and routes before serving the device endpoints.
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Method: r.Method, Path: r.URL.Path, Query: r.URL.Query(), Header: r.Header.Clone()})
+	delay := s.delay
+	var fail *failure
+	if len(s.failures) > 0 {
+		fail = &s.failures[0]
+		s.failures = s.failures[1:]
+	}
+	route := s.routes[r.URL.Path]
+	s.mu.Unlock()
+
+	if delay > 0 {
+		// A cancelled request is only noticed once its body is read.
+		if b, err := ioutil.ReadAll(r.Body); err == nil {
+			r.Body = ioutil.NopCloser(bytes.NewReader(b))
+		}
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	switch {
+	case fail != nil:
+		w.WriteHeader(fail.status)
+		io.WriteString(w, fail.body)
+	case route != nil:
+		route(w, r)
+	default:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.serveDevices(w, r)
+	}
+}
+
+// serveDevices implements the SmartApp device endpoints. Must be called with
+// s.mu held.
+func (s *Server) serveDevices(w http.ResponseWriter, r *http.Request) {
+	// Split the escaped path, so escaped slashes stay in their part.
+	parts := strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/")
+	for i, p := range parts {
+		if u, err := url.PathUnescape(p); err == nil {
+			parts[i] = u
+		}
+	}
+	if parts[0] != "devices" {
+		http.NotFound(w, r)
+		return
+	}
+	if len(parts) == 1 {
+		var since time.Time
+		if ms, err := strconv.ParseInt(r.URL.Query().Get("updatedSince"), 10, 64); err == nil {
+			since = time.Unix(0, ms*int64(time.Millisecond))
+		}
+		var list []gosmart.DeviceList
+		for _, id := range s.order {
+			if s.updated[id].Before(since) {
+				continue
+			}
+			d := s.devices[id]
+			list = append(list, gosmart.DeviceList{ID: d.ID, Name: d.Name, DisplayName: d.DisplayName})
+		}
+		reply(w, list)
+		return
+	}
+
+	d, ok := s.devices[parts[1]]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if len(parts) == 2 {
+		var last interface{}
+		if !d.LastActivity.IsZero() {
+			last = d.LastActivity.UnixNano() / int64(time.Millisecond)
+		}
+		reply(w, map[string]interface{}{
+			"id":                  d.ID,
+			"name":                d.Name,
+			"displayName":         d.DisplayName,
+			"roomId":              d.RoomID,
+			"parentDeviceId":      d.ParentID,
+			"lastActivity":        last,
+			"attributes":          d.Attributes,
+			"supportedAttributes": d.AttributeTypes,
+			"capabilities":        d.Capabilities,
+		})
+		return
+	}
+
+	switch cmd := parts[2]; cmd {
+	case "commands":
+		reply(w, d.Commands)
+	case "events":
+		s.serveEvents(w, r, d)
+	case "preferences":
+		s.servePreferences(w, r, d, parts[3:])
+	case "data":
+		s.serveData(w, r, d, parts[3:])
+	default:
+		if !hasCommand(d, cmd) {
+			http.NotFound(w, r)
+			return
+		}
+		args := parts[3:]
+		s.calls = append(s.calls, Call{DeviceID: d.ID, Command: cmd, Args: args})
+		if fn, ok := s.handlers[cmd]; ok {
+			s.update(d, func() { fn(d, args, r.URL.Query()) })
+		}
+		reply(w, map[string]interface{}{})
+	}
+}
+
+// serveEvents replies with the most recent events of d, newest first. The
+// events can be limited to one attribute ("attribute") and to those older
+// than a time in milliseconds ("before").
+func (s *Server) serveEvents(w http.ResponseWriter, r *http.Request, d *Device) {
+	q := r.URL.Query()
+	before, err := strconv.ParseInt(q.Get("before"), 10, 64)
+	if err != nil {
+		before = math.MaxInt64
+	}
+	var events []event
+	for _, e := range s.events[d.ID] {
+		if e.Date < before && (q.Get("attribute") == "" || e.Name == q.Get("attribute")) {
+			events = append(events, e)
+		}
+	}
+	if max, err := strconv.Atoi(r.URL.Query().Get("max")); err == nil && max > 0 && max < len(events) {
+		events = events[len(events)-max:]
+	}
+	ret := make([]event, 0, len(events))
+	for i := len(events) - 1; i >= 0; i-- {
+		ret = append(ret, events[i])
+	}
+	reply(w, ret)
+}
+
+// servePreferences replies with the preferences of d, or sets the one given
+// in args as {key}/{value}.
+func (s *Server) servePreferences(w http.ResponseWriter, r *http.Request, d *Device, args []string) {
+	switch len(args) {
+	case 0:
+		reply(w, d.Preferences)
+	case 2:
+		var v interface{} = args[1]
+		if f, err := strconv.ParseFloat(args[1], 64); err == nil {
+			v = f
+		} else if b, err := strconv.ParseBool(args[1]); err == nil {
+			v = b
+		}
+		d.Preferences[args[0]] = v
+		reply(w, map[string]interface{}{})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveData replies with the custom data of d, or sets the value given in
+// args as {key}/{JSON value}.
+func (s *Server) serveData(w http.ResponseWriter, r *http.Request, d *Device, args []string) {
+	switch len(args) {
+	case 0:
+		reply(w, d.Data)
+	case 2:
+		var v interface{}
+		if err := json.Unmarshal([]byte(args[1]), &v); err != nil {
+			http.Error(w, "malformed value", http.StatusBadRequest)
+			return
+		}
+		d.Data[args[0]] = v
+		reply(w, map[string]interface{}{})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// reply writes v as a JSON response.
+func reply(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// JSON returns a handler replying with v encoded as JSON, for use with
+// HandleFunc.
+func JSON(v interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) { reply(w, v) }
+}
+
+// hasCommand returns true if d accepts cmd.
+func hasCommand(d *Device, cmd string) bool {
+	for _, c := range d.Commands {
+		if c.Command == cmd {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultHandlers returns the command behavior of common capabilities.
+func defaultHandlers() map[string]CommandFunc {
+	set := func(attr string, value interface{}) CommandFunc {
+		return func(d *Device, _ []string, _ url.Values) { d.Attributes[attr] = value }
+	}
+	setArg := func(attr string) CommandFunc {
+		return func(d *Device, args []string, _ url.Values) {
+			if len(args) == 0 {
+				return
+			}
+			if f, err := strconv.ParseFloat(args[0], 64); err == nil {
+				d.Attributes[attr] = f
+			} else {
+				d.Attributes[attr] = args[0]
+			}
+		}
+	}
+	return map[string]CommandFunc{
+		"on":                 set("switch", "on"),
+		"off":                set("switch", "off"),
+		"lock":               set("lock", "locked"),
+		"unlock":             set("lock", "unlocked"),
+		"setLevel":           setArg("level"),
+		"setHue":             setArg("hue"),
+		"setSaturation":      setArg("saturation"),
+		"setHeatingSetpoint": setArg("heatingSetpoint"),
+		"setCoolingSetpoint": setArg("coolingSetpoint"),
+		"setThermostatMode":  setArg("thermostatMode"),
+		"heat":               set("thermostatMode", "heat"),
+		"cool":               set("thermostatMode", "cool"),
+		"auto":               set("thermostatMode", "auto"),
+	}
+}
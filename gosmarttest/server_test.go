@@ -0,0 +1,132 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmarttest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/smoogle/gosmart"
+)
+
+// switchDevice returns a switch fixture.
+func switchDevice(id string) Device {
+	return Device{
+		ID:         id,
+		Name:       "Switch " + id,
+		Attributes: map[string]interface{}{"switch": "off"},
+		Commands:   []gosmart.DeviceCommand{{Command: "on"}, {Command: "off"}},
+	}
+}
+
+func TestNew(t *testing.T) {
+	st := New(t, switchDevice("1"))
+	d, err := st.DeviceByID("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Call("on"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := d.AttributeString("switch"); v != "on" {
+		t.Errorf("switch is %q, want on", v)
+	}
+}
+
+func TestServerCommands(t *testing.T) {
+	s := NewServer(switchDevice("1"))
+	defer s.Close()
+	s.Handle("on", func(d *Device, _ []string, _ url.Values) { d.Attributes["switch"] = "turning on" })
+	st, err := s.Connect(gosmart.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, _ := st.DeviceByID("1")
+	if err := d.Call("on"); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := s.Attribute("1", "switch"); v != "turning on" {
+		t.Errorf("switch is %v, want the value set by the handler", v)
+	}
+	if calls := s.Calls(); len(calls) != 1 || calls[0].DeviceID != "1" || calls[0].Command != "on" {
+		t.Errorf("got calls %+v", calls)
+	}
+}
+
+func TestServerDevices(t *testing.T) {
+	s := NewServer(switchDevice("1"))
+	defer s.Close()
+	st, err := s.Connect(gosmart.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.AddDevice(switchDevice("2"))
+	s.RemoveDevice("1")
+	if err := st.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	devices := st.DeviceList()
+	if len(devices) != 1 || devices[0].ID != "2" {
+		t.Errorf("got devices %v, want only device 2", devices)
+	}
+}
+
+func TestServerFail(t *testing.T) {
+	s := NewServer(switchDevice("1"))
+	defer s.Close()
+	s.Fail(1, http.StatusTeapot, "short and stout")
+
+	resp, err := http.Get(s.URL + "/devices")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTeapot || string(body) != "short and stout" {
+		t.Errorf("got %d %q, want the programmed failure", resp.StatusCode, body)
+	}
+	resp, err = http.Get(s.URL + "/devices")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("second request got status %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestServerRoutes(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.HandleFunc("/modes", JSON([]string{"Home", "Away"}))
+	s.SetDelay(10 * time.Millisecond)
+
+	start := time.Now()
+	resp, err := http.Get(s.URL + "/modes?x=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if time.Since(start) < 10*time.Millisecond {
+		t.Error("reply was not delayed")
+	}
+	var modes []string
+	if err := json.NewDecoder(resp.Body).Decode(&modes); err != nil || len(modes) != 2 {
+		t.Errorf("got modes %v (%v)", modes, err)
+	}
+	reqs := s.Requests()
+	if len(reqs) != 1 || reqs[0].Method != "GET" || reqs[0].Path != "/modes" || reqs[0].Query.Get("x") != "1" {
+		t.Errorf("got requests %+v", reqs)
+	}
+}
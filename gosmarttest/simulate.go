@@ -0,0 +1,109 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmarttest
+
+import (
+	"math"
+	"time"
+)
+
+// Rule evolves the attributes of a device over dt of simulated time.
+type Rule func(d *Device, dt time.Duration)
+
+// Simulate adds rules evolving the device with the given ID on every Step.
+func (s *Server) Simulate(id string, rules ...Rule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules[id] = append(s.rules[id], rules...)
+}
+
+// Step advances the simulated clock by dt and applies the rules of every
+// device. Attribute changes are recorded as events at the new time. Long
+// steps should be split into smaller ones, as rules are applied once per
+// step. Between steps, the simulated clock follows the wall clock.
+func (s *Server) Step(dt time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ahead += dt
+	for _, id := range s.order {
+		d := s.devices[id]
+		for _, rule := range s.rules[id] {
+			s.update(d, func() { rule(d, dt) })
+		}
+	}
+}
+
+// Now returns the current simulated time. Events are stamped with it.
+func (s *Server) Now() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.clock()
+}
+
+// clock returns the current simulated time. Must be called with s.mu held.
+func (s *Server) clock() time.Time {
+	return time.Now().Add(s.ahead)
+}
+
+// Thermostat returns a rule simulating a thermostat. The operating state is
+// derived from thermostatMode ("heat", "cool" or "auto") and the setpoints,
+// and the temperature moves toward the active setpoint by rate degrees per
+// minute while heating or cooling, and toward ambient otherwise.
+func Thermostat(rate, ambient float64) Rule {
+	return func(d *Device, dt time.Duration) {
+		temp := number(d, "temperature", ambient)
+		heat := number(d, "heatingSetpoint", temp)
+		cool := number(d, "coolingSetpoint", temp)
+		mode, _ := d.Attributes["thermostatMode"].(string)
+
+		state, target := "idle", ambient
+		switch {
+		case (mode == "heat" || mode == "auto") && temp < heat:
+			state, target = "heating", heat
+		case (mode == "cool" || mode == "auto") && temp > cool:
+			state, target = "cooling", cool
+		}
+		d.Attributes["thermostatOperatingState"] = state
+		d.Attributes["temperature"] = approach(temp, target, rate*dt.Minutes())
+	}
+}
+
+// MotionTimeout returns a rule clearing motion ("inactive") once it has
+// been active for timeout.
+func MotionTimeout(timeout time.Duration) Rule {
+	var active time.Duration
+	return func(d *Device, dt time.Duration) {
+		if d.Attributes["motion"] != "active" {
+			active = 0
+			return
+		}
+		active += dt
+		if active >= timeout {
+			d.Attributes["motion"] = "inactive"
+			active = 0
+		}
+	}
+}
+
+// number returns the numeric attribute name of d, or def if not set.
+func number(d *Device, name string, def float64) float64 {
+	if v, ok := d.Attributes[name].(float64); ok {
+		return v
+	}
+	return def
+}
+
+// approach moves v toward target by at most step.
+func approach(v, target, step float64) float64 {
+	if math.Abs(target-v) <= step {
+		return target
+	}
+	if target > v {
+		return v + step
+	}
+	return v - step
+}
@@ -0,0 +1,108 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmarttest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smoogle/gosmart"
+)
+
+// heater returns a thermostat fixture, turned off in a cold room.
+func heater(id string) Device {
+	return Device{
+		ID:   id,
+		Name: "Thermostat " + id,
+		Attributes: map[string]interface{}{
+			"temperature":     16.0,
+			"heatingSetpoint": 16.0,
+			"thermostatMode":  "off",
+		},
+		Commands: []gosmart.DeviceCommand{{Command: "setHeatingSetpoint"}, {Command: "heat"}},
+	}
+}
+
+// heatTo is a heating automation: it turns on the heating with the given
+// setpoint when the device is colder than that.
+func heatTo(d *gosmart.Device, target float64) error {
+	if d.Attribute("temperature") >= target {
+		return nil
+	}
+	if err := d.Call("setHeatingSetpoint", target); err != nil {
+		return err
+	}
+	return d.Call("heat")
+}
+
+func TestSimulateThermostat(t *testing.T) {
+	s := NewServer(heater("1"))
+	defer s.Close()
+	s.Simulate("1", Thermostat(1, 15))
+	st, err := s.Connect(gosmart.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := st.DeviceByID("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := heatTo(d, 20); err != nil {
+		t.Fatalf("automation: %v", err)
+	}
+
+	// The temperature climbs one degree per minute up to the setpoint.
+	start := s.Now()
+	for want := 17.0; want <= 20; want++ {
+		s.Step(time.Minute)
+		if err := d.Refresh(); err != nil {
+			t.Fatal(err)
+		}
+		if got := d.Attribute("temperature"); got != want {
+			t.Errorf("after %v: temperature = %v, want %v", s.Now().Sub(start).Round(time.Minute), got, want)
+		}
+		if state, _ := d.AttributeString("thermostatOperatingState"); state != "heating" {
+			t.Errorf("after %v: operating state = %q, want heating", s.Now().Sub(start).Round(time.Minute), state)
+		}
+	}
+	if ahead := s.Now().Sub(start); ahead < 4*time.Minute {
+		t.Errorf("simulated clock moved %v, want at least 4m", ahead)
+	}
+
+	// Once there, it stays around the setpoint.
+	for i := 0; i < 5; i++ {
+		s.Step(time.Minute)
+		if err := d.Refresh(); err != nil {
+			t.Fatal(err)
+		}
+		if got := d.Attribute("temperature"); got < 19 || got > 20 {
+			t.Errorf("temperature = %v, want it kept at 19-20", got)
+		}
+	}
+}
+
+func TestSimulateMotionTimeout(t *testing.T) {
+	s := NewServer(Device{ID: "1", Attributes: map[string]interface{}{"motion": "active"}})
+	defer s.Close()
+	s.Simulate("1", MotionTimeout(time.Minute))
+
+	s.Step(30 * time.Second)
+	if v, _ := s.Attribute("1", "motion"); v != "active" {
+		t.Errorf("motion = %v after 30s, want active", v)
+	}
+	s.Step(30 * time.Second)
+	if v, _ := s.Attribute("1", "motion"); v != "inactive" {
+		t.Errorf("motion = %v after 1m, want inactive", v)
+	}
+
+	// New motion restarts the timeout.
+	s.SetAttribute("1", "motion", "active")
+	s.Step(45 * time.Second)
+	if v, _ := s.Attribute("1", "motion"); v != "active" {
+		t.Errorf("motion = %v 45s after new motion, want active", v)
+	}
+}
@@ -0,0 +1,124 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/net/context"
+	"net/http"
+	"net/url"
+	"sort"
+)
+
+// Group holds a device group as returned by the groups endpoint.
+type Group struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	DeviceIDs []string `json:"devices"`
+
+	st *SmartThings
+}
+
+// GetGroups returns the device groups of the location the SmartApp is
+// installed in.
+func GetGroups(ctx context.Context, client *http.Client, endpoint string) ([]Group, error) {
+	ret := []Group{}
+
+	contents, err := issueCommand(ctx, client, endpoint, "/groups")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(contents, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Groups returns the device groups of the location.
+func (st *SmartThings) Groups() ([]Group, error) {
+	return st.GroupsContext(context.Background())
+}
+
+// GroupsContext is like Groups, but honors ctx.
+func (st *SmartThings) GroupsContext(ctx context.Context) ([]Group, error) {
+	if err := st.connected(); err != nil {
+		return nil, err
+	}
+	groups, err := GetGroups(ctx, st.client, st.endpoint)
+	if err != nil {
+		return nil, err
+	}
+	for i := range groups {
+		groups[i].st = st
+	}
+	return groups, nil
+}
+
+// Devices returns the known devices belonging to the group.
+func (g *Group) Devices() []*Device {
+	var ret []*Device
+	for _, id := range g.DeviceIDs {
+		if d := g.st.deviceByID(id); d != nil {
+			ret = append(ret, d)
+		}
+	}
+	return ret
+}
+
+// Call issues a command to the whole group. The group endpoint is used if
+// the server provides one; otherwise the command is sent to every member
+// (see BatchCall) and the first error, by device ID, is returned.
+func (g *Group) Call(cmd string, args ...float64) error {
+	return g.CallContext(context.Background(), cmd, args...)
+}
+
+// CallContext is like Call, but honors ctx.
+func (g *Group) CallContext(ctx context.Context, cmd string, args ...float64) error {
+	if len(args) > 1 {
+		return errors.New("too many arguments")
+	}
+	if err := g.st.writable(); err != nil {
+		return err
+	}
+	if err := g.st.connected(); err != nil {
+		return err
+	}
+	if !g.st.commandAllowed(cmd) {
+		return fmt.Errorf("%w: %v", ErrCommandNotAllowed, cmd)
+	}
+
+	path := fmt.Sprintf("/groups/%s/%s", url.PathEscape(g.ID), cmd)
+	for _, a := range floatArgs(args) {
+		path += "/" + url.PathEscape(a)
+	}
+	req, err := g.st.commandRequest(ctx, cmd, path, false)
+	if err != nil {
+		return err
+	}
+	_, err = doRequest(g.st.client, req)
+	var herr *HTTPError
+	if !errors.As(err, &herr) || herr.StatusCode != http.StatusNotFound {
+		return err
+	}
+
+	// No group endpoint: fan out to the members.
+	outcomes := g.st.batchCall(ctx, g.Devices(), cmd, args...)
+	var ids []string
+	for id := range outcomes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if err := outcomes[id].Err; err != nil {
+			return fmt.Errorf("group %s: device %s: %w", g.Name, id, err)
+		}
+	}
+	return nil
+}
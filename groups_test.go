@@ -0,0 +1,108 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/smoogle/gosmart"
+	"github.com/smoogle/gosmart/gosmarttest"
+	"golang.org/x/net/context"
+)
+
+func TestGroups(t *testing.T) {
+	s := newServer(t, lamp("1"), lamp("2"), lamp("3"))
+	s.HandleFunc("/groups", gosmarttest.JSON([]map[string]interface{}{
+		{"id": "g1", "name": "Living Room", "devices": []string{"1", "2"}},
+		{"id": "g2", "name": "Porch", "devices": []string{"2", "3", "gone"}},
+	}))
+	var mu sync.Mutex
+	var groupCalls []string
+	s.HandleFunc("/groups/g1/on", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		groupCalls = append(groupCalls, r.URL.Path)
+	})
+	st := connect(t, s, gosmart.Config{})
+
+	groups, err := st.Groups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 2 || groups[0].Name != "Living Room" || !reflect.DeepEqual(groups[1].DeviceIDs, []string{"2", "3", "gone"}) {
+		t.Fatalf("Groups() = %+v", groups)
+	}
+	// Members the SmartApp cannot see are left out.
+	if got := deviceIDs(groups[1].Devices()); !reflect.DeepEqual(got, []string{"2", "3"}) {
+		t.Errorf("Porch devices = %q, want [2 3]", got)
+	}
+
+	// The group endpoint actuates all members at once.
+	if err := groups[0].Call("on"); err != nil {
+		t.Fatal(err)
+	}
+	if len(groupCalls) != 1 || len(s.Calls()) != 0 {
+		t.Errorf("group endpoint called %d times and devices %d times, want the group endpoint only", len(groupCalls), len(s.Calls()))
+	}
+
+	// Without one, the command goes to every member.
+	if err := groups[1].Call("setLevel", 40); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"2", "3"} {
+		if v, _ := s.Attribute(id, "level"); v != 40.0 {
+			t.Errorf("device %s level = %v, want 40", id, v)
+		}
+	}
+	if v, _ := s.Attribute("1", "level"); v != 0.0 {
+		t.Errorf("device 1 level = %v, want it left alone", v)
+	}
+
+	// Member failures are reported with the device.
+	s.RemoveDevice("3")
+	err = groups[1].Call("off")
+	var herr *gosmart.HTTPError
+	if err == nil || !strings.Contains(err.Error(), "device 3") || !errors.As(err, &herr) || herr.StatusCode != http.StatusNotFound {
+		t.Errorf("Call(off) = %v, want device 3 to fail with HTTP 404", err)
+	}
+	if err := groups[1].Call("setLevel", 1, 2); err == nil {
+		t.Error("Call with two arguments succeeded")
+	}
+}
+
+func TestGroupCallContext(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	s.HandleFunc("/groups", gosmarttest.JSON([]map[string]interface{}{
+		{"id": "a?b", "name": "Odd", "devices": []string{"1"}},
+	}))
+	var called bool
+	s.HandleFunc("/groups/a?b/on", func(http.ResponseWriter, *http.Request) { called = true })
+	st := connect(t, s, gosmart.Config{})
+
+	groups, err := st.GroupsContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The group ID is escaped in the path.
+	if err := groups[0].CallContext(context.Background(), "on"); err != nil || !called {
+		t.Errorf("CallContext(on) = %v, group endpoint called %v", err, called)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := groups[0].CallContext(ctx, "off"); !errors.Is(err, context.Canceled) {
+		t.Errorf("CallContext with a cancelled context = %v, want context.Canceled", err)
+	}
+	if _, err := st.GroupsContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("GroupsContext with a cancelled context = %v, want context.Canceled", err)
+	}
+}
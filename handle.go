@@ -0,0 +1,29 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"sync"
+)
+
+// Handle identifies a registered alert, callback or watcher, so it can be
+// removed without affecting the others.
+type Handle struct {
+	once   sync.Once
+	cancel func()
+}
+
+// newHandle returns a handle calling cancel (once) when cancelled.
+func newHandle(cancel func()) *Handle {
+	return &Handle{cancel: cancel}
+}
+
+// Cancel removes the registration. Calling Cancel more than once has no
+// further effect.
+func (h *Handle) Cancel() {
+	h.once.Do(h.cancel)
+}
@@ -0,0 +1,127 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"errors"
+	"golang.org/x/net/context"
+	"time"
+)
+
+// Healthy returns false if the last health check (see StartHealthCheck)
+// failed to reach SmartThings.
+func (st *SmartThings) Healthy() bool {
+	if st.smartThings == nil {
+		return false
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return !st.unhealthy
+}
+
+// StartHealthCheck starts a background goroutine that pings SmartThings
+// every interval. Each ping must complete within interval. After
+// maxFailures consecutive failed pings, the pooled connections are dropped
+// and the OAuth transports are rebuilt from the stored tokens, so long
+// running programs recover from network changes or stale connections (e.g.
+// after a laptop sleep).
+func (st *SmartThings) StartHealthCheck(interval time.Duration, maxFailures int) error {
+	if err := st.connected(); err != nil {
+		return err
+	}
+	if interval <= 0 {
+		return errors.New("health check interval must be positive")
+	}
+	if maxFailures <= 0 {
+		maxFailures = 1
+	}
+
+	st.hcMu.Lock()
+	defer st.hcMu.Unlock()
+	if st.hcStop != nil {
+		return errors.New("health check already running")
+	}
+	st.hcStop = make(chan struct{})
+	go st.healthCheck(interval, maxFailures, st.hcStop)
+	return nil
+}
+
+// StopHealthCheck stops the health check goroutine, if running.
+func (st *SmartThings) StopHealthCheck() {
+	if st.smartThings == nil {
+		return
+	}
+	st.hcMu.Lock()
+	defer st.hcMu.Unlock()
+	if st.hcStop != nil {
+		close(st.hcStop)
+		st.hcStop = nil
+	}
+}
+
+// healthCheck implements the health check loop. It runs until stop is closed.
+func (st *SmartThings) healthCheck(interval time.Duration, maxFailures int, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	failures := 0
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		err := st.ping(ctx)
+		cancel()
+		st.mu.Lock()
+		st.unhealthy = err != nil
+		st.mu.Unlock()
+		if err == nil {
+			failures = 0
+			continue
+		}
+
+		failures++
+		if failures >= maxFailures {
+			if st.reconnect() == nil {
+				failures = 0
+			}
+		}
+	}
+}
+
+// ping checks that the SmartThings API is reachable with the current client.
+// The discovery service is only used if Connect discovered the endpoint.
+func (st *SmartThings) ping(ctx context.Context) error {
+	switch {
+	case st.v1():
+		// A single device is enough to check the endpoint and token.
+		_, err := issueCommand(ctx, st.client, st.endpoint, "/devices?max=1")
+		return err
+	case st.config().Endpoint != "" || st.rotate == nil:
+		_, err := GetDevices(ctx, st.client, st.endpoint)
+		return err
+	}
+	_, err := GetEndPoints(ctx, st.client)
+	return err
+}
+
+// reconnect closes the pooled connections, which may be stale, and rebuilds
+// the OAuth transports from the stored tokens (if st authenticates with
+// OAuth).
+func (st *SmartThings) reconnect() error {
+	if err := st.connected(); err != nil {
+		return err
+	}
+	closeIdleConnections(st.client.Transport)
+	if st.rotate == nil {
+		return nil
+	}
+	return st.rotate.reconnect(st.oauthContext(context.Background()), st.config().Logger)
+}
@@ -0,0 +1,160 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smoogle/gosmart"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+)
+
+// authCheck is an http.RoundTripper rejecting the requests not sent with
+// the current access token.
+type authCheck struct {
+	mu    sync.Mutex
+	token string
+}
+
+func (a *authCheck) set(token string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.token = token
+}
+
+func (a *authCheck) RoundTrip(r *http.Request) (*http.Response, error) {
+	a.mu.Lock()
+	want := "Bearer " + a.token
+	a.mu.Unlock()
+	if r.Header.Get("Authorization") != want {
+		return &http.Response{
+			StatusCode: http.StatusUnauthorized,
+			Header:     http.Header{},
+			Body:       http.NoBody,
+			Request:    r,
+		}, nil
+	}
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+// token returns a valid OAuth token.
+func token(access string) *oauth2.Token {
+	return &oauth2.Token{AccessToken: access, TokenType: "Bearer", Expiry: time.Now().Add(time.Hour)}
+}
+
+func TestHealthCheckReconnect(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	auth := &authCheck{token: "old"}
+	store := gosmart.NewMemoryTokenStore(token("old"))
+	st, err := gosmart.Connect(context.Background(), gosmart.Config{
+		ClientID:   "client",
+		Secret:     "secret",
+		TokenStore: store,
+		Endpoint:   s.URL,
+		HTTPClient: &http.Client{Transport: auth},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.StartHealthCheck(10*time.Millisecond, 2); err != nil {
+		t.Fatal(err)
+	}
+	defer st.StopHealthCheck()
+	if err := st.StartHealthCheck(time.Second, 1); err == nil {
+		t.Error("second health check started")
+	}
+
+	// The token is replaced behind our back: pings fail until the client
+	// is rebuilt from the store.
+	auth.set("new")
+	waitFor(t, "the connection to turn unhealthy", func() bool { return !st.Healthy() })
+	if err := store.Save(token("new")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the connection to recover", st.Healthy)
+	if err := st.Refresh(); err != nil {
+		t.Errorf("refresh after reconnecting: %v", err)
+	}
+}
+
+// idleCounter is an http.RoundTripper counting the calls to
+// CloseIdleConnections.
+type idleCounter struct {
+	mu     sync.Mutex
+	closed int
+}
+
+func (c *idleCounter) RoundTrip(r *http.Request) (*http.Response, error) {
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func (c *idleCounter) CloseIdleConnections() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed++
+}
+
+func (c *idleCounter) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+func TestHealthCheckStaleConnection(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	idle := &idleCounter{}
+	st, err := gosmart.Connect(context.Background(), gosmart.Config{
+		AccessToken: "personal",
+		Endpoint:    s.URL,
+		HTTPClient:  &http.Client{Transport: idle},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The connection hangs: each ping times out after the interval, even
+	// without a RequestTimeout, and the pooled connections are dropped.
+	s.SetDelay(time.Hour)
+	if err := st.StartHealthCheck(20*time.Millisecond, 1); err != nil {
+		t.Fatal(err)
+	}
+	defer st.StopHealthCheck()
+	waitFor(t, "the connection to turn unhealthy", func() bool { return !st.Healthy() })
+	waitFor(t, "the idle connections to be closed", func() bool { return idle.count() > 0 })
+
+	s.SetDelay(0)
+	waitFor(t, "the connection to recover", st.Healthy)
+}
+
+func TestHealthCheckV1(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	st := gosmart.NewSmartThings(s.Client(), s.URL, gosmart.Config{APIVersion: gosmart.APIV1})
+	if err := st.StartHealthCheck(10*time.Millisecond, 1); err != nil {
+		t.Fatal(err)
+	}
+	defer st.StopHealthCheck()
+
+	waitFor(t, "a ping", func() bool { return len(s.Requests()) > 0 })
+	r := s.Requests()[0]
+	if r.Path != "/devices" || r.Query.Get("max") != "1" {
+		t.Errorf("pinged %s?%s, want /devices?max=1", r.Path, r.Query.Encode())
+	}
+	if !st.Healthy() {
+		t.Error("Healthy() = false after a successful ping")
+	}
+}
+
+func TestStartHealthCheckInterval(t *testing.T) {
+	st := gosmart.NewSmartThings(nil, "http://localhost", gosmart.Config{})
+	if err := st.StartHealthCheck(0, 1); err == nil {
+		t.Error("health check started with a zero interval")
+	}
+}
@@ -0,0 +1,147 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smoogle/gosmart"
+	"github.com/smoogle/gosmart/gosmarttest"
+)
+
+func TestBeforeCommand(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	errTooBright := errors.New("too bright")
+	var seen []string
+	st := connect(t, s, gosmart.Config{
+		BeforeCommand: func(id, cmd string, args []float64) error {
+			seen = append(seen, fmt.Sprintf("%s %s %v", id, cmd, args))
+			if cmd == "setLevel" && len(args) > 0 && args[0] > 50 {
+				return errTooBright
+			}
+			return nil
+		},
+	})
+	d := device(t, st, "1")
+
+	before := len(s.Requests())
+	if err := d.Call("setLevel", 80); !errors.Is(err, errTooBright) {
+		t.Errorf("vetoed Call(setLevel, 80) = %v, want the hook error", err)
+	}
+	if n := len(s.Requests()) - before; n != 0 {
+		t.Errorf("vetoed command sent %d requests, want none", n)
+	}
+	if v, _ := s.Attribute("1", "level"); v != 0.0 {
+		t.Errorf("level = %v after a vetoed command, want 0", v)
+	}
+
+	if err := d.Call("setLevel", 30); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Call("on"); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(s.Calls()); n != 2 {
+		t.Errorf("server received %d commands, want the 2 allowed", n)
+	}
+	want := []string{"1 setLevel [80]", "1 setLevel [30]", "1 on []"}
+	if !reflect.DeepEqual(seen, want) {
+		t.Errorf("hook called with %q, want %q", seen, want)
+	}
+}
+
+// request records a call to Config.OnRequest.
+type request struct {
+	path     string
+	duration time.Duration
+	status   int
+	err      error
+}
+
+// requestLog keeps the requests reported to Config.OnRequest.
+type requestLog struct {
+	mu       sync.Mutex
+	requests []request
+}
+
+func (l *requestLog) add(path string, duration time.Duration, status int, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.requests = append(l.requests, request{path, duration, status, err})
+}
+
+// take returns the requests reported since the last call.
+func (l *requestLog) take() []request {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ret := l.requests
+	l.requests = nil
+	return ret
+}
+
+func TestOnRequest(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	log := &requestLog{}
+	cfg := fastRetries(2)
+	cfg.OnRequest = log.add
+	st := connect(t, s, cfg)
+	d := device(t, st, "1")
+	log.take()
+
+	if err := d.Call("on"); err != nil {
+		t.Fatal(err)
+	}
+	got := log.take()
+	if len(got) != 1 || got[0].path != "/devices/1/on" || got[0].status != http.StatusOK || got[0].err != nil {
+		t.Errorf("Call(on) reported %+v, want one successful /devices/1/on", got)
+	}
+
+	// The duration covers the whole request.
+	delay := 30 * time.Millisecond
+	s.SetDelay(delay)
+	if err := d.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	s.SetDelay(0)
+	got = log.take()
+	if len(got) != 1 || got[0].path != "/devices/1" || got[0].duration < delay {
+		t.Errorf("Refresh() reported %+v, want /devices/1 taking at least %v", got, delay)
+	}
+
+	// Retries are reported once, with the final status.
+	s.Fail(1, http.StatusServiceUnavailable, "")
+	if err := d.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if got = log.take(); len(got) != 1 || got[0].status != http.StatusOK {
+		t.Errorf("retried Refresh() reported %+v, want one success", got)
+	}
+	s.Fail(3, http.StatusServiceUnavailable, "")
+	if err := d.Refresh(); err == nil {
+		t.Fatal("Refresh() succeeded with the server failing")
+	}
+	if got = log.take(); len(got) != 1 || got[0].status != http.StatusServiceUnavailable || got[0].err != nil {
+		t.Errorf("failed Refresh() reported %+v, want one 503", got)
+	}
+
+	// Network errors have no status.
+	down := gosmarttest.NewServer()
+	down.Close()
+	st = gosmart.NewSmartThings(nil, down.URL, gosmart.Config{OnRequest: log.add})
+	if err := st.Refresh(); err == nil {
+		t.Fatal("Refresh() succeeded with the server down")
+	}
+	if got = log.take(); len(got) != 1 || got[0].path != "/devices" || got[0].status != 0 || got[0].err == nil {
+		t.Errorf("Refresh() with the server down reported %+v, want a network error", got)
+	}
+}
@@ -0,0 +1,87 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/net/context"
+	"net"
+	"net/http"
+)
+
+// Hub holds the metadata of the hub as returned by the /hub endpoint.
+type Hub struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// LocalIP is the address of the hub in the local network, if known.
+	LocalIP string `json:"localIP"`
+	// LocalPort is the TCP port of the hub local server, if known.
+	LocalPort string `json:"-"`
+}
+
+// UnmarshalJSON decodes a hub response. The local port may be reported as
+// either a number or a string.
+func (h *Hub) UnmarshalJSON(b []byte) error {
+	type alias Hub
+	aux := struct {
+		*alias
+		LocalPort interface{} `json:"localSrvPortTCP"`
+	}{alias: (*alias)(h)}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+	switch p := aux.LocalPort.(type) {
+	case string:
+		h.LocalPort = p
+	case float64:
+		h.LocalPort = fmt.Sprintf("%d", int(p))
+	}
+	return nil
+}
+
+// GetHub returns the metadata of the hub in the location the SmartApp is
+// installed in.
+func GetHub(ctx context.Context, client *http.Client, endpoint string) (*Hub, error) {
+	ret := &Hub{}
+
+	contents, err := issueCommand(ctx, client, endpoint, "/hub")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(contents, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// HubLocalAddress returns the local network address of the hub, as
+// "host:port" (or just the host if the hub does not report a port), for
+// direct LAN calls.
+func (st *SmartThings) HubLocalAddress() (string, error) {
+	return st.HubLocalAddressContext(context.Background())
+}
+
+// HubLocalAddressContext is like HubLocalAddress, but honors ctx.
+func (st *SmartThings) HubLocalAddressContext(ctx context.Context) (string, error) {
+	if err := st.connected(); err != nil {
+		return "", err
+	}
+	hub, err := GetHub(ctx, st.client, st.endpoint)
+	if err != nil {
+		return "", err
+	}
+	if hub.LocalIP == "" {
+		return "", errors.New("hub local address unavailable")
+	}
+	if hub.LocalPort == "" {
+		return hub.LocalIP, nil
+	}
+	return net.JoinHostPort(hub.LocalIP, hub.LocalPort), nil
+}
@@ -0,0 +1,41 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"testing"
+
+	"github.com/smoogle/gosmart"
+	"github.com/smoogle/gosmart/gosmarttest"
+)
+
+func TestHubLocalAddress(t *testing.T) {
+	cases := []struct {
+		hub  map[string]interface{}
+		want string
+	}{
+		{map[string]interface{}{"id": "h", "localIP": "192.168.1.10", "localSrvPortTCP": 39500.0}, "192.168.1.10:39500"},
+		{map[string]interface{}{"id": "h", "localIP": "192.168.1.10", "localSrvPortTCP": "39500"}, "192.168.1.10:39500"},
+		{map[string]interface{}{"id": "h", "localIP": "192.168.1.10"}, "192.168.1.10"},
+		{map[string]interface{}{"id": "h"}, ""},
+	}
+	for _, c := range cases {
+		s := newServer(t, lamp("1"))
+		s.HandleFunc("/hub", gosmarttest.JSON(c.hub))
+		st := connect(t, s, gosmart.Config{})
+		got, err := st.HubLocalAddress()
+		if c.want == "" {
+			if err == nil {
+				t.Errorf("hub %v: HubLocalAddress() = %q, want an error", c.hub, got)
+			}
+			continue
+		}
+		if err != nil || got != c.want {
+			t.Errorf("hub %v: HubLocalAddress() = %q, %v; want %q", c.hub, got, err, c.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"golang.org/x/net/context"
+	"io"
+	"net/http"
+)
+
+const (
+	// Header carrying the idempotency key of a command.
+	idempotencyHeader = "Idempotency-Key"
+)
+
+// DefaultIdempotentCommands lists the commands retried by default. Turning
+// a switch on or off twice has the same effect as doing it once.
+var DefaultIdempotentCommands = []string{"on", "off"}
+
+// idempotent returns true if cmd is configured as safe to retry.
+func (st *SmartThings) idempotent(cmd string) bool {
+	cmds := st.config().IdempotentCommands
+	if cmds == nil {
+		cmds = DefaultIdempotentCommands
+	}
+	for _, c := range cmds {
+		if c == cmd {
+			return true
+		}
+	}
+	return false
+}
+
+// commandRequest builds the request for a device command. Each request gets
+// a unique idempotency key, kept across retries. Requests for commands that
+// are not idempotent are marked so the retry transport sends them only once.
+func (st *SmartThings) commandRequest(ctx context.Context, cmd, path string, idempotent bool) (*http.Request, error) {
+	return st.newCommandRequest(ctx, cmd, "GET", path, nil, idempotent)
+}
+
+// newCommandRequest works like commandRequest, with the given method and
+// body.
+func (st *SmartThings) newCommandRequest(ctx context.Context, cmd, method, path string, body io.Reader, idempotent bool) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, st.endpoint+path, body)
+	if err != nil {
+		return nil, err
+	}
+	key, err := randomString(16)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(idempotencyHeader, key)
+	if !idempotent && !st.idempotent(cmd) {
+		req = req.WithContext(context.WithValue(req.Context(), noRetryKey{}, true))
+	}
+	return req, nil
+}
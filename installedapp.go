@@ -0,0 +1,44 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"encoding/json"
+	"golang.org/x/net/context"
+	"net/http"
+)
+
+// GetInstalledAppConfig returns the configuration of the SmartApp
+// installation: the devices and preferences selected by the user during
+// setup, keyed by setting name.
+func GetInstalledAppConfig(ctx context.Context, client *http.Client, endpoint string) (map[string]interface{}, error) {
+	ret := map[string]interface{}{}
+
+	contents, err := issueCommand(ctx, client, endpoint, "/config")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(contents, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// InstalledAppConfig returns the configuration of the SmartApp installation.
+// See GetInstalledAppConfig.
+func (st *SmartThings) InstalledAppConfig() (map[string]interface{}, error) {
+	return st.InstalledAppConfigContext(context.Background())
+}
+
+// InstalledAppConfigContext is like InstalledAppConfig, but honors ctx.
+func (st *SmartThings) InstalledAppConfigContext(ctx context.Context) (map[string]interface{}, error) {
+	if err := st.connected(); err != nil {
+		return nil, err
+	}
+	return GetInstalledAppConfig(ctx, st.client, st.endpoint)
+}
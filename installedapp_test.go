@@ -0,0 +1,46 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/smoogle/gosmart"
+	"github.com/smoogle/gosmart/gosmarttest"
+)
+
+func TestInstalledAppConfig(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	s.HandleFunc("/config", gosmarttest.JSON(map[string]interface{}{
+		"switches":  []string{"1"},
+		"threshold": 25,
+		"notify":    true,
+	}))
+	st := connect(t, s, gosmart.Config{})
+
+	cfg, err := st.InstalledAppConfig()
+	if err != nil {
+		t.Fatalf("InstalledAppConfig: %v", err)
+	}
+	want := map[string]interface{}{
+		"switches":  []interface{}{"1"},
+		"threshold": 25.0,
+		"notify":    true,
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("InstalledAppConfig() = %v, want %v", cfg, want)
+	}
+
+	s.HandleFunc("/config", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("not json"))
+	})
+	if _, err := st.InstalledAppConfig(); err == nil {
+		t.Error("InstalledAppConfig accepted a malformed response")
+	}
+}
@@ -0,0 +1,117 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// Number of command latencies kept for percentile estimation.
+	latencySamples = 1024
+)
+
+// latencyPercentiles lists the percentiles reported by LatencyPercentiles.
+var latencyPercentiles = []float64{50, 90, 99}
+
+// reservoir keeps a uniform random sample of the durations recorded, using
+// reservoir sampling, so memory use is bounded no matter how many commands
+// are issued.
+type reservoir struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	seen    int64
+}
+
+// add records one duration.
+func (r *reservoir) add(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seen++
+	if len(r.samples) < latencySamples {
+		r.samples = append(r.samples, d)
+		return
+	}
+	if i := rand.Int63n(r.seen); i < latencySamples {
+		r.samples[i] = d
+	}
+}
+
+// percentiles returns the requested percentiles (0-100) of the sample,
+// using the nearest-rank method. Returns nil if nothing was recorded.
+func (r *reservoir) percentiles(ps []float64) map[float64]time.Duration {
+	r.mu.Lock()
+	sorted := append([]time.Duration(nil), r.samples...)
+	r.mu.Unlock()
+	if len(sorted) == 0 {
+		return nil
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	ret := make(map[float64]time.Duration)
+	for _, p := range ps {
+		rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+		if rank < 1 {
+			rank = 1
+		}
+		if rank > len(sorted) {
+			rank = len(sorted)
+		}
+		ret[p] = sorted[rank-1]
+	}
+	return ret
+}
+
+// LatencyPercentiles returns the 50th, 90th and 99th percentiles of the
+// command round-trip latency, keyed by percentile (50, 90, 99). The figures
+// are estimated from a random sample of up to 1024 commands. Returns nil if
+// no command was issued yet.
+func (st *SmartThings) LatencyPercentiles() map[float64]time.Duration {
+	if st.smartThings == nil {
+		return nil
+	}
+	return st.latency.percentiles(latencyPercentiles)
+}
+
+// latencyStats accumulates the request durations of one device.
+type latencyStats struct {
+	min, max, total time.Duration
+	count           int
+}
+
+// recordLatency adds the duration of one request to the device stats.
+func (d *Device) recordLatency(dur time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	l := &d.latency
+	if l.count == 0 || dur < l.min {
+		l.min = dur
+	}
+	if dur > l.max {
+		l.max = dur
+	}
+	l.total += dur
+	l.count++
+}
+
+// LatencyStats returns the minimum, average and maximum duration of the
+// requests made for the device (commands and refreshes), and the number of
+// requests. Refreshes served from the cache (see Config.CacheTTL) are not
+// counted. All values are zero if no request was made yet.
+func (d *Device) LatencyStats() (min, avg, max time.Duration, count int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	l := d.latency
+	if l.count == 0 {
+		return 0, 0, 0, 0
+	}
+	return l.min, l.total / time.Duration(l.count), l.max, l.count
+}
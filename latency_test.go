@@ -0,0 +1,48 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smoogle/gosmart"
+)
+
+func TestLatencyPercentiles(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	st := connect(t, s, gosmart.Config{})
+	d := device(t, st, "1")
+
+	if p := st.LatencyPercentiles(); p != nil {
+		t.Errorf("LatencyPercentiles() = %v before any command", p)
+	}
+
+	// Five fast commands, four slow ones and a very slow one.
+	delays := []time.Duration{0, 0, 0, 0, 0, 20, 20, 20, 20, 80}
+	for _, ms := range delays {
+		s.SetDelay(ms * time.Millisecond)
+		if err := d.Call("on"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := st.LatencyPercentiles()
+	if p[50] >= 20*time.Millisecond {
+		t.Errorf("p50 = %v, want under 20ms", p[50])
+	}
+	if p[90] < 20*time.Millisecond || p[90] >= 80*time.Millisecond {
+		t.Errorf("p90 = %v, want 20-80ms", p[90])
+	}
+	if p[99] < 80*time.Millisecond {
+		t.Errorf("p99 = %v, want at least 80ms", p[99])
+	}
+
+	// The device stats also count the refresh made when connecting.
+	if _, _, max, n := d.LatencyStats(); n != len(delays)+1 || max < 80*time.Millisecond {
+		t.Errorf("LatencyStats() = max %v, %d requests; want at least 80ms, %d", max, n, len(delays)+1)
+	}
+}
@@ -0,0 +1,136 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"encoding/json"
+	"errors"
+	"golang.org/x/net/context"
+	"net/http"
+	"strconv"
+)
+
+// Location holds the metadata of the location the SmartApp is installed in,
+// as returned by the /location endpoint.
+type Location struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// TimeZone is the IANA time zone of the location (e.g.
+	// "America/Los_Angeles"), if set.
+	TimeZone string `json:"timeZone"`
+	// Latitude and Longitude hold the geolocation of the location. Nil if
+	// not set.
+	Latitude  *float64 `json:"-"`
+	Longitude *float64 `json:"-"`
+}
+
+// UnmarshalJSON decodes a location response. Coordinates may be reported as
+// either numbers or strings.
+func (l *Location) UnmarshalJSON(b []byte) error {
+	type alias Location
+	aux := struct {
+		*alias
+		Latitude  interface{} `json:"latitude"`
+		Longitude interface{} `json:"longitude"`
+	}{alias: (*alias)(l)}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+	l.Latitude = coordinate(aux.Latitude)
+	l.Longitude = coordinate(aux.Longitude)
+	return nil
+}
+
+// coordinate converts a number or numeric string to a *float64. Returns nil
+// for anything else.
+func coordinate(v interface{}) *float64 {
+	switch t := v.(type) {
+	case float64:
+		return &t
+	case string:
+		if f, err := strconv.ParseFloat(t, 64); err == nil {
+			return &f
+		}
+	}
+	return nil
+}
+
+// GetLocation returns the metadata of the location the SmartApp is
+// installed in.
+func GetLocation(ctx context.Context, client *http.Client, endpoint string) (*Location, error) {
+	ret := &Location{}
+
+	contents, err := issueCommand(ctx, client, endpoint, "/location")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(contents, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// GetLocations returns the metadata of all the locations of the account.
+func GetLocations(ctx context.Context, client *http.Client, endpoint string) ([]Location, error) {
+	ret := []Location{}
+
+	contents, err := issueCommand(ctx, client, endpoint, "/locations")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(contents, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Locations returns the metadata of all the locations of the account.
+func (st *SmartThings) Locations() ([]Location, error) {
+	return st.LocationsContext(context.Background())
+}
+
+// LocationsContext is like Locations, but honors ctx.
+func (st *SmartThings) LocationsContext(ctx context.Context) ([]Location, error) {
+	if err := st.connected(); err != nil {
+		return nil, err
+	}
+	return GetLocations(ctx, st.client, st.endpoint)
+}
+
+// Location returns the metadata of the location the SmartApp is installed
+// in.
+func (st *SmartThings) Location() (*Location, error) {
+	return st.LocationContext(context.Background())
+}
+
+// LocationContext is like Location, but honors ctx.
+func (st *SmartThings) LocationContext(ctx context.Context) (*Location, error) {
+	if err := st.connected(); err != nil {
+		return nil, err
+	}
+	return GetLocation(ctx, st.client, st.endpoint)
+}
+
+// LocationGeo returns the latitude and longitude of the location the
+// SmartApp is installed in. Returns an error if the geolocation is not set.
+func (st *SmartThings) LocationGeo() (lat, lon float64, err error) {
+	return st.LocationGeoContext(context.Background())
+}
+
+// LocationGeoContext is like LocationGeo, but honors ctx.
+func (st *SmartThings) LocationGeoContext(ctx context.Context) (lat, lon float64, err error) {
+	loc, err := st.LocationContext(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	if loc.Latitude == nil || loc.Longitude == nil {
+		return 0, 0, errors.New("location geolocation is not set")
+	}
+	return *loc.Latitude, *loc.Longitude, nil
+}
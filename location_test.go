@@ -0,0 +1,74 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"testing"
+
+	"github.com/smoogle/gosmart"
+	"github.com/smoogle/gosmart/gosmarttest"
+)
+
+func TestLocationGeo(t *testing.T) {
+	s := newServer(t)
+	st := connect(t, s, gosmart.Config{})
+
+	s.HandleFunc("/location", gosmarttest.JSON(map[string]interface{}{
+		"id":        "loc-1",
+		"name":      "Home",
+		"timeZone":  "Europe/Lisbon",
+		"latitude":  38.72,
+		"longitude": -9.14,
+	}))
+	loc, err := st.Location()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.ID != "loc-1" || loc.Name != "Home" || loc.TimeZone != "Europe/Lisbon" {
+		t.Errorf("Location() = %+v", loc)
+	}
+	if lat, lon, err := st.LocationGeo(); err != nil || lat != 38.72 || lon != -9.14 {
+		t.Errorf("LocationGeo() = %v, %v, %v; want 38.72, -9.14", lat, lon, err)
+	}
+
+	// Coordinates sent as strings.
+	s.HandleFunc("/location", gosmarttest.JSON(map[string]interface{}{"id": "loc-1", "latitude": "38.72", "longitude": "-9.14"}))
+	if lat, lon, err := st.LocationGeo(); err != nil || lat != 38.72 || lon != -9.14 {
+		t.Errorf("LocationGeo() with string coordinates = %v, %v, %v", lat, lon, err)
+	}
+
+	// Missing or invalid coordinates.
+	for _, loc := range []map[string]interface{}{
+		{"id": "loc-1"},
+		{"id": "loc-1", "latitude": 38.72},
+		{"id": "loc-1", "latitude": "north", "longitude": -9.14},
+	} {
+		s.HandleFunc("/location", gosmarttest.JSON(loc))
+		if lat, lon, err := st.LocationGeo(); err == nil {
+			t.Errorf("LocationGeo() for %v = %v, %v; want an error", loc, lat, lon)
+		}
+	}
+}
+
+func TestLocations(t *testing.T) {
+	s := newServer(t)
+	st := connect(t, s, gosmart.Config{})
+	s.HandleFunc("/locations", gosmarttest.JSON([]map[string]interface{}{
+		{"id": "l1", "name": "Home", "latitude": 38.72, "longitude": -9.14},
+		{"id": "l2", "name": "Cabin"},
+	}))
+	locs, err := st.Locations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locs) != 2 || locs[0].ID != "l1" || locs[1].Name != "Cabin" {
+		t.Fatalf("Locations() = %+v", locs)
+	}
+	if locs[0].Latitude == nil || *locs[0].Latitude != 38.72 || locs[1].Latitude != nil {
+		t.Errorf("latitudes = %v, %v; want 38.72 and none", locs[0].Latitude, locs[1].Latitude)
+	}
+}
@@ -0,0 +1,20 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+// Logger receives the diagnostic messages of the library. It is satisfied by
+// *log.Logger.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// logf sends a message to the configured Logger, if any.
+func (st *SmartThings) logf(format string, v ...interface{}) {
+	if l := st.config().Logger; l != nil {
+		l.Printf(format, v...)
+	}
+}
@@ -0,0 +1,51 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DeviceByID returns the device with the given ID, or an error wrapping
+// ErrDeviceNotFound.
+func (st *SmartThings) DeviceByID(id string) (*Device, error) {
+	if st.smartThings == nil {
+		return nil, ErrNotConnected
+	}
+	if d := st.deviceByID(id); d != nil {
+		return d, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrDeviceNotFound, id)
+}
+
+// DeviceByName returns the device whose name or display name matches name
+// (case insensitive). Returns an error wrapping ErrDeviceNotFound if no
+// device matches, or an error if several devices do.
+func (st *SmartThings) DeviceByName(name string) (*Device, error) {
+	if st.smartThings == nil {
+		return nil, ErrNotConnected
+	}
+	var found []*Device
+	for _, d := range st.DeviceList() {
+		n, displayName := d.Names()
+		if strings.EqualFold(displayName, name) || strings.EqualFold(n, name) {
+			found = append(found, d)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("%w: %q", ErrDeviceNotFound, name)
+	case 1:
+		return found[0], nil
+	}
+	var ids []string
+	for _, d := range found {
+		ids = append(ids, d.ID)
+	}
+	return nil, fmt.Errorf("ambiguous device name %q: matches devices %s", name, strings.Join(ids, ", "))
+}
@@ -0,0 +1,54 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/smoogle/gosmart"
+)
+
+func TestDeviceLookup(t *testing.T) {
+	twin := lamp("3")
+	twin.DisplayName = "Lamp 2"
+	s := newServer(t, lamp("1"), lamp("2"), twin)
+	st := connect(t, s, gosmart.Config{})
+
+	d, err := st.DeviceByID("1")
+	if err != nil || d.ID != "1" {
+		t.Fatalf("DeviceByID(1) = %v, %v", d, err)
+	}
+	if _, err := st.DeviceByID("99"); !errors.Is(err, gosmart.ErrDeviceNotFound) {
+		t.Errorf("DeviceByID(99) = %v, want ErrDeviceNotFound", err)
+	}
+
+	// Display names match regardless of case, names too.
+	for _, name := range []string{"Lamp 1", "lamp 1", "DIMMER 1"} {
+		if d, err := st.DeviceByName(name); err != nil || d.ID != "1" {
+			t.Errorf("DeviceByName(%q) = %v, %v; want device 1", name, d, err)
+		}
+	}
+	if _, err := st.DeviceByName("Porch"); !errors.Is(err, gosmart.ErrDeviceNotFound) {
+		t.Errorf("DeviceByName(Porch) = %v, want ErrDeviceNotFound", err)
+	}
+	if _, err := st.DeviceByName("lamp 2"); err == nil || !strings.Contains(err.Error(), "2, 3") {
+		t.Errorf("DeviceByName(lamp 2) = %v, want an error naming both devices", err)
+	}
+
+	// The result is the live device, not a copy.
+	if err := d.Call("on"); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := st.DeviceByID("1"); again != d || d.Attribute("switch") != 1 {
+		t.Error("DeviceByID did not return the device updated by Refresh")
+	}
+}
@@ -0,0 +1,121 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"encoding/json"
+	"fmt"
+	"golang.org/x/net/context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Mode holds a location mode (e.g. "Home", "Away", "Night").
+type Mode struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// GetModes returns the list of modes defined for the location.
+func GetModes(ctx context.Context, client *http.Client, endpoint string) ([]Mode, error) {
+	ret := []Mode{}
+
+	contents, err := issueCommand(ctx, client, endpoint, "/modes")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(contents, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// GetCurrentMode returns the current location mode.
+func GetCurrentMode(ctx context.Context, client *http.Client, endpoint string) (*Mode, error) {
+	ret := &Mode{}
+
+	contents, err := issueCommand(ctx, client, endpoint, "/mode")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(contents, ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// SetLocationMode changes the current location mode to the named mode.
+func SetLocationMode(ctx context.Context, client *http.Client, endpoint string, name string) error {
+	_, err := issueAction(ctx, client, endpoint, "/mode/"+url.PathEscape(name))
+	return err
+}
+
+// CurrentMode returns the name of the current location mode.
+func (st *SmartThings) CurrentMode() (string, error) {
+	return st.CurrentModeContext(context.Background())
+}
+
+// CurrentModeContext is like CurrentMode, but honors ctx.
+func (st *SmartThings) CurrentModeContext(ctx context.Context) (string, error) {
+	if err := st.connected(); err != nil {
+		return "", err
+	}
+	m, err := GetCurrentMode(ctx, st.client, st.endpoint)
+	if err != nil {
+		return "", err
+	}
+	return m.Name, nil
+}
+
+// SetMode changes the current location mode.
+func (st *SmartThings) SetMode(mode string) error {
+	return st.SetModeContext(context.Background(), mode)
+}
+
+// SetModeContext is like SetMode, but honors ctx.
+func (st *SmartThings) SetModeContext(ctx context.Context, mode string) error {
+	if err := st.writable(); err != nil {
+		return err
+	}
+	if err := st.connected(); err != nil {
+		return err
+	}
+	return SetLocationMode(ctx, st.client, st.endpoint, mode)
+}
+
+// SetModeAndConfirm changes the current location mode and polls CurrentMode
+// until it matches mode or timeout expires.
+func (st *SmartThings) SetModeAndConfirm(ctx context.Context, mode string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if err := st.SetModeContext(ctx, mode); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(confirmPollInterval)
+	defer ticker.Stop()
+
+	var last string
+	for {
+		cur, err := st.CurrentModeContext(ctx)
+		if err == nil {
+			if cur == mode {
+				return nil
+			}
+			last = cur
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("mode change to %q not confirmed (current mode: %q): %v", mode, last, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
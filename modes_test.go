@@ -0,0 +1,111 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smoogle/gosmart"
+	"github.com/smoogle/gosmart/gosmarttest"
+	"golang.org/x/net/context"
+)
+
+// modes serves /mode and /mode/{name} on s. A mode change only shows up
+// in /mode after lag.
+func modes(s *gosmarttest.Server, current string, lag time.Duration) {
+	var mu sync.Mutex
+	var changed time.Time
+	next := current
+	s.HandleFunc("/mode", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		if next != current && time.Since(changed) >= lag {
+			current = next
+		}
+		m := gosmart.Mode{ID: strings.ToLower(current), Name: current}
+		mu.Unlock()
+		gosmarttest.JSON(m)(w, r)
+	})
+	for _, name := range []string{"Home", "Away", "Night"} {
+		name := name
+		s.HandleFunc("/mode/"+name, func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			next, changed = name, time.Now()
+			mu.Unlock()
+		})
+	}
+}
+
+func TestSetModeAndConfirm(t *testing.T) {
+	s := newServer(t)
+	modes(s, "Home", 500*time.Millisecond)
+	st := connect(t, s, gosmart.Config{})
+
+	if err := st.SetModeAndConfirm(context.Background(), "Away", 5*time.Second); err != nil {
+		t.Fatalf("SetModeAndConfirm: %v", err)
+	}
+	mode, err := st.CurrentMode()
+	if err != nil || mode != "Away" {
+		t.Errorf("CurrentMode() = %q, %v; want Away", mode, err)
+	}
+}
+
+func TestSetModeAndConfirmTimeout(t *testing.T) {
+	s := newServer(t)
+	modes(s, "Home", time.Hour)
+	st := connect(t, s, gosmart.Config{})
+
+	err := st.SetModeAndConfirm(context.Background(), "Night", 100*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), `"Home"`) {
+		t.Errorf("SetModeAndConfirm() = %v, want a timeout naming the current mode", err)
+	}
+}
+
+func TestSetModeContext(t *testing.T) {
+	s := newServer(t)
+	modes(s, "Home", 0)
+	st := connect(t, s, gosmart.Config{})
+	s.SetDelay(time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := st.SetModeContext(ctx, "Away"); err == nil {
+		t.Error("SetModeContext succeeded past its deadline")
+	}
+	if _, err := st.CurrentModeContext(ctx); err == nil {
+		t.Error("CurrentModeContext succeeded past its deadline")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("calls took %v, want them cut short by ctx", d)
+	}
+}
+
+func TestActionsNotRetried(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	modes(s, "Home", 0)
+	st := connect(t, s, fastRetries(3))
+	d := device(t, st, "1")
+
+	actions := map[string]func() error{
+		"SetMode":       func() error { return st.SetMode("Away") },
+		"SetPreference": func() error { return d.SetPreference("delay", 10) },
+	}
+	for name, action := range actions {
+		before := len(s.Requests())
+		s.Fail(1, http.StatusServiceUnavailable, "")
+		if err := action(); err == nil {
+			t.Errorf("%s: failed request returned no error", name)
+		}
+		if n := len(s.Requests()) - before; n != 1 {
+			t.Errorf("%s: sent %d times, want 1", name, n)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"encoding/json"
+	"fmt"
+	"golang.org/x/net/context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// GetDevicePreferences returns the preferences (settings) of a device.
+func GetDevicePreferences(ctx context.Context, client *http.Client, endpoint string, id string) (map[string]interface{}, error) {
+	ret := make(map[string]interface{})
+
+	contents, err := issueCommand(ctx, client, endpoint, "/devices/"+url.PathEscape(id)+"/preferences")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(contents, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// SetDevicePreference sets one preference of a device. Value must be a
+// string, bool, or a number.
+func SetDevicePreference(ctx context.Context, client *http.Client, endpoint string, id string, key string, value interface{}) error {
+	v, err := preferenceValue(value)
+	if err != nil {
+		return err
+	}
+	path := "/devices/" + url.PathEscape(id) + "/preferences/" + url.PathEscape(key) + "/" + url.PathEscape(v)
+	_, err = issueAction(ctx, client, endpoint, path)
+	return err
+}
+
+// preferenceValue formats a preference value for the preferences endpoint.
+func preferenceValue(value interface{}) (string, error) {
+	switch t := value.(type) {
+	case string:
+		return t, nil
+	case bool:
+		return strconv.FormatBool(t), nil
+	case int:
+		return strconv.Itoa(t), nil
+	case int64:
+		return strconv.FormatInt(t, 10), nil
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64), nil
+	case float32:
+		return strconv.FormatFloat(float64(t), 'f', -1, 32), nil
+	}
+	return "", fmt.Errorf("unsupported preference value type: %T", value)
+}
+
+// Preferences returns the device preferences (settings).
+func (d *Device) Preferences() (map[string]interface{}, error) {
+	return d.PreferencesContext(context.Background())
+}
+
+// PreferencesContext is like Preferences, but honors ctx.
+func (d *Device) PreferencesContext(ctx context.Context) (map[string]interface{}, error) {
+	if err := d.st.connected(); err != nil {
+		return nil, err
+	}
+	return GetDevicePreferences(ctx, d.st.client, d.st.endpoint, d.ID)
+}
+
+// SetPreference sets one device preference. Value must be a string, bool,
+// or a number.
+func (d *Device) SetPreference(key string, value interface{}) error {
+	return d.SetPreferenceContext(context.Background(), key, value)
+}
+
+// SetPreferenceContext is like SetPreference, but honors ctx.
+func (d *Device) SetPreferenceContext(ctx context.Context, key string, value interface{}) error {
+	if err := d.st.writable(); err != nil {
+		return err
+	}
+	if err := d.st.connected(); err != nil {
+		return err
+	}
+	return SetDevicePreference(ctx, d.st.client, d.st.endpoint, d.ID, key, value)
+}
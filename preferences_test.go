@@ -0,0 +1,48 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/smoogle/gosmart"
+)
+
+func TestPreferences(t *testing.T) {
+	sensor := lamp("1")
+	sensor.Preferences = map[string]interface{}{"reportInterval": 300.0, "sensitivity": "high", "ledEnabled": true}
+	s := newServer(t, sensor)
+	st := connect(t, s, gosmart.Config{})
+	d := device(t, st, "1")
+
+	got, err := d.Preferences()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, sensor.Preferences) {
+		t.Errorf("Preferences() = %v, want %v", got, sensor.Preferences)
+	}
+
+	for key, value := range map[string]interface{}{"reportInterval": 60, "sensitivity": "low", "ledEnabled": false, "offset": 1.5} {
+		if err := d.SetPreference(key, value); err != nil {
+			t.Fatalf("SetPreference(%q, %v): %v", key, value, err)
+		}
+	}
+	want := map[string]interface{}{"reportInterval": 60.0, "sensitivity": "low", "ledEnabled": false, "offset": 1.5}
+	if got, err := d.Preferences(); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Preferences() after setting = %v, %v; want %v", got, err, want)
+	}
+
+	before := len(s.Requests())
+	if err := d.SetPreference("schedule", []string{"mon"}); err == nil {
+		t.Error("SetPreference accepted a list")
+	}
+	if len(s.Requests()) != before {
+		t.Error("unsupported preference value sent to the server")
+	}
+}
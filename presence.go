@@ -0,0 +1,88 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"time"
+)
+
+const (
+	// Size of the channels returned by WatchPresence.
+	presenceBuffer = 16
+)
+
+// PresenceChange reports a presence device arriving (Present is true) or
+// departing.
+type PresenceChange struct {
+	DeviceID string
+	Present  bool
+	// When is the time the transition was detected.
+	When time.Time
+}
+
+// presenceWatcher holds one channel registered by WatchPresence.
+type presenceWatcher struct {
+	ch chan PresenceChange
+}
+
+// WatchPresence returns a channel receiving a PresenceChange each time the
+// presence attribute of a device changes between "present" and "not
+// present", as detected when devices are refreshed (use StartAutoRefresh to
+// poll them). Only transitions are reported; the first state seen for a
+// device is not. Changes are dropped if the channel is full. The returned
+// handle stops the watch and closes the channel.
+func (st *SmartThings) WatchPresence() (<-chan PresenceChange, *Handle) {
+	if st.smartThings == nil {
+		ch := make(chan PresenceChange)
+		close(ch)
+		return ch, newHandle(func() {})
+	}
+	w := &presenceWatcher{ch: make(chan PresenceChange, presenceBuffer)}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.presenceWatchers = append(st.presenceWatchers, w)
+	return w.ch, newHandle(func() { st.removePresenceWatcher(w) })
+}
+
+// removePresenceWatcher unregisters w and closes its channel.
+func (st *SmartThings) removePresenceWatcher(w *presenceWatcher) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for i, x := range st.presenceWatchers {
+		if x == w {
+			st.presenceWatchers = append(st.presenceWatchers[:i], st.presenceWatchers[i+1:]...)
+			close(w.ch)
+			return
+		}
+	}
+}
+
+// evalPresence records the presence state of the device and notifies the
+// watchers if it changed since the previous refresh.
+func (st *SmartThings) evalPresence(d *Device, now time.Time) {
+	present, ok := d.BoolAttribute("presence")
+	if !ok {
+		return
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.presenceState == nil {
+		st.presenceState = make(map[string]bool)
+	}
+	prev, seen := st.presenceState[d.ID]
+	st.presenceState[d.ID] = present
+	if !seen || prev == present {
+		return
+	}
+	c := PresenceChange{DeviceID: d.ID, Present: present, When: now}
+	for _, w := range st.presenceWatchers {
+		select {
+		case w.ch <- c:
+		default:
+		}
+	}
+}
@@ -0,0 +1,64 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smoogle/gosmart"
+	"github.com/smoogle/gosmart/gosmarttest"
+)
+
+func TestWatchPresence(t *testing.T) {
+	s := newServer(t,
+		gosmarttest.Device{ID: "phone", Name: "Phone", Attributes: map[string]interface{}{"presence": "not present"}},
+		lamp("2"),
+	)
+	before := time.Now()
+	st := connect(t, s, gosmart.Config{})
+	ch, h := st.WatchPresence()
+	defer h.Cancel()
+
+	refresh := func() {
+		if err := st.Refresh(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect := func(present bool) {
+		t.Helper()
+		select {
+		case c := <-ch:
+			if c.DeviceID != "phone" || c.Present != present || c.When.Before(before) {
+				t.Errorf("got %+v, want phone present=%v", c, present)
+			}
+		default:
+			t.Errorf("no change reported, want phone present=%v", present)
+		}
+	}
+
+	// The first state seen is not a transition.
+	refresh()
+	if len(ch) != 0 {
+		t.Errorf("initial state reported: %+v", <-ch)
+	}
+
+	s.SetAttribute("phone", "presence", "present")
+	refresh()
+	expect(true)
+
+	// Only edges are reported, not every refresh in the same state.
+	s.SetAttribute("2", "switch", "on")
+	refresh()
+	if len(ch) != 0 {
+		t.Errorf("change reported without a transition: %+v", <-ch)
+	}
+
+	s.SetAttribute("phone", "presence", "not present")
+	refresh()
+	expect(false)
+}
@@ -0,0 +1,299 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/net/context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Maximum size of an event notification body.
+	maxEventBytes = 64 << 10
+
+	// SignatureHeader is the header carrying the signature of an event
+	// notification: the hex encoded HMAC-SHA256 of the body, keyed with
+	// the callback secret (see Config.CallbackSecret).
+	SignatureHeader = "X-Gosmart-Signature"
+)
+
+// errBadSignature is returned for event notifications failing verification.
+var errBadSignature = errors.New("missing or invalid event signature")
+
+// Event is a device event notification posted by the SmartApp to the
+// callback URL (see SubscribeDevice).
+type Event struct {
+	DeviceID string
+	// Name is the name of the attribute the event refers to.
+	Name string
+	// Value is the new attribute value, as a string.
+	Value string
+	Unit  string
+	// Time is the time the event happened. Set to the time the notification
+	// was received if the event carries no timestamp.
+	Time time.Time
+
+	// raw is the value as decoded from the notification.
+	raw interface{}
+}
+
+// SubscribeDevice asks the SmartApp to post the events of the given
+// attributes of a device (all attributes if empty) to Config.CallbackURL,
+// where an EventHandler should be listening. The subscription is posted as
+// JSON, so Config.CallbackSecret, passed to the SmartApp to sign the
+// notifications with, stays out of the URL (and out of access logs).
+func (st *SmartThings) SubscribeDevice(id string, attributes []string) error {
+	return st.SubscribeDeviceContext(context.Background(), id, attributes)
+}
+
+// SubscribeDeviceContext is like SubscribeDevice, but honors ctx.
+func (st *SmartThings) SubscribeDeviceContext(ctx context.Context, id string, attributes []string) error {
+	if err := st.connected(); err != nil {
+		return err
+	}
+	cfg := st.config()
+	if cfg.CallbackURL == "" {
+		return errors.New("no callback URL configured for event subscriptions")
+	}
+	if cfg.CallbackSecret == "" {
+		return errors.New("no callback secret configured for event subscriptions")
+	}
+	body := struct {
+		Callback   string   `json:"callback"`
+		Secret     string   `json:"secret"`
+		Attributes []string `json:"attributes,omitempty"`
+	}{cfg.CallbackURL, cfg.CallbackSecret, attributes}
+	_, err := issuePost(ctx, st.client, st.endpoint, "/devices/"+url.PathEscape(id)+"/subscribe", body)
+	return notFound(err, id)
+}
+
+// EventHandler returns an http.Handler receiving the event notifications
+// posted by the SmartApp and passing them to fn. Notifications must be POST
+// requests signed with secret (see SignatureHeader), with a JSON body
+// holding at least "deviceId" and "name"; others are rejected with an HTTP
+// error (401 for unsigned or wrongly signed ones) and not passed to fn. A
+// blank secret rejects every notification.
+func EventHandler(secret string, fn func(Event)) http.Handler {
+	return eventHandler(func() string { return secret }, func(e Event) error {
+		fn(e)
+		return nil
+	})
+}
+
+// pushWaiter receives the events pushed for a device (see awaitPushed).
+type pushWaiter struct {
+	deviceID string
+	ch       chan Event
+}
+
+// EventHandler works like the EventHandler function, verifying the
+// notifications with Config.CallbackSecret, and also updates the attributes
+// of the device from each event before passing it to fn (which may be nil).
+// Events for unknown devices are rejected. Events older than the value
+// already held for the attribute (e.g. delivered after a newer refresh) are
+// acknowledged but neither applied nor passed to fn.
+func (st *SmartThings) EventHandler(fn func(Event)) http.Handler {
+	if st.smartThings != nil {
+		st.pushMu.Lock()
+		st.push = true
+		st.pushMu.Unlock()
+	}
+	return eventHandler(func() string { return st.config().CallbackSecret }, func(e Event) error {
+		d := st.deviceByID(e.DeviceID)
+		if d == nil {
+			return fmt.Errorf("%w: %s", ErrDeviceNotFound, e.DeviceID)
+		}
+		if !d.applyEvent(e) {
+			return nil
+		}
+		st.notifyPushed(e)
+		if fn != nil {
+			fn(e)
+		}
+		return nil
+	})
+}
+
+// awaitPushed returns a channel receiving the events pushed for a device,
+// and a function to stop receiving them. The channel is nil if no event
+// handler was created, so events are not pushed. Events are dropped if the
+// channel is full.
+func (st *SmartThings) awaitPushed(deviceID string) (<-chan Event, func()) {
+	st.pushMu.Lock()
+	defer st.pushMu.Unlock()
+	if !st.push {
+		return nil, func() {}
+	}
+	w := &pushWaiter{deviceID: deviceID, ch: make(chan Event, awaitEventBuffer)}
+	st.pushWaiters = append(st.pushWaiters, w)
+	return w.ch, func() {
+		st.pushMu.Lock()
+		defer st.pushMu.Unlock()
+		for i, x := range st.pushWaiters {
+			if x == w {
+				st.pushWaiters = append(st.pushWaiters[:i], st.pushWaiters[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// notifyPushed passes a pushed event to the waiters for its device.
+func (st *SmartThings) notifyPushed(e Event) {
+	st.pushMu.Lock()
+	defer st.pushMu.Unlock()
+	for _, w := range st.pushWaiters {
+		if w.deviceID != e.DeviceID {
+			continue
+		}
+		select {
+		case w.ch <- e:
+		default:
+		}
+	}
+}
+
+// eventHandler returns an http.Handler verifying (with the secret returned
+// by secret) and decoding event notifications and passing them to fn. An
+// error returned by fn is sent back as HTTP 404.
+func eventHandler(secret func() string, fn func(Event) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		b, err := ioutil.ReadAll(io.LimitReader(r.Body, maxEventBytes+1))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(b) > maxEventBytes {
+			http.Error(w, ErrResponseTooLarge.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if !validSignature(secret(), b, r.Header.Get(SignatureHeader)) {
+			http.Error(w, errBadSignature.Error(), http.StatusUnauthorized)
+			return
+		}
+		e, err := parseEvent(b, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := fn(e); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// SignEvent returns the signature of an event notification body for
+// SignatureHeader, as the SmartApp computes it.
+func SignEvent(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// validSignature returns true if sig is the signature of body with secret.
+// Nothing is valid with a blank secret.
+func validSignature(secret string, body []byte, sig string) bool {
+	if secret == "" {
+		return false
+	}
+	return hmac.Equal([]byte(SignEvent(secret, body)), []byte(strings.ToLower(sig)))
+}
+
+// parseEvent decodes and checks an event notification body.
+func parseEvent(b []byte, now time.Time) (Event, error) {
+	var raw struct {
+		DeviceID string      `json:"deviceId"`
+		Name     string      `json:"name"`
+		Value    interface{} `json:"value"`
+		Unit     string      `json:"unit"`
+		Date     interface{} `json:"date"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return Event{}, fmt.Errorf("invalid event: %v", err)
+	}
+	if raw.DeviceID == "" || raw.Name == "" {
+		return Event{}, errors.New("invalid event: missing deviceId or name")
+	}
+	e := Event{DeviceID: raw.DeviceID, Name: raw.Name, Unit: raw.Unit, raw: raw.Value}
+	switch t := raw.Value.(type) {
+	case nil:
+	case string:
+		e.Value = t
+	case float64:
+		e.Value = strconv.FormatFloat(t, 'f', -1, 64)
+	default:
+		e.Value = fmt.Sprintf("%v", t)
+	}
+	var ok bool
+	if e.Time, ok = parseTime(raw.Date); !ok {
+		e.Time = now
+	}
+	return e, nil
+}
+
+// applyEvent updates the attributes of the device from an event. The cached
+// device details are invalidated, so the next refresh reads them again.
+// Returns false, changing nothing, if the event is older than the time of
+// the attribute value already held.
+func (d *Device) applyEvent(e Event) bool {
+	d.mu.Lock()
+	if t, ok := d.times[e.Name]; ok && e.Time.Before(t) {
+		d.mu.Unlock()
+		return false
+	}
+	raw := make(map[string]interface{})
+	for k, v := range d.raw {
+		raw[k] = v
+	}
+	raw[e.Name] = e.raw
+	changes := diffAttributes(d.ID, d.raw, raw, e.Time)
+	var (
+		types   []AttributeType
+		details map[string]AttributeDetail
+	)
+	if d.info != nil {
+		types, details = d.info.SupportedAttributes, d.info.details
+	}
+	if d.times == nil {
+		d.times = make(map[string]time.Time)
+	}
+	d.times[e.Name] = e.Time
+	d.raw = raw
+	d.attributes = numericAttributes(raw, types, d.st.truthyValues(), nil)
+	d.tempUnit = attributesUnit(raw, details)
+	if _, ok := raw["temperatureUnit"].(string); !ok && e.Name == "temperature" && e.Unit != "" {
+		d.tempUnit = normalUnit(e.Unit)
+	}
+	d.mu.Unlock()
+
+	d.st.Invalidate(d.ID)
+	if len(changes) > 0 {
+		d.st.feed.add(d.st.config().ActivityFeedSize, changes)
+	}
+	d.st.evalAlerts(d)
+	d.st.evalConnectivity(d, time.Now())
+	d.st.evalPresence(d, e.Time)
+	return true
+}
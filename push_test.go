@@ -0,0 +1,241 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smoogle/gosmart"
+)
+
+// secret is the callback secret the test notifications are signed with.
+const secret = "s3cret"
+
+// post sends an event notification body signed with secret to url and
+// returns the HTTP status.
+func post(t *testing.T, url, body string) int {
+	t.Helper()
+	return postSigned(t, url, body, gosmart.SignEvent(secret, []byte(body)))
+}
+
+// postSigned sends an event notification body to url with the signature sig
+// (none if blank) and returns the HTTP status.
+func postSigned(t *testing.T, url, body, sig string) int {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if sig != "" {
+		req.Header.Set(gosmart.SignatureHeader, sig)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestSubscribeDevice(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	var (
+		mu   sync.Mutex
+		subs []string
+	)
+	s.HandleFunc("/devices/1/subscribe", func(_ http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		subs = append(subs, r.Method+" "+string(b))
+		mu.Unlock()
+	})
+
+	st := connect(t, s, gosmart.Config{CallbackSecret: secret})
+	if err := st.SubscribeDevice("1", nil); err == nil {
+		t.Error("SubscribeDevice succeeded without a callback URL")
+	}
+	st = connect(t, s, gosmart.Config{CallbackURL: "https://example.com/events"})
+	if err := st.SubscribeDevice("1", nil); err == nil {
+		t.Error("SubscribeDevice succeeded without a callback secret")
+	}
+
+	st = connect(t, s, gosmart.Config{CallbackURL: "https://example.com/events", CallbackSecret: secret})
+	if err := st.SubscribeDevice("1", []string{"switch", "level"}); err != nil {
+		t.Fatal(err)
+	}
+	// The secret is sent in the body, never in the URL.
+	for _, r := range s.Requests() {
+		if r.Path == "/devices/1/subscribe" && strings.Contains(r.Query.Encode(), secret) {
+			t.Errorf("subscription sent the secret in the query %v", r.Query)
+		}
+	}
+	want := `POST {"callback":"https://example.com/events","secret":"` + secret + `","attributes":["switch","level"]}`
+	mu.Lock()
+	if len(subs) != 1 || subs[0] != want {
+		t.Errorf("subscriptions sent %q, want %q", subs, want)
+	}
+	mu.Unlock()
+	if err := st.SubscribeDevice("2", nil); !errors.Is(err, gosmart.ErrDeviceNotFound) {
+		t.Errorf("SubscribeDevice on an unknown device = %v, want ErrDeviceNotFound", err)
+	}
+}
+
+func TestEventHandler(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events []gosmart.Event
+	)
+	srv := httptest.NewServer(gosmart.EventHandler(secret, func(e gosmart.Event) {
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	before := time.Now()
+	if code := post(t, srv.URL, `{"deviceId": "1", "name": "temperature", "value": 21.5, "unit": "C", "date": "2016-03-01T10:20:30Z"}`); code != http.StatusNoContent {
+		t.Errorf("valid event got HTTP %d", code)
+	}
+	if code := post(t, srv.URL, `{"deviceId": "1", "name": "switch", "value": "on"}`); code != http.StatusNoContent {
+		t.Errorf("valid event got HTTP %d", code)
+	}
+	for _, body := range []string{`{"deviceId": "1"`, `{"deviceId": "1", "value": "on"}`, `{"name": "switch"}`} {
+		if code := post(t, srv.URL, body); code != http.StatusBadRequest {
+			t.Errorf("event %s got HTTP %d, want 400", body, code)
+		}
+	}
+	// Unsigned and wrongly signed notifications are rejected.
+	body := `{"deviceId": "1", "name": "switch", "value": "off"}`
+	for _, sig := range []string{"", "zz", gosmart.SignEvent("other", []byte(body))} {
+		if code := postSigned(t, srv.URL, body, sig); code != http.StatusUnauthorized {
+			t.Errorf("event signed %q got HTTP %d, want 401", sig, code)
+		}
+	}
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET got HTTP %d, want 405", resp.StatusCode)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 2 {
+		t.Fatalf("handler got %d events, want the 2 valid ones", len(events))
+	}
+	e := events[0]
+	if e.DeviceID != "1" || e.Name != "temperature" || e.Value != "21.5" || e.Unit != "C" || !e.Time.Equal(time.Date(2016, 3, 1, 10, 20, 30, 0, time.UTC)) {
+		t.Errorf("got event %+v", e)
+	}
+	// Events without a date are timestamped on receipt.
+	if e := events[1]; e.Value != "on" || e.Time.Before(before) {
+		t.Errorf("got event %+v", e)
+	}
+}
+
+func TestDeviceEventHandler(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	st := connect(t, s, gosmart.Config{CallbackSecret: secret})
+	d := device(t, st, "1")
+
+	var got []gosmart.Event
+	srv := httptest.NewServer(st.EventHandler(func(e gosmart.Event) { got = append(got, e) }))
+	defer srv.Close()
+
+	if code := post(t, srv.URL, `{"deviceId": "1", "name": "level", "value": 40}`); code != http.StatusNoContent {
+		t.Fatalf("event got HTTP %d", code)
+	}
+	if code := post(t, srv.URL, `{"deviceId": "2", "name": "level", "value": 40}`); code != http.StatusNotFound {
+		t.Errorf("event for an unknown device got HTTP %d, want 404", code)
+	}
+	if len(got) != 1 {
+		t.Errorf("handler got %d events, want 1", len(got))
+	}
+	// The device is updated without a refresh.
+	if v := d.Attribute("level"); v != 40 {
+		t.Errorf("level = %v after the event, want 40", v)
+	}
+	if _, ok := d.AttributeTime("level"); !ok {
+		t.Error("no time recorded for the pushed attribute")
+	}
+	if n := len(s.Calls()); n != 0 {
+		t.Errorf("event caused %d commands", n)
+	}
+}
+
+func TestDeviceEventHandlerNoSecret(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	st := connect(t, s, gosmart.Config{})
+	d := device(t, st, "1")
+	srv := httptest.NewServer(st.EventHandler(nil))
+	defer srv.Close()
+
+	// Without a secret, nothing can be verified.
+	body := `{"deviceId": "1", "name": "level", "value": 40}`
+	if code := postSigned(t, srv.URL, body, gosmart.SignEvent("", []byte(body))); code != http.StatusUnauthorized {
+		t.Errorf("event got HTTP %d, want 401", code)
+	}
+	if v := d.Attribute("level"); v == 40 {
+		t.Error("unverified event applied to the device")
+	}
+}
+
+func TestDeviceEventHandlerStale(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	st := connect(t, s, gosmart.Config{CallbackSecret: secret})
+	d := device(t, st, "1")
+	var got []gosmart.Event
+	srv := httptest.NewServer(st.EventHandler(func(e gosmart.Event) { got = append(got, e) }))
+	defer srv.Close()
+
+	if code := post(t, srv.URL, `{"deviceId": "1", "name": "level", "value": 40, "date": "2016-03-01T10:20:30Z"}`); code != http.StatusNoContent {
+		t.Fatalf("event got HTTP %d", code)
+	}
+	// A late event is acknowledged, but does not overwrite the newer value.
+	if code := post(t, srv.URL, `{"deviceId": "1", "name": "level", "value": 10, "date": "2016-03-01T10:20:00Z"}`); code != http.StatusNoContent {
+		t.Fatalf("late event got HTTP %d", code)
+	}
+	if v := d.Attribute("level"); v != 40 {
+		t.Errorf("level = %v after a late event, want 40", v)
+	}
+	if len(got) != 1 {
+		t.Errorf("handler got %d events, want 1", len(got))
+	}
+}
+
+func TestDeviceEventHandlerConnectivity(t *testing.T) {
+	health := lamp("1")
+	health.Attributes["healthStatus"] = "online"
+	s := newServer(t, health)
+	st := connect(t, s, gosmart.Config{CallbackSecret: secret})
+	ch, h := st.WatchConnectivity()
+	defer h.Cancel()
+	srv := httptest.NewServer(st.EventHandler(nil))
+	defer srv.Close()
+
+	if code := post(t, srv.URL, `{"deviceId": "1", "name": "healthStatus", "value": "offline"}`); code != http.StatusNoContent {
+		t.Fatalf("event got HTTP %d", code)
+	}
+	select {
+	case c := <-ch:
+		if c.DeviceID != "1" || c.Online {
+			t.Errorf("got change %+v, want device 1 offline", c)
+		}
+	default:
+		t.Error("pushed health status not reported to the connectivity watchers")
+	}
+}
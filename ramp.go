@@ -0,0 +1,58 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/net/context"
+	"time"
+)
+
+// RampLevel gradually changes the level of the given dimmers from one level
+// to another, in steps evenly spread over duration. The first setLevel is
+// issued immediately (with level from) and the last one, with level to,
+// after duration. Each step is sent to all devices concurrently (see
+// BatchCall). The ramp stops at the first step with a failed command, or
+// when ctx is cancelled.
+func (st *SmartThings) RampLevel(ctx context.Context, deviceIDs []string, from, to, steps int, duration time.Duration) error {
+	if steps <= 0 {
+		return errors.New("ramp steps must be positive")
+	}
+	if err := st.connected(); err != nil {
+		return err
+	}
+	var devices []*Device
+	for _, id := range deviceIDs {
+		d := st.deviceByID(id)
+		if d == nil {
+			return fmt.Errorf("%w: %s", ErrDeviceNotFound, id)
+		}
+		if !d.HasCommand("setLevel") {
+			return fmt.Errorf("%w: setLevel on device %s", ErrCommandUnavailable, id)
+		}
+		devices = append(devices, d)
+	}
+
+	interval := duration / time.Duration(steps)
+	for i := 0; i <= steps; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(interval):
+			}
+		}
+		level := from + (to-from)*i/steps
+		for id, o := range st.BatchCall(devices, "setLevel", float64(level)) {
+			if o.Err != nil {
+				return fmt.Errorf("ramp step %d on device %s: %w", i, id, o.Err)
+			}
+		}
+	}
+	return nil
+}
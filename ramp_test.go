@@ -0,0 +1,63 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/smoogle/gosmart"
+	"golang.org/x/net/context"
+)
+
+func TestRampLevel(t *testing.T) {
+	s := newServer(t, lamp("1"), lamp("2"))
+	st := connect(t, s, gosmart.Config{})
+
+	start := time.Now()
+	if err := st.RampLevel(context.Background(), []string{"1", "2"}, 0, 100, 4, 100*time.Millisecond); err != nil {
+		t.Fatalf("RampLevel: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("ramp took %v, want at least 100ms", elapsed)
+	}
+	levels := map[string][]string{}
+	for _, c := range s.Calls() {
+		if c.Command == "setLevel" {
+			levels[c.DeviceID] = append(levels[c.DeviceID], c.Args...)
+		}
+	}
+	want := []string{"0", "25", "50", "75", "100"}
+	for _, id := range []string{"1", "2"} {
+		if !reflect.DeepEqual(levels[id], want) {
+			t.Errorf("device %s got levels %v, want %v", id, levels[id], want)
+		}
+	}
+}
+
+func TestRampLevelCancel(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	st := connect(t, s, gosmart.Config{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := st.RampLevel(ctx, []string{"1"}, 0, 100, 10, time.Second); err != context.DeadlineExceeded {
+		t.Errorf("RampLevel() = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("cancelled ramp took %v", elapsed)
+	}
+	if n := len(s.Calls()); n < 1 || n >= 11 {
+		t.Errorf("cancelled ramp sent %d commands", n)
+	}
+
+	if err := st.RampLevel(context.Background(), []string{"1", "99"}, 0, 100, 2, 0); err == nil {
+		t.Error("RampLevel accepted an unknown device")
+	}
+}
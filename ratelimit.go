@@ -0,0 +1,134 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Rate limit response headers.
+const (
+	rateLimitHeader     = "X-RateLimit-Limit"
+	rateRemainingHeader = "X-RateLimit-Remaining"
+	rateResetHeader     = "X-RateLimit-Reset"
+)
+
+// RateLimit holds the quota status last reported by the server.
+type RateLimit struct {
+	// Limit is the number of requests allowed in the current window.
+	Limit int
+	// Remaining is the number of requests left in the current window.
+	Remaining int
+	// Reset is the time the current window ends.
+	Reset time.Time
+	// Updated is the time the status was last reported. Zero if the server
+	// never sent rate limit headers.
+	Updated time.Time
+}
+
+// rateLimitTransport is an http.RoundTripper recording the rate limit
+// headers of every response.
+type rateLimitTransport struct {
+	base http.RoundTripper
+
+	mu sync.Mutex
+	// warn is the number of remaining requests below which a warning is
+	// logged. Zero disables the warning.
+	warn int
+	last RateLimit
+	// logf logs the warning.
+	logf func(format string, v ...interface{})
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	rl, ok := parseRateLimit(resp, time.Now())
+	if !ok {
+		return resp, err
+	}
+	t.mu.Lock()
+	t.last = rl
+	warn := t.warn
+	t.mu.Unlock()
+	if warn > 0 && rl.Remaining < warn && t.logf != nil {
+		t.logf("rate limit low: %d of %d requests remaining, reset at %v", rl.Remaining, rl.Limit, rl.Reset.Format(time.RFC3339))
+	}
+	return resp, err
+}
+
+// setWarning sets the remaining request count below which a warning is
+// logged.
+func (t *rateLimitTransport) setWarning(n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.warn = n
+}
+
+// status returns the last recorded rate limit status.
+func (t *rateLimitTransport) status() RateLimit {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.last
+}
+
+// parseRateLimit extracts the rate limit status from response headers.
+// The reset header may hold either a Unix timestamp or the number of
+// seconds until the reset. A 429 response without rate limit headers counts
+// as no requests remaining, until the time given by its Retry-After header
+// (if any). Returns false if no remaining count is present.
+func parseRateLimit(resp *http.Response, now time.Time) (RateLimit, bool) {
+	h := resp.Header
+	remaining, err := strconv.Atoi(h.Get(rateRemainingHeader))
+	if err != nil {
+		if resp.StatusCode != http.StatusTooManyRequests {
+			return RateLimit{}, false
+		}
+		remaining = 0
+	}
+	rl := RateLimit{Remaining: remaining, Updated: now}
+	rl.Limit, _ = strconv.Atoi(h.Get(rateLimitHeader))
+	if reset, err := strconv.ParseInt(h.Get(rateResetHeader), 10, 64); err == nil {
+		// Anything smaller than a year of seconds is a relative value.
+		if reset < 365*24*3600 {
+			rl.Reset = now.Add(time.Duration(reset) * time.Second)
+		} else {
+			rl.Reset = time.Unix(reset, 0)
+		}
+	} else if ra, ok := retryAfter(resp, now); ok {
+		rl.Reset = now.Add(ra)
+	}
+	return rl, true
+}
+
+// RateLimitStatus returns the quota status from the rate limit headers of
+// the last response. The Updated field is zero if the server never sent
+// them.
+func (st *SmartThings) RateLimitStatus() RateLimit {
+	if st.smartThings == nil {
+		return RateLimit{}
+	}
+	if st.rateLimit == nil {
+		return RateLimit{}
+	}
+	return st.rateLimit.status()
+}
+
+// RateLimit returns the number of requests remaining in the current rate
+// limit window and the time the window resets, as last reported by the
+// server. Both are zero if the server never reported them; use
+// RateLimitStatus to tell this apart from an exhausted quota.
+func (st *SmartThings) RateLimit() (remaining int, reset time.Time) {
+	rl := st.RateLimitStatus()
+	return rl.Remaining, rl.Reset
+}
@@ -0,0 +1,73 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/smoogle/gosmart"
+	"github.com/smoogle/gosmart/gosmarttest"
+)
+
+// quota serves /mode on s, replying with the given rate limit headers.
+func quota(s *gosmarttest.Server, headers http.Header) {
+	s.HandleFunc("/mode", func(w http.ResponseWriter, r *http.Request) {
+		for k, v := range headers {
+			w.Header()[k] = v
+		}
+		gosmarttest.JSON(gosmart.Mode{ID: "home", Name: "Home"})(w, r)
+	})
+}
+
+func TestRateLimitStatus(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	headers := http.Header{}
+	quota(s, headers)
+	log := &logger{}
+	st := connect(t, s, gosmart.Config{Logger: log, RateLimitWarning: 10})
+
+	if rl := st.RateLimitStatus(); !rl.Updated.IsZero() {
+		t.Errorf("RateLimitStatus() = %+v before any rate limit headers", rl)
+	}
+
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+	headers.Set("X-RateLimit-Limit", "250")
+	headers.Set("X-RateLimit-Remaining", "200")
+	headers.Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+	before := time.Now()
+	if _, err := st.CurrentMode(); err != nil {
+		t.Fatalf("CurrentMode: %v", err)
+	}
+	rl := st.RateLimitStatus()
+	if rl.Limit != 250 || rl.Remaining != 200 || !rl.Reset.Equal(reset) || rl.Updated.Before(before) {
+		t.Errorf("RateLimitStatus() = %+v, want 200 of 250 resetting at %v", rl, reset)
+	}
+	if len(log.logged("rate limit low")) != 0 {
+		t.Error("warning logged with plenty of requests remaining")
+	}
+
+	// A small reset value counts in seconds from now.
+	headers.Set("X-RateLimit-Remaining", "5")
+	headers.Set("X-RateLimit-Reset", "60")
+	before = time.Now()
+	if _, err := st.CurrentMode(); err != nil {
+		t.Fatalf("CurrentMode: %v", err)
+	}
+	rl = st.RateLimitStatus()
+	if rl.Remaining != 5 || rl.Reset.Before(before.Add(time.Minute)) || rl.Reset.After(time.Now().Add(time.Minute)) {
+		t.Errorf("RateLimitStatus() = %+v, want 5 remaining resetting in 1m", rl)
+	}
+	if remaining, r := st.RateLimit(); remaining != 5 || !r.Equal(rl.Reset) {
+		t.Errorf("RateLimit() = %d, %v; want 5, %v", remaining, r, rl.Reset)
+	}
+	if len(log.logged("rate limit low: 5 of 250")) != 1 {
+		t.Errorf("low quota warning not logged: %q", log.logged(""))
+	}
+}
@@ -0,0 +1,92 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"strconv"
+	"time"
+)
+
+const (
+	// Number of recent events searched by EnergyUsage.
+	energyEvents = 200
+)
+
+// BatteryVoltage returns the raw battery voltage, from the batteryVoltage
+// or voltage attributes. Returns false if the device reports neither.
+func (d *Device) BatteryVoltage() (float64, bool) {
+	if v, ok := d.reading("batteryVoltage"); ok {
+		return v, true
+	}
+	return d.reading("voltage")
+}
+
+// PowerSource returns the current power source of the device, as reported
+// by the powerSource attribute (e.g. "mains", "battery", "dc"). Returns false
+// if the device does not report it.
+func (d *Device) PowerSource() (string, bool) {
+	return d.stringAttribute("powerSource")
+}
+
+// BatteryPoweredDevices returns the devices currently running on battery.
+func (st *SmartThings) BatteryPoweredDevices() []*Device {
+	var ret []*Device
+	for _, d := range st.DeviceList() {
+		if ps, ok := d.PowerSource(); ok && ps == "battery" {
+			ret = append(ret, d)
+		}
+	}
+	return ret
+}
+
+// EnergyUsage returns the energy consumed over the last window, computed
+// from the history of the cumulative energy attribute: the sum of the
+// increases between the last reading at or before the start of the window
+// and the most recent one. A counter reset (a reading lower than the
+// previous one) counts from zero. Returns false if the history does not go
+// back far enough or cannot be read.
+func (d *Device) EnergyUsage(window time.Duration) (float64, bool) {
+	events, err := d.Events(energyEvents)
+	if err != nil {
+		return 0, false
+	}
+	return energyUsage(events, time.Now().Add(-window))
+}
+
+// energyUsage computes the energy consumed since start from the energy
+// events (sorted oldest first).
+func energyUsage(events []DeviceEvent, start time.Time) (float64, bool) {
+	var (
+		total   float64
+		prev    float64
+		started bool
+	)
+	for _, e := range events {
+		if e.Name != "energy" {
+			continue
+		}
+		v, err := strconv.ParseFloat(e.Value, 64)
+		if err != nil {
+			continue
+		}
+		switch {
+		case !e.Time.After(start):
+			// Still before the window: this is the baseline.
+			prev, started = v, true
+		case !started:
+			// The first reading is already inside the window.
+			return 0, false
+		case v >= prev:
+			total += v - prev
+			prev = v
+		default:
+			total += v
+			prev = v
+		}
+	}
+	return total, started
+}
@@ -0,0 +1,107 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/smoogle/gosmart"
+	"github.com/smoogle/gosmart/gosmarttest"
+)
+
+func TestBatteryVoltage(t *testing.T) {
+	both, voltage, none := frontDoor("1"), frontDoor("2"), frontDoor("3")
+	both.Attributes["batteryVoltage"] = 2.9
+	both.Attributes["voltage"] = 120.0
+	voltage.Attributes["voltage"] = 3.1
+	s := newServer(t, both, voltage, none)
+	st := connect(t, s, gosmart.Config{})
+
+	cases := []struct {
+		id string
+		v  float64
+		ok bool
+	}{
+		{"1", 2.9, true},
+		{"2", 3.1, true},
+		{"3", 0, false},
+	}
+	for _, c := range cases {
+		if v, ok := device(t, st, c.id).BatteryVoltage(); v != c.v || ok != c.ok {
+			t.Errorf("device %s BatteryVoltage() = %v, %v; want %v, %v", c.id, v, ok, c.v, c.ok)
+		}
+	}
+}
+
+func TestPowerSource(t *testing.T) {
+	mains, battery, none := frontDoor("1"), frontDoor("2"), frontDoor("3")
+	mains.Attributes["powerSource"] = "mains"
+	battery.Attributes["powerSource"] = "battery"
+	s := newServer(t, mains, battery, none)
+	st := connect(t, s, gosmart.Config{})
+
+	if ps, ok := device(t, st, "1").PowerSource(); ps != "mains" || !ok {
+		t.Errorf("PowerSource() = %q, %v; want mains, true", ps, ok)
+	}
+	if ps, ok := device(t, st, "3").PowerSource(); ok {
+		t.Errorf("PowerSource() = %q, true for a device without powerSource", ps)
+	}
+	devs := st.BatteryPoweredDevices()
+	if len(devs) != 1 || devs[0].ID != "2" {
+		t.Errorf("BatteryPoweredDevices() = %v; want only device 2", devs)
+	}
+}
+
+func TestEnergyUsage(t *testing.T) {
+	meter := gosmarttest.Device{ID: "1", Attributes: map[string]interface{}{"energy": 1.0, "power": 40.0}}
+	s := newServer(t, meter, lamp("2"))
+	now := time.Now()
+	history := []struct {
+		ago    time.Duration
+		energy float64
+	}{
+		{3 * time.Hour, 100},
+		{90 * time.Minute, 101.5},
+		{40 * time.Minute, 102},
+		// The counter was reset.
+		{20 * time.Minute, 0.5},
+		{5 * time.Minute, 1},
+	}
+	for _, h := range history {
+		s.AddEvent("1", "energy", h.energy, now.Add(-h.ago))
+		s.AddEvent("1", "power", 40.0, now.Add(-h.ago+time.Second))
+	}
+	st := connect(t, s, gosmart.Config{})
+	d := device(t, st, "1")
+
+	cases := []struct {
+		window time.Duration
+		want   float64
+	}{
+		// From 101.5: +0.5, then 0.5 and 0.5 after the reset.
+		{time.Hour, 1.5},
+		{2 * time.Hour, 3},
+		{10 * time.Minute, 0.5},
+		// No reading since the window started.
+		{time.Minute, 0},
+	}
+	for _, c := range cases {
+		if got, ok := d.EnergyUsage(c.window); !ok || math.Abs(got-c.want) > 1e-9 {
+			t.Errorf("EnergyUsage(%v) = %v, %v; want %v", c.window, got, ok, c.want)
+		}
+	}
+
+	// The history does not go back far enough, or there is none.
+	if got, ok := d.EnergyUsage(4 * time.Hour); ok {
+		t.Errorf("EnergyUsage(4h) = %v, want false", got)
+	}
+	if got, ok := device(t, st, "2").EnergyUsage(time.Hour); ok {
+		t.Errorf("EnergyUsage() of a device without energy history = %v, want false", got)
+	}
+}
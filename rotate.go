@@ -0,0 +1,152 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Credential holds one OAuth client registration (a SmartApp).
+type Credential struct {
+	ClientID, Secret string
+	// Weight is the relative share of requests sent using this credential.
+	// Zero or less means 1.
+	Weight int
+	// TokenStore keeps the token of this credential. If nil, the token is
+	// kept in a file named after the client ID.
+	TokenStore TokenStore
+}
+
+// member holds the per-credential state of a rotateTransport.
+type member struct {
+	oauth    *oauth2.Config
+	store    TokenStore
+	endpoint string
+	base     http.RoundTripper
+	weight   int
+	current  int
+	// scopes holds the scopes granted to the token, if reported.
+	scopes []string
+}
+
+// rotateTransport is an http.RoundTripper that spreads requests across
+// several OAuth credentials using smooth weighted round-robin. Each
+// credential belongs to its own SmartApp installation, so requests for the
+// primary endpoint are rewritten to the endpoint of the chosen credential.
+type rotateTransport struct {
+	mu      sync.Mutex
+	primary string
+	members []*member
+}
+
+// newMember authenticates cred, requesting the scopes in cfg (DefaultScopes
+// if empty). Interactive authentication listens for the OAuth redirect at
+// cfg.RedirectURL, or the default if blank.
+func newMember(ctx context.Context, cred Credential, cfg Config) (*member, error) {
+	store := cred.TokenStore
+	if store == nil {
+		prefix := cfg.TokenPrefix
+		if prefix == "" {
+			prefix = tokenFilePrefix
+		}
+		store = NewFileTokenStore(fmt.Sprintf("%s_%s.json", prefix, cred.ClientID))
+	}
+	config := NewOAuthConfig(cred.ClientID, cred.Secret, cfg.Scopes...)
+	token, err := getTokenFromStore(store, config, cfg.RedirectURL, cfg.Logger)
+	if err != nil {
+		return nil, err
+	}
+	weight := cred.Weight
+	if weight <= 0 {
+		weight = 1
+	}
+	return &member{
+		oauth:  config,
+		store:  store,
+		base:   persistentClient(ctx, config, token, store, cfg.Logger).Transport,
+		weight: weight,
+		scopes: tokenScopes(token),
+	}, nil
+}
+
+// tokenMember returns a member authenticating with a static bearer token.
+func tokenMember(ctx context.Context, token string) *member {
+	src := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token, TokenType: "Bearer"})
+	return &member{
+		base:   oauth2.NewClient(ctx, src).Transport,
+		weight: 1,
+	}
+}
+
+// next picks the member to use for the next request. It returns the member
+// and its current transport.
+func (t *rotateTransport) next() (*member, http.RoundTripper) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var (
+		best  *member
+		total int
+	)
+	for _, m := range t.members {
+		m.current += m.weight
+		total += m.weight
+		if best == nil || m.current > best.current {
+			best = m
+		}
+	}
+	best.current -= total
+	return best, best.base
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *rotateTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	m, base := t.next()
+	uri := req.URL.String()
+	if m.endpoint == "" || m.endpoint == t.primary || !strings.HasPrefix(uri, t.primary) {
+		return base.RoundTrip(req)
+	}
+
+	u, err := url.Parse(m.endpoint + strings.TrimPrefix(uri, t.primary))
+	if err != nil {
+		return nil, err
+	}
+	r := req.Clone(req.Context())
+	r.URL = u
+	r.Host = u.Host
+	return base.RoundTrip(r)
+}
+
+// reconnect rebuilds the transport of every member authenticating with
+// OAuth from its stored token, logging token store failures to logger.
+// Members using a static token keep their transport.
+func (t *rotateTransport) reconnect(ctx context.Context, logger Logger) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.members) == 0 {
+		return errors.New("cannot reconnect: not connected")
+	}
+	for _, m := range t.members {
+		if m.store == nil {
+			// Static token, nothing to reload.
+			continue
+		}
+		token, err := m.store.Load()
+		if err != nil {
+			return err
+		}
+		m.base = persistentClient(ctx, m.oauth, token, m.store, logger).Transport
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/smoogle/gosmart"
+	"golang.org/x/net/context"
+)
+
+// discoverAt is an http.RoundTripper answering endpoint discovery with
+// endpoint, and sending every other request to the network.
+type discoverAt struct {
+	endpoint string
+}
+
+func (d discoverAt) RoundTrip(r *http.Request) (*http.Response, error) {
+	if !strings.HasSuffix(r.URL.Path, "/smartapps/endpoints") {
+		return http.DefaultTransport.RoundTrip(r)
+	}
+	body := fmt.Sprintf(`[{"uri": %q}]`, d.endpoint)
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       r,
+	}, nil
+}
+
+func TestCredentialRotation(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	st, err := gosmart.Connect(context.Background(), gosmart.Config{
+		ClientID:   "primary",
+		Secret:     "secret",
+		TokenStore: gosmart.NewMemoryTokenStore(token("a")),
+		Credentials: []gosmart.Credential{{
+			ClientID:   "secondary",
+			Secret:     "secret",
+			Weight:     3,
+			TokenStore: gosmart.NewMemoryTokenStore(token("b")),
+		}},
+		Endpoint:   s.URL,
+		HTTPClient: &http.Client{Transport: discoverAt{s.URL}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := device(t, &st, "1")
+
+	before := len(s.Requests())
+	for i := 0; i < 8; i++ {
+		if err := d.Call("on"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	used := make(map[string]int)
+	for _, r := range s.Requests()[before:] {
+		used[r.Header.Get("Authorization")]++
+	}
+	if used["Bearer a"] != 2 || used["Bearer b"] != 6 || len(used) != 2 {
+		t.Errorf("requests by token = %v, want 2 with a and 6 with b", used)
+	}
+}
@@ -0,0 +1,111 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"encoding/json"
+	"fmt"
+	"golang.org/x/net/context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Scene holds a scene (or routine) defined for the location.
+type Scene struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// GetScenes returns the list of scenes defined for the location.
+func GetScenes(ctx context.Context, client *http.Client, endpoint string) ([]Scene, error) {
+	ret := []Scene{}
+
+	contents, err := issueCommand(ctx, client, endpoint, "/scenes")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(contents, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// ExecuteScene executes the scene with the given ID.
+func ExecuteScene(ctx context.Context, client *http.Client, endpoint string, sceneID string) error {
+	_, err := issueAction(ctx, client, endpoint, "/scenes/"+url.PathEscape(sceneID)+"/execute")
+	return err
+}
+
+// RefreshScenes re-reads the list of scenes returned by SceneList.
+func (st *SmartThings) RefreshScenes() error {
+	return st.RefreshScenesContext(context.Background())
+}
+
+// RefreshScenesContext is like RefreshScenes, but honors ctx.
+func (st *SmartThings) RefreshScenesContext(ctx context.Context) error {
+	if err := st.connected(); err != nil {
+		return err
+	}
+	scenes, err := GetScenes(ctx, st.client, st.endpoint)
+	if err != nil {
+		return err
+	}
+	st.devMu.Lock()
+	st.scenes = scenes
+	st.devMu.Unlock()
+	return nil
+}
+
+// SceneList returns a copy of the scenes read by Connect or RefreshScenes.
+// Empty if the SmartApp does not expose them.
+func (st *SmartThings) SceneList() []Scene {
+	if st.smartThings == nil {
+		return nil
+	}
+	st.devMu.RLock()
+	defer st.devMu.RUnlock()
+	return append([]Scene(nil), st.scenes...)
+}
+
+// RunScene executes the scene whose name matches name (case insensitive),
+// as listed by SceneList. Returns an error if no scene or several scenes
+// match.
+func (st *SmartThings) RunScene(name string) error {
+	return st.RunSceneContext(context.Background(), name)
+}
+
+// RunSceneContext is like RunScene, but honors ctx.
+func (st *SmartThings) RunSceneContext(ctx context.Context, name string) error {
+	if err := st.writable(); err != nil {
+		return err
+	}
+	if err := st.connected(); err != nil {
+		return err
+	}
+	st.devMu.RLock()
+	var found []Scene
+	for _, s := range st.scenes {
+		if strings.EqualFold(s.Name, name) {
+			found = append(found, s)
+		}
+	}
+	st.devMu.RUnlock()
+
+	switch len(found) {
+	case 0:
+		return fmt.Errorf("scene not found: %q", name)
+	case 1:
+		return ExecuteScene(ctx, st.client, st.endpoint, found[0].ID)
+	}
+	var ids []string
+	for _, s := range found {
+		ids = append(ids, s.ID)
+	}
+	return fmt.Errorf("ambiguous scene name %q: matches scenes %s", name, strings.Join(ids, ", "))
+}
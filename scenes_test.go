@@ -0,0 +1,101 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/smoogle/gosmart"
+	"github.com/smoogle/gosmart/gosmarttest"
+	"golang.org/x/net/context"
+)
+
+func TestRunScene(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	s.HandleFunc("/scenes", gosmarttest.JSON([]gosmart.Scene{
+		{ID: "s1", Name: "Movie Time"},
+		{ID: "s2", Name: "Good Night"},
+		{ID: "s3", Name: "good night"},
+	}))
+	for _, id := range []string{"s1", "s2", "s3"} {
+		s.HandleFunc("/scenes/"+id+"/execute", func(http.ResponseWriter, *http.Request) {})
+	}
+	executed := func() []string {
+		var ids []string
+		for _, r := range s.Requests() {
+			if strings.HasSuffix(r.Path, "/execute") {
+				ids = append(ids, strings.Split(r.Path, "/")[2])
+			}
+		}
+		return ids
+	}
+	st, err := gosmart.Connect(context.Background(), gosmart.Config{Endpoint: s.URL, AccessToken: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if scenes := st.SceneList(); len(scenes) != 3 || scenes[0].Name != "Movie Time" {
+		t.Fatalf("SceneList() = %+v, want the 3 scenes read on connect", scenes)
+	}
+	if err := st.RunScene("movie TIME"); err != nil {
+		t.Fatal(err)
+	}
+	if ids := executed(); !reflect.DeepEqual(ids, []string{"s1"}) {
+		t.Errorf("executed scenes %v, want s1", ids)
+	}
+
+	if err := st.RunScene("Good Night"); err == nil || !strings.Contains(err.Error(), "ambiguous") || !strings.Contains(err.Error(), "s2, s3") {
+		t.Errorf("RunScene with an ambiguous name = %v, want both matches listed", err)
+	}
+	if err := st.RunScene("Party"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("RunScene with an unknown name = %v, want not found", err)
+	}
+	if ids := executed(); len(ids) != 1 {
+		t.Errorf("executed scenes %v, want only s1", ids)
+	}
+
+	// The free functions work on any client and endpoint.
+	scenes, err := gosmart.GetScenes(context.Background(), http.DefaultClient, s.URL)
+	if err != nil || len(scenes) != 3 {
+		t.Fatalf("GetScenes() = %v, %v", scenes, err)
+	}
+	if err := gosmart.ExecuteScene(context.Background(), http.DefaultClient, s.URL, "s2"); err != nil {
+		t.Fatal(err)
+	}
+	if ids := executed(); !reflect.DeepEqual(ids, []string{"s1", "s2"}) {
+		t.Errorf("executed scenes %v, want s1 and s2", ids)
+	}
+}
+
+func TestRunSceneContext(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	s.HandleFunc("/scenes", gosmarttest.JSON([]gosmart.Scene{{ID: "a?b", Name: "Odd"}}))
+	var executed bool
+	s.HandleFunc("/scenes/a?b/execute", func(http.ResponseWriter, *http.Request) { executed = true })
+	st := connect(t, s, gosmart.Config{})
+
+	if err := st.RefreshScenesContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// The scene ID is escaped in the path.
+	if err := st.RunSceneContext(context.Background(), "odd"); err != nil || !executed {
+		t.Errorf("RunSceneContext() = %v, scene executed %v", err, executed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := st.RunSceneContext(ctx, "odd"); !errors.Is(err, context.Canceled) {
+		t.Errorf("RunSceneContext with a cancelled context = %v, want context.Canceled", err)
+	}
+	if err := st.RefreshScenesContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("RefreshScenesContext with a cancelled context = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,348 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"encoding/json"
+	"fmt"
+	"golang.org/x/net/context"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParamSchema describes one parameter of a device command, as parsed from
+// the Params field of DeviceCommand.
+type ParamSchema struct {
+	Name string `json:"name"`
+	// Type is the parameter type, in upper case (e.g. "NUMBER", "ENUM").
+	// Blank if the API did not declare one.
+	Type string `json:"type,omitempty"`
+	// Enum lists the allowed values for ENUM parameters.
+	Enum []string `json:"enum,omitempty"`
+	// Min and Max hold the allowed range of numeric parameters, if declared.
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+	// Order is the position of the parameter in the command arguments.
+	Order int `json:"order"`
+	// Optional is true if the parameter may be omitted.
+	Optional bool `json:"optional,omitempty"`
+}
+
+// parseParams converts the Params map of a DeviceCommand into a slice of
+// ParamSchema, sorted by argument order. Each parameter definition may
+// either be a plain type name (e.g. "NUMBER") or an object with "type",
+// "values", "order", range ("range" as [min, max], or "min" and "max") and
+// "optional" (or "required") keys. Parameters are required unless declared
+// otherwise.
+func parseParams(params map[string]interface{}) []ParamSchema {
+	var ret []ParamSchema
+	for name, def := range params {
+		p := ParamSchema{Name: name, Order: len(params)}
+		switch t := def.(type) {
+		case string:
+			p.Type = strings.ToUpper(t)
+		case map[string]interface{}:
+			if s, ok := t["type"].(string); ok {
+				p.Type = strings.ToUpper(s)
+			}
+			if o, ok := t["order"].(float64); ok {
+				p.Order = int(o)
+			}
+			if vals, ok := t["values"].([]interface{}); ok {
+				for _, v := range vals {
+					p.Enum = append(p.Enum, fmt.Sprintf("%v", v))
+				}
+			}
+			if r, ok := t["range"].([]interface{}); ok && len(r) == 2 {
+				p.Min, p.Max = floatPtr(r[0]), floatPtr(r[1])
+			}
+			if v := floatPtr(t["min"]); v != nil {
+				p.Min = v
+			}
+			if v := floatPtr(t["max"]); v != nil {
+				p.Max = v
+			}
+			if o, ok := t["optional"].(bool); ok {
+				p.Optional = o
+			}
+			if r, ok := t["required"].(bool); ok {
+				p.Optional = !r
+			}
+		}
+		ret = append(ret, p)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Order != ret[j].Order {
+			return ret[i].Order < ret[j].Order
+		}
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
+
+// floatPtr returns a pointer to v if it is a number, or nil.
+func floatPtr(v interface{}) *float64 {
+	if f, ok := v.(float64); ok {
+		return &f
+	}
+	return nil
+}
+
+// validate checks value against the parameter's enum options, if any.
+func (p ParamSchema) validate(value string) error {
+	if len(p.Enum) == 0 {
+		return nil
+	}
+	for _, e := range p.Enum {
+		if value == e {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid value %q for parameter %q, expected one of %v", value, p.Name, p.Enum)
+}
+
+// checkRange checks a numeric argument (at position i) of cmd against the
+// range declared by the command schema. If the schema declares no bound,
+// min and max are used instead.
+func (d *Device) checkRange(cmd string, i int, v, min, max float64) error {
+	name := "value"
+	if params := d.paramSchema(cmd); i < len(params) {
+		p := params[i]
+		name = p.Name
+		if p.Min != nil {
+			min = *p.Min
+		}
+		if p.Max != nil {
+			max = *p.Max
+		}
+	}
+	if v < min || v > max {
+		return fmt.Errorf("invalid value %v for parameter %q of command %v, expected %v to %v", v, name, cmd, min, max)
+	}
+	return nil
+}
+
+// CommandParams returns the parameters of cmd, in argument order, as
+// declared by the API. Returns nil if the device does not accept cmd or the
+// API declares no parameters for it.
+func (d *Device) CommandParams(cmd string) []ParamSchema {
+	return append([]ParamSchema(nil), d.paramSchema(cmd)...)
+}
+
+// CommandInfo returns the definition of cmd as reported by the API, with
+// the parameters of all the capabilities defining it merged, and the first
+// of those capabilities. Returns false if the device does not accept cmd.
+func (d *Device) CommandInfo(cmd string) (DeviceCommand, bool) {
+	d.mu.Lock()
+	params, ok := d.params[cmd]
+	d.mu.Unlock()
+	if !ok {
+		return DeviceCommand{}, false
+	}
+	dc := DeviceCommand{Command: cmd, Params: make(map[string]interface{})}
+	for name, def := range params {
+		dc.Params[name] = def
+	}
+	dc.Capability, _ = d.CommandCapability(cmd)
+	return dc, true
+}
+
+// param returns the schema for the named parameter of cmd.
+func (d *Device) param(cmd, name string) (ParamSchema, bool) {
+	for _, p := range d.paramSchema(cmd) {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return ParamSchema{}, false
+}
+
+// CallString issues a command with string arguments, in the order declared
+// by the command schema. Arguments for enum parameters are checked against
+// the allowed values before the request is sent.
+func (d *Device) CallString(cmd string, args ...string) error {
+	return d.CallStringContext(context.Background(), cmd, args...)
+}
+
+// CallStringContext works like CallString, aborting the request when ctx is
+// cancelled.
+func (d *Device) CallStringContext(ctx context.Context, cmd string, args ...string) error {
+	params := d.paramSchema(cmd)
+	for i, a := range args {
+		if i >= len(params) {
+			break
+		}
+		if err := params[i].validate(a); err != nil {
+			return err
+		}
+	}
+	return d.call(ctx, cmd, args, nil, false)
+}
+
+// CallNamed issues a command with named arguments, sent as query parameters.
+// The argument names must be declared by the command schema (when the API
+// provides one) and enum values are checked against the allowed options.
+func (d *Device) CallNamed(cmd string, args map[string]interface{}) error {
+	return d.CallNamedContext(context.Background(), cmd, args)
+}
+
+// CallNamedContext works like CallNamed, aborting the request when ctx is
+// cancelled.
+func (d *Device) CallNamedContext(ctx context.Context, cmd string, args map[string]interface{}) error {
+	query := url.Values{}
+	for name, v := range args {
+		value := fmt.Sprintf("%v", v)
+		if len(d.paramSchema(cmd)) > 0 {
+			p, ok := d.param(cmd, name)
+			if !ok {
+				return fmt.Errorf("unknown parameter %q for command %v", name, cmd)
+			}
+			if err := p.validate(value); err != nil {
+				return err
+			}
+		}
+		query.Set(name, value)
+	}
+	return d.call(ctx, cmd, nil, query, false)
+}
+
+// CallWithArgs issues a command with any number of arguments of mixed types,
+// sent in order as path elements. Strings are sent as is, numbers and
+// booleans are formatted, and other values are sent as JSON. When the API
+// declares the command parameters, the arguments are checked against them
+// (see checkArgs) before the request is sent.
+func (d *Device) CallWithArgs(cmd string, args ...interface{}) error {
+	return d.CallWithArgsContext(context.Background(), cmd, args...)
+}
+
+// CallWithArgsContext works like CallWithArgs, aborting the request when ctx
+// is cancelled.
+func (d *Device) CallWithArgsContext(ctx context.Context, cmd string, args ...interface{}) error {
+	strs, err := d.checkArgs(cmd, args)
+	if err != nil {
+		return err
+	}
+	return d.call(ctx, cmd, strs, nil, false)
+}
+
+// checkArgs formats the arguments of cmd and checks them against the
+// parameters declared by the command schema, if any: the number of
+// arguments (see requiredParams), the type and range of numeric parameters and the values of ENUM
+// parameters. Arguments of integer parameters (see integerParam) must be
+// whole numbers, and are sent without a fractional part.
+func (d *Device) checkArgs(cmd string, args []interface{}) ([]string, error) {
+	params := d.paramSchema(cmd)
+	if len(params) > 0 && len(args) > len(params) {
+		return nil, fmt.Errorf("too many arguments for command %v: got %d, expected at most %d", cmd, len(args), len(params))
+	}
+	if n := requiredParams(params); len(args) < n {
+		return nil, fmt.Errorf("missing arguments for command %v: got %d, expected at least %d", cmd, len(args), n)
+	}
+	var strs []string
+	for i, a := range args {
+		value, numeric, err := formatArg(a)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d of command %v: %v", i+1, cmd, err)
+		}
+		if numeric && d.integerParam(cmd, i) {
+			f, _ := strconv.ParseFloat(value, 64)
+			if f != math.Trunc(f) {
+				return nil, fmt.Errorf("invalid value %v for argument %d of command %v, expected an integer", value, i+1, cmd)
+			}
+			value = strconv.FormatFloat(f, 'f', -1, 64)
+		}
+		if i < len(params) {
+			p := params[i]
+			if p.Type == "NUMBER" || p.Type == "DECIMAL" || p.Type == "INTEGER" {
+				if !numeric {
+					return nil, fmt.Errorf("invalid value %q for parameter %q, expected a number", value, p.Name)
+				}
+				f, _ := strconv.ParseFloat(value, 64)
+				if (p.Min != nil && f < *p.Min) || (p.Max != nil && f > *p.Max) {
+					return nil, fmt.Errorf("invalid value %v for parameter %q of command %v, expected %v to %v", value, p.Name, cmd, bound(p.Min), bound(p.Max))
+				}
+			}
+			if err := p.validate(value); err != nil {
+				return nil, err
+			}
+		}
+		strs = append(strs, value)
+	}
+	return strs, nil
+}
+
+// requiredParams returns the number of leading arguments that must be given
+// for params: all of them up to the last parameter not declared optional.
+func requiredParams(params []ParamSchema) int {
+	for i := len(params) - 1; i >= 0; i-- {
+		if !params[i].Optional {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// integerCommands lists the commands known to take an integer first
+// argument, used when the API does not declare the parameter type.
+var integerCommands = map[string]bool{
+	"setLevel":            true,
+	"setColorTemperature": true,
+}
+
+// integerParam returns true if argument i of cmd must be an integer: the
+// parameter is declared as INTEGER by the command schema or, when the schema
+// does not declare its type, cmd is listed in integerCommands.
+func (d *Device) integerParam(cmd string, i int) bool {
+	if params := d.paramSchema(cmd); i < len(params) && params[i].Type != "" {
+		return params[i].Type == "INTEGER"
+	}
+	return i == 0 && integerCommands[cmd]
+}
+
+// checkFloatArgs checks numeric arguments of cmd against the command schema,
+// as checkArgs does.
+func (d *Device) checkFloatArgs(cmd string, args []float64) error {
+	var iargs []interface{}
+	for _, a := range args {
+		iargs = append(iargs, a)
+	}
+	_, err := d.checkArgs(cmd, iargs)
+	return err
+}
+
+// bound formats an optional range bound for error messages.
+func bound(v *float64) string {
+	if v == nil {
+		return "any"
+	}
+	return strconv.FormatFloat(*v, 'f', -1, 64)
+}
+
+// formatArg formats a command argument, and reports whether it is a number.
+func formatArg(a interface{}) (string, bool, error) {
+	switch t := a.(type) {
+	case string:
+		_, err := strconv.ParseFloat(t, 64)
+		return t, err == nil, nil
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64), true, nil
+	case float32:
+		return strconv.FormatFloat(float64(t), 'f', -1, 32), true, nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprintf("%d", t), true, nil
+	case bool:
+		return strconv.FormatBool(t), false, nil
+	}
+	b, err := json.Marshal(a)
+	if err != nil {
+		return "", false, err
+	}
+	return string(b), false, nil
+}
@@ -0,0 +1,119 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/smoogle/gosmart"
+	"github.com/smoogle/gosmart/gosmarttest"
+)
+
+// modeThermostat returns a thermostat fixture accepting setThermostatMode
+// with an enum argument.
+func modeThermostat(id string) gosmarttest.Device {
+	d := thermostat(id)
+	d.Commands = append(d.Commands, gosmart.DeviceCommand{
+		Command:    "setThermostatMode",
+		Capability: "Thermostat Mode",
+		Params: map[string]interface{}{
+			"mode": map[string]interface{}{"type": "ENUM", "values": []interface{}{"heat", "cool", "auto", "off"}},
+		},
+	})
+	return d
+}
+
+func TestCallStringEnum(t *testing.T) {
+	s := newServer(t, modeThermostat("1"))
+	st := connect(t, s, gosmart.Config{})
+	d := device(t, st, "1")
+
+	before := len(s.Calls())
+	err := d.CallString("setThermostatMode", "sauna")
+	if err == nil || !strings.Contains(err.Error(), `invalid value "sauna"`) || !strings.Contains(err.Error(), "[heat cool auto off]") {
+		t.Errorf("CallString with an invalid value = %v, want the allowed values listed", err)
+	}
+	if err := d.CallNamed("setThermostatMode", map[string]interface{}{"mode": "sauna"}); err == nil {
+		t.Error("CallNamed accepted an invalid enum value")
+	}
+	if n := len(s.Calls()) - before; n != 0 {
+		t.Errorf("%d invalid commands reached the server", n)
+	}
+
+	if err := d.CallString("setThermostatMode", "cool"); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if mode := d.StringAttributes()["thermostatMode"]; mode != "cool" {
+		t.Errorf("thermostatMode = %q, want cool", mode)
+	}
+}
+
+func TestCallNamedUnknownParam(t *testing.T) {
+	s := newServer(t, modeThermostat("1"))
+	st := connect(t, s, gosmart.Config{})
+	if err := device(t, st, "1").CallNamed("setThermostatMode", map[string]interface{}{"fan": "on"}); err == nil {
+		t.Error("CallNamed accepted an undeclared parameter")
+	}
+}
+
+func TestCallWithArgsSchema(t *testing.T) {
+	dev := lamp("1")
+	dev.Commands[2].Params["level"].(map[string]interface{})["order"] = 0.0
+	dev.Commands[2].Params["rate"] = map[string]interface{}{"type": "NUMBER", "order": 1.0, "optional": true}
+	dev.Commands = append(dev.Commands, gosmart.DeviceCommand{
+		Command:    "setHueSaturation",
+		Capability: "Color Control",
+		Params: map[string]interface{}{
+			"hue":        map[string]interface{}{"type": "NUMBER", "order": 0.0},
+			"saturation": map[string]interface{}{"type": "NUMBER", "order": 1.0},
+		},
+	})
+	s := newServer(t, dev)
+	st := connect(t, s, gosmart.Config{})
+	d := device(t, st, "1")
+
+	for _, tc := range []struct {
+		cmd  string
+		args []interface{}
+		want string
+	}{
+		{"setLevel", nil, "missing arguments"},
+		{"setHueSaturation", []interface{}{50}, "missing arguments"},
+		{"setLevel", []interface{}{40, 2, 3}, "too many arguments"},
+		{"setLevel", []interface{}{150}, `invalid value 150 for parameter "level"`},
+		{"setLevel", []interface{}{"high"}, "expected a number"},
+	} {
+		err := d.CallWithArgs(tc.cmd, tc.args...)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("CallWithArgs(%v, %v) = %v, want %q", tc.cmd, tc.args, err, tc.want)
+		}
+	}
+	if err := d.Call("setLevel"); err == nil {
+		t.Error("Call accepted a command without its required argument")
+	}
+	if n := len(s.Calls()); n != 0 {
+		t.Errorf("%d invalid commands reached the server", n)
+	}
+
+	// Optional parameters may be left out.
+	if err := d.CallWithArgs("setLevel", 40); err != nil {
+		t.Error(err)
+	}
+	if err := d.CallWithArgs("setLevel", 60, 2); err != nil {
+		t.Error(err)
+	}
+	if err := d.CallWithArgs("setHueSaturation", 50, 100); err != nil {
+		t.Error(err)
+	}
+	if n := len(s.Calls()); n != 3 {
+		t.Errorf("server received %d commands, want 3", n)
+	}
+}
@@ -0,0 +1,140 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"strings"
+)
+
+// Selector selects devices by combining filters. Each filter narrows the
+// set of devices returned by Devices:
+//
+//	low := st.Select().WithAttribute("motion").InRoom("Basement").WhereAttrBelow("battery", 20).Devices()
+type Selector struct {
+	st      *SmartThings
+	filters []func(*Device) bool
+	rooms   []string
+}
+
+// Select returns a Selector matching all devices.
+func (st *SmartThings) Select() *Selector {
+	return &Selector{st: st}
+}
+
+// Where keeps the devices for which fn returns true.
+func (s *Selector) Where(fn func(*Device) bool) *Selector {
+	s.filters = append(s.filters, fn)
+	return s
+}
+
+// WithCommand keeps the devices accepting cmd.
+func (s *Selector) WithCommand(cmd string) *Selector {
+	return s.Where(func(d *Device) bool { return d.HasCommand(cmd) })
+}
+
+// WithCapability keeps the devices with the given capability (see
+// DevicesWithCapability).
+func (s *Selector) WithCapability(capability string) *Selector {
+	return s.Where(func(d *Device) bool { return d.HasCapability(capability) })
+}
+
+// WithAttribute keeps the devices reporting the named attribute.
+func (s *Selector) WithAttribute(name string) *Selector {
+	return s.Where(func(d *Device) bool { return d.hasAttribute(name) })
+}
+
+// WhereAttrBelow keeps the devices with a numeric attribute below value.
+func (s *Selector) WhereAttrBelow(name string, value float64) *Selector {
+	return s.Where(func(d *Device) bool {
+		v, ok := d.reading(name)
+		return ok && v < value
+	})
+}
+
+// WhereAttrAbove keeps the devices with a numeric attribute above value.
+func (s *Selector) WhereAttrAbove(name string, value float64) *Selector {
+	return s.Where(func(d *Device) bool {
+		v, ok := d.reading(name)
+		return ok && v > value
+	})
+}
+
+// WhereAttrEquals keeps the devices with a string attribute equal to value.
+func (s *Selector) WhereAttrEquals(name, value string) *Selector {
+	return s.Where(func(d *Device) bool {
+		v, ok := d.stringAttribute(name)
+		return ok && v == value
+	})
+}
+
+// InRoom keeps the devices in the given room, matched by room ID or by name
+// (case insensitive). Multiple InRoom filters all apply, so they only make
+// sense when naming the same room.
+func (s *Selector) InRoom(room string) *Selector {
+	s.rooms = append(s.rooms, room)
+	return s
+}
+
+// Devices returns the devices matching all filters, in the order of
+// DeviceList. Room names are resolved by reading the room list; if it
+// cannot be read, rooms are matched by ID only.
+func (s *Selector) Devices() []*Device {
+	filters := append([]func(*Device) bool(nil), s.filters...)
+	if len(s.rooms) > 0 {
+		names := make(map[string]string)
+		if rooms, err := s.st.Rooms(); err == nil {
+			for _, r := range rooms {
+				names[r.ID] = r.Name
+			}
+		}
+		for _, room := range s.rooms {
+			room := room
+			filters = append(filters, func(d *Device) bool {
+				id := d.RoomID()
+				return id != "" && (id == room || strings.EqualFold(names[id], room))
+			})
+		}
+	}
+
+	var ret []*Device
+next:
+	for _, d := range s.st.DeviceList() {
+		for _, f := range filters {
+			if !f(d) {
+				continue next
+			}
+		}
+		ret = append(ret, d)
+	}
+	return ret
+}
+
+// DevicesWithCommand returns the devices accepting cmd.
+func (st *SmartThings) DevicesWithCommand(cmd string) []*Device {
+	return st.Select().WithCommand(cmd).Devices()
+}
+
+// DevicesWithCapability returns the devices with the given capability
+// (e.g. "Switch Level"), as reported by Device.Capabilities. The match
+// ignores case and spaces.
+func (st *SmartThings) DevicesWithCapability(capability string) []*Device {
+	return st.Select().WithCapability(capability).Devices()
+}
+
+// DevicesInRoom returns the devices assigned to the room with the given ID
+// (see Device.RoomID), in the order of DeviceList. A blank ID returns the
+// devices not assigned to a room. Use Select().InRoom to match rooms by
+// name.
+func (st *SmartThings) DevicesInRoom(roomID string) []*Device {
+	var ret []*Device
+	for _, d := range st.DeviceList() {
+		if d.RoomID() == roomID {
+			ret = append(ret, d)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,163 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/smoogle/gosmart"
+	"github.com/smoogle/gosmart/gosmarttest"
+)
+
+// deviceIDs returns the IDs of devices, in order.
+func deviceIDs(devices []*gosmart.Device) []string {
+	var ret []string
+	for _, d := range devices {
+		ret = append(ret, d.ID)
+	}
+	return ret
+}
+
+func TestDevicesWithCommand(t *testing.T) {
+	s := newServer(t, lamp("1"), thermostat("2"), frontDoor("3"), lamp("4"))
+	st := connect(t, s, gosmart.Config{})
+
+	cases := map[string][]string{
+		"setLevel": {"1", "4"},
+		"heat":     {"2"},
+		"lock":     {"3"},
+		"open":     nil,
+	}
+	for cmd, want := range cases {
+		if got := deviceIDs(st.DevicesWithCommand(cmd)); !reflect.DeepEqual(got, want) {
+			t.Errorf("DevicesWithCommand(%q) = %q, want %q", cmd, got, want)
+		}
+	}
+
+	// The devices returned can be controlled directly.
+	for _, d := range st.DevicesWithCommand("on") {
+		if err := d.Call("on"); err != nil {
+			t.Error(err)
+		}
+	}
+	if n := len(s.Calls()); n != 2 {
+		t.Errorf("server received %d calls, want 2", n)
+	}
+}
+
+func TestDevicesWithCapability(t *testing.T) {
+	// The sensor has no commands, and only reports its capabilities with
+	// the device details.
+	sensor := reporting("5", 0, time.Time{})
+	sensor.Capabilities = []gosmart.Capability{{ID: "temperatureMeasurement"}, {ID: "battery"}}
+	door := frontDoor("3")
+	door.Capabilities = []gosmart.Capability{{ID: "battery"}}
+	s := newServer(t, lamp("1"), thermostat("2"), door, lamp("4"), sensor)
+	st := connect(t, s, gosmart.Config{})
+
+	cases := map[string][]string{
+		"Switch Level":            {"1", "4"},
+		"switchlevel":             {"1", "4"},
+		"Lock":                    {"3"},
+		"Battery":                 {"3", "5"},
+		"Temperature Measurement": {"5"},
+		"Color Control":           nil,
+	}
+	for capability, want := range cases {
+		if got := deviceIDs(st.DevicesWithCapability(capability)); !reflect.DeepEqual(got, want) {
+			t.Errorf("DevicesWithCapability(%q) = %q, want %q", capability, got, want)
+		}
+	}
+}
+
+func TestDevicesWithCapabilityVersion(t *testing.T) {
+	old, current := lamp("1"), lamp("2")
+	old.Capabilities = []gosmart.Capability{{ID: "switch", Version: 1}}
+	current.Capabilities = []gosmart.Capability{{ID: "switch", Version: 3}}
+	s := newServer(t, old, current, lamp("3"))
+	// Versions may be reported as strings, and capabilities as plain names.
+	s.HandleFunc("/devices/4", gosmarttest.JSON(map[string]interface{}{
+		"id":           "4",
+		"name":         "Switch 4",
+		"capabilities": []interface{}{map[string]interface{}{"id": "switch", "version": "v2"}, "refresh"},
+	}))
+	s.AddDevice(gosmarttest.Device{ID: "4", Name: "Switch 4"})
+	st := connect(t, s, gosmart.Config{})
+
+	cases := map[int][]string{
+		0: {"1", "2", "4"},
+		1: {"1", "2", "4"},
+		2: {"2", "4"},
+		3: {"2"},
+		4: nil,
+	}
+	for min, want := range cases {
+		if got := deviceIDs(st.DevicesWithCapabilityVersion("Switch", min)); !reflect.DeepEqual(got, want) {
+			t.Errorf("DevicesWithCapabilityVersion(Switch, %d) = %q, want %q", min, got, want)
+		}
+	}
+	if v, ok := device(t, st, "4").CapabilityVersion("refresh"); !ok || v != 1 {
+		t.Errorf("CapabilityVersion(refresh) = %d, %v; want version 1 for a plain name", v, ok)
+	}
+	if got := st.DevicesWithCapabilityVersion("lock", 1); len(got) != 0 {
+		t.Errorf("DevicesWithCapabilityVersion(lock) = %q, want none", deviceIDs(got))
+	}
+}
+
+func TestSelect(t *testing.T) {
+	battery := func(d gosmarttest.Device, level float64, room string) gosmarttest.Device {
+		d.Attributes["battery"] = level
+		d.RoomID = room
+		return d
+	}
+	s := newServer(t,
+		battery(lamp("1"), 10, "b1"),
+		battery(lamp("2"), 50, "b1"),
+		battery(lamp("3"), 5, "h1"),
+		battery(sensor("4", map[string]interface{}{"motion": "inactive"}), 10, "b1"),
+		lamp("5"),
+	)
+	s.HandleFunc("/rooms", gosmarttest.JSON([]gosmart.Room{{ID: "b1", Name: "Basement"}, {ID: "h1", Name: "Hall"}}))
+	st := connect(t, s, gosmart.Config{})
+
+	cases := []struct {
+		name string
+		sel  *gosmart.Selector
+		want []string
+	}{
+		{"all", st.Select(), []string{"1", "2", "3", "4", "5"}},
+		{"command", st.Select().WithCommand("on"), []string{"1", "2", "3", "5"}},
+		{"room name", st.Select().InRoom("basement"), []string{"1", "2", "4"}},
+		{"room ID", st.Select().InRoom("h1"), []string{"3"}},
+		{"command and room", st.Select().WithCommand("on").InRoom("basement"), []string{"1", "2"}},
+		{"command, room and battery", st.Select().WithCommand("on").InRoom("basement").WhereAttrBelow("battery", 20), []string{"1"}},
+		{"attribute and room", st.Select().WithAttribute("motion").InRoom("Basement"), []string{"4"}},
+		{"above", st.Select().WhereAttrAbove("battery", 5), []string{"1", "2", "4"}},
+		{"equals", st.Select().WhereAttrEquals("switch", "off").WhereAttrBelow("battery", 20), []string{"1", "3"}},
+		{"no match", st.Select().WithCommand("on").InRoom("attic"), nil},
+	}
+	for _, c := range cases {
+		if got := deviceIDs(c.sel.Devices()); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: Devices() = %q, want %q", c.name, got, c.want)
+		}
+	}
+
+	// Without the room list, rooms only match by ID.
+	s.HandleFunc("/rooms", func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	})
+	st = connect(t, s, gosmart.Config{})
+	if got := deviceIDs(st.Select().InRoom("Basement").Devices()); got != nil {
+		t.Errorf("InRoom(Basement) without rooms = %q, want none", got)
+	}
+	if got := deviceIDs(st.Select().InRoom("b1").WithCommand("on").Devices()); !reflect.DeepEqual(got, []string{"1", "2"}) {
+		t.Errorf("InRoom(b1) without rooms = %q, want [1 2]", got)
+	}
+}
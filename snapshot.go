@@ -0,0 +1,89 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// Maximum number of attributes shown by Device.String.
+	stringAttributes = 8
+)
+
+// deviceJSON is the JSON representation of a device.
+type deviceJSON struct {
+	ID          string                 `json:"id"`
+	Name        string                 `json:"name"`
+	DisplayName string                 `json:"displayName"`
+	Commands    []string               `json:"commands"`
+	Attributes  map[string]interface{} `json:"attributes"`
+}
+
+// String returns a short description of the device: its display name, ID,
+// number of commands and (some of) its attributes, sorted by name.
+func (d *Device) String() string {
+	attrs := d.StringAttributes()
+	var names []string
+	for k := range attrs {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var kv []string
+	for i, k := range names {
+		if i == stringAttributes {
+			kv = append(kv, "...")
+			break
+		}
+		kv = append(kv, k+"="+attrs[k])
+	}
+	_, displayName := d.Names()
+	return fmt.Sprintf("%s (%s): %d commands [%s]", displayName, d.ID, len(d.CommandList()), strings.Join(kv, " "))
+}
+
+// MarshalJSON encodes the device as an object holding its ID, name, display
+// name, commands and raw attributes.
+func (d *Device) MarshalJSON() ([]byte, error) {
+	cmds := d.CommandList()
+	if cmds == nil {
+		cmds = []string{}
+	}
+	name, displayName := d.Names()
+	return json.Marshal(deviceJSON{
+		ID:          d.ID,
+		Name:        name,
+		DisplayName: displayName,
+		Commands:    cmds,
+		Attributes:  d.RawAttributes(),
+	})
+}
+
+// UnmarshalJSON restores a device encoded by MarshalJSON. The restored
+// device is a detached snapshot: it is not bound to a SmartThings
+// connection, so methods sending requests (Refresh, Call, Events and the
+// like) return ErrNotConnected.
+func (d *Device) UnmarshalJSON(b []byte) error {
+	var dj deviceJSON
+	if err := json.Unmarshal(b, &dj); err != nil {
+		return err
+	}
+	if dj.Attributes == nil {
+		dj.Attributes = make(map[string]interface{})
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.ID, d.Name, d.DisplayName = dj.ID, dj.Name, dj.DisplayName
+	d.Commands = dj.Commands
+	d.raw = dj.Attributes
+	d.attributes = numericAttributes(dj.Attributes, nil, DefaultTruthyValues, nil)
+	d.tempUnit = attributesUnit(dj.Attributes, nil)
+	return nil
+}
@@ -0,0 +1,137 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smoogle/gosmart"
+	"github.com/smoogle/gosmart/gosmarttest"
+	"golang.org/x/net/context"
+)
+
+func TestDeviceJSONRoundTrip(t *testing.T) {
+	attrs := map[string]interface{}{
+		"switch":      "on",
+		"level":       40.0,
+		"temperature": 21.5,
+	}
+	s := newServer(t, gosmarttest.Device{
+		ID:          "1",
+		Name:        "lamp",
+		DisplayName: "Desk Lamp",
+		Attributes:  attrs,
+		Commands:    lamp("1").Commands,
+	})
+	st := connect(t, s, gosmart.Config{})
+	d := device(t, st, "1")
+
+	b, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got gosmart.Device
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != "1" {
+		t.Errorf("restored ID = %q, want 1", got.ID)
+	}
+	if name, displayName := got.Names(); name != "lamp" || displayName != "Desk Lamp" {
+		t.Errorf("restored names = %q, %q", name, displayName)
+	}
+	if !reflect.DeepEqual(got.CommandList(), d.CommandList()) {
+		t.Errorf("restored commands = %q, want %q", got.CommandList(), d.CommandList())
+	}
+	if !reflect.DeepEqual(got.RawAttributes(), attrs) {
+		t.Errorf("restored attributes = %v, want %v", got.RawAttributes(), attrs)
+	}
+	if got.Attribute("switch") != 1 || got.Attribute("level") != 40 {
+		t.Errorf("restored numeric attributes = %v", got.Attributes())
+	}
+	if got.String() != d.String() {
+		t.Errorf("restored String() = %q, want %q", got.String(), d.String())
+	}
+
+	// Encoding the restored device gives the same JSON.
+	b2, err := json.Marshal(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b2) != string(b) {
+		t.Errorf("re-encoded device = %s, want %s", b2, b)
+	}
+}
+
+func TestDeviceString(t *testing.T) {
+	attrs := map[string]interface{}{"switch": "on"}
+	for i := 0; i < 10; i++ {
+		attrs[string(rune('a'+i))] = float64(i)
+	}
+	s := newServer(t, gosmarttest.Device{ID: "1", DisplayName: "Lamp", Attributes: attrs})
+	d := device(t, connect(t, s, gosmart.Config{}), "1")
+
+	str := d.String()
+	if !strings.HasPrefix(str, "Lamp (1): 0 commands [a=0 b=1 ") || !strings.HasSuffix(str, " ...]") {
+		t.Errorf("String() = %q", str)
+	}
+}
+
+func TestDetachedDevice(t *testing.T) {
+	var d gosmart.Device
+	if err := json.Unmarshal([]byte(`{"id": "1", "commands": ["on", "off"], "attributes": {"switch": "on"}}`), &d); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	calls := map[string]func() error{
+		"Refresh":         func() error { return d.Refresh() },
+		"ForceRefresh":    func() error { return d.ForceRefresh() },
+		"Info":            func() error { _, err := d.Info(); return err },
+		"Events":          func() error { _, err := d.Events(10); return err },
+		"EventsSince":     func() error { _, err := d.EventsSince("switch", time.Now()); return err },
+		"Health":          func() error { _, err := d.Health(); return err },
+		"Presentation":    func() error { _, err := d.Presentation(); return err },
+		"CustomData":      func() error { _, err := d.CustomData(); return err },
+		"SetCustomData":   func() error { return d.SetCustomData("k", 1) },
+		"Preferences":     func() error { _, err := d.Preferences(); return err },
+		"SetPreference":   func() error { return d.SetPreference("k", 1) },
+		"RefreshCommands": func() error { return d.RefreshCommands() },
+		"Call":            func() error { return d.Call("on") },
+		"CallString":      func() error { return d.CallString("on") },
+		"CallNamed":       func() error { return d.CallNamed("on", nil) },
+		"CallResult":      func() error { _, err := d.CallResult("on"); return err },
+		"CallSticky":      func() error { return d.CallSticky(ctx, "on", "switch", "on", 1) },
+		"Watch":           func() error { _, err := d.Watch(ctx, time.Second); return err },
+	}
+	for name, call := range calls {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("%s panicked on a detached device: %v", name, r)
+				}
+			}()
+			if err := call(); !errors.Is(err, gosmart.ErrNotConnected) {
+				t.Errorf("%s on a detached device = %v, want ErrNotConnected", name, err)
+			}
+		}()
+	}
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				t.Errorf("EnergyUsage panicked on a detached device: %v", r)
+			}
+		}()
+		if _, ok := d.EnergyUsage(time.Hour); ok {
+			t.Error("EnergyUsage on a detached device succeeded")
+		}
+	}()
+}
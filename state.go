@@ -0,0 +1,202 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/net/context"
+	"time"
+)
+
+const (
+	// How often ApplyAndConfirm re-reads devices while waiting.
+	confirmPollInterval = time.Second
+)
+
+// DesiredState describes a command to send to a device and the attribute
+// value expected once the command takes effect.
+type DesiredState struct {
+	DeviceID  string
+	Command   string
+	Args      []float64
+	Attribute string
+	Value     float64
+}
+
+// ApplyState issues the command in each desired state. It returns one error
+// per state, in the same order (nil for the commands sent successfully), so
+// several states on the same device are reported separately.
+func (st *SmartThings) ApplyState(states []DesiredState) []error {
+	return st.ApplyStateContext(context.Background(), states)
+}
+
+// ApplyStateContext works like ApplyState, aborting the requests when ctx is
+// cancelled.
+func (st *SmartThings) ApplyStateContext(ctx context.Context, states []DesiredState) []error {
+	errs := make([]error, len(states))
+	if err := st.connected(); err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+	ctx = st.withRetryBudget(ctx)
+	for i, s := range states {
+		d := st.deviceByID(s.DeviceID)
+		if d == nil {
+			errs[i] = fmt.Errorf("%w: %v", ErrDeviceNotFound, s.DeviceID)
+			continue
+		}
+		errs[i] = d.CallContext(ctx, s.Command, s.Args...)
+	}
+	return errs
+}
+
+// ApplyAndConfirm applies the desired states and polls the devices until
+// each attribute reflects the expected value, or until timeout expires (or
+// ctx is done). It returns the states that failed to converge, in the order
+// given, including those whose command could not be sent and those whose
+// device is no longer known. The error wraps the first command error, if
+// any.
+func (st *SmartThings) ApplyAndConfirm(ctx context.Context, states []DesiredState, timeout time.Duration) ([]DesiredState, error) {
+	if err := st.connected(); err != nil {
+		return states, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// Pending and failed hold the indexes of the states not yet confirmed
+	// and of those that cannot be.
+	pending := make(map[int]bool)
+	failed := make(map[int]bool)
+	var sendErr error
+	for i, err := range st.ApplyStateContext(ctx, states) {
+		if err != nil {
+			failed[i] = true
+			if sendErr == nil {
+				sendErr = err
+			}
+		} else {
+			pending[i] = true
+		}
+	}
+
+	ticker := time.NewTicker(confirmPollInterval)
+	defer ticker.Stop()
+
+loop:
+	for len(pending) > 0 {
+		// Each device is read once per round, however many of its
+		// attributes are pending.
+		read := make(map[string]bool)
+		for i := range pending {
+			s := states[i]
+			d := st.deviceByID(s.DeviceID)
+			if d == nil {
+				delete(pending, i)
+				failed[i] = true
+				continue
+			}
+			ok, seen := read[s.DeviceID]
+			if !seen {
+				ok = d.RefreshContext(ctx) == nil
+				read[s.DeviceID] = ok
+			}
+			if ok && d.Attribute(s.Attribute) == s.Value {
+				delete(pending, i)
+			}
+		}
+		if len(pending) == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-ticker.C:
+		}
+	}
+
+	var ret []DesiredState
+	for i, s := range states {
+		if failed[i] || pending[i] {
+			ret = append(ret, s)
+		}
+	}
+	if len(ret) == 0 {
+		return nil, nil
+	}
+	if sendErr != nil {
+		return ret, fmt.Errorf("%d state(s) failed to converge: %w", len(ret), sendErr)
+	}
+	return ret, fmt.Errorf("%d state(s) failed to converge", len(ret))
+}
+
+// deviceByID returns the device with the given ID, or nil if not found.
+func (st *SmartThings) deviceByID(id string) *Device {
+	for _, d := range st.DeviceList() {
+		if d.ID == id {
+			return d
+		}
+	}
+	return nil
+}
+
+// Snapshot is a set of desired device states, as reconciled by Reconcile.
+type Snapshot []DesiredState
+
+// Reconcile keeps the devices in the desired state until ctx is cancelled.
+// Every interval (and once when called) it refreshes all devices and, for
+// each desired state whose attribute does not hold the expected value, issues
+// the command again. OnCorrect, if not nil, is called after each correction
+// with the state corrected and the error returned by the command, if any.
+// Refresh errors skip the round. Reconcile blocks until ctx is cancelled and
+// returns ctx.Err().
+func (st *SmartThings) Reconcile(ctx context.Context, desired Snapshot, interval time.Duration, onCorrect func(DesiredState, error)) error {
+	if interval <= 0 {
+		return errors.New("reconcile interval must be positive")
+	}
+	if err := st.connected(); err != nil {
+		return err
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := st.RefreshContext(ctx); err == nil {
+			st.reconcile(ctx, desired, onCorrect)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// reconcile corrects the drift from the desired states once.
+func (st *SmartThings) reconcile(ctx context.Context, desired Snapshot, onCorrect func(DesiredState, error)) {
+	ctx = st.withRetryBudget(ctx)
+	for _, s := range desired {
+		var err error
+		d := st.deviceByID(s.DeviceID)
+		if d == nil {
+			err = fmt.Errorf("%w: %v", ErrDeviceNotFound, s.DeviceID)
+		} else {
+			if d.Attribute(s.Attribute) == s.Value {
+				continue
+			}
+			// The correction must not be suppressed as a duplicate of the
+			// command that set the state in the first place.
+			d.forgetCall()
+			err = d.CallContext(ctx, s.Command, s.Args...)
+		}
+		if onCorrect != nil {
+			onCorrect(s, err)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/smoogle/gosmart"
+	"github.com/smoogle/gosmart/gosmarttest"
+	"golang.org/x/net/context"
+)
+
+func TestApplyState(t *testing.T) {
+	s := newServer(t, lamp("1"), thermostat("2"))
+	st := connect(t, s, gosmart.Config{})
+	errs := st.ApplyState([]gosmart.DesiredState{
+		{DeviceID: "2", Command: "setHeatingSetpoint", Args: []float64{21}},
+		{DeviceID: "9", Command: "on"},
+		{DeviceID: "2", Command: "setCoolingSetpoint", Args: []float64{25}},
+	})
+	if len(errs) != 3 || errs[0] != nil || errs[2] != nil || !errors.Is(errs[1], gosmart.ErrDeviceNotFound) {
+		t.Fatalf("ApplyState returned %v", errs)
+	}
+	if len(s.Calls()) != 2 {
+		t.Errorf("server received %+v, want both setpoints", s.Calls())
+	}
+}
+
+func TestApplyAndConfirm(t *testing.T) {
+	s := newServer(t, lamp("1"), thermostat("2"), lamp("3"))
+	// Lamp 3 ignores its level changes.
+	s.Handle("setLevel", func(*gosmarttest.Device, []string, url.Values) {})
+	st := connect(t, s, gosmart.Config{})
+
+	states := []gosmart.DesiredState{
+		{DeviceID: "1", Command: "on", Attribute: "switch", Value: 1},
+		{DeviceID: "2", Command: "setHeatingSetpoint", Args: []float64{21}, Attribute: "heatingSetpoint", Value: 21},
+		{DeviceID: "2", Command: "setCoolingSetpoint", Args: []float64{25}, Attribute: "coolingSetpoint", Value: 25},
+		{DeviceID: "3", Command: "setLevel", Args: []float64{50}, Attribute: "level", Value: 50},
+		{DeviceID: "9", Command: "on", Attribute: "switch", Value: 1},
+	}
+	failed, err := st.ApplyAndConfirm(context.Background(), states, 100*time.Millisecond)
+	if err == nil {
+		t.Error("ApplyAndConfirm returned no error with states failing to converge")
+	}
+	if want := []gosmart.DesiredState{states[3], states[4]}; !reflect.DeepEqual(failed, want) {
+		t.Errorf("failed states = %+v, want %+v", failed, want)
+	}
+	d := device(t, st, "2")
+	if d.Attribute("heatingSetpoint") != 21 || d.Attribute("coolingSetpoint") != 25 {
+		t.Errorf("thermostat setpoints are %v", d.Attributes())
+	}
+
+	failed, err = st.ApplyAndConfirm(context.Background(), states[:3], time.Second)
+	if err != nil || len(failed) != 0 {
+		t.Errorf("converging states returned %v, %v", failed, err)
+	}
+}
+
+func TestApplyAndConfirmTimeout(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	st := connect(t, s, gosmart.Config{})
+	s.SetDelay(time.Minute)
+
+	start := time.Now()
+	states := []gosmart.DesiredState{{DeviceID: "1", Command: "on", Attribute: "switch", Value: 1}}
+	failed, err := st.ApplyAndConfirm(context.Background(), states, 50*time.Millisecond)
+	if err == nil || len(failed) != 1 {
+		t.Errorf("hung command returned %v, %v", failed, err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("ApplyAndConfirm took %v, the timeout did not stop the request", elapsed)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	s := newServer(t, lamp("1"), lamp("2"))
+	st := connect(t, s, gosmart.Config{})
+	desired := gosmart.Snapshot{
+		{DeviceID: "1", Command: "setLevel", Args: []float64{50}, Attribute: "level", Value: 50},
+		{DeviceID: "9", Command: "on", Attribute: "switch", Value: 1},
+	}
+	if err := st.Reconcile(context.Background(), desired, 0, nil); err == nil {
+		t.Error("Reconcile accepted a zero interval")
+	}
+
+	corrections := make(chan gosmart.DesiredState, 100)
+	var missing int32
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- st.Reconcile(ctx, desired, 10*time.Millisecond, func(ds gosmart.DesiredState, err error) {
+			if ds.DeviceID == "9" {
+				if errors.Is(err, gosmart.ErrDeviceNotFound) {
+					atomic.AddInt32(&missing, 1)
+				}
+				return
+			}
+			if err != nil {
+				t.Error(err)
+			}
+			corrections <- ds
+		})
+	}()
+	level := func() interface{} {
+		v, _ := s.Attribute("1", "level")
+		return v
+	}
+
+	// The first round corrects the initial state.
+	<-corrections
+	waitFor(t, "the initial correction", func() bool { return level() == 50.0 })
+
+	// A later external change is corrected on the next tick.
+	s.SetAttribute("1", "level", 10.0)
+	select {
+	case c := <-corrections:
+		if c.Command != "setLevel" {
+			t.Errorf("corrected with %+v", c)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("drift not corrected")
+	}
+	waitFor(t, "the drift correction", func() bool { return level() == 50.0 })
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Reconcile() = %v, want context.Canceled", err)
+	}
+	if atomic.LoadInt32(&missing) == 0 {
+		t.Error("missing device not reported")
+	}
+	// Only the drifting lamp received commands.
+	for _, c := range s.Calls() {
+		if c.DeviceID != "1" || c.Command != "setLevel" {
+			t.Errorf("server received %+v", c)
+		}
+	}
+	if n := len(s.Calls()); n != 2 {
+		t.Errorf("server received %d commands, want 2 corrections", n)
+	}
+}
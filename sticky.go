@@ -0,0 +1,55 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"fmt"
+	"golang.org/x/net/context"
+	"time"
+)
+
+const (
+	// How long CallSticky waits after each command before verifying it.
+	stickyDelay = confirmPollInterval
+)
+
+// CallSticky issues a command and verifies that verifyAttr reports
+// verifyValue once the command settles, re-issuing the command up to
+// maxAttempts times if the state did not stick. This helps with flaky RF
+// devices that sometimes miss or revert a command. VerifyValue is formatted
+// like a command argument (e.g. "on", 75) and compared to the attribute
+// string value. Returns an error if the state never sticks.
+func (d *Device) CallSticky(ctx context.Context, cmd, verifyAttr string, verifyValue interface{}, maxAttempts int, args ...float64) error {
+	want, _, err := formatArg(verifyValue)
+	if err != nil {
+		return err
+	}
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	var got string
+	for i := 0; i < maxAttempts; i++ {
+		// Re-issued commands must not be suppressed as duplicates.
+		d.forgetCall()
+		if err := d.CallContext(ctx, cmd, args...); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(stickyDelay):
+		}
+		if err := d.RefreshContext(ctx); err != nil {
+			return err
+		}
+		var ok bool
+		if got, ok = d.AttributeString(verifyAttr); ok && got == want {
+			return nil
+		}
+	}
+	return fmt.Errorf("command %v on device %s did not stick after %d attempts: %v is %q, expected %q", cmd, d.ID, maxAttempts, verifyAttr, got, want)
+}
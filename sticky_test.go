@@ -0,0 +1,63 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/smoogle/gosmart"
+	"github.com/smoogle/gosmart/gosmarttest"
+	"golang.org/x/net/context"
+)
+
+func TestCallSticky(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	// The lamp misses the first command, then holds.
+	var calls int
+	s.Handle("on", func(d *gosmarttest.Device, _ []string, _ url.Values) {
+		calls++
+		if calls > 1 {
+			d.Attributes["switch"] = "on"
+		}
+	})
+	st := connect(t, s, gosmart.Config{})
+	d := device(t, st, "1")
+
+	if err := d.CallSticky(context.Background(), "on", "switch", "on", 3); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(s.Calls()); n != 2 {
+		t.Errorf("sent %d commands, want 2", n)
+	}
+	if v, _ := d.AttributeString("switch"); v != "on" {
+		t.Errorf("switch = %q, want on", v)
+	}
+}
+
+func TestCallStickyNeverSticks(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	s.Handle("setLevel", func(*gosmarttest.Device, []string, url.Values) {})
+	st := connect(t, s, gosmart.Config{})
+	d := device(t, st, "1")
+
+	err := d.CallSticky(context.Background(), "setLevel", "level", 75, 3, 75)
+	if err == nil || !strings.Contains(err.Error(), "after 3 attempts") || !strings.Contains(err.Error(), `expected "75"`) {
+		t.Errorf("CallSticky() = %v, want an error after 3 attempts", err)
+	}
+	if n := len(s.Calls()); n != 3 {
+		t.Errorf("sent %d commands, want 3", n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := d.CallSticky(ctx, "setLevel", "level", 75, 3, 75); !errors.Is(err, context.Canceled) {
+		t.Errorf("CallSticky with a cancelled context = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,45 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"strings"
+	"time"
+)
+
+// timeFormats lists the timestamp layouts seen in SmartThings responses.
+var timeFormats = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.000Z0700",
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02 15:04:05.000 MST",
+	"2006-01-02 15:04:05 MST",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// parseTime converts a timestamp from a JSON response into a time.Time.
+// Timestamps may be strings in one of timeFormats or numbers representing
+// milliseconds since the epoch. Returns false if v cannot be parsed.
+func parseTime(v interface{}) (time.Time, bool) {
+	switch t := v.(type) {
+	case float64:
+		if t <= 0 {
+			return time.Time{}, false
+		}
+		ms := int64(t)
+		return time.Unix(ms/1000, (ms%1000)*int64(time.Millisecond)), true
+	case string:
+		t = strings.TrimSpace(t)
+		for _, f := range timeFormats {
+			if ts, err := time.Parse(f, t); err == nil {
+				return ts, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
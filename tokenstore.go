@@ -0,0 +1,178 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"errors"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	"net/http"
+	"sync"
+)
+
+// TokenStore loads and saves OAuth tokens. Implement it to keep tokens
+// somewhere other than the local filesystem (e.g. Redis or Vault).
+type TokenStore interface {
+	Load() (*oauth2.Token, error)
+	Save(*oauth2.Token) error
+}
+
+// fileTokenStore is a TokenStore backed by a local file.
+type fileTokenStore struct {
+	fname string
+}
+
+// NewFileTokenStore returns a TokenStore that keeps the token in a local
+// file, using the same naming rules as LoadToken and SaveToken.
+func NewFileTokenStore(fname string) TokenStore {
+	return &fileTokenStore{fname: fname}
+}
+
+// tokenChecker is implemented by the token stores that can tell whether a
+// token can be saved before it is obtained.
+type tokenChecker interface {
+	check() error
+}
+
+func (s *fileTokenStore) Load() (*oauth2.Token, error) { return LoadToken(s.fname) }
+func (s *fileTokenStore) Save(t *oauth2.Token) error   { return SaveToken(s.fname, t) }
+func (s *fileTokenStore) check() error                 { return checkTokenFile(s.fname) }
+
+// memoryTokenStore is a TokenStore keeping the token in memory.
+type memoryTokenStore struct {
+	mu    sync.Mutex
+	token *oauth2.Token
+}
+
+// NewMemoryTokenStore returns a TokenStore that keeps the token in memory,
+// starting with token (which may be nil). Useful for tests and for
+// deployments without a writable filesystem.
+func NewMemoryTokenStore(token *oauth2.Token) TokenStore {
+	return &memoryTokenStore{token: token}
+}
+
+// Load implements TokenStore.
+func (s *memoryTokenStore) Load() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token == nil {
+		return nil, errors.New("no token stored")
+	}
+	t := *s.token
+	return &t, nil
+}
+
+// Save implements TokenStore.
+func (s *memoryTokenStore) Save(t *oauth2.Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := *t
+	s.token = &c
+	return nil
+}
+
+// backupTokenStore is a file TokenStore keeping a backup of the previous
+// token next to the primary file.
+type backupTokenStore struct {
+	fname  string
+	backup string
+}
+
+// NewBackupFileTokenStore returns a file TokenStore (see NewFileTokenStore)
+// that keeps the previously saved token in a backup file (named after fname,
+// with a ".bak" suffix). Loading picks the freshest of the two tokens that
+// can be read, so a corrupted primary file falls back to the backup instead
+// of forcing a full re-authentication.
+func NewBackupFileTokenStore(fname string) TokenStore {
+	backup := fname
+	if backup == "" {
+		backup = defaultTokenFile
+	}
+	return &backupTokenStore{fname: fname, backup: backup + ".bak"}
+}
+
+// Load implements TokenStore.
+func (s *backupTokenStore) Load() (*oauth2.Token, error) {
+	token, err := LoadToken(s.fname)
+	backup, berr := LoadToken(s.backup)
+	switch {
+	case err != nil && berr != nil:
+		return nil, err
+	case err != nil:
+		return backup, nil
+	case berr == nil && backup.Expiry.After(token.Expiry):
+		return backup, nil
+	}
+	return token, nil
+}
+
+// check implements tokenChecker.
+func (s *backupTokenStore) check() error { return checkTokenFile(s.fname) }
+
+// Save implements TokenStore. The current primary token, if readable, is
+// saved as the backup first.
+func (s *backupTokenStore) Save(t *oauth2.Token) error {
+	if old, err := LoadToken(s.fname); err == nil {
+		if err := SaveToken(s.backup, old); err != nil {
+			return err
+		}
+	}
+	return SaveToken(s.fname, t)
+}
+
+// persistingTokenSource is an oauth2.TokenSource that saves the token to a
+// TokenStore every time it changes (i.e. is refreshed). It is wrapped in an
+// oauth2.ReuseTokenSource, and its mutex serializes concurrent refreshes so
+// the store is never written by two goroutines at once.
+type persistingTokenSource struct {
+	mu     sync.Mutex
+	src    oauth2.TokenSource
+	store  TokenStore
+	last   string
+	logger Logger
+}
+
+// Token implements oauth2.TokenSource.
+func (p *persistingTokenSource) Token() (*oauth2.Token, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	t, err := p.src.Token()
+	if err != nil {
+		return nil, err
+	}
+	if t.AccessToken != p.last {
+		// The refreshed token is valid even if it cannot be saved; it is
+		// saved again on the next refresh.
+		if err := p.store.Save(t); err != nil {
+			if p.logger != nil {
+				p.logger.Printf("Cannot save refreshed token: %v", err)
+			}
+			return t, nil
+		}
+		p.last = t.AccessToken
+	}
+	return t, nil
+}
+
+// persistentClient returns an HTTP client using token that saves refreshed
+// tokens back to store, logging failures to logger (if not nil). The client
+// outlives ctx: only its HTTP client (oauth2.HTTPClient) is kept, so
+// cancelling ctx does not break later token refreshes.
+func persistentClient(ctx context.Context, config *oauth2.Config, token *oauth2.Token, store TokenStore, logger Logger) *http.Client {
+	bg := context.Background()
+	if c, ok := ctx.Value(oauth2.HTTPClient).(*http.Client); ok {
+		bg = context.WithValue(bg, oauth2.HTTPClient, c)
+	}
+	src := &persistingTokenSource{
+		src:    config.TokenSource(bg, token),
+		store:  store,
+		last:   token.AccessToken,
+		logger: logger,
+	}
+	return oauth2.NewClient(bg, oauth2.ReuseTokenSource(token, src))
+}
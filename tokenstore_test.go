@@ -0,0 +1,308 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smoogle/gosmart"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+)
+
+// tokenEndpoint is an http.RoundTripper acting as the OAuth token endpoint,
+// issuing access tokens "new1", "new2"... on every refresh. Other requests
+// are sent to the network. Like a real transport, it fails requests whose
+// context is done.
+type tokenEndpoint struct {
+	mu     sync.Mutex
+	issued int
+}
+
+func (e *tokenEndpoint) RoundTrip(r *http.Request) (*http.Response, error) {
+	if !strings.HasSuffix(r.URL.Path, "/oauth/token") {
+		return http.DefaultTransport.RoundTrip(r)
+	}
+	if err := r.Context().Err(); err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	e.issued++
+	body := fmt.Sprintf(`{"access_token": "new%d", "token_type": "Bearer", "refresh_token": "refresh", "expires_in": 3600}`, e.issued)
+	e.mu.Unlock()
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       r,
+	}, nil
+}
+
+// refreshed returns the number of tokens issued.
+func (e *tokenEndpoint) refreshed() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.issued
+}
+
+// expired returns an expired OAuth token that can be refreshed.
+func expired(access string) *oauth2.Token {
+	return &oauth2.Token{AccessToken: access, TokenType: "Bearer", RefreshToken: "refresh", Expiry: time.Now().Add(-time.Hour)}
+}
+
+func TestTokenStore(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	tokens := &tokenEndpoint{}
+	store := gosmart.NewMemoryTokenStore(expired("old"))
+	st, err := gosmart.Connect(context.Background(), gosmart.Config{
+		ClientID:   "client",
+		Secret:     "secret",
+		TokenStore: store,
+		Endpoint:   s.URL,
+		HTTPClient: &http.Client{Transport: tokens},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st.DeviceList()) != 1 {
+		t.Errorf("got %d devices, want 1", len(st.DeviceList()))
+	}
+
+	// The expired token was refreshed once, used and saved to the store.
+	if n := tokens.refreshed(); n != 1 {
+		t.Errorf("token refreshed %d times, want 1", n)
+	}
+	for _, r := range s.Requests() {
+		if auth := r.Header.Get("Authorization"); auth != "Bearer new1" {
+			t.Errorf("%s sent with %q, want the refreshed token", r.Path, auth)
+		}
+	}
+	saved, err := store.Load()
+	if err != nil || saved.AccessToken != "new1" {
+		t.Errorf("store holds %v, %v; want the refreshed token", saved, err)
+	}
+}
+
+// readOnlyStore is a TokenStore that cannot save tokens.
+type readOnlyStore struct {
+	gosmart.TokenStore
+}
+
+func (readOnlyStore) Save(*oauth2.Token) error {
+	return errors.New("disk full")
+}
+
+func TestTokenStoreSaveFailure(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	tokens := &tokenEndpoint{}
+	log := &logger{}
+	st, err := gosmart.Connect(context.Background(), gosmart.Config{
+		ClientID:   "client",
+		Secret:     "secret",
+		TokenStore: readOnlyStore{gosmart.NewMemoryTokenStore(expired("old"))},
+		Endpoint:   s.URL,
+		HTTPClient: &http.Client{Transport: tokens},
+		Logger:     log,
+	})
+	if err != nil {
+		t.Fatalf("Connect failed when the refreshed token could not be saved: %v", err)
+	}
+
+	// The refreshed token is used, and the failure logged.
+	if n := tokens.refreshed(); n != 1 {
+		t.Errorf("token refreshed %d times, want 1", n)
+	}
+	for _, r := range s.Requests() {
+		if auth := r.Header.Get("Authorization"); auth != "Bearer new1" {
+			t.Errorf("%s sent with %q, want the refreshed token", r.Path, auth)
+		}
+	}
+	if len(log.logged("disk full")) != 1 {
+		t.Errorf("save failure not logged: %q", log.lines)
+	}
+	if err := st.Refresh(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTokenRefreshAfterConnectContext(t *testing.T) {
+	s := newServer(t, lamp("1"))
+	tokens := &tokenEndpoint{}
+	// Valid at Connect, but due for refresh (10 seconds before expiry, as
+	// set by the oauth2 package) shortly after.
+	tok := expired("old")
+	tok.Expiry = time.Now().Add(10*time.Second + 200*time.Millisecond)
+	store := gosmart.NewMemoryTokenStore(tok)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	st, err := gosmart.Connect(ctx, gosmart.Config{
+		ClientID:   "client",
+		Secret:     "secret",
+		TokenStore: store,
+		Endpoint:   s.URL,
+		HTTPClient: &http.Client{Transport: tokens},
+	})
+	cancel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := tokens.refreshed(); n != 0 {
+		t.Fatalf("token refreshed %d times at Connect, want 0", n)
+	}
+
+	time.Sleep(time.Until(tok.Expiry.Add(-10*time.Second)) + 50*time.Millisecond)
+	if err := st.Refresh(); err != nil {
+		t.Fatalf("Refresh after the Connect context was cancelled: %v", err)
+	}
+	if n := tokens.refreshed(); n != 1 {
+		t.Errorf("token refreshed %d times, want 1", n)
+	}
+	if saved, err := store.Load(); err != nil || saved.AccessToken != "new1" {
+		t.Errorf("store holds %v, %v; want the refreshed token", saved, err)
+	}
+}
+
+func TestFileTokenStore(t *testing.T) {
+	store := gosmart.NewFileTokenStore(filepath.Join(t.TempDir(), "token.json"))
+	if _, err := store.Load(); err == nil {
+		t.Error("Load succeeded before a token was saved")
+	}
+	want := token("abc")
+	if err := store.Save(want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.AccessToken != want.AccessToken || !got.Expiry.Equal(want.Expiry) {
+		t.Errorf("Load() = %+v, want %+v", got, want)
+	}
+}
+
+func TestBackupFileTokenStore(t *testing.T) {
+	dir := t.TempDir()
+	fname := filepath.Join(dir, "token.json")
+	store := gosmart.NewBackupFileTokenStore(fname)
+	for _, access := range []string{"first", "second"} {
+		if err := store.Save(token(access)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, err := store.Load(); err != nil || got.AccessToken != "second" {
+		t.Errorf("Load() = %v, %v; want the last token saved", got, err)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Errorf("got %d files after saving, want the token and its backup only", len(files))
+	}
+
+	// A corrupted primary falls back to the backup.
+	if err := ioutil.WriteFile(fname, []byte(`{"access_token": "sec`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := store.Load(); err != nil || got.AccessToken != "first" {
+		t.Errorf("Load() = %v, %v; want the backup token", got, err)
+	}
+
+	// A fresher backup wins over a readable primary.
+	stale := token("stale")
+	stale.Expiry = time.Now().Add(-time.Hour)
+	if err := gosmart.SaveToken(fname, stale); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := store.Load(); err != nil || got.AccessToken != "first" {
+		t.Errorf("Load() = %v, %v; want the fresher backup token", got, err)
+	}
+}
+
+func TestCorruptTokenFile(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "token.json")
+	for _, content := range []string{"", " \n", `{"access_token": "tru`} {
+		if err := ioutil.WriteFile(fname, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := gosmart.LoadToken(fname); err == nil || !strings.Contains(err.Error(), fname) {
+			t.Errorf("LoadToken(%q) = %v, want an error naming the file", content, err)
+		}
+
+		// The token is ignored as if missing, and the reason is logged
+		// rather than printed.
+		log := &logger{}
+		var err error
+		out := captureStdout(t, func() {
+			_, err = gosmart.Connect(context.Background(), gosmart.Config{ClientID: "id", TokenStore: gosmart.NewFileTokenStore(fname), Logger: log})
+		})
+		if err == nil || !strings.Contains(err.Error(), "Need ClientID and Secret") {
+			t.Errorf("Connect with a corrupt token = %v, want a new token required", err)
+		}
+		if lines := log.logged("Ignoring saved token"); len(lines) != 1 || !strings.Contains(lines[0], fname) {
+			t.Errorf("logged %q, want the token file ignored", log.lines)
+		}
+		if out != "" {
+			t.Errorf("printed %q to stdout", out)
+		}
+	}
+}
+
+// captureStdout returns what fn writes to os.Stdout.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	fn()
+	w.Close()
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestSaveTokenPermissions(t *testing.T) {
+	dir := t.TempDir()
+	fname := filepath.Join(dir, "token.json")
+	if err := ioutil.WriteFile(fname, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := gosmart.SaveToken(fname, token("abc")); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := fi.Mode().Perm(); perm != 0600 {
+		t.Errorf("token file mode is %o, want 600", perm)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("got %d files after saving, want the token only", len(files))
+	}
+
+	missing := filepath.Join(dir, "missing", "token.json")
+	if err := gosmart.SaveToken(missing, token("abc")); err == nil || !strings.Contains(err.Error(), missing) {
+		t.Errorf("SaveToken in a missing directory = %v, want an error naming the file", err)
+	}
+}
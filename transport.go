@@ -0,0 +1,390 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"bytes"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Default delay before the first retry. Doubles on each subsequent
+	// attempt.
+	retryDelay = 500 * time.Millisecond
+
+	// Default maximum size of a response body.
+	maxResponseBytes = 32 << 20
+)
+
+// budgetKey is the context key holding the retry budget of an operation.
+type budgetKey struct{}
+
+// retryBudget caps the total number of retries issued during a high-level
+// operation (e.g. Refresh), regardless of how many requests it makes. The
+// budget travels in the context of the operation requests, so concurrent
+// operations do not share it.
+type retryBudget struct {
+	mu        sync.Mutex
+	remaining int
+}
+
+// withRetryBudget returns a context carrying a budget of n retries. Zero or
+// less means unlimited, and ctx is returned unchanged. A budget already in
+// ctx is kept, so nested operations count against the outermost one.
+func withRetryBudget(ctx context.Context, n int) context.Context {
+	if n <= 0 || budgetFrom(ctx) != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, budgetKey{}, &retryBudget{remaining: n})
+}
+
+// budgetFrom returns the retry budget in ctx, or nil if none.
+func budgetFrom(ctx context.Context) *retryBudget {
+	b, _ := ctx.Value(budgetKey{}).(*retryBudget)
+	return b
+}
+
+// take consumes one retry from the budget. Returns false if the budget is
+// exhausted. A nil budget is unlimited.
+func (b *retryBudget) take() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.remaining <= 0 {
+		return false
+	}
+	b.remaining--
+	return true
+}
+
+// retryPolicy sets how requests are retried.
+type retryPolicy struct {
+	// maxRetries is the maximum number of retries per request.
+	maxRetries int
+	// baseDelay is the delay before the first retry. Zero means retryDelay.
+	baseDelay time.Duration
+	// maxDelay caps the delay between retries. Zero means no cap.
+	maxDelay time.Duration
+	// timeout limits each attempt. Zero means no limit.
+	timeout time.Duration
+	// maxBody is the maximum size of a response body. Zero or less means
+	// maxResponseBytes.
+	maxBody int64
+}
+
+// policyFromConfig returns the retry policy set by cfg.
+func policyFromConfig(cfg Config) retryPolicy {
+	return retryPolicy{
+		maxRetries: cfg.MaxRetries,
+		baseDelay:  cfg.RetryBaseDelay,
+		maxDelay:   cfg.RetryMaxDelay,
+		timeout:    cfg.RequestTimeout,
+		maxBody:    cfg.MaxResponseBytes,
+	}
+}
+
+// delay returns the delay before retry number attempt (starting at zero),
+// doubling on every attempt, unless the server asked for a specific delay
+// with a Retry-After header.
+func (p retryPolicy) delay(attempt int, resp *http.Response) time.Duration {
+	d := p.baseDelay
+	if d <= 0 {
+		d = retryDelay
+	}
+	for i := 0; i < attempt && (p.maxDelay <= 0 || d < p.maxDelay); i++ {
+		d *= 2
+	}
+	if ra, ok := retryAfter(resp, time.Now()); ok {
+		d = ra
+	}
+	if p.maxDelay > 0 && d > p.maxDelay {
+		d = p.maxDelay
+	}
+	return d
+}
+
+// retryAfter returns the delay requested by the Retry-After header of resp,
+// given either in seconds or as an HTTP date.
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// retryTransport is an http.RoundTripper that retries requests failing with
+// a network error or a transient HTTP status.
+type retryTransport struct {
+	base http.RoundTripper
+
+	mu     sync.Mutex
+	policy retryPolicy
+}
+
+// currentPolicy returns the retry policy in use.
+func (t *retryTransport) currentPolicy() retryPolicy {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.policy
+}
+
+// setPolicy replaces the retry policy.
+func (t *retryTransport) setPolicy(p retryPolicy) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.policy = p
+}
+
+// RoundTrip implements http.RoundTripper. The wait between retries stops as
+// soon as the request context is done. Retries are counted against the
+// budget in the request context, if any.
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	policy := t.currentPolicy()
+	for attempt := 0; ; attempt++ {
+		resp, err := t.attempt(req, policy)
+		if !transient(resp, err) || attempt >= policy.maxRetries || !rewindable(req) || noRetry(req) || !budgetFrom(req.Context()).take() {
+			return resp, err
+		}
+		delay := policy.delay(attempt, resp)
+		if resp != nil {
+			resp.Body.Close()
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+		if req, err = rewind(req); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// attempt sends req once, limited to the policy timeout (if set). The
+// response body is read before returning, so the timeout covers it too.
+func (t *retryTransport) attempt(req *http.Request, policy retryPolicy) (*http.Response, error) {
+	if policy.timeout > 0 {
+		ctx, cancel := context.WithTimeout(req.Context(), policy.timeout)
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err == nil && req.Method != http.MethodHead {
+		resp, err = bufferBody(resp, policy.maxBody)
+	}
+	return resp, err
+}
+
+// bufferBody reads the whole response body into memory, so truncated
+// responses can be detected (and retried) before the caller sees them.
+// Returns ErrTruncatedResponse if the body is shorter than announced, and
+// ErrResponseTooLarge if it exceeds limit bytes (zero or less means
+// maxResponseBytes).
+func bufferBody(resp *http.Response, limit int64) (*http.Response, error) {
+	data, err := readLimited(resp.Body, limit)
+	resp.Body.Close()
+	if err == ErrResponseTooLarge {
+		return nil, err
+	}
+	if err == io.ErrUnexpectedEOF || (err == nil && resp.ContentLength >= 0 && int64(len(data)) != resp.ContentLength) {
+		return nil, ErrTruncatedResponse
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = bufferedBody{bytes.NewReader(data), limit}
+	return resp, nil
+}
+
+// bufferedBody is a response body already read into memory (and checked
+// against the size limit) by bufferBody.
+type bufferedBody struct {
+	*bytes.Reader
+	// limit is the size limit the body was read with, also applied when
+	// decompressing it.
+	limit int64
+}
+
+// Close implements io.Closer.
+func (bufferedBody) Close() error { return nil }
+
+// readLimited reads r up to limit bytes (zero or less means
+// maxResponseBytes). Returns ErrResponseTooLarge if r holds more.
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		limit = maxResponseBytes
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if err == nil && int64(len(data)) > limit {
+		return nil, ErrResponseTooLarge
+	}
+	return data, err
+}
+
+// transient returns true if the result of a request indicates a temporary
+// failure worth retrying.
+func transient(resp *http.Response, err error) bool {
+	if err == ErrResponseTooLarge {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// noRetryKey is the context key marking requests that must not be retried.
+type noRetryKey struct{}
+
+// noRetry returns true if req is marked as not safe to retry.
+func noRetry(req *http.Request) bool {
+	return req.Context().Value(noRetryKey{}) != nil
+}
+
+// rewindable returns true if the request can safely be sent again: it has
+// no body, or its body can be read again with GetBody.
+func rewindable(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// rewind returns a copy of req with a fresh body, to send it again.
+func rewind(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	r := req.Clone(req.Context())
+	r.Body = body
+	return r, nil
+}
+
+// Version is the version of the library, sent in the default User-Agent.
+const Version = "0.1.0"
+
+// headerTransport is an http.RoundTripper setting the User-Agent and the
+// extra headers configured (Config.UserAgent and Config.Headers) on every
+// request.
+type headerTransport struct {
+	base http.RoundTripper
+	st   *SmartThings
+}
+
+// RoundTrip implements http.RoundTripper. The request is cloned, as a
+// RoundTripper must not modify it.
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	cfg := t.st.config()
+	ua := cfg.UserAgent
+	if ua == "" {
+		ua = "gosmart/" + Version
+	}
+	r := req.Clone(req.Context())
+	r.Header.Set("User-Agent", ua)
+	for k, v := range cfg.Headers {
+		r.Header.Set(k, v)
+	}
+	return t.base.RoundTrip(r)
+}
+
+// hookTransport is an http.RoundTripper reporting every request to
+// Config.OnRequest.
+type hookTransport struct {
+	base http.RoundTripper
+	st   *SmartThings
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *hookTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	hook := t.st.config().OnRequest
+	if hook == nil {
+		return t.base.RoundTrip(req)
+	}
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	hook(requestPath(t.st.endpoint, req.URL), time.Since(start), status, err)
+	return resp, err
+}
+
+// requestPath returns the path of u relative to endpoint, or the full path
+// for requests outside the endpoint.
+func requestPath(endpoint string, u *url.URL) string {
+	base, err := url.Parse(endpoint)
+	if err != nil || base.Host != u.Host {
+		return u.Path
+	}
+	return strings.TrimPrefix(u.Path, strings.TrimSuffix(base.Path, "/"))
+}
+
+// closeIdleConnections closes the idle connections kept by the transport at
+// the bottom of rt, unwrapping the transports of this package and the OAuth2
+// transport, so the next requests dial new connections.
+func closeIdleConnections(rt http.RoundTripper) {
+	switch t := rt.(type) {
+	case *hookTransport:
+		closeIdleConnections(t.base)
+	case *headerTransport:
+		closeIdleConnections(t.base)
+	case *retryTransport:
+		closeIdleConnections(t.base)
+	case *rateLimitTransport:
+		closeIdleConnections(t.base)
+	case *rotateTransport:
+		t.mu.Lock()
+		bases := make([]http.RoundTripper, len(t.members))
+		for i, m := range t.members {
+			bases[i] = m.base
+		}
+		t.mu.Unlock()
+		for _, b := range bases {
+			closeIdleConnections(b)
+		}
+	case *oauth2.Transport:
+		if t.Base == nil {
+			closeIdleConnections(http.DefaultTransport)
+		} else {
+			closeIdleConnections(t.Base)
+		}
+	case interface{ CloseIdleConnections() }:
+		t.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,154 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"strings"
+)
+
+// UnitSystem selects the units used by the convenience accessors (see
+// Config.UnitSystem).
+type UnitSystem string
+
+// Unit systems.
+const (
+	// UnitsMetric reports temperatures in degrees Celsius.
+	UnitsMetric UnitSystem = "metric"
+	// UnitsImperial reports temperatures in degrees Fahrenheit.
+	UnitsImperial UnitSystem = "imperial"
+)
+
+// Temperature returns the temperature reported by the device, in the unit
+// system set by Config.UnitSystem or, if unset, in the native unit of the
+// device. Returns false if the device does not report a temperature.
+func (d *Device) Temperature() (float64, bool) {
+	t, ok := d.reading("temperature")
+	if !ok {
+		return 0, false
+	}
+	return d.localTemperature(t), true
+}
+
+// unitSystem returns the configured unit system, blank for detached
+// devices.
+func (d *Device) unitSystem() UnitSystem {
+	if d.st == nil {
+		return ""
+	}
+	return d.st.config().UnitSystem
+}
+
+// localTemperature converts a temperature value reported by the device (e.g.
+// a setpoint) to the configured unit system.
+func (d *Device) localTemperature(t float64) float64 {
+	switch d.unitSystem() {
+	case UnitsMetric:
+		if d.temperatureUnit() == "F" {
+			return fToC(t)
+		}
+	case UnitsImperial:
+		if d.temperatureUnit() == "C" {
+			return cToF(t)
+		}
+	}
+	return t
+}
+
+// deviceTemperature converts a temperature in the configured unit system to
+// the unit of the device, for commands such as setHeatingSetpoint.
+func (d *Device) deviceTemperature(t float64) float64 {
+	switch d.unitSystem() {
+	case UnitsMetric:
+		if d.temperatureUnit() == "F" {
+			return cToF(t)
+		}
+	case UnitsImperial:
+		if d.temperatureUnit() == "C" {
+			return fToC(t)
+		}
+	}
+	return t
+}
+
+// fToC converts degrees Fahrenheit to Celsius.
+func fToC(t float64) float64 {
+	return (t - 32) * 5 / 9
+}
+
+// cToF converts degrees Celsius to Fahrenheit.
+func cToF(t float64) float64 {
+	return t*9/5 + 32
+}
+
+// TemperatureC returns the temperature reported by the device in degrees
+// Celsius, converting from Fahrenheit if needed. Returns false if the device
+// does not report a temperature.
+func (d *Device) TemperatureC() (float64, bool) {
+	t, unit, ok := d.temperature()
+	if !ok {
+		return 0, false
+	}
+	if unit == "F" {
+		t = fToC(t)
+	}
+	return t, true
+}
+
+// TemperatureF returns the temperature reported by the device in degrees
+// Fahrenheit, converting from Celsius if needed. Returns false if the device
+// does not report a temperature.
+func (d *Device) TemperatureF() (float64, bool) {
+	t, unit, ok := d.temperature()
+	if !ok {
+		return 0, false
+	}
+	if unit == "C" {
+		t = cToF(t)
+	}
+	return t, true
+}
+
+// temperature returns the temperature of the device and its unit ("C" or
+// "F"), as returned by temperatureUnit.
+func (d *Device) temperature() (float64, string, bool) {
+	t, ok := d.reading("temperature")
+	if !ok {
+		return 0, "", false
+	}
+	return t, d.temperatureUnit(), true
+}
+
+// temperatureUnit returns the temperature unit of the device ("C" or "F"),
+// as found when its attributes were last read.
+func (d *Device) temperatureUnit() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.tempUnit == "" {
+		return "F"
+	}
+	return d.tempUnit
+}
+
+// attributesUnit returns the temperature unit ("C" or "F") given by the
+// temperatureUnit attribute when present, or else by the unit reported with
+// the temperature attribute. If neither reports it, the value is assumed to
+// be in Fahrenheit, the SmartThings default.
+func attributesUnit(raw map[string]interface{}, details map[string]AttributeDetail) string {
+	unit, ok := raw["temperatureUnit"].(string)
+	if !ok {
+		unit = details["temperature"].Unit
+	}
+	return normalUnit(unit)
+}
+
+// normalUnit maps a unit such as "°C" to "C" or "F".
+func normalUnit(unit string) string {
+	if strings.ToUpper(strings.TrimPrefix(strings.TrimSpace(unit), "°")) == "C" {
+		return "C"
+	}
+	return "F"
+}
@@ -0,0 +1,171 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/smoogle/gosmart"
+	"github.com/smoogle/gosmart/gosmarttest"
+)
+
+// sensor returns a temperature sensor fixture with the given attributes.
+func sensor(id string, attrs map[string]interface{}) gosmarttest.Device {
+	return gosmarttest.Device{ID: id, Name: "Sensor " + id, DisplayName: "Sensor " + id, Attributes: attrs}
+}
+
+func TestTemperatureUnits(t *testing.T) {
+	s := newServer(t,
+		sensor("celsius", map[string]interface{}{"temperature": 20.0, "temperatureUnit": "C"}),
+		sensor("detail", map[string]interface{}{"temperature": map[string]interface{}{"value": 20.0, "unit": "°C"}}),
+		sensor("fahrenheit", map[string]interface{}{"temperature": 68.0, "temperatureUnit": "F"}),
+		sensor("default", map[string]interface{}{"temperature": 68.0}),
+		sensor("none", map[string]interface{}{"humidity": 40.0}),
+	)
+	st := connect(t, s, gosmart.Config{})
+
+	for _, id := range []string{"celsius", "detail", "fahrenheit", "default"} {
+		d := device(t, st, id)
+		if c, ok := d.TemperatureC(); !ok || math.Abs(c-20) > 1e-9 {
+			t.Errorf("%s: TemperatureC() = %v, %v; want 20", id, c, ok)
+		}
+		if f, ok := d.TemperatureF(); !ok || math.Abs(f-68) > 1e-9 {
+			t.Errorf("%s: TemperatureF() = %v, %v; want 68", id, f, ok)
+		}
+	}
+	d := device(t, st, "none")
+	if _, ok := d.TemperatureC(); ok {
+		t.Error("TemperatureC() reported a temperature for a device without one")
+	}
+	if _, ok := d.TemperatureF(); ok {
+		t.Error("TemperatureF() reported a temperature for a device without one")
+	}
+}
+
+func TestTemperatureUnitsNoRequests(t *testing.T) {
+	s := newServer(t, sensor("1", map[string]interface{}{"temperature": 68.0}), thermostat("2"))
+	st := connect(t, s, gosmart.Config{UnitSystem: gosmart.UnitsMetric})
+	d, th := device(t, st, "1"), device(t, st, "2")
+	var therm gosmart.Thermostat
+	if !th.As(&therm) {
+		t.Fatal("device 2 is not a thermostat")
+	}
+
+	// Reading the unit does not look it up in the event history.
+	before := len(s.Requests())
+	for i := 0; i < 5; i++ {
+		d.TemperatureC()
+		d.TemperatureF()
+		d.Temperature()
+		therm.HeatingSetpoint()
+	}
+	if n := len(s.Requests()) - before; n != 0 {
+		t.Errorf("reading temperatures sent %d requests, want none", n)
+	}
+
+	// Restored snapshots have no connection to read from.
+	b, err := json.Marshal(th)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var restored gosmart.Device
+	if err := json.Unmarshal(b, &restored); err != nil {
+		t.Fatal(err)
+	}
+	if c, ok := restored.TemperatureC(); !ok || math.Abs(c-fToC(20)) > 1e-9 {
+		t.Errorf("restored TemperatureC() = %v, %v; want %v", c, ok, fToC(20))
+	}
+	if !restored.As(&therm) {
+		t.Fatal("restored device is not a thermostat")
+	}
+	if v := therm.HeatingSetpoint(); v != 18 {
+		t.Errorf("restored HeatingSetpoint() = %v, want 18 without a unit system", v)
+	}
+}
+
+// fToC converts degrees Fahrenheit to Celsius.
+func fToC(t float64) float64 {
+	return (t - 32) * 5 / 9
+}
+
+func TestThermostatUnitSystem(t *testing.T) {
+	celsius := thermostat("c")
+	celsius.Attributes["temperatureUnit"] = "C"
+	fahrenheit := thermostat("f")
+	fahrenheit.Attributes["heatingSetpoint"] = 68.0
+	fahrenheit.Attributes["temperatureUnit"] = "F"
+
+	cases := []struct {
+		units     gosmart.UnitSystem
+		id        string
+		setpoint  float64 // HeatingSetpoint, in units
+		set, sent float64 // SetHeatingSetpoint argument and value sent
+	}{
+		{gosmart.UnitsImperial, "c", 64.4, 77, 25},
+		{gosmart.UnitsMetric, "c", 18, 25, 25},
+		{gosmart.UnitsMetric, "f", 20, 25, 77},
+		{gosmart.UnitsImperial, "f", 68, 77, 77},
+		{"", "c", 18, 25, 25},
+		{"", "f", 68, 77, 77},
+	}
+	for _, c := range cases {
+		s := newServer(t, celsius, fahrenheit)
+		st := connect(t, s, gosmart.Config{UnitSystem: c.units})
+		var th gosmart.Thermostat
+		if !device(t, st, c.id).As(&th) {
+			t.Fatalf("device %s is not a thermostat", c.id)
+		}
+		if v := th.HeatingSetpoint(); math.Abs(v-c.setpoint) > 1e-9 {
+			t.Errorf("%q/%s: HeatingSetpoint() = %v, want %v", c.units, c.id, v, c.setpoint)
+		}
+		if err := th.SetHeatingSetpoint(c.set); err != nil {
+			t.Fatal(err)
+		}
+		if v, _ := s.Attribute(c.id, "heatingSetpoint"); v == nil || math.Abs(v.(float64)-c.sent) > 1e-9 {
+			t.Errorf("%q/%s: SetHeatingSetpoint(%v) sent %v, want %v", c.units, c.id, c.set, v, c.sent)
+		}
+	}
+}
+
+func TestAttributeDetail(t *testing.T) {
+	s := newServer(t, sensor("1", map[string]interface{}{
+		"temperature": map[string]interface{}{
+			"value":     21.5,
+			"unit":      "C",
+			"timestamp": "2016-03-01T10:20:30.000Z",
+			"data":      map[string]interface{}{"source": "probe"},
+		},
+		"humidity": 40.0,
+	}))
+	st := connect(t, s, gosmart.Config{})
+	d := device(t, st, "1")
+
+	ad, ok := d.AttributeDetail("temperature")
+	if !ok {
+		t.Fatal("AttributeDetail(temperature) not found")
+	}
+	want := time.Date(2016, 3, 1, 10, 20, 30, 0, time.UTC)
+	if ad.Name != "temperature" || ad.Value != 21.5 || ad.Unit != "C" || !ad.Timestamp.Equal(want) {
+		t.Errorf("AttributeDetail(temperature) = %+v", ad)
+	}
+	if !reflect.DeepEqual(ad.Data, map[string]interface{}{"source": "probe"}) {
+		t.Errorf("Data = %v, want the reported data", ad.Data)
+	}
+
+	// Plain values carry no metadata.
+	ad, ok = d.AttributeDetail("humidity")
+	if !ok || ad.Value != 40.0 || ad.Unit != "" || !ad.Timestamp.IsZero() || ad.Data != nil {
+		t.Errorf("AttributeDetail(humidity) = %+v, %v", ad, ok)
+	}
+	if _, ok := d.AttributeDetail("battery"); ok {
+		t.Error("AttributeDetail(battery) found on a device without it")
+	}
+}
@@ -0,0 +1,349 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"golang.org/x/net/context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// APIVersion selects the SmartThings API spoken by the library.
+type APIVersion string
+
+const (
+	// APILegacy is the SmartApp endpoint API (the default).
+	APILegacy APIVersion = ""
+	// APIV1 is the SmartThings REST API (api.smartthings.com/v1).
+	APIV1 APIVersion = "v1"
+)
+
+const (
+	// Base URI of the v1 REST API, used when Config.Endpoint is blank.
+	v1Endpoint = "https://api.smartthings.com/v1"
+	// Component whose attributes and commands are used in v1 mode.
+	v1Component = "main"
+)
+
+// v1Device is a device as returned by the v1 devices endpoint.
+type v1Device struct {
+	DeviceID       string `json:"deviceId"`
+	Name           string `json:"name"`
+	Label          string `json:"label"`
+	LocationID     string `json:"locationId"`
+	RoomID         string `json:"roomId"`
+	ParentDeviceID string `json:"parentDeviceId"`
+	Type           string `json:"type"`
+	Components     []struct {
+		ID           string       `json:"id"`
+		Capabilities []Capability `json:"capabilities"`
+	} `json:"components"`
+}
+
+// list returns the device as an entry of the device list.
+func (v v1Device) list() DeviceList {
+	return DeviceList{ID: v.DeviceID, Name: v.Name, DisplayName: v.Label}
+}
+
+// capabilities returns the capabilities of the main component.
+func (v v1Device) capabilities() []Capability {
+	for _, c := range v.Components {
+		if c.ID == v1Component {
+			return c.Capabilities
+		}
+	}
+	return nil
+}
+
+// v1 returns true if st speaks the v1 REST API.
+func (st *SmartThings) v1() bool {
+	return st.config().APIVersion == APIV1
+}
+
+// listDevices returns the device list, using the API selected by
+// Config.APIVersion.
+func (st *SmartThings) listDevices(ctx context.Context) ([]DeviceList, error) {
+	if st.v1() {
+		return getDeviceList(ctx, st.client, st.endpoint, "/devices", parseV1DevicePage)
+	}
+	return GetDevices(ctx, st.client, st.endpoint)
+}
+
+// parseV1DevicePage decodes one page of the v1 device list, as
+// parseDevicePage does for the legacy API.
+func parseV1DevicePage(contents []byte) ([]DeviceList, string, error) {
+	var page struct {
+		Items []v1Device `json:"items"`
+		Links struct {
+			Next struct {
+				Href string `json:"href"`
+			} `json:"next"`
+		} `json:"_links"`
+	}
+	if err := json.Unmarshal(contents, &page); err != nil {
+		return nil, "", err
+	}
+	var ret []DeviceList
+	for _, v := range page.Items {
+		ret = append(ret, v.list())
+	}
+	return ret, page.Links.Next.Href, nil
+}
+
+// getV1Device returns the v1 description of a device.
+func getV1Device(ctx context.Context, client *http.Client, endpoint string, id string) (*v1Device, error) {
+	contents, err := issueCommand(ctx, client, endpoint, "/devices/"+url.PathEscape(id))
+	if err != nil {
+		return nil, notFound(err, id)
+	}
+	ret := &v1Device{}
+	if err := json.Unmarshal(contents, ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// getV1DeviceInfo reads the description and status of a device from the v1
+// API and returns them as a legacy device info response, so they decode into
+// DeviceInfo. Attributes come from the main component, keeping their unit and
+// timestamp (see AttributeDetail).
+func getV1DeviceInfo(ctx context.Context, client *http.Client, endpoint string, id string) ([]byte, error) {
+	v, err := getV1Device(ctx, client, endpoint, id)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := issueCommand(ctx, client, endpoint, "/devices/"+url.PathEscape(id)+"/status")
+	if err != nil {
+		return nil, notFound(err, id)
+	}
+	var status struct {
+		Components map[string]map[string]map[string]json.RawMessage `json:"components"`
+	}
+	if err := json.Unmarshal(contents, &status); err != nil {
+		return nil, err
+	}
+
+	// Capabilities are merged in order, so the result does not depend on
+	// the map order when two of them report the same attribute.
+	main := status.Components[v1Component]
+	var caps []string
+	for c := range main {
+		caps = append(caps, c)
+	}
+	sort.Strings(caps)
+	attrs := make(map[string]json.RawMessage)
+	for _, c := range caps {
+		for name, value := range main[c] {
+			attrs[name] = value
+		}
+	}
+	return json.Marshal(map[string]interface{}{
+		"id":             v.DeviceID,
+		"name":           v.Name,
+		"displayName":    v.Label,
+		"locationId":     v.LocationID,
+		"roomId":         v.RoomID,
+		"parentDeviceId": v.ParentDeviceID,
+		"typeName":       v.Type,
+		"attributes":     attrs,
+		"capabilities":   v.capabilities(),
+	})
+}
+
+// v1Argument is one command argument in a v1 capability definition.
+type v1Argument struct {
+	Name     string `json:"name"`
+	Optional bool   `json:"optional"`
+	Schema   struct {
+		Type    string        `json:"type"`
+		Minimum *float64      `json:"minimum"`
+		Maximum *float64      `json:"maximum"`
+		Enum    []interface{} `json:"enum"`
+	} `json:"schema"`
+}
+
+// v1Commands returns the commands of a device, as defined by the
+// capabilities of its main component. Capability definitions are read once
+// per connection; capabilities whose definition cannot be read are skipped.
+func (st *SmartThings) v1Commands(ctx context.Context, id string) ([]DeviceCommand, error) {
+	v, err := getV1Device(ctx, st.client, st.endpoint, id)
+	if err != nil {
+		return nil, err
+	}
+	ret := []DeviceCommand{}
+	for _, c := range v.capabilities() {
+		cmds, err := st.v1Capability(ctx, c)
+		if err != nil {
+			st.logf("cannot read capability %s (version %d) of device %s: %v", c.ID, c.Version, id, err)
+			continue
+		}
+		ret = append(ret, cmds...)
+	}
+	return ret, nil
+}
+
+// v1Capability returns the commands defined by a capability.
+func (st *SmartThings) v1Capability(ctx context.Context, c Capability) ([]DeviceCommand, error) {
+	key := c.ID + "/" + strconv.Itoa(c.Version)
+	st.v1Mu.Lock()
+	cmds, ok := st.v1Caps[key]
+	st.v1Mu.Unlock()
+	if ok {
+		return cmds, nil
+	}
+
+	contents, err := issueCommand(ctx, st.client, st.endpoint, "/capabilities/"+key)
+	if err != nil {
+		return nil, err
+	}
+	var def struct {
+		Commands map[string]struct {
+			Arguments []v1Argument `json:"arguments"`
+		} `json:"commands"`
+	}
+	if err := json.Unmarshal(contents, &def); err != nil {
+		return nil, err
+	}
+	for name, cmd := range def.Commands {
+		dc := DeviceCommand{Command: name, Capability: c.ID, Params: make(map[string]interface{})}
+		for i, a := range cmd.Arguments {
+			dc.Params[a.Name] = v1Param(i, a)
+		}
+		cmds = append(cmds, dc)
+	}
+	sort.Slice(cmds, func(i, j int) bool { return cmds[i].Command < cmds[j].Command })
+
+	st.v1Mu.Lock()
+	defer st.v1Mu.Unlock()
+	if st.v1Caps == nil {
+		st.v1Caps = make(map[string][]DeviceCommand)
+	}
+	st.v1Caps[key] = cmds
+	return cmds, nil
+}
+
+// v1Param converts argument i of a v1 command into a parameter definition
+// understood by parseParams.
+func v1Param(i int, a v1Argument) map[string]interface{} {
+	ret := map[string]interface{}{
+		"type":  strings.ToUpper(a.Schema.Type),
+		"order": float64(i),
+	}
+	if a.Optional {
+		ret["optional"] = true
+	}
+	if len(a.Schema.Enum) > 0 {
+		ret["type"] = "ENUM"
+		ret["values"] = a.Schema.Enum
+	}
+	if a.Schema.Minimum != nil {
+		ret["min"] = *a.Schema.Minimum
+	}
+	if a.Schema.Maximum != nil {
+		ret["max"] = *a.Schema.Maximum
+	}
+	return ret
+}
+
+// v1CommandRequest builds the v1 request for a device command. Arguments
+// are sent as JSON values of the type declared by the command schema (see
+// v1Value). Named arguments are sent in the order declared by the command
+// schema.
+func (d *Device) v1CommandRequest(ctx context.Context, cmd string, args []string, query url.Values, idempotent bool) (*http.Request, error) {
+	caps := d.CommandCapabilities(cmd)
+	if len(caps) == 0 {
+		return nil, fmt.Errorf("unknown capability for command %v", cmd)
+	}
+	params := d.paramSchema(cmd)
+	var types []string
+	for _, p := range params {
+		types = append(types, p.Type)
+	}
+	if len(query) > 0 {
+		args, types = nil, nil
+		for _, p := range params {
+			if v, ok := query[p.Name]; ok && len(v) > 0 {
+				args = append(args, v[0])
+				types = append(types, p.Type)
+			}
+		}
+		if len(args) != len(query) {
+			return nil, fmt.Errorf("unknown parameter for command %v", cmd)
+		}
+	}
+	arguments := []interface{}{}
+	for i, a := range args {
+		var typ string
+		if i < len(types) {
+			typ = types[i]
+		}
+		v, err := v1Value(a, typ)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d of command %v: %v", i+1, cmd, err)
+		}
+		arguments = append(arguments, v)
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"commands": []map[string]interface{}{{
+			"component":  v1Component,
+			"capability": caps[0],
+			"command":    cmd,
+			"arguments":  arguments,
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := d.st.newCommandRequest(ctx, cmd, "POST", "/devices/"+url.PathEscape(d.ID)+"/commands", bytes.NewReader(body), idempotent)
+	if err != nil {
+		return nil, err
+	}
+	// Retries send the body again (see rewindable).
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// v1Value converts a formatted command argument into the JSON value sent
+// for a parameter of type typ: a number for numeric parameters, a boolean
+// for BOOLEAN parameters and a string for STRING and ENUM parameters, so a
+// PIN such as "0123" or "1234" is always sent as a string. Arguments of
+// parameters without a known type are sent as the JSON value they hold, or
+// as strings if they are not valid JSON.
+func v1Value(a, typ string) (interface{}, error) {
+	switch typ {
+	case "NUMBER", "INTEGER", "DECIMAL":
+		f, err := strconv.ParseFloat(a, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q, expected a number", a)
+		}
+		return f, nil
+	case "BOOLEAN":
+		b, err := strconv.ParseBool(a)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q, expected a boolean", a)
+		}
+		return b, nil
+	case "STRING", "ENUM":
+		return a, nil
+	}
+	var v interface{}
+	if err := json.Unmarshal([]byte(a), &v); err != nil {
+		return a, nil
+	}
+	return v, nil
+}
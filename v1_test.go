@@ -0,0 +1,187 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/smoogle/gosmart"
+	"github.com/smoogle/gosmart/gosmarttest"
+)
+
+// v1Lock serves a lock with lock codes through the v1 REST API, on top of
+// the mock server routes. The commands posted are kept, and the first n are
+// failed with HTTP 503.
+type v1Lock struct {
+	mu     sync.Mutex
+	fail   int
+	bodies []string
+}
+
+// v1Command is a command as posted to the v1 API.
+type v1Command struct {
+	Component  string        `json:"component"`
+	Capability string        `json:"capability"`
+	Command    string        `json:"command"`
+	Arguments  []interface{} `json:"arguments"`
+}
+
+func (l *v1Lock) install(s *gosmarttest.Server) {
+	s.HandleFunc("/devices", gosmarttest.JSON(map[string]interface{}{
+		"items": []map[string]interface{}{{"deviceId": "L1", "name": "Lock", "label": "Front Door"}},
+	}))
+	s.HandleFunc("/devices/L1", gosmarttest.JSON(map[string]interface{}{
+		"deviceId": "L1",
+		"name":     "Lock",
+		"label":    "Front Door",
+		"components": []map[string]interface{}{{
+			"id":           "main",
+			"capabilities": []map[string]interface{}{{"id": "lock", "version": 1}, {"id": "lockCodes", "version": 1}},
+		}},
+	}))
+	s.HandleFunc("/devices/L1/status", gosmarttest.JSON(map[string]interface{}{
+		"components": map[string]interface{}{"main": map[string]interface{}{
+			"lock": map[string]interface{}{"lock": map[string]interface{}{"value": "locked"}},
+		}},
+	}))
+	arg := func(name, typ string) map[string]interface{} {
+		return map[string]interface{}{"name": name, "schema": map[string]interface{}{"type": typ}}
+	}
+	s.HandleFunc("/capabilities/lock/1", gosmarttest.JSON(map[string]interface{}{
+		"commands": map[string]interface{}{
+			"lock":   map[string]interface{}{"arguments": []interface{}{}},
+			"unlock": map[string]interface{}{"arguments": []interface{}{}},
+		},
+	}))
+	s.HandleFunc("/capabilities/lockCodes/1", gosmarttest.JSON(map[string]interface{}{
+		"commands": map[string]interface{}{
+			"setCode":     map[string]interface{}{"arguments": []interface{}{arg("codeSlot", "integer"), arg("codePIN", "string")}},
+			"setAutoLock": map[string]interface{}{"arguments": []interface{}{arg("enabled", "boolean")}},
+			"setNote":     map[string]interface{}{"arguments": []interface{}{map[string]interface{}{"name": "note"}}},
+		},
+	}))
+	s.HandleFunc("/devices/L1/commands", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.bodies = append(l.bodies, string(body))
+		if l.fail > 0 {
+			l.fail--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"results": [{"status": "ACCEPTED"}]}`))
+	})
+}
+
+// commands returns the commands posted, decoded, and forgets them.
+func (l *v1Lock) commands(t *testing.T) []v1Command {
+	t.Helper()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var ret []v1Command
+	for _, b := range l.bodies {
+		var req struct {
+			Commands []v1Command `json:"commands"`
+		}
+		if err := json.Unmarshal([]byte(b), &req); err != nil || len(req.Commands) != 1 {
+			t.Fatalf("invalid command body %q: %v", b, err)
+		}
+		ret = append(ret, req.Commands[0])
+	}
+	l.bodies = nil
+	return ret
+}
+
+func (l *v1Lock) failNext(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.fail = n
+}
+
+func TestV1Commands(t *testing.T) {
+	s := newServer(t)
+	l := &v1Lock{}
+	l.install(s)
+	cfg := fastRetries(2)
+	cfg.APIVersion = gosmart.APIV1
+	st := gosmart.NewSmartThings(s.Client(), s.URL, cfg)
+	if err := st.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	d := device(t, st, "L1")
+	if v, _ := d.AttributeString("lock"); v != "locked" {
+		t.Errorf("lock = %q, want locked", v)
+	}
+
+	// Arguments are typed by the schema, not by their shape: PINs are
+	// strings whether or not they look like numbers.
+	cases := []struct {
+		cmd  string
+		args []interface{}
+		want []interface{}
+	}{
+		{"setCode", []interface{}{3, "0123"}, []interface{}{3.0, "0123"}},
+		{"setCode", []interface{}{4, "1234"}, []interface{}{4.0, "1234"}},
+		{"setAutoLock", []interface{}{true}, []interface{}{true}},
+		{"setNote", []interface{}{"42"}, []interface{}{42.0}},
+		{"setNote", []interface{}{"back door"}, []interface{}{"back door"}},
+	}
+	for _, tc := range cases {
+		if err := d.CallWithArgs(tc.cmd, tc.args...); err != nil {
+			t.Fatalf("CallWithArgs(%v, %v): %v", tc.cmd, tc.args, err)
+		}
+		cmds := l.commands(t)
+		if len(cmds) != 1 || cmds[0].Command != tc.cmd || cmds[0].Capability != "lockCodes" || cmds[0].Component != "main" {
+			t.Fatalf("CallWithArgs(%v) posted %+v", tc.cmd, cmds)
+		}
+		if !reflect.DeepEqual(cmds[0].Arguments, tc.want) {
+			t.Errorf("CallWithArgs(%v, %v) sent arguments %#v, want %#v", tc.cmd, tc.args, cmds[0].Arguments, tc.want)
+		}
+	}
+	if err := d.CallWithArgs("setAutoLock", "maybe"); err == nil {
+		t.Error("a non-boolean value was sent for a boolean parameter")
+	}
+}
+
+func TestV1Retries(t *testing.T) {
+	s := newServer(t)
+	l := &v1Lock{}
+	l.install(s)
+	cfg := fastRetries(2)
+	cfg.APIVersion = gosmart.APIV1
+	cfg.IdempotentCommands = []string{"lock"}
+	st := gosmart.NewSmartThings(s.Client(), s.URL, cfg)
+	if err := st.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	d := device(t, st, "L1")
+
+	// Idempotent commands are posted again, with the whole body.
+	l.failNext(1)
+	if err := d.Call("lock"); err != nil {
+		t.Fatal(err)
+	}
+	cmds := l.commands(t)
+	if len(cmds) != 2 || !reflect.DeepEqual(cmds[0], cmds[1]) || cmds[1].Command != "lock" {
+		t.Errorf("posted %+v, want the idempotent command twice", cmds)
+	}
+
+	// Other commands are not.
+	l.failNext(1)
+	if err := d.Call("unlock"); err == nil {
+		t.Error("failed command reported as a success")
+	}
+	if cmds := l.commands(t); len(cmds) != 1 {
+		t.Errorf("posted %+v, want the command once", cmds)
+	}
+}
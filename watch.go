@@ -0,0 +1,77 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart
+
+import (
+	"errors"
+	"golang.org/x/net/context"
+	"time"
+)
+
+// Watch refreshes the device every interval and sends the attribute changes
+// found on the returned channel. Refresh errors are skipped. The channel is
+// closed, and the polling stops, when ctx is done.
+func (d *Device) Watch(ctx context.Context, interval time.Duration) (<-chan AttributeChange, error) {
+	if err := d.st.connected(); err != nil {
+		return nil, err
+	}
+	return watch(ctx, interval, func() []*Device { return []*Device{d} }, d.RefreshContext)
+}
+
+// Watch works like Device.Watch for all devices, calling Refresh every
+// interval. Devices added since the previous refresh are not reported (see
+// DeviceDelta).
+func (st *SmartThings) Watch(ctx context.Context, interval time.Duration) (<-chan AttributeChange, error) {
+	if err := st.connected(); err != nil {
+		return nil, err
+	}
+	return watch(ctx, interval, func() []*Device { return st.DeviceList() }, st.RefreshContext)
+}
+
+// watch implements the Watch loops. Devices returns the devices to diff, and
+// refresh re-reads them.
+func watch(ctx context.Context, interval time.Duration, devices func() []*Device, refresh func(context.Context) error) (<-chan AttributeChange, error) {
+	if interval <= 0 {
+		return nil, errors.New("watch interval must be positive")
+	}
+	ch := make(chan AttributeChange)
+	go func() {
+		defer close(ch)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			old := make(map[string]map[string]interface{})
+			for _, d := range devices() {
+				old[d.ID] = d.RawAttributes()
+			}
+			if err := refresh(ctx); err != nil {
+				continue
+			}
+			now := time.Now()
+			for _, d := range devices() {
+				prev, ok := old[d.ID]
+				if !ok {
+					continue
+				}
+				for _, c := range diffAttributes(d.ID, prev, d.RawAttributes(), now) {
+					select {
+					case ch <- c:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
@@ -0,0 +1,118 @@
+// This file is part of gosmart, a set of libraries to communicate with
+// the Samsumg SmartThings API using Go (golang).
+//
+// http://github.com/marcopaganini/gosmart
+// (C) 2016 by Marco Paganini <paganini@paganini.net>
+
+package gosmart_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smoogle/gosmart"
+	"golang.org/x/net/context"
+)
+
+// next returns the next change sent on ch, failing the test after a few
+// seconds.
+func next(t *testing.T, ch <-chan gosmart.AttributeChange) gosmart.AttributeChange {
+	t.Helper()
+	select {
+	case c, ok := <-ch:
+		if !ok {
+			t.Fatal("watch channel closed")
+		}
+		return c
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a change")
+	}
+	return gosmart.AttributeChange{}
+}
+
+// closed fails the test unless ch is closed within a few seconds, skipping
+// any change still pending.
+func closed(t *testing.T, ch <-chan gosmart.AttributeChange) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("watch channel still open after cancel")
+		}
+	}
+}
+
+func TestDeviceWatch(t *testing.T) {
+	s := newServer(t, frontDoor("1"), lamp("2"))
+	st := connect(t, s, gosmart.Config{})
+	d := device(t, st, "1")
+
+	if _, err := d.Watch(context.Background(), 0); err == nil {
+		t.Error("Watch accepted a zero interval")
+	}
+	var unattached gosmart.Device
+	if _, err := unattached.Watch(context.Background(), time.Millisecond); err != gosmart.ErrNotConnected {
+		t.Errorf("Watch on an unattached device = %v, want ErrNotConnected", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := d.Watch(ctx, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetAttribute("1", "contact", "open")
+	c := next(t, ch)
+	if c.DeviceID != "1" || c.Name != "contact" || c.Old != "closed" || c.New != "open" || c.Time.IsZero() {
+		t.Errorf("got change %+v, want contact closed -> open", c)
+	}
+	// Other devices are not watched.
+	s.SetAttribute("2", "switch", "on")
+	s.SetAttribute("1", "lock", "unlocked")
+	if c := next(t, ch); c.DeviceID != "1" || c.Name != "lock" {
+		t.Errorf("got change %+v, want the lock of device 1", c)
+	}
+
+	cancel()
+	closed(t, ch)
+}
+
+func TestWatch(t *testing.T) {
+	s := newServer(t, lamp("1"), lamp("2"))
+	st := connect(t, s, gosmart.Config{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := st.Watch(ctx, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.SetAttribute("1", "switch", "on")
+	s.SetAttribute("2", "level", 30.0)
+	got := map[string]gosmart.AttributeChange{}
+	for len(got) < 2 {
+		c := next(t, ch)
+		got[c.DeviceID+" "+c.Name] = c
+	}
+	if c, ok := got["1 switch"]; !ok || c.Old != "off" || c.New != "on" {
+		t.Errorf("switch change = %+v, want off -> on", c)
+	}
+	if c, ok := got["2 level"]; !ok || c.Old != 0.0 || c.New != 30.0 {
+		t.Errorf("level change = %+v, want 0 -> 30", c)
+	}
+
+	// New devices are listed, but changes are only reported once known.
+	s.AddDevice(lamp("3"))
+	s.SetAttribute("1", "switch", "off")
+	if c := next(t, ch); c.DeviceID != "1" || c.New != "off" {
+		t.Errorf("got change %+v, want device 1 switching off", c)
+	}
+
+	cancel()
+	closed(t, ch)
+}